@@ -84,6 +84,7 @@ type appServices interface {
 	repositoryReaderAction(act func(ctx context.Context, rep repo.Repository) error) func(ctx *kingpin.ParseContext) error
 	repositoryWriterAction(act func(ctx context.Context, rep repo.RepositoryWriter) error) func(ctx *kingpin.ParseContext) error
 	repositoryWriterActionWithMaintenance(act func(ctx context.Context, rep repo.RepositoryWriter) error) func(ctx *kingpin.ParseContext) error
+	writeSessionWithMaintenance(ctx context.Context, rep repo.Repository, act func(ctx context.Context, rw repo.RepositoryWriter) error) error
 	repositoryHintAction(act func(ctx context.Context, rep repo.Repository) []string) func() []string
 	baseActionWithContext(act func(ctx context.Context) error) func(ctx *kingpin.ParseContext) error
 	openRepository(ctx context.Context, mustBeConnected bool) (repo.Repository, error)
@@ -465,21 +466,27 @@ func(ctx context.Context, rep repo.Repository) error {
 // only for operations that modify snapshot data such as snapshot create/delete.
 func (c *App) repositoryWriterActionWithMaintenance(act func(ctx context.Context, rw repo.RepositoryWriter) error) func(ctx *kingpin.ParseContext) error {
 	return c.repositoryAction(func(ctx context.Context, rep repo.Repository) error {
-		o := repo.WriteSessionOptions{
-			Purpose:  "cli:" + c.currentActionName(),
-			OnUpload: c.progress.UploadedBytes,
-		}
+		return c.writeSessionWithMaintenance(ctx, rep, act)
+	})
+}
 
-		if err := repo.WriteSession(ctx, rep, o, act); err != nil {
-			return errors.Wrap(err, "running in write session")
-		}
+// writeSessionWithMaintenance runs act in a write session of an already opened repository
+// and may run opportunistic automatic maintenance on success.
+func (c *App) writeSessionWithMaintenance(ctx context.Context, rep repo.Repository, act func(ctx context.Context, rw repo.RepositoryWriter) error) error {
+	o := repo.WriteSessionOptions{
+		Purpose:  "cli:" + c.currentActionName(),
+		OnUpload: c.progress.UploadedBytes,
+	}
 
-		if err := c.maybeRunMaintenance(ctx, rep); err != nil {
-			return errors.Wrap(err, "running auto-maintenance")
-		}
+	if err := repo.WriteSession(ctx, rep, o, act); err != nil {
+		return errors.Wrap(err, "running in write session")
+	}
 
-		return nil
-	})
+	if err := c.maybeRunMaintenance(ctx, rep); err != nil {
+		return errors.Wrap(err, "running auto-maintenance")
+	}
+
+	return nil
 }
 
 func (c *App) runAppWithContext(command *kingpin.CmdClause, cb func(ctx context.Context) error) error {
@@ -6,6 +6,7 @@
 
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/internal/repodiag"
+	"github.com/kopia/kopia/internal/server"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content/indexblob"
@@ -70,6 +71,10 @@ func (c *commandBlobList) shouldInclude(b blob.Metadata) bool {
 			return false
 		}
 
+		if strings.HasPrefix(string(b.BlobID), string(server.AuditBlobPrefix)) {
+			return false
+		}
+
 		if strings.HasPrefix(string(b.BlobID), "kopia.") {
 			return false
 		}
@@ -2,6 +2,8 @@
 
 import (
 	"context"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/skratchdot/open-golang/open"
@@ -9,9 +11,13 @@
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/cachefs"
 	"github.com/kopia/kopia/fs/loggingfs"
+	"github.com/kopia/kopia/fs/overlayfs"
 	"github.com/kopia/kopia/internal/mount"
 	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
 )
 
 type commandMount struct {
@@ -24,6 +30,10 @@ type commandMount struct {
 	mountPreferWebDAV           bool
 	maxCachedEntries            int
 	maxCachedDirectories        int
+	overlayDir                  string
+	commit                      bool
+	commitDescription           string
+	timeTravel                  bool
 
 	svc appServices
 }
@@ -43,6 +53,11 @@ func (c *commandMount) setup(svc appServices, parent commandParent) {
 	cmd.Flag("max-cached-entries", "Limit the number of cached directory entries").Default("100000").IntVar(&c.maxCachedEntries)
 	cmd.Flag("max-cached-dirs", "Limit the number of cached directories").Default("100").IntVar(&c.maxCachedDirectories)
 
+	cmd.Flag("overlay", "Mount read-write, storing all modifications in the specified local directory (copy-on-write). The directory can be reused across mounts.").PlaceHolder("DIR").StringVar(&c.overlayDir)
+	cmd.Flag("commit", "After unmounting, save the modified overlay as a new snapshot of the same source (requires --overlay and a snapshot ID).").BoolVar(&c.commit)
+	cmd.Flag("commit-description", "Description of the snapshot created by --commit").StringVar(&c.commitDescription)
+	cmd.Flag("time-travel", "Organize snapshots by path, with a virtual '.snapshots' directory in each directory listing its versions from all snapshots (requires mounting 'all').").BoolVar(&c.timeTravel)
+
 	c.svc = svc
 	cmd.Action(svc.repositoryReaderAction(c.run))
 }
@@ -55,7 +70,22 @@ func (c *commandMount) newFSCache() cachefs.DirectoryCacher {
 }
 
 func (c *commandMount) run(ctx context.Context, rep repo.Repository) error {
-	var entry fs.Directory
+	var (
+		entry     fs.Directory
+		commitMan *snapshot.Manifest
+	)
+
+	if c.timeTravel && c.mountObjectID != "all" {
+		return errors.New("--time-travel requires mounting 'all'")
+	}
+
+	if c.commit {
+		var err error
+
+		if commitMan, err = c.snapshotToCommit(ctx, rep); err != nil {
+			return err
+		}
+	}
 
 	if c.mountObjectID == "all" {
 		entry = snapshotfs.AllSourcesEntry(rep)
@@ -68,6 +98,8 @@ func (c *commandMount) run(ctx context.Context, rep repo.Repository) error {
 		}
 	}
 
+	lowerEntry := entry
+
 	if c.mountTraceFS {
 		//nolint:forcetypeassert
 		entry = loggingfs.Wrap(entry, log(ctx).Debugf).(fs.Directory)
@@ -81,6 +113,8 @@ func (c *commandMount) run(ctx context.Context, rep repo.Repository) error {
 			FuseAllowOther:         c.mountFuseAllowOther,
 			FuseAllowNonEmptyMount: c.mountFuseAllowNonEmptyMount,
 			PreferWebDAV:           c.mountPreferWebDAV,
+			OverlayDir:             c.overlayDir,
+			TimeTravel:             c.timeTravel,
 		})
 	if mountErr != nil {
 		return errors.Wrap(mountErr, "mount error")
@@ -119,12 +153,82 @@ func (c *commandMount) run(ctx context.Context, rep repo.Repository) error {
 
 	case <-ctrl.Done():
 		log(ctx).Info("Unmounted.")
-		return nil
+		return c.maybeCommit(ctx, rep, lowerEntry, commitMan)
 	}
 
 	// Reporting clean unmount in case of interrupt signal.
 	<-ctrl.Done()
 	log(ctx).Info("Unmounted.")
 
-	return nil
+	return c.maybeCommit(ctx, rep, lowerEntry, commitMan)
+}
+
+// snapshotToCommit returns the snapshot whose source will receive the committed overlay.
+func (c *commandMount) snapshotToCommit(ctx context.Context, rep repo.Repository) (*snapshot.Manifest, error) {
+	if c.overlayDir == "" {
+		return nil, errors.New("--commit requires --overlay")
+	}
+
+	if strings.Contains(filepath.ToSlash(c.mountObjectID), "/") {
+		return nil, errors.New("--commit requires mounting the root of a snapshot")
+	}
+
+	man, err := snapshotfs.FindSnapshotByRootObjectIDOrManifestID(ctx, rep, c.mountObjectID, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find snapshot %v", c.mountObjectID)
+	}
+
+	if man == nil {
+		return nil, errors.Errorf("--commit requires a snapshot, %v does not identify one", c.mountObjectID)
+	}
+
+	return man, nil
+}
+
+// maybeCommit saves the merged contents of the snapshot and the overlay as a new snapshot of the same source.
+func (c *commandMount) maybeCommit(ctx context.Context, rep repo.Repository, lower fs.Directory, man *snapshot.Manifest) error {
+	if man == nil {
+		return nil
+	}
+
+	merged, err := overlayfs.New(ctx, lower, c.overlayDir)
+	if err != nil {
+		return errors.Wrap(err, "unable to open overlay")
+	}
+
+	log(ctx).Infof("Committing overlay %v as a new snapshot of %v...", c.overlayDir, man.Source)
+
+	return c.svc.writeSessionWithMaintenance(ctx, rep, func(ctx context.Context, w repo.RepositoryWriter) error {
+		policyTree, err := policy.TreeForSource(ctx, w, man.Source)
+		if err != nil {
+			return errors.Wrap(err, "unable to get policy tree")
+		}
+
+		u := upload.NewUploader(w)
+		u.Progress = c.svc.getProgress()
+		c.svc.onTerminate(u.Cancel)
+
+		newMan, err := u.Upload(ctx, merged, policyTree, man.Source, man)
+		if err != nil {
+			return errors.Wrap(err, "upload error")
+		}
+
+		c.svc.getProgress().Finish()
+
+		if newMan.RootObjectID() == man.RootObjectID() {
+			log(ctx).Infof("Overlay %v does not modify the snapshot, not committing.", c.overlayDir)
+			return nil
+		}
+
+		newMan.Description = c.commitDescription
+
+		id, err := snapshot.SaveSnapshot(ctx, w, newMan)
+		if err != nil {
+			return errors.Wrap(err, "cannot save manifest")
+		}
+
+		log(ctx).Infof("Created snapshot %v of %v with root %v", id, man.Source, newMan.RootObjectID())
+
+		return nil
+	})
 }
@@ -5,6 +5,7 @@
 	"encoding/csv"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -24,6 +25,9 @@ type policyActionFlags struct {
 	policySetActionCommandTimeout            time.Duration
 	policySetActionCommandMode               string
 	policySetPersistActionScript             bool
+	policySetAddStreamSource                 []string
+	policySetRemoveStreamSource              []string
+	policySetClearStreamSources              bool
 }
 
 func (c *policyActionFlags) setup(cmd *kingpin.CmdClause) {
@@ -34,6 +38,9 @@ func (c *policyActionFlags) setup(cmd *kingpin.CmdClause) {
 	cmd.Flag("action-command-timeout", "Max time allowed for an action to run in seconds").Default("5m").DurationVar(&c.policySetActionCommandTimeout)
 	cmd.Flag("action-command-mode", "Action command mode").Default("essential").EnumVar(&c.policySetActionCommandMode, "essential", "optional", "async")
 	cmd.Flag("persist-action-script", "Persist action script").BoolVar(&c.policySetPersistActionScript)
+	cmd.Flag("add-stream-source", "Add a command whose output is stored as a file in the snapshot root").PlaceHolder("FILENAME=COMMAND").StringsVar(&c.policySetAddStreamSource)
+	cmd.Flag("remove-stream-source", "Remove the stream source with the given file name").PlaceHolder("FILENAME").StringsVar(&c.policySetRemoveStreamSource)
+	cmd.Flag("clear-stream-sources", "Remove all stream sources").BoolVar(&c.policySetClearStreamSources)
 }
 
 func (c *policyActionFlags) setActionsFromFlags(ctx context.Context, p *policy.ActionsPolicy, changeCount *int) error {
@@ -53,6 +60,61 @@ func (c *policyActionFlags) setActionsFromFlags(ctx context.Context, p *policy.A
 		return errors.Wrap(err, "invalid after-snapshot-root-action")
 	}
 
+	return c.setStreamSourcesFromFlags(ctx, p, changeCount)
+}
+
+func (c *policyActionFlags) setStreamSourcesFromFlags(ctx context.Context, p *policy.ActionsPolicy, changeCount *int) error {
+	if c.policySetClearStreamSources {
+		log(ctx).Info(" - removing all stream sources")
+
+		*changeCount++
+
+		p.StreamSources = nil
+	}
+
+	for _, name := range c.policySetRemoveStreamSource {
+		idx := slices.IndexFunc(p.StreamSources, func(s policy.StreamSourceCommand) bool { return s.FileName == name })
+		if idx < 0 {
+			log(ctx).Infof(" - stream source %v not found", name)
+			continue
+		}
+
+		log(ctx).Infof(" - removing stream source %v", name)
+
+		*changeCount++
+
+		p.StreamSources = slices.Delete(p.StreamSources, idx, idx+1)
+	}
+
+	for _, v := range c.policySetAddStreamSource {
+		name, command, ok := strings.Cut(v, "=")
+		if !ok || name == "" || command == "" {
+			return errors.Errorf("invalid stream source %q, expected FILENAME=COMMAND", v)
+		}
+
+		if err := policy.ValidateStreamSourceFileName(name); err != nil {
+			return errors.Wrap(err, "invalid stream source")
+		}
+
+		if c.policySetActionCommandMode == "async" {
+			return errors.New("stream sources cannot use async mode")
+		}
+
+		var cmd *policy.ActionCommand
+
+		if err := c.setActionCommandFromFlags(ctx, "stream-source "+name, &cmd, command, changeCount); err != nil {
+			return errors.Wrapf(err, "invalid stream source %v", name)
+		}
+
+		src := policy.StreamSourceCommand{FileName: name, ActionCommand: *cmd}
+
+		if idx := slices.IndexFunc(p.StreamSources, func(s policy.StreamSourceCommand) bool { return s.FileName == name }); idx >= 0 {
+			p.StreamSources[idx] = src
+		} else {
+			p.StreamSources = append(p.StreamSources, src)
+		}
+	}
+
 	return nil
 }
 
@@ -11,12 +11,17 @@
 
 type policyOSSnapshotFlags struct {
 	policyEnableVolumeShadowCopy string
+	policyEnableLinuxSnapshot    string
+	policyLinuxSnapshotProvider  string
 }
 
 func (c *policyOSSnapshotFlags) setup(cmd *kingpin.CmdClause) {
 	osSnapshotMode := []string{policy.OSSnapshotNeverString, policy.OSSnapshotAlwaysString, policy.OSSnapshotWhenAvailableString, inheritPolicyString}
 
 	cmd.Flag("enable-volume-shadow-copy", "Enable Volume Shadow Copy snapshots ('never', 'always', 'when-available', 'inherit')").PlaceHolder("MODE").EnumVar(&c.policyEnableVolumeShadowCopy, osSnapshotMode...)
+	cmd.Flag("enable-linux-snapshot", "Enable btrfs, ZFS or LVM thin snapshots on Linux ('never', 'always', 'when-available', 'inherit')").PlaceHolder("MODE").EnumVar(&c.policyEnableLinuxSnapshot, osSnapshotMode...)
+	cmd.Flag("linux-snapshot-provider", "Linux snapshot provider ('auto', 'btrfs', 'zfs', 'lvm', 'inherit')").PlaceHolder("PROVIDER").EnumVar(&c.policyLinuxSnapshotProvider,
+		policy.LinuxSnapshotProviderAuto, policy.LinuxSnapshotProviderBtrfs, policy.LinuxSnapshotProviderZFS, policy.LinuxSnapshotProviderLVM, inheritPolicyString)
 }
 
 func (c *policyOSSnapshotFlags) setOSSnapshotPolicyFromFlags(ctx context.Context, fp *policy.OSSnapshotPolicy, changeCount *int) error {
@@ -24,6 +29,26 @@ func (c *policyOSSnapshotFlags) setOSSnapshotPolicyFromFlags(ctx context.Context
 		return errors.Wrap(err, "enable volume shadow copy")
 	}
 
+	if err := applyPolicyOSSnapshotMode(ctx, "enable linux snapshot", &fp.LinuxSnapshot.Enable, c.policyEnableLinuxSnapshot, changeCount); err != nil {
+		return errors.Wrap(err, "enable linux snapshot")
+	}
+
+	switch c.policyLinuxSnapshotProvider {
+	case "":
+	case inheritPolicyString:
+		*changeCount++
+
+		log(ctx).Info(" - resetting linux snapshot provider to a default value inherited from parent.")
+
+		fp.LinuxSnapshot.Provider = ""
+	default:
+		*changeCount++
+
+		log(ctx).Infof(" - setting linux snapshot provider to %v.", c.policyLinuxSnapshotProvider)
+
+		fp.LinuxSnapshot.Provider = c.policyLinuxSnapshotProvider
+	}
+
 	return nil
 }
 
@@ -46,4 +46,20 @@ func TestSetOSSnapshotPolicy(t *testing.T) {
 	lines = compressSpaces(lines)
 
 	require.Contains(t, lines, " Volume Shadow Copy: never (defined for this target)")
+
+	e.RunAndExpectSuccess(t, "policy", "set", "--global", "--enable-linux-snapshot=when-available", "--linux-snapshot-provider=zfs")
+
+	lines = e.RunAndExpectSuccess(t, "policy", "show", td)
+	lines = compressSpaces(lines)
+
+	require.Contains(t, lines, " Linux snapshot: when-available inherited from (global)")
+	require.Contains(t, lines, " Linux snapshot provider: zfs inherited from (global)")
+
+	e.RunAndExpectSuccess(t, "policy", "set", "--enable-linux-snapshot=always", "--linux-snapshot-provider=btrfs", td)
+
+	lines = e.RunAndExpectSuccess(t, "policy", "show", td)
+	lines = compressSpaces(lines)
+
+	require.Contains(t, lines, " Linux snapshot: always (defined for this target)")
+	require.Contains(t, lines, " Linux snapshot provider: btrfs (defined for this target)")
 }
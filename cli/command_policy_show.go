@@ -432,6 +432,17 @@ func appendActionsPolicyRows(rows []policyTableRow, p *policy.Policy, def *polic
 		anyActions = true
 	}
 
+	if len(p.Actions.StreamSources) > 0 {
+		rows = append(rows, policyTableRow{"Stream sources:", "", definitionPointToString(p.Target(), def.Actions.StreamSources)})
+
+		for _, src := range p.Actions.StreamSources {
+			rows = append(rows, policyTableRow{"  File " + src.FileName + ":", "", ""})
+			rows = appendActionCommandRows(rows, &src.ActionCommand)
+		}
+
+		anyActions = true
+	}
+
 	if h := p.Actions.BeforeFolder; h != nil {
 		rows = append(rows, policyTableRow{"Run command before this folder:", "", "(non-inheritable)"})
 		rows = appendActionCommandRows(rows, h)
@@ -487,6 +498,16 @@ func appendOSSnapshotPolicyRows(rows []policyTableRow, p *policy.Policy, def *po
 			p.OSSnapshotPolicy.VolumeShadowCopy.Enable.OrDefault(policy.OSSnapshotNever).String(),
 			definitionPointToString(p.Target(), def.OSSnapshotPolicy.VolumeShadowCopy.Enable),
 		},
+		policyTableRow{
+			"  Linux snapshot:",
+			p.OSSnapshotPolicy.LinuxSnapshot.Enable.OrDefault(policy.OSSnapshotNever).String(),
+			definitionPointToString(p.Target(), def.OSSnapshotPolicy.LinuxSnapshot.Enable),
+		},
+		policyTableRow{
+			"  Linux snapshot provider:",
+			p.OSSnapshotPolicy.LinuxSnapshot.Provider,
+			definitionPointToString(p.Target(), def.OSSnapshotPolicy.LinuxSnapshot.Provider),
+		},
 	)
 
 	return rows
@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"path/filepath"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -16,6 +17,9 @@ type commandRepositoryConnectServer struct {
 	connectAPIServerURL                              string
 	connectAPIServerCertFingerprint                  string
 	connectAPIServerLocalCacheKeyDerivationAlgorithm string
+	connectAPIServerClientCertFile                   string
+	connectAPIServerClientKeyFile                    string
+	connectAPIServerRepository                       string
 
 	svc advancedAppServices
 	out textOutput
@@ -29,6 +33,9 @@ func (c *commandRepositoryConnectServer) setup(svc advancedAppServices, parent c
 	cmd := parent.Command("server", "Connect to a repository API Server.")
 	cmd.Flag("url", "Server URL").Required().StringVar(&c.connectAPIServerURL)
 	cmd.Flag("server-cert-fingerprint", "Server certificate fingerprint").StringVar(&c.connectAPIServerCertFingerprint)
+	cmd.Flag("client-cert-file", "Client certificate PEM file used to authenticate to servers started with --tls-client-ca").ExistingFileVar(&c.connectAPIServerClientCertFile)
+	cmd.Flag("client-key-file", "Client certificate private key PEM file").ExistingFileVar(&c.connectAPIServerClientKeyFile)
+	cmd.Flag("server-repository", "Name of the repository to connect to when the server hosts multiple repositories").StringVar(&c.connectAPIServerRepository)
 	//nolint:lll
 	cmd.Flag("local-cache-key-derivation-algorithm", "Key derivation algorithm used to derive the local cache encryption key").Hidden().Default(repo.DefaultServerRepoCacheKeyDerivationAlgorithm).EnumVar(&c.connectAPIServerLocalCacheKeyDerivationAlgorithm, repo.SupportedLocalCacheKeyDerivationAlgorithms()...)
 	cmd.Action(svc.noRepositoryAction(c.run))
@@ -41,6 +48,27 @@ func (c *commandRepositoryConnectServer) run(ctx context.Context) error {
 		BaseURL:                             strings.TrimSuffix(c.connectAPIServerURL, "/"),
 		TrustedServerCertificateFingerprint: strings.ToLower(c.connectAPIServerCertFingerprint),
 		LocalCacheKeyDerivationAlgorithm:    localCacheKeyDerivationAlgorithm,
+		Repository:                          c.connectAPIServerRepository,
+	}
+
+	if c.connectAPIServerClientCertFile != "" || c.connectAPIServerClientKeyFile != "" {
+		if c.connectAPIServerClientCertFile == "" || c.connectAPIServerClientKeyFile == "" {
+			return errors.New("both --client-cert-file and --client-key-file must be specified")
+		}
+
+		// the paths are persisted in the configuration file, make sure they don't depend on the current directory.
+		certFile, err := filepath.Abs(c.connectAPIServerClientCertFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to resolve client certificate path")
+		}
+
+		keyFile, err := filepath.Abs(c.connectAPIServerClientKeyFile)
+		if err != nil {
+			return errors.Wrap(err, "unable to resolve client key path")
+		}
+
+		as.ClientCertificateFile = certFile
+		as.ClientKeyFile = keyFile
 	}
 
 	configFile := c.svc.repositoryConfigFileName()
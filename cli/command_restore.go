@@ -4,11 +4,13 @@
 	"archive/zip"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -64,6 +66,19 @@
 --no-overwrite-directories
 --no-overwrite-symlinks
 
+The restore target can also be a remote location, in which case restored files
+are written directly without a local staging copy. Remote targets are selected
+using '--mode' or detected automatically from the 's3://' and 'sftp://' prefixes:
+
+'restore --mode=s3 kffbb7c28ea6c34d6cbe555d1cf80faa9 s3://bucket/prefix'
+'restore --mode=sftp kffbb7c28ea6c34d6cbe555d1cf80faa9 sftp://user@host/path'
+'restore --mode=webdav kffbb7c28ea6c34d6cbe555d1cf80faa9 https://host/path'
+
+The snapshot can also be written as a single-layer container image in OCI image
+layout, which can be imported using tools such as skopeo or podman:
+
+'restore --mode=oci kffbb7c28ea6c34d6cbe555d1cf80faa9 image-dir'
+
 If the '--shallow' option is provided, files and directories this
 depth and below in the directory hierarchy will be represented by
 compact placeholder files of the form 'entry.kopia-entry' instead of
@@ -114,6 +129,12 @@ type commandRestore struct {
 	restoreOverwriteFiles         bool
 	restoreOverwriteSymlinks      bool
 	restoreWriteSparseFiles       bool
+	restoreDelta                  bool
+	restoreJournal                bool
+	restoreResume                 bool
+	restoreVerify                 bool
+	restoreVerifyReport           string
+	ociImage                      restore.OCIImageOptions
 	restoreConsistentAttributes   bool
 	restoreMode                   string
 	restoreParallel               int
@@ -129,9 +150,17 @@ type commandRestore struct {
 	restoreShallowAtDepth         int32
 	minSizeForPlaceholder         int32
 	snapshotTime                  string
+	restoreInclude                []string
+	restoreExclude                []string
+	restoreMinFileSize            int64
+	restoreMaxFileSize            int64
+	restoreModifiedSince          string
+	restoreModifiedBefore         string
 
 	restores []restoreSourceTarget
 
+	remote remoteRestoreFlags
+
 	svc appServices
 }
 
@@ -145,8 +174,11 @@ func (c *commandRestore) setup(svc appServices, parent commandParent) {
 	cmd.Flag("overwrite-files", "Specifies whether or not to overwrite already existing files").Default("true").BoolVar(&c.restoreOverwriteFiles)
 	cmd.Flag("overwrite-symlinks", "Specifies whether or not to overwrite already existing symlinks").Default("true").BoolVar(&c.restoreOverwriteSymlinks)
 	cmd.Flag("write-sparse-files", "When doing a restore, attempt to write files sparsely-allocating the minimum amount of disk space needed.").Default("false").BoolVar(&c.restoreWriteSparseFiles)
+	cmd.Flag("delta", "When overwriting existing files, only rewrite ranges whose contents differ from the snapshot.").BoolVar(&c.restoreDelta)
+	cmd.Flag("journal", "Record restore progress in a journal in the target directory, which allows an interrupted restore to be resumed with --resume").BoolVar(&c.restoreJournal)
+	cmd.Flag("resume", "Resume an interrupted restore using the journal in the target directory and keep journaling its progress").BoolVar(&c.restoreResume)
 	cmd.Flag("consistent-attributes", "When multiple snapshots match, fail if they have inconsistent attributes").Envar(svc.EnvName("KOPIA_RESTORE_CONSISTENT_ATTRIBUTES")).BoolVar(&c.restoreConsistentAttributes)
-	cmd.Flag("mode", "Override restore mode").Default(restoreModeAuto).EnumVar(&c.restoreMode, restoreModeAuto, restoreModeLocal, restoreModeZip, restoreModeZipNoCompress, restoreModeTar, restoreModeTgz)
+	cmd.Flag("mode", "Override restore mode").Default(restoreModeAuto).EnumVar(&c.restoreMode, restoreModeAuto, restoreModeLocal, restoreModeZip, restoreModeZipNoCompress, restoreModeTar, restoreModeTgz, restoreModeOCI, restoreModeS3, restoreModeSFTP, restoreModeWebDAV)
 	cmd.Flag("parallel", "Restore parallelism (1=disable)").Default("8").IntVar(&c.restoreParallel)
 	cmd.Flag("skip-owners", "Skip owners during restore").BoolVar(&c.restoreSkipOwners)
 	cmd.Flag("skip-permissions", "Skip permissions during restore").BoolVar(&c.restoreSkipPermissions)
@@ -159,7 +191,21 @@ func (c *commandRestore) setup(svc appServices, parent commandParent) {
 	cmd.Flag("shallow", "Shallow restore the directory hierarchy starting at this level (default is to deep restore the entire hierarchy.)").Int32Var(&c.restoreShallowAtDepth)
 	cmd.Flag("shallow-minsize", "When doing a shallow restore, write actual files instead of placeholders smaller than this size.").Int32Var(&c.minSizeForPlaceholder)
 	cmd.Flag("snapshot-time", "When using a path as the source, use the latest snapshot available before this date. Default is latest").Default("latest").StringVar(&c.snapshotTime)
+	cmd.Flag("include", "Only restore entries matching the provided pattern (.gitignore syntax, relative to the restore root)").StringsVar(&c.restoreInclude)
+	cmd.Flag("exclude", "Do not restore entries matching the provided pattern (.gitignore syntax, relative to the restore root)").StringsVar(&c.restoreExclude)
+	cmd.Flag("min-size", "Only restore files of at least the provided size in bytes").Int64Var(&c.restoreMinFileSize)
+	cmd.Flag("max-size", "Only restore files of at most the provided size in bytes").Int64Var(&c.restoreMaxFileSize)
+	cmd.Flag("modified-since", "Only restore entries modified at or after the provided time (YYYY-MM-DD or RFC 3339)").StringVar(&c.restoreModifiedSince)
+	cmd.Flag("modified-before", "Only restore entries modified before the provided time (YYYY-MM-DD or RFC 3339)").StringVar(&c.restoreModifiedBefore)
+	cmd.Flag("verify", "Read back restored files and symbolic links and verify them against the snapshot").BoolVar(&c.restoreVerify)
+	cmd.Flag("verify-report", "Write signed JSON report of verified entries to the provided file (implies --verify)").StringVar(&c.restoreVerifyReport)
 	cmd.Flag("flush-files", "Specifies whether or not to flush files after restore completes").Default("false").BoolVar(&c.flushFiles)
+	cmd.Flag("oci-ref", "Reference name of the image when restoring to OCI image layout").Default("latest").StringVar(&c.ociImage.RefName)
+	cmd.Flag("oci-os", "Operating system of the image when restoring to OCI image layout").Default("linux").StringVar(&c.ociImage.OS)
+	cmd.Flag("oci-arch", "Architecture of the image when restoring to OCI image layout").Default(runtime.GOARCH).StringVar(&c.ociImage.Architecture)
+	cmd.Flag("oci-entrypoint", "Entrypoint of the image when restoring to OCI image layout").StringsVar(&c.ociImage.Entrypoint)
+	cmd.Flag("oci-cmd", "Default command of the image when restoring to OCI image layout").StringsVar(&c.ociImage.Cmd)
+	c.remote.setup(svc, cmd)
 	cmd.Action(svc.repositoryReaderAction(c.run))
 }
 
@@ -170,6 +216,7 @@ func (c *commandRestore) setup(svc appServices, parent commandParent) {
 	restoreModeZipNoCompress = "zip-nocompress"
 	restoreModeTar           = "tar"
 	restoreModeTgz           = "tgz"
+	restoreModeOCI           = "oci"
 )
 
 // constructTargetPairs builds the sourceIdPathPairs array for this
@@ -225,9 +272,15 @@ func (c *commandRestore) constructTargetPairs(rep repo.Repository) error {
 	case tplen == 0 && restpslen == 2:
 		// This means that none of the restoreTargetPaths are placeholders and we
 		// have two args: a sourceID and a destination directory.
-		absp, err := filepath.Abs(c.restoreTargetPaths[1])
-		if err != nil {
-			return errors.Wrapf(err, "restore can't resolve path for %q", c.restoreTargetPaths[1])
+		absp := c.restoreTargetPaths[1]
+
+		if !isRemoteRestoreTarget(c.restoreMode, absp) {
+			var err error
+
+			absp, err = filepath.Abs(absp)
+			if err != nil {
+				return errors.Wrapf(err, "restore can't resolve path for %q", c.restoreTargetPaths[1])
+			}
 		}
 
 		c.restores = []restoreSourceTarget{
@@ -271,6 +324,9 @@ func (c *commandRestore) restoreOutput(ctx context.Context, rep repo.Repository)
 			SkipPermissions:        c.restoreSkipPermissions,
 			SkipTimes:              c.restoreSkipTimes,
 			WriteSparseFiles:       c.restoreWriteSparseFiles,
+			DeltaRestore:           c.restoreDelta,
+			Journal:                c.restoreJournal,
+			Resume:                 c.restoreResume,
 			FlushFiles:             c.flushFiles,
 		}
 
@@ -309,6 +365,17 @@ func (c *commandRestore) restoreOutput(ctx context.Context, rep repo.Repository)
 
 		return restore.NewTarOutput(gzip.NewWriter(f)), nil
 
+	case restoreModeOCI:
+		o, err := restore.NewOCIOutput(targetpath, c.ociImage)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create OCI image output")
+		}
+
+		return o, nil
+
+	case restoreModeS3, restoreModeSFTP, restoreModeWebDAV:
+		return c.remote.output(ctx, m, targetpath)
+
 	default:
 		return nil, errors.Errorf("unknown mode %v", m)
 	}
@@ -320,6 +387,14 @@ func (c *commandRestore) detectRestoreMode(ctx context.Context, m, targetpath st
 	}
 
 	switch {
+	case strings.HasPrefix(targetpath, "s3://"):
+		log(ctx).Infof("Restoring to S3 (%v)...", targetpath)
+		return restoreModeS3
+
+	case strings.HasPrefix(targetpath, "sftp://"):
+		log(ctx).Infof("Restoring to SFTP (%v)...", targetpath)
+		return restoreModeSFTP
+
 	case strings.HasSuffix(targetpath, ".zip"):
 		log(ctx).Infof("Restoring to a zip file (%v)...", targetpath)
 		return restoreModeZip
@@ -339,12 +414,24 @@ func (c *commandRestore) detectRestoreMode(ctx context.Context, m, targetpath st
 }
 
 func printRestoreStats(ctx context.Context, st *restore.Stats) {
-	var maybeSkipped, maybeDeletedDirs, maybeDeletedFiles, maybeDeletedSymlinks, maybeErrors string
+	var maybeSkipped, maybeUnchanged, maybeVerified, maybeExcluded, maybeDeletedDirs, maybeDeletedFiles, maybeDeletedSymlinks, maybeErrors string
 
 	if st.SkippedCount > 0 {
 		maybeSkipped = fmt.Sprintf(", skipped %v (%v)", st.SkippedCount, units.BytesString(st.SkippedTotalFileSize))
 	}
 
+	if st.DeltaSkippedTotalFileSize > 0 {
+		maybeUnchanged = fmt.Sprintf(", unchanged data %v", units.BytesString(st.DeltaSkippedTotalFileSize))
+	}
+
+	if st.VerifiedCount+st.VerifyMismatchCount+st.VerifySkippedCount > 0 {
+		maybeVerified = fmt.Sprintf(", verified %v, mismatched %v, not verified %v", st.VerifiedCount, st.VerifyMismatchCount, st.VerifySkippedCount)
+	}
+
+	if st.ExcludedCount > 0 {
+		maybeExcluded = fmt.Sprintf(", excluded %v", st.ExcludedCount)
+	}
+
 	if st.DeletedDirCount > 0 {
 		maybeDeletedDirs = fmt.Sprintf(", deleted directories %v", st.DeletedDirCount)
 	}
@@ -361,12 +448,12 @@ func printRestoreStats(ctx context.Context, st *restore.Stats) {
 		maybeErrors = fmt.Sprintf(", ignored %v errors", st.IgnoredErrorCount)
 	}
 
-	log(ctx).Infof("Restored %v files, %v directories and %v symbolic links (%v)%v%v%v%v%v.\n",
+	log(ctx).Infof("Restored %v files, %v directories and %v symbolic links (%v)%v%v%v%v%v%v%v%v.\n",
 		st.RestoredFileCount,
 		st.RestoredDirCount,
 		st.RestoredSymlinkCount,
 		units.BytesString(st.RestoredTotalFileSize),
-		maybeSkipped, maybeDeletedDirs, maybeDeletedFiles, maybeDeletedSymlinks, maybeErrors)
+		maybeSkipped, maybeUnchanged, maybeVerified, maybeExcluded, maybeDeletedDirs, maybeDeletedFiles, maybeDeletedSymlinks, maybeErrors)
 }
 
 func (c *commandRestore) setupPlaceholderExpansion(ctx context.Context, rep repo.Repository, rstp restoreSourceTarget, output restore.Output) (fs.Entry, error) {
@@ -411,6 +498,12 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 		return errors.Wrap(oerr, "unable to initialize output")
 	}
 
+	var verifyReport *restore.VerifyReport
+
+	if c.restoreVerify || c.restoreVerifyReport != "" {
+		verifyReport = &restore.VerifyReport{}
+	}
+
 	for _, rstp := range c.restores {
 		var rootEntry fs.Entry
 
@@ -440,7 +533,7 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 			restoreProgress.SetCounters(stats)
 		}
 
-		st, err := restore.Entry(ctx, rep, output, rootEntry, restore.Options{
+		opt := restore.Options{
 			Parallel:               c.restoreParallel,
 			Incremental:            c.restoreIncremental,
 			DeleteExtra:            c.restoreDeleteExtra,
@@ -448,8 +541,34 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 			RestoreDirEntryAtDepth: c.restoreShallowAtDepth,
 			MinSizeForPlaceholder:  c.minSizeForPlaceholder,
 			ProgressCallback:       progressCallback,
-		})
+			Include:                c.restoreInclude,
+			Exclude:                c.restoreExclude,
+			MinFileSize:            c.restoreMinFileSize,
+			MaxFileSize:            c.restoreMaxFileSize,
+			Verify:                 verifyReport != nil,
+			VerifyReport:           verifyReport,
+		}
+
+		var err error
+
+		if opt.ModifiedSince, err = parseRestoreTimeFilter(c.restoreModifiedSince); err != nil {
+			return errors.Wrap(err, "invalid --modified-since")
+		}
+
+		if opt.ModifiedBefore, err = parseRestoreTimeFilter(c.restoreModifiedBefore); err != nil {
+			return errors.Wrap(err, "invalid --modified-before")
+		}
+
+		if verifyReport != nil {
+			verifyReport.Source = rstp.source
+		}
+
+		st, err := restore.Entry(ctx, rep, output, rootEntry, opt)
 		if err != nil {
+			if fso, ok := output.(*restore.FilesystemOutput); ok && journalExists(fso) {
+				log(ctx).Infof("Restore progress has been journaled, run the same command with --resume to continue.")
+			}
+
 			return errors.Wrap(err, "error restoring")
 		}
 
@@ -458,6 +577,46 @@ func (c *commandRestore) run(ctx context.Context, rep repo.Repository) error {
 		printRestoreStats(ctx, &st)
 	}
 
+	if verifyReport == nil {
+		return nil
+	}
+
+	if c.restoreVerifyReport != "" {
+		if err := writeVerifyReport(ctx, rep, verifyReport, c.restoreVerifyReport); err != nil {
+			return err
+		}
+	}
+
+	if verifyReport.Mismatches > 0 {
+		return errors.Errorf("verification failed for %v restored entries", verifyReport.Mismatches)
+	}
+
+	return nil
+}
+
+func journalExists(o *restore.FilesystemOutput) bool {
+	_, err := os.Stat(filepath.Join(o.TargetPath, restore.JournalFileName))
+
+	return err == nil
+}
+
+// writeVerifyReport signs the verification report, if possible, and writes it to the provided file.
+func writeVerifyReport(ctx context.Context, rep repo.Repository, report *restore.VerifyReport, fname string) error {
+	if err := report.Sign(rep); err != nil {
+		log(ctx).Warnf("verification report will not be signed: %v", err)
+	}
+
+	b, err := json.MarshalIndent(report, "", "  ") //nolint:musttag
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize verification report")
+	}
+
+	if err := os.WriteFile(fname, b, 0o600); err != nil { //nolint:mnd
+		return errors.Wrap(err, "unable to write verification report")
+	}
+
+	log(ctx).Infof("Wrote verification report to %v.", fname)
+
 	return nil
 }
 
@@ -636,6 +795,25 @@ func computeMaxTime(timespec string) (time.Time, error) {
 	return now, errors.Errorf("Invalid time spec: %v", timespec)
 }
 
+// parseRestoreTimeFilter parses the value of a modification time filter, which can be either
+// a date in local time or RFC 3339 timestamp. Empty value means no filter.
+func parseRestoreTimeFilter(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, errors.Errorf("invalid time: %v", v)
+	}
+
+	return &t, nil
+}
+
 func findLastManifestWithPath(ctx context.Context, rep repo.Repository, ms []*snapshot.Manifest, path string, filter func(*snapshot.Manifest, int, int) bool) (*snapshot.Manifest, string, object.ID) {
 	ms = snapshot.SortByTime(ms, true)
 
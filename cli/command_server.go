@@ -9,15 +9,18 @@
 
 type commandServer struct {
 	acl      commandServerACL
+	audit    commandServerAudit
 	user     commandServerUser
 	cancel   commandServerCancel
 	flush    commandServerFlush
 	pause    commandServerPause
+	pull     commandServerPullSources
 	refresh  commandServerRefresh
 	resume   commandServerResume
 	start    commandServerStart
 	status   commandServerStatus
 	throttle commandServerThrottle
+	token    commandServerToken
 	upload   commandServerUpload
 	shutdown commandServerShutdown
 }
@@ -38,7 +41,9 @@ type serverClientFlags struct {
 	serverAddress         string
 	serverUsername        string
 	serverPassword        string
+	serverToken           string
 	serverCertFingerprint string
+	serverRepository      string
 }
 
 func (c *serverClientFlags) setup(svc appServices, cmd *kingpin.CmdClause) {
@@ -47,12 +52,14 @@ func (c *serverClientFlags) setup(svc appServices, cmd *kingpin.CmdClause) {
 	cmd.Flag("address", "Address of the server to connect to").Envar(svc.EnvName("KOPIA_SERVER_ADDRESS")).Default("http://127.0.0.1:51515").StringVar(&c.serverAddress)
 	cmd.Flag("server-control-username", "Server control username").Envar(svc.EnvName("KOPIA_SERVER_USERNAME")).StringVar(&c.serverUsername)
 	cmd.Flag("server-control-password", "Server control password").PlaceHolder("PASSWORD").Envar(svc.EnvName("KOPIA_SERVER_PASSWORD")).StringVar(&c.serverPassword)
+	cmd.Flag("server-token", "API token created with 'kopia server tokens create', used instead of server control username and password").PlaceHolder("TOKEN").Envar(svc.EnvName("KOPIA_SERVER_TOKEN")).StringVar(&c.serverToken)
 
 	// aliases for backwards compat
 	cmd.Flag("server-username", "Server control username").Hidden().StringVar(&c.serverUsername)
 	cmd.Flag("server-password", "Server control password").Hidden().StringVar(&c.serverPassword)
 
 	cmd.Flag("server-cert-fingerprint", "Server certificate fingerprint").PlaceHolder("SHA256-FINGERPRINT").Envar(svc.EnvName("KOPIA_SERVER_CERT_FINGERPRINT")).StringVar(&c.serverCertFingerprint)
+	cmd.Flag("server-repository", "Name of the repository to control when the server hosts multiple repositories").Envar(svc.EnvName("KOPIA_SERVER_REPOSITORY")).StringVar(&c.serverRepository)
 }
 
 func (c *commandServer) setup(svc advancedAppServices, parent commandParent) {
@@ -61,6 +68,9 @@ func (c *commandServer) setup(svc advancedAppServices, parent commandParent) {
 	c.start.setup(svc, cmd)
 	c.acl.setup(svc, cmd)
 	c.user.setup(svc, cmd)
+	c.token.setup(svc, cmd)
+	c.audit.setup(svc, cmd)
+	c.pull.setup(svc, cmd)
 
 	c.status.setup(svc, cmd)
 	c.refresh.setup(svc, cmd)
@@ -83,6 +93,8 @@ func (c *serverClientFlags) serverAPIClientOptions() (apiclient.Options, error)
 		BaseURL:                             c.serverAddress,
 		Username:                            c.serverUsername,
 		Password:                            c.serverPassword,
+		BearerToken:                         c.serverToken,
 		TrustedServerCertificateFingerprint: c.serverCertFingerprint,
+		Repository:                          c.serverRepository,
 	}, nil
 }
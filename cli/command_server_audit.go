@@ -0,0 +1,13 @@
+package cli
+
+type commandServerAudit struct {
+	list commandServerAuditList
+	show commandServerAuditShow
+}
+
+func (c *commandServerAudit) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("audit", "Inspect the audit log of operations performed through the server")
+
+	c.list.setup(svc, cmd)
+	c.show.setup(svc, cmd)
+}
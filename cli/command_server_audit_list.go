@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerAuditList struct {
+	user        string
+	outcome     string
+	latest      int
+	youngerThan time.Duration
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerAuditList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List audit events").Alias("ls")
+	cmd.Flag("user", "Only include events made by the given user").StringVar(&c.user)
+	cmd.Flag("outcome", "Only include events with the given outcome").EnumVar(&c.outcome, server.AuditOutcomeSuccess, server.AuditOutcomeFailure, server.AuditOutcomeDenied)
+	cmd.Flag("latest", "Only include last N events").Short('n').IntVar(&c.latest)
+	cmd.Flag("younger-than", "Include events younger than X (e.g. '1h')").DurationVar(&c.youngerThan)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandServerAuditList) matches(ev *server.AuditEvent) bool {
+	if c.user != "" && ev.User != c.user {
+		return false
+	}
+
+	if c.outcome != "" && ev.Outcome != c.outcome {
+		return false
+	}
+
+	if c.youngerThan > 0 && clock.Now().Sub(ev.Time) > c.youngerThan {
+		return false
+	}
+
+	return true
+}
+
+func (c *commandServerAuditList) run(ctx context.Context, rep repo.DirectRepository) error {
+	events, err := server.ListAuditEvents(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing audit events")
+	}
+
+	var matching []*server.AuditEvent
+
+	for _, ev := range events {
+		if c.matches(ev) {
+			matching = append(matching, ev)
+		}
+	}
+
+	if c.latest > 0 && len(matching) > c.latest {
+		matching = matching[len(matching)-c.latest:]
+	}
+
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, ev := range matching {
+		if c.jo.jsonOutput {
+			jl.emit(ev)
+			continue
+		}
+
+		who := ev.User
+		if ev.APITokenID != "" {
+			who = "token:" + ev.APITokenID
+		}
+
+		c.out.printStdout("%v %v %v %v from %v %v %v %v\n",
+			ev.ID, formatTimestamp(ev.Time), ev.Outcome, who, ev.SourceIP, ev.Protocol, ev.Operation, strings.Join(ev.Targets, ","))
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerAuditShow struct {
+	eventIDs []string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerAuditShow) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("show", "Show details of audit events").Alias("cat")
+	cmd.Arg("id", "Audit event ID").Required().StringsVar(&c.eventIDs)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandServerAuditShow) run(ctx context.Context, rep repo.DirectRepository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, id := range c.eventIDs {
+		ev, err := server.GetAuditEvent(ctx, rep, id)
+		if err != nil {
+			return errors.Wrapf(err, "error getting audit event %v", id)
+		}
+
+		if c.jo.jsonOutput {
+			jl.emit(ev)
+			continue
+		}
+
+		c.out.printStdout("ID:         %v\n", ev.ID)
+		c.out.printStdout("Time:       %v\n", formatTimestamp(ev.Time))
+		c.out.printStdout("User:       %v\n", ev.User)
+
+		if ev.APITokenID != "" {
+			c.out.printStdout("API Token:  %v\n", ev.APITokenID)
+		}
+
+		c.out.printStdout("Source IP:  %v\n", ev.SourceIP)
+		c.out.printStdout("Protocol:   %v\n", ev.Protocol)
+		c.out.printStdout("Operation:  %v\n", ev.Operation)
+
+		for _, t := range ev.Targets {
+			c.out.printStdout("Target:     %v\n", t)
+		}
+
+		c.out.printStdout("Outcome:    %v\n", ev.Outcome)
+
+		if ev.Error != "" {
+			c.out.printStdout("Error:      %v\n", ev.Error)
+		}
+
+		c.out.printStdout("\n")
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package cli_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestServerAudit(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir1 := testutil.TempDirectory(t)
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--override-username=test-user", "--override-hostname=test-host")
+	env.RunAndExpectSuccess(t, "snap", "create", dir1)
+
+	require.Empty(t, env.RunAndExpectSuccess(t, "server", "audit", "list"))
+
+	statusToken := env.RunAndExpectSuccess(t, "server", "tokens", "create", "--scope=read-status")[0]
+
+	var sp testutil.ServerParameters
+
+	wait, kill := env.RunAndProcessStderr(t, sp.ProcessOutput,
+		"server", "start", "--insecure", "--random-server-control-password", "--address=127.0.0.1:0")
+
+	defer func() {
+		kill()
+		wait()
+	}()
+
+	const (
+		pollFrequency = 100 * time.Millisecond
+		waitTimeout   = 15 * time.Second
+	)
+
+	require.Eventually(t, func() bool {
+		lines := env.RunAndExpectSuccess(t, "server", "status", "--address", sp.BaseURL, "--server-control-password", sp.ServerControlPassword)
+
+		return hasLine(lines, "IDLE: test-user@test-host:"+dir1)
+	}, waitTimeout, pollFrequency)
+
+	env.RunAndExpectSuccess(t, "server", "pause", "--address", sp.BaseURL, "--server-control-password", sp.ServerControlPassword, dir1)
+	env.RunAndExpectFailure(t, "server", "pause", "--address", sp.BaseURL, "--server-control-password", "wrong-password", dir1)
+
+	// uses of API tokens are audited even when they don't change anything.
+	env.RunAndExpectSuccess(t, "server", "status", "--address", sp.BaseURL, "--server-token", statusToken)
+
+	lines := env.RunAndExpectSuccess(t, "server", "audit", "list")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[0], " success server-control from 127.0.0.1 http POST /api/v1/control/pause-source")
+
+	var events []*server.AuditEvent
+
+	require.NoError(t, json.Unmarshal([]byte(strings.Join(env.RunAndExpectSuccess(t, "server", "audit", "list", "--json"), "\n")), &events))
+	require.Len(t, events, 2)
+	require.Equal(t, "server-control", events[0].User)
+	require.Empty(t, events[0].APITokenID)
+	require.NotEmpty(t, events[1].APITokenID)
+	require.Contains(t, lines[1], " success token:"+events[1].APITokenID+" from 127.0.0.1 http GET /api/v1/control/sources")
+	require.True(t, strings.HasPrefix(statusToken, "kopia-token-"+events[1].APITokenID+"."))
+
+	shown := env.RunAndExpectSuccess(t, "server", "audit", "show", events[0].ID)
+	require.Contains(t, shown, "Operation:  POST /api/v1/control/pause-source")
+
+	env.RunAndExpectFailure(t, "server", "audit", "show", "no-such-event")
+	require.Empty(t, env.RunAndExpectSuccess(t, "server", "audit", "list", "--outcome=failure"))
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/pullsource"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandServerPullSources struct {
+	add    commandServerPullSourcesAdd
+	list   commandServerPullSourcesList
+	remove commandServerPullSourcesRemove
+}
+
+func (c *commandServerPullSources) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("pull-sources", "Manage sources snapshotted by the server by reading files from remote hosts").Alias("pull-source")
+
+	c.add.setup(svc, cmd)
+	c.list.setup(svc, cmd)
+	c.remove.setup(svc, cmd)
+}
+
+// pullSourceFlags is implemented by protocols which can be used to read files of pull sources.
+type pullSourceFlags interface {
+	setup(cmd *kingpin.CmdClause)
+	pullSource() (*pullsource.Source, error)
+}
+
+type pullSourceProtocol struct {
+	name        string
+	description string
+	newFlags    func() pullSourceFlags
+}
+
+//nolint:gochecknoglobals
+var pullSourceProtocols []pullSourceProtocol
+
+// registerPullSourceProtocol registers the protocol for use with 'kopia server pull-sources add'.
+// It should be called from init() functions.
+func registerPullSourceProtocol(name, description string, newFlags func() pullSourceFlags) {
+	pullSourceProtocols = append(pullSourceProtocols, pullSourceProtocol{name, description, newFlags})
+}
+
+type commandServerPullSourcesAdd struct {
+	overrideUsername string
+	overrideHostname string
+}
+
+func (c *commandServerPullSourcesAdd) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("add", "Add a pull source, which is snapshotted by the server according to its scheduling policy")
+
+	for _, p := range pullSourceProtocols {
+		flags := p.newFlags()
+
+		pc := cmd.Command(p.name, p.description)
+		flags.setup(pc)
+		pc.Flag("override-username", "Username of the snapshot source instead of the remote username").StringVar(&c.overrideUsername)
+		pc.Flag("override-hostname", "Hostname of the snapshot source instead of the remote hostname").StringVar(&c.overrideHostname)
+		pc.Action(svc.repositoryWriterAction(func(ctx context.Context, rep repo.RepositoryWriter) error {
+			return c.run(ctx, rep, flags)
+		}))
+	}
+}
+
+func (c *commandServerPullSourcesAdd) run(ctx context.Context, rep repo.RepositoryWriter, flags pullSourceFlags) error {
+	ps, err := flags.pullSource()
+	if err != nil {
+		return err
+	}
+
+	if c.overrideUsername != "" {
+		ps.Source.UserName = c.overrideUsername
+	}
+
+	if c.overrideHostname != "" {
+		ps.Source.Host = c.overrideHostname
+	}
+
+	if err := pullsource.Set(ctx, rep, ps); err != nil {
+		return errors.Wrap(err, "error adding pull source")
+	}
+
+	log(ctx).Infof("Added pull source %v. To refresh the server, run 'kopia server refresh'.", ps.Source)
+
+	return nil
+}
+
+type commandServerPullSourcesList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerPullSourcesList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List pull sources").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+// pullSourceInfo is the JSON representation of pull sources, which omits connection options since they may include credentials.
+type pullSourceInfo struct {
+	Source   snapshot.SourceInfo `json:"source"`
+	Protocol string              `json:"protocol"`
+}
+
+func (c *commandServerPullSourcesList) run(ctx context.Context, rep repo.Repository) error {
+	sources, err := pullsource.List(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing pull sources")
+	}
+
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, ps := range sources {
+		if c.jo.jsonOutput {
+			jl.emit(pullSourceInfo{ps.Source, ps.Protocol})
+		} else {
+			c.out.printStdout("%v %v\n", ps.Source, ps.Protocol)
+		}
+	}
+
+	return nil
+}
+
+type commandServerPullSourcesRemove struct {
+	source string
+}
+
+func (c *commandServerPullSourcesRemove) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("remove", "Remove a pull source, existing snapshots are not deleted").Alias("delete").Alias("rm")
+	cmd.Arg("source", "Source to remove, 'user@host:/path'").Required().StringVar(&c.source)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerPullSourcesRemove) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	si, err := snapshot.ParseSourceInfo(c.source, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	if err != nil {
+		return errors.Wrapf(err, "invalid source %q", c.source)
+	}
+
+	if err := pullsource.Delete(ctx, rep, si); err != nil {
+		return errors.Wrap(err, "error removing pull source")
+	}
+
+	log(ctx).Infof("Removed pull source %v. To refresh the server, run 'kopia server refresh'.", si)
+
+	return nil
+}
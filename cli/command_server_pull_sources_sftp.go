@@ -0,0 +1,50 @@
+//go:build !no_extra_providers
+
+package cli
+
+import (
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/pullsource"
+	"github.com/kopia/kopia/repo/blob/sftp"
+)
+
+type pullSourceSFTPFlags struct {
+	options sftp.Options
+	path    string
+}
+
+// setup registers the subset of SFTP connection flags supported by pull sources, which authenticate with
+// a key file accessible to the server, since passwords and key data would be stored in the repository.
+func (c *pullSourceSFTPFlags) setup(cmd *kingpin.CmdClause) {
+	cmd.Flag("path", "Absolute path of the directory to snapshot on the SFTP/SSH server").Required().StringVar(&c.path)
+	cmd.Flag("host", "SFTP/SSH server hostname").Required().StringVar(&c.options.Host)
+	cmd.Flag("port", "SFTP/SSH server port").Default("22").IntVar(&c.options.Port)
+	cmd.Flag("username", "SFTP/SSH server username").Required().StringVar(&c.options.Username)
+	cmd.Flag("keyfile", "Path to private key file accessible to the server").Required().StringVar(&c.options.Keyfile)
+
+	// one of those 2 must be provided
+	cmd.Flag("known-hosts", "Path to known_hosts file accessible to the server").StringVar(&c.options.KnownHostsFile)
+	cmd.Flag("known-hosts-data", "known_hosts file entries").StringVar(&c.options.KnownHostsData)
+}
+
+func (c *pullSourceSFTPFlags) pullSource() (*pullsource.Source, error) {
+	opt := c.options
+
+	if err := resolveSFTPCredentials(&opt, false); err != nil {
+		return nil, err
+	}
+
+	ps, err := pullsource.NewSFTP(&opt, c.path)
+
+	return ps, errors.Wrap(err, "unable to create SFTP pull source")
+}
+
+func init() {
+	registerPullSourceProtocol(
+		pullsource.ProtocolSFTP,
+		"Read files over SFTP/SSH using a key file accessible to the server",
+		func() pullSourceFlags { return &pullSourceSFTPFlags{} },
+	)
+}
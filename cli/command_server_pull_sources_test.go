@@ -0,0 +1,64 @@
+//go:build !no_extra_providers
+
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestServerPullSources(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--override-username=test-user", "--override-hostname=test-host")
+
+	env.RunAndExpectSuccess(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--keyfile=/etc/kopia/id_ed25519", "--known-hosts-data=remote-host ssh-ed25519 AAAA",
+		"--path=/home/alice")
+	env.RunAndExpectSuccess(t, "server", "pull-sources", "add", "sftp",
+		"--host=other-host", "--username=bob", "--keyfile=/etc/kopia/id_ed25519", "--known-hosts-data=other-host ssh-ed25519 AAAA",
+		"--path=/srv", "--override-username=backup", "--override-hostname=files")
+
+	// credentials are required.
+	env.RunAndExpectFailure(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--known-hosts-data=remote-host ssh-ed25519 AAAA", "--path=/data")
+
+	// passwords, key data and external SSH commands can't be used with pull sources.
+	env.RunAndExpectFailure(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--sftp-password=secret", "--known-hosts-data=remote-host ssh-ed25519 AAAA", "--path=/data")
+	env.RunAndExpectFailure(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--key-data=private-key", "--known-hosts-data=remote-host ssh-ed25519 AAAA", "--path=/data")
+	env.RunAndExpectFailure(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--external", "--ssh-command=/bin/sh", "--path=/data")
+
+	// path must be absolute.
+	env.RunAndExpectFailure(t, "server", "pull-sources", "add", "sftp",
+		"--host=remote-host", "--username=alice", "--keyfile=/etc/kopia/id_ed25519", "--known-hosts-data=remote-host ssh-ed25519 AAAA", "--path=data")
+
+	require.Equal(t, []string{
+		"alice@remote-host:/home/alice sftp",
+		"backup@files:/srv sftp",
+	}, env.RunAndExpectSuccess(t, "server", "pull-sources", "list"))
+
+	var sources []struct {
+		Source   snapshot.SourceInfo `json:"source"`
+		Protocol string              `json:"protocol"`
+	}
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "server", "pull-sources", "list", "--json"), &sources)
+	require.Len(t, sources, 2)
+	require.Equal(t, "remote-host", sources[0].Source.Host)
+	require.Equal(t, "sftp", sources[0].Protocol)
+
+	env.RunAndExpectSuccess(t, "server", "pull-sources", "remove", "backup@files:/srv")
+	env.RunAndExpectFailure(t, "server", "pull-sources", "remove", "backup@files:/srv")
+
+	require.Equal(t, []string{
+		"alice@remote-host:/home/alice sftp",
+	}, env.RunAndExpectSuccess(t, "server", "pull-sources", "list"))
+}
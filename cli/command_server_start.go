@@ -11,6 +11,8 @@
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -64,16 +66,32 @@ type commandServerStart struct {
 	serverStartTLSGenerateCertValidDays int
 	serverStartTLSGenerateCertNames     []string
 	serverStartTLSPrintFullServerCert   bool
+	serverStartTLSClientCAFile          string
 	uiTitlePrefix                       string
 	uiPreferencesFile                   string
 	asyncRepoConnect                    bool
 	persistentLogs                      bool
 	debugScheduler                      bool
 	minMaintenanceInterval              time.Duration
+	changeJournal                       bool
+
+	oidcIssuerURL       string
+	oidcClientID        string
+	oidcClientSecret    string
+	oidcRedirectURL     string
+	oidcScopes          []string
+	oidcUsernameClaim   string
+	oidcDefaultHostname string
+	oidcGroupsClaim     string
+	oidcUIGroup         string
+	oidcControlGroup    string
+	oidcOnly            bool
 
 	shutdownGracePeriod  time.Duration
 	kopiauiNotifications bool
 
+	namedRepositories []string
+
 	logServerRequests bool
 
 	serverStartAllowDangerousUnauthenticatedNetwork bool
@@ -122,6 +140,19 @@ func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent
 	cmd.Flag("tls-generate-cert-valid-days", "How long should the TLS certificate be valid").Default("3650").Hidden().IntVar(&c.serverStartTLSGenerateCertValidDays)
 	cmd.Flag("tls-generate-cert-name", "Host names/IP addresses to generate TLS certificate for").Default("127.0.0.1").Hidden().StringsVar(&c.serverStartTLSGenerateCertNames)
 	cmd.Flag("tls-print-server-cert", "Print server certificate").Hidden().BoolVar(&c.serverStartTLSPrintFullServerCert)
+	cmd.Flag("tls-client-ca", "PEM file with CA certificates used to verify client certificates, which authenticate clients as the 'user@host' in their e-mail address or common name").StringVar(&c.serverStartTLSClientCAFile)
+
+	cmd.Flag("oidc-issuer", "OpenID Connect issuer URL used to authenticate UI users and API bearer tokens").StringVar(&c.oidcIssuerURL)
+	cmd.Flag("oidc-client-id", "OpenID Connect client ID").StringVar(&c.oidcClientID)
+	cmd.Flag("oidc-client-secret", "OpenID Connect client secret").Envar(svc.EnvName("KOPIA_OIDC_CLIENT_SECRET")).StringVar(&c.oidcClientSecret)
+	cmd.Flag("oidc-redirect-url", "URL of the server's /oidc/callback endpoint registered with the provider").StringVar(&c.oidcRedirectURL)
+	cmd.Flag("oidc-scope", "OpenID Connect scopes to request").Default(auth.DefaultOIDCScopes...).StringsVar(&c.oidcScopes)
+	cmd.Flag("oidc-username-claim", "ID token claim with the 'user@host' identity of the user, the 'email' claim must be verified by the provider").Default(auth.DefaultOIDCUsernameClaim).StringVar(&c.oidcUsernameClaim)
+	cmd.Flag("oidc-default-hostname", "Hostname appended to usernames without '@'").StringVar(&c.oidcDefaultHostname)
+	cmd.Flag("oidc-groups-claim", "ID token claim with the groups of the user").Default(auth.DefaultOIDCGroupsClaim).StringVar(&c.oidcGroupsClaim)
+	cmd.Flag("oidc-ui-group", "OpenID Connect group whose members are allowed to access the UI").StringVar(&c.oidcUIGroup)
+	cmd.Flag("oidc-server-control-group", "OpenID Connect group whose members are allowed to access the server control API").StringVar(&c.oidcControlGroup)
+	cmd.Flag("oidc-only", "Redirect UI users to the OpenID Connect provider instead of asking for a password, otherwise OpenID Connect login starts at /oidc/login").BoolVar(&c.oidcOnly)
 
 	cmd.Flag("async-repo-connect", "Connect to repository asynchronously").Hidden().BoolVar(&c.asyncRepoConnect)
 	cmd.Flag("persistent-logs", "Persist logs in a file").Default("true").BoolVar(&c.persistentLogs)
@@ -133,6 +164,10 @@ func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent
 
 	cmd.Flag("shutdown-grace-period", "Grace period for shutting down the server").Default("5s").DurationVar(&c.shutdownGracePeriod)
 
+	cmd.Flag("change-journal", "Track filesystem changes of local sources to skip unchanged directories during snapshots (Linux only)").BoolVar(&c.changeJournal)
+
+	cmd.Flag("named-repository", "Also serve the repository connected with the provided config file under a name (name=/path/to/repository.config), its password must be persisted").StringsVar(&c.namedRepositories)
+
 	cmd.Flag("kopiaui-notifications", "Enable notifications to be printed to stdout for KopiaUI").BoolVar(&c.kopiauiNotifications)
 
 	c.sf.setup(svc, cmd)
@@ -143,10 +178,19 @@ func (c *commandServerStart) setup(svc advancedAppServices, parent commandParent
 	cmd.Action(svc.baseActionWithContext(c.run))
 }
 
-func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Options, error) {
-	authn, err := c.getAuthenticator(ctx)
+func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Options, func() auth.Authenticator, error) {
+	newAuthenticator, err := c.getAuthenticator(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to initialize authentication")
+	}
+
+	oidc, err := c.getOIDCAuthenticator(ctx)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to initialize authentication")
+		return nil, nil, errors.Wrap(err, "unable to initialize OpenID Connect")
+	}
+
+	if c.changeJournal && runtime.GOOS != "linux" {
+		return nil, nil, errors.New("change journal is only supported on Linux")
 	}
 
 	uiPreferencesFile := c.uiPreferencesFile
@@ -159,7 +203,7 @@ func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Op
 		ConnectOptions:       c.co.toRepoConnectOptions(),
 		RefreshInterval:      c.serverStartRefreshInterval,
 		MaxConcurrency:       c.serverStartMaxConcurrency,
-		Authenticator:        authn,
+		Authenticator:        newAuthenticator(),
 		Authorizer:           auth.DefaultAuthorizer(),
 		AuthCookieSigningKey: c.serverAuthCookieSingingKey,
 		UIUser:               c.sf.serverUsername,
@@ -176,7 +220,40 @@ func (c *commandServerStart) serverStartOptions(ctx context.Context) (*server.Op
 
 		EnableErrorNotifications: c.svc.enableErrorNotifications(),
 		NotifyTemplateOptions:    c.svc.notificationTemplateOptions(),
-	}, nil
+
+		EnableChangeJournal: c.changeJournal,
+
+		OIDC:                   oidc,
+		OIDCOnly:               c.oidcOnly,
+		OIDCUIGroup:            c.oidcUIGroup,
+		OIDCServerControlGroup: c.oidcControlGroup,
+	}, newAuthenticator, nil
+}
+
+func (c *commandServerStart) getOIDCAuthenticator(ctx context.Context) (*auth.OIDCAuthenticator, error) {
+	if c.oidcIssuerURL == "" {
+		if c.oidcOnly {
+			return nil, errors.New("--oidc-only requires --oidc-issuer")
+		}
+
+		return nil, nil
+	}
+
+	if c.oidcRedirectURL == "" && c.serverStartUI {
+		return nil, errors.New("--oidc-redirect-url must be specified")
+	}
+
+	//nolint:wrapcheck
+	return auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:       c.oidcIssuerURL,
+		ClientID:        c.oidcClientID,
+		ClientSecret:    c.oidcClientSecret,
+		RedirectURL:     c.oidcRedirectURL,
+		Scopes:          c.oidcScopes,
+		UsernameClaim:   c.oidcUsernameClaim,
+		DefaultHostname: c.oidcDefaultHostname,
+		GroupsClaim:     c.oidcGroupsClaim,
+	})
 }
 
 func (c *commandServerStart) initRepositoryPossiblyAsync(ctx context.Context, srv *server.Server) error {
@@ -206,7 +283,7 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 		return errors.Wrap(err, "listen address not allowed for insecure server without password")
 	}
 
-	opts, err := c.serverStartOptions(ctx)
+	opts, newAuthenticator, err := c.serverStartOptions(ctx)
 	if err != nil {
 		return err
 	}
@@ -268,6 +345,27 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 		}
 	})
 
+	namedServers, err := c.startNamedRepositories(ctx, srv, opts, newAuthenticator)
+
+	defer func() {
+		for _, ns := range namedServers {
+			if err := ns.SetRepository(ctx, nil); err != nil {
+				reterr = stderrors.Join(reterr, errors.Wrap(err, "error disconnecting repository"))
+			}
+		}
+	}()
+
+	if err != nil {
+		return err
+	}
+
+	// event streams never finish on their own, close them so that they don't block graceful shutdown.
+	httpServer.RegisterOnShutdown(srv.CloseEventStreams)
+
+	for _, ns := range namedServers {
+		httpServer.RegisterOnShutdown(ns.CloseEventStreams)
+	}
+
 	m := mux.NewRouter()
 
 	c.setupHandlers(srv, m)
@@ -278,6 +376,10 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 
 	var handler http.Handler = m
 
+	if len(namedServers) > 0 {
+		handler = srv.RepositoryRouterHandler(handler)
+	}
+
 	if c.serverStartGRPC {
 		handler = srv.GRPCRouterHandler(handler)
 	}
@@ -295,7 +397,13 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 		}()
 	}
 
-	onExternalConfigReloadRequest(srv.Refresh)
+	onExternalConfigReloadRequest(func() {
+		srv.Refresh()
+
+		for _, ns := range namedServers {
+			ns.Refresh()
+		}
+	})
 
 	// enable notification to be printed to stderr where KopiaUI will pick it up
 	if c.kopiauiNotifications {
@@ -309,6 +417,79 @@ func (c *commandServerStart) run(ctx context.Context) (reterr error) {
 	return c.startServerWithOptionalTLS(ctx, httpServer)
 }
 
+// startNamedRepositories starts servers for repositories specified with --named-repository and registers them
+// with the default server. Each named repository authenticates and authorizes its own users.
+func (c *commandServerStart) startNamedRepositories(ctx context.Context, srv *server.Server, opts *server.Options, newAuthenticator func() auth.Authenticator) ([]*server.Server, error) {
+	var result []*server.Server
+
+	for _, nr := range c.namedRepositories {
+		name, configFile, ok := strings.Cut(nr, "=")
+		if !ok || name == "" || configFile == "" {
+			return result, errors.Errorf("invalid named repository %q, must be name=/path/to/repository.config", nr)
+		}
+
+		configFile, err := filepath.Abs(configFile)
+		if err != nil {
+			return result, errors.Wrap(err, "unable to resolve repository config file path")
+		}
+
+		nopts := *opts
+		nopts.ConfigFile = configFile
+		// unless configured, each repository signs its cookies with its own random key, the key of the default
+		// server was stored in opts when it was created.
+		nopts.AuthCookieSigningKey = c.serverAuthCookieSingingKey
+		nopts.Authenticator = newAuthenticator()
+		nopts.Authorizer = auth.DefaultAuthorizer()
+
+		ns, err := server.New(ctx, &nopts)
+		if err != nil {
+			return result, errors.Wrapf(err, "unable to initialize server for repository %q", name)
+		}
+
+		result = append(result, ns)
+
+		if _, err := ns.InitRepositoryAsync(ctx, "Open", c.namedRepositoryInitializer(configFile), !c.asyncRepoConnect); err != nil {
+			return result, errors.Wrapf(err, "unable to initialize repository %q", name)
+		}
+
+		// only the default server shuts down the HTTP server.
+		ns.OnShutdown = func(ctx context.Context) error {
+			return srv.OnShutdown(ctx)
+		}
+
+		m := mux.NewRouter()
+		c.setupHandlers(ns, m)
+
+		if err := srv.AddNamedRepository(name, ns, m); err != nil {
+			return result, errors.Wrap(err, "unable to add named repository")
+		}
+
+		log(ctx).Infof("Serving repository %q from %v", name, configFile)
+	}
+
+	return result, nil
+}
+
+func (c *commandServerStart) namedRepositoryInitializer(configFile string) server.InitRepositoryFunc {
+	initialize := func(ctx context.Context) (repo.Repository, error) {
+		pass, err := c.svc.passwordPersistenceStrategy().GetPassword(ctx, configFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to get persisted repository password")
+		}
+
+		r, err := repo.Open(ctx, configFile, pass, c.svc.optionsFromFlags(ctx))
+
+		return r, errors.Wrap(err, "unable to open repository")
+	}
+
+	if c.asyncRepoConnect {
+		// retry initialization indefinitely
+		initialize = server.RetryInitRepository(initialize)
+	}
+
+	return initialize
+}
+
 func shutdownHTTPServer(ctx context.Context, httpServer *http.Server) {
 	log(ctx).Info("Shutting down HTTP server ...")
 
@@ -341,7 +522,9 @@ func stripProtocol(addr string) string {
 	return strings.TrimPrefix(strings.TrimPrefix(addr, "https://"), "http://")
 }
 
-func (c *commandServerStart) getAuthenticator(ctx context.Context) (auth.Authenticator, error) {
+// getAuthenticator returns a function creating the authenticator of each repository served, which accepts
+// the server-wide passwords and the user accounts stored in the repository.
+func (c *commandServerStart) getAuthenticator(ctx context.Context) (func() auth.Authenticator, error) {
 	var authenticators []auth.Authenticator
 
 	// handle passwords (UI and remote) from htpasswd file.
@@ -361,7 +544,7 @@ func (c *commandServerStart) getAuthenticator(ctx context.Context) (auth.Authent
 			return nil, errors.New("--without-password specified without --insecure, refusing to start server")
 		}
 
-		return nil, nil
+		return func() auth.Authenticator { return nil }, nil
 
 	case c.sf.serverPassword != "":
 		authenticators = append(authenticators, auth.AuthenticateSingleUser(c.sf.serverUsername, c.sf.serverPassword))
@@ -402,8 +585,8 @@ func (c *commandServerStart) getAuthenticator(ctx context.Context) (auth.Authent
 User accounts can be added using 'kopia server user add'.
 `)
 
-	// handle user accounts stored in the repository
-	authenticators = append(authenticators, auth.AuthenticateRepositoryUsers())
-
-	return auth.CombineAuthenticators(authenticators...), nil
+	return func() auth.Authenticator {
+		// handle user accounts stored in the repository
+		return auth.CombineAuthenticators(append(slices.Clone(authenticators), auth.AuthenticateRepositoryUsers())...)
+	}, nil
 }
@@ -130,6 +130,10 @@ func (c *commandServerStart) startServerWithOptionalTLSAndListener(ctx context.C
 	switch {
 	case c.serverStartTLSCertFile != "" && c.serverStartTLSKeyFile != "":
 		// PEM files provided
+		if err := c.maybeRequestClientCertificates(httpServer); err != nil {
+			return err
+		}
+
 		fmt.Fprintf(c.out.stderr(), "SERVER ADDRESS: %shttps://%v\n", udsPfx, httpServer.Addr) //nolint:errcheck
 		c.showServerUIPrompt(ctx)
 
@@ -152,6 +156,10 @@ func (c *commandServerStart) startServerWithOptionalTLSAndListener(ctx context.C
 			},
 		}
 
+		if err := c.maybeRequestClientCertificates(httpServer); err != nil {
+			return err
+		}
+
 		fingerprint := sha256.Sum256(cert.Raw)
 		fmt.Fprintf(c.out.stderr(), "SERVER CERT SHA256: %v\n", hex.EncodeToString(fingerprint[:])) //nolint:errcheck
 
@@ -176,6 +184,10 @@ func (c *commandServerStart) startServerWithOptionalTLSAndListener(ctx context.C
 			return errors.New("TLS not configured. To start server without encryption pass --insecure")
 		}
 
+		if c.serverStartTLSClientCAFile != "" {
+			return errors.New("client certificates require TLS")
+		}
+
 		fmt.Fprintf(c.out.stderr(), "SERVER ADDRESS: %shttp://%v\n", udsPfx, httpServer.Addr) //nolint:errcheck
 		c.showServerUIPrompt(ctx)
 
@@ -183,6 +195,34 @@ func (c *commandServerStart) startServerWithOptionalTLSAndListener(ctx context.C
 	}
 }
 
+// maybeRequestClientCertificates configures the server to request client certificates and verify them
+// against the CA certificates in --tls-client-ca. Clients that don't present a certificate can still
+// authenticate with a password.
+func (c *commandServerStart) maybeRequestClientCertificates(httpServer *http.Server) error {
+	if c.serverStartTLSClientCAFile == "" {
+		return nil
+	}
+
+	pemData, err := os.ReadFile(c.serverStartTLSClientCAFile)
+	if err != nil {
+		return errors.Wrap(err, "unable to read client CA file")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return errors.Errorf("no certificates found in %v", c.serverStartTLSClientCAFile)
+	}
+
+	if httpServer.TLSConfig == nil {
+		httpServer.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	httpServer.TLSConfig.ClientCAs = pool
+	httpServer.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return nil
+}
+
 func (c *commandServerStart) showServerUIPrompt(ctx context.Context) {
 	if c.serverStartUI {
 		log(ctx).Info("Open the address above in a web browser to use the UI.")
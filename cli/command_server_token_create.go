@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/apitoken"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandServerTokenCreate struct {
+	scopes      []string
+	sources     []string
+	expires     string
+	description string
+
+	out textOutput
+}
+
+func (c *commandServerTokenCreate) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("create", "Create API token")
+	cmd.Flag("scope", "Comma-separated list of calls allowed with the token: "+joinScopes(apitoken.AllScopes())).Required().StringsVar(&c.scopes)
+	cmd.Flag("source", "Restrict the token to the source (user@host, user@host:/path or @host)").StringsVar(&c.sources)
+	cmd.Flag("expires", "Token lifetime, such as 12h or 30d, or 'never'").Default("30d").StringVar(&c.expires)
+	cmd.Flag("description", "Token description").StringVar(&c.description)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerTokenCreate) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	t := &apitoken.Token{
+		Description: c.description,
+		CreatedBy:   rep.ClientOptions().UsernameAtHost(),
+		CreatedTime: clock.Now(),
+	}
+
+	for _, s := range c.scopes {
+		for _, scope := range strings.Split(s, ",") {
+			t.Scopes = append(t.Scopes, apitoken.Scope(strings.TrimSpace(scope)))
+		}
+	}
+
+	for _, s := range c.sources {
+		si, err := snapshot.ParseSourceInfo(s, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+		if err != nil {
+			return errors.Wrapf(err, "invalid source %q", s)
+		}
+
+		t.Sources = append(t.Sources, si)
+	}
+
+	lifetime, err := parseTokenLifetime(c.expires)
+	if err != nil {
+		return err
+	}
+
+	if lifetime > 0 {
+		t.ExpiresTime = t.CreatedTime.Add(lifetime)
+	}
+
+	token, err := apitoken.CreateToken(ctx, rep, t)
+	if err != nil {
+		return errors.Wrap(err, "error creating API token")
+	}
+
+	log(ctx).Infof("Created API token %v. It can't be displayed again, store it securely.", t.ID)
+
+	c.out.printStdout("%v\n", token)
+
+	return nil
+}
+
+// parseTokenLifetime parses the duration in Go format or a number of days such as '30d'.
+// Returns zero for tokens that never expire.
+func parseTokenLifetime(s string) (time.Duration, error) {
+	if s == "never" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, errors.Errorf("invalid token lifetime %q", s)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil //nolint:mnd
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, errors.Errorf("invalid token lifetime %q", s)
+	}
+
+	return d, nil
+}
+
+func joinScopes(scopes []apitoken.Scope) string {
+	var s []string
+
+	for _, sc := range scopes {
+		s = append(s, string(sc))
+	}
+
+	return strings.Join(s, ",")
+}
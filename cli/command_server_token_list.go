@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/apitoken"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerTokenList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerTokenList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List API tokens").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandServerTokenList) run(ctx context.Context, rep repo.Repository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	tokens, err := apitoken.ListTokens(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing API tokens")
+	}
+
+	for _, t := range tokens {
+		if c.jo.jsonOutput {
+			jl.emit(t)
+			continue
+		}
+
+		expires := "never"
+		if !t.ExpiresTime.IsZero() {
+			expires = formatTimestamp(t.ExpiresTime)
+		}
+
+		if t.IsExpired(clock.Now()) {
+			expires += " (expired)"
+		}
+
+		c.out.printStdout("id:%v scopes:%v sources:%v created:%v expires:%v %v\n", t.ID, joinScopes(t.Scopes), t.Sources, formatTimestamp(t.CreatedTime), expires, t.Description)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestServerTokens(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir1 := testutil.TempDirectory(t)
+	dir2 := testutil.TempDirectory(t)
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir, "--override-username=test-user", "--override-hostname=test-host")
+	env.RunAndExpectSuccess(t, "snap", "create", dir1)
+	env.RunAndExpectSuccess(t, "snap", "create", dir2)
+
+	statusToken := env.RunAndExpectSuccess(t, "server", "tokens", "create", "--scope=read-status", "--description=status")[0]
+	snapshotToken := env.RunAndExpectSuccess(t, "server", "tokens", "create", "--scope", "trigger-snapshot,read-status", "--source", dir1, "--expires=30d")[0]
+
+	env.RunAndExpectFailure(t, "server", "tokens", "create", "--scope=no-such-scope")
+	env.RunAndExpectFailure(t, "server", "tokens", "create", "--scope=read-status", "--expires=10x")
+
+	tokens := env.RunAndExpectSuccess(t, "server", "tokens", "list")
+	require.Len(t, tokens, 2)
+	require.Contains(t, tokens[0], "scopes:read-status ")
+	require.Contains(t, tokens[1], "scopes:trigger-snapshot,read-status ")
+
+	var sp testutil.ServerParameters
+
+	wait, kill := env.RunAndProcessStderr(t, sp.ProcessOutput,
+		"server", "start", "--insecure", "--random-server-control-password", "--address=127.0.0.1:0")
+
+	defer func() {
+		kill()
+		wait()
+	}()
+
+	const (
+		pollFrequency = 100 * time.Millisecond
+		waitTimeout   = 15 * time.Second
+	)
+
+	require.Eventually(t, func() bool {
+		lines := env.RunAndExpectSuccess(t, "server", "status", "--address", sp.BaseURL, "--server-token", statusToken)
+
+		return hasLine(lines, "IDLE: test-user@test-host:"+dir1) && hasLine(lines, "IDLE: test-user@test-host:"+dir2)
+	}, waitTimeout, pollFrequency)
+
+	// the token restricted to a source only sees that source.
+	lines := env.RunAndExpectSuccess(t, "server", "status", "--address", sp.BaseURL, "--server-token", snapshotToken)
+	require.Equal(t, []string{"IDLE: test-user@test-host:" + dir1}, lines)
+
+	// tokens can only make calls permitted by their scopes.
+	env.RunAndExpectFailure(t, "server", "snapshot", "--address", sp.BaseURL, "--server-token", statusToken, "--all")
+	env.RunAndExpectSuccess(t, "server", "snapshot", "--address", sp.BaseURL, "--server-token", snapshotToken, "--all")
+	env.RunAndExpectFailure(t, "server", "flush", "--address", sp.BaseURL, "--server-token", snapshotToken)
+
+	env.RunAndExpectFailure(t, "server", "status", "--address", sp.BaseURL, "--server-token", "kopia-token-invalid.token")
+
+	// revoked tokens are rejected.
+	env.RunAndExpectSuccess(t, "server", "tokens", "revoke", strings.Fields(tokens[0])[0][len("id:"):])
+
+	env.RunAndExpectSuccess(t, "server", "refresh", "--address", sp.BaseURL, "--server-control-password", sp.ServerControlPassword)
+
+	require.Eventually(t, func() bool {
+		_, _, err := env.Run(t, true, "server", "status", "--address", sp.BaseURL, "--server-token", statusToken)
+
+		return err != nil
+	}, waitTimeout, pollFrequency)
+}
@@ -1,18 +1,19 @@
 package cli
 
 type commandSnapshot struct {
-	copyHistory commandSnapshotCopyMoveHistory
-	moveHistory commandSnapshotCopyMoveHistory
-	create      commandSnapshotCreate
-	delete      commandSnapshotDelete
-	estimate    commandSnapshotEstimate
-	expire      commandSnapshotExpire
-	fix         commandSnapshotFix
-	list        commandSnapshotList
-	migrate     commandSnapshotMigrate
-	pin         commandSnapshotPin
-	restore     commandSnapshotRestore
-	verify      commandSnapshotVerify
+	copyHistory   commandSnapshotCopyMoveHistory
+	moveHistory   commandSnapshotCopyMoveHistory
+	create        commandSnapshotCreate
+	delete        commandSnapshotDelete
+	estimate      commandSnapshotEstimate
+	expire        commandSnapshotExpire
+	fix           commandSnapshotFix
+	importArchive commandSnapshotImportArchive
+	list          commandSnapshotList
+	migrate       commandSnapshotMigrate
+	pin           commandSnapshotPin
+	restore       commandSnapshotRestore
+	verify        commandSnapshotVerify
 }
 
 func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
@@ -24,6 +25,7 @@ func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
 	c.estimate.setup(svc, cmd)
 	c.expire.setup(svc, cmd)
 	c.fix.setup(svc, cmd)
+	c.importArchive.setup(svc, cmd)
 	c.list.setup(svc, cmd)
 	c.migrate.setup(svc, cmd)
 	c.pin.setup(svc, cmd)
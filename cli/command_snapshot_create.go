@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
@@ -13,6 +15,8 @@
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/localfs"
 	"github.com/kopia/kopia/fs/virtualfs"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/metrics"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/repo"
@@ -39,11 +43,14 @@ type commandSnapshotCreate struct {
 	snapshotCreateForceEnableActions      bool
 	snapshotCreateForceDisableActions     bool
 	snapshotCreateStdinFileName           string
+	snapshotCreateFilesFrom               string
+	snapshotCreateResume                  bool
 	snapshotCreateCheckpointUploadLimitMB int64
 	snapshotCreateTags                    []string
 	flushPerSource                        bool
 	sourceOverride                        string
 	sendSnapshotReport                    bool
+	metricsFile                           string
 
 	snapshotCreateStreamingReads bool
 
@@ -73,11 +80,14 @@ func (c *commandSnapshotCreate) setup(svc appServices, parent commandParent) {
 	cmd.Flag("force-enable-actions", "Enable snapshot actions even if globally disabled on this client").Hidden().BoolVar(&c.snapshotCreateForceEnableActions)
 	cmd.Flag("force-disable-actions", "Disable snapshot actions even if globally enabled on this client").Hidden().BoolVar(&c.snapshotCreateForceDisableActions)
 	cmd.Flag("stdin-file", "File path to be used for stdin data snapshot.").StringVar(&c.snapshotCreateStdinFileName)
+	cmd.Flag("files-from", "Snapshot only the paths listed in the given file (newline or NUL-separated, '-' for stdin), relative to the single source directory.").PlaceHolder("FILE").StringVar(&c.snapshotCreateFilesFrom)
+	cmd.Flag("resume", "Resume the most recent interrupted snapshot of each source, skipping directories that have already been completed.").BoolVar(&c.snapshotCreateResume)
 	cmd.Flag("tags", "Tags applied on the snapshot. Must be provided in the <key>:<value> format.").StringsVar(&c.snapshotCreateTags)
 	cmd.Flag("pin", "Create a pinned snapshot that will not expire automatically").StringsVar(&c.pins)
 	cmd.Flag("flush-per-source", "Flush writes at the end of each source").Hidden().BoolVar(&c.flushPerSource)
 	cmd.Flag("override-source", "Override the source of the snapshot.").StringVar(&c.sourceOverride)
 	cmd.Flag("send-snapshot-report", "Send a snapshot report notification using configured notification profiles").Default("true").BoolVar(&c.sendSnapshotReport)
+	cmd.Flag("metrics-file", "Write Prometheus metrics describing the outcome of each snapshot to the provided file, for use with the node exporter textfile collector.").PlaceHolder("FILE").StringVar(&c.metricsFile)
 	cmd.Flag("hint-streaming-reads", "[EXPERIMENTAL] Hint the OS to release memory used for I/O after reading files that are being backed up, aiming at reducing the memory footprint during backups (Linux only, best-effort).").
 		Default("false").Hidden().BoolVar(&c.snapshotCreateStreamingReads)
 
@@ -119,6 +129,16 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 		return errors.New("no snapshot sources")
 	}
 
+	if c.snapshotCreateFilesFrom != "" {
+		if len(sources) != 1 {
+			return errors.New("--files-from requires exactly one source directory")
+		}
+
+		if c.snapshotCreateStdinFileName != "" {
+			return errors.New("--files-from cannot be used with --stdin-file")
+		}
+	}
+
 	if err := validateStartEndTime(c.snapshotCreateStartTime, c.snapshotCreateEndTime); err != nil {
 		return err
 	}
@@ -160,6 +180,12 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 		notification.Send(ctx, rep, "snapshot-report", st, c.reportSeverity(st), c.svc.notificationTemplateOptions())
 	}
 
+	if c.metricsFile != "" {
+		if err := metrics.WriteOutcomesToTextfile(c.metricsFile); err != nil {
+			finalErrors = append(finalErrors, err.Error())
+		}
+	}
+
 	// ensure we flush at least once in the session to properly close all pending buffers,
 	// otherwise the session will be reported as memory leak.
 	// by default the wrapper function does not flush on errors, which is what we want to do always.
@@ -267,6 +293,7 @@ func (c *commandSnapshotCreate) setupUploader(rep repo.RepositoryWriter) *upload
 	u.ParallelUploads = c.snapshotCreateParallelUploads
 
 	u.FailFast = c.snapshotCreateFailFast
+	u.Resume = c.snapshotCreateResume
 	u.Progress = c.svc.getProgress()
 
 	return u
@@ -300,16 +327,33 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 ) (finalErr error) {
 	log(ctx).Infof("Snapshotting %v ...", sourceInfo)
 
-	var mwe notifydata.ManifestWithError
+	var (
+		mwe           notifydata.ManifestWithError
+		uploadedBytes int64
+	)
 
 	mwe.Manifest.Source = sourceInfo
 
 	st.Snapshots = append(st.Snapshots, &mwe)
 
+	startTime := clock.Now()
+
 	defer func() {
 		if finalErr != nil {
 			mwe.Error = finalErr.Error()
 		}
+
+		metrics.RecordSnapshotOutcome(&metrics.SnapshotOutcome{
+			UserName:      sourceInfo.UserName,
+			Host:          sourceInfo.Host,
+			Path:          sourceInfo.Path,
+			StartTime:     startTime,
+			EndTime:       clock.Now(),
+			Success:       finalErr == nil && mwe.Manifest.IncompleteReason == "",
+			UploadedBytes: uploadedBytes,
+			Files:         int64(mwe.Manifest.Stats.TotalFileCount),
+			Errors:        int64(mwe.Manifest.Stats.ErrorCount) + int64(mwe.Manifest.Stats.IgnoredErrorCount),
+		})
 	}()
 
 	var previous []*snapshot.Manifest
@@ -329,6 +373,9 @@ func (c *commandSnapshotCreate) snapshotSingleSource(
 	}
 
 	manifest, finalErr := u.Upload(ctx, fsEntry, policyTree, sourceInfo, previous...)
+
+	uploadedBytes = c.svc.getProgress().uploadedBytes.Load()
+
 	if finalErr != nil {
 		// fail-fast uploads will fail here without recording a manifest, other uploads will
 		// possibly fail later.
@@ -494,6 +541,15 @@ func (c *commandSnapshotCreate) getContentToSnapshot(ctx context.Context, dir st
 			virtualfs.StreamingFileFromReader(c.snapshotCreateStdinFileName, io.NopCloser(c.svc.stdin())),
 		})
 		setManual = true
+	} else if c.snapshotCreateFilesFrom != "" {
+		// only the listed paths will be snapshotted using a virtual root directory that mirrors
+		// the real directory structure leading to them, the source remains the base directory
+		// so that retention and caching based on previous snapshots keep working. The scheduling
+		// policy of the directory is left alone, since scheduled snapshots of it remain complete.
+		fsEntry, err = c.getFilesFromEntry(ctx, absDir, opts)
+		if err != nil {
+			return nil, info, false, err
+		}
 	} else {
 		fsEntry, err = getLocalFSEntry(ctx, absDir, opts)
 		if err != nil {
@@ -504,6 +560,108 @@ func (c *commandSnapshotCreate) getContentToSnapshot(ctx context.Context, dir st
 	return fsEntry, info, setManual, nil
 }
 
+func (c *commandSnapshotCreate) getFilesFromEntry(ctx context.Context, absDir string, opts localfs.Options) (fs.Entry, error) {
+	var r io.Reader
+
+	if c.snapshotCreateFilesFrom == "-" {
+		r = c.svc.stdin()
+	} else {
+		f, err := os.Open(c.snapshotCreateFilesFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open file list")
+		}
+
+		defer f.Close() //nolint:errcheck
+
+		r = f
+	}
+
+	paths, err := readFilesFromList(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no paths listed in %v", c.snapshotCreateFilesFrom)
+	}
+
+	relPaths := make([]string, 0, len(paths))
+
+	for _, p := range paths {
+		rel, err := relativeToSourceDir(absDir, p)
+		if err != nil {
+			return nil, err
+		}
+
+		relPaths = append(relPaths, rel)
+	}
+
+	root, err := getLocalFSEntry(ctx, absDir, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get local filesystem entry")
+	}
+
+	rootPath := root.LocalFilesystemPath()
+
+	d, err := virtualfs.NewDirectoryFromPaths(ctx, relPaths, func(_ context.Context, relPath string) (fs.Entry, error) {
+		if relPath == "" {
+			return root, nil
+		}
+
+		//nolint:wrapcheck
+		return localfs.NewEntryWithOptions(filepath.Join(rootPath, filepath.FromSlash(relPath)), opts)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to build directory from file list")
+	}
+
+	return d, nil
+}
+
+// readFilesFromList parses the list of paths separated by NUL characters or newlines, skipping empty entries.
+func readFilesFromList(r io.Reader) ([]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read file list")
+	}
+
+	sep := "\n"
+	if bytes.IndexByte(b, 0) >= 0 {
+		sep = "\x00"
+	}
+
+	var result []string
+
+	for _, p := range strings.Split(string(b), sep) {
+		if sep == "\n" {
+			p = strings.TrimSuffix(p, "\r")
+		}
+
+		if p == "" {
+			continue
+		}
+
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// relativeToSourceDir returns the slash-separated path of p relative to the source directory.
+// Relative paths are interpreted as relative to the source directory.
+func relativeToSourceDir(absDir, p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(absDir, p)
+	}
+
+	rel, err := filepath.Rel(absDir, filepath.Clean(p))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("path %v is outside of source directory %v", p, absDir)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
 func parseFullSource(str, hostname, username string) (snapshot.SourceInfo, error) {
 	sourceInfo, err := snapshot.ParseSourceInfo(str, hostname, username)
 	if err != nil {
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/archivefs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+type commandSnapshotImportArchive struct {
+	archiveFile string
+	source      string
+	startTime   string
+	description string
+	tempDir     string
+	tags        []string
+	pins        []string
+
+	svc appServices
+}
+
+func (c *commandSnapshotImportArchive) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("import-archive", "Imports the contents of a tar or zip archive (optionally compressed using gzip or zstd) as a snapshot without extracting it.")
+	cmd.Arg("archive", "Archive file to import.").Required().ExistingFileVar(&c.archiveFile)
+	cmd.Flag("source", "Source of the snapshot (user@host:/path).").Required().StringVar(&c.source)
+	cmd.Flag("time", "Snapshot start time ("+timeFormat+"), defaults to the modification time of the archive.").StringVar(&c.startTime)
+	cmd.Flag("description", "Free-form snapshot description.").StringVar(&c.description)
+	cmd.Flag("temp-dir", "Directory where compressed tar archives are decompressed to.").StringVar(&c.tempDir)
+	cmd.Flag("tags", "Tags applied on the snapshot. Must be provided in the <key>:<value> format.").StringsVar(&c.tags)
+	cmd.Flag("pin", "Create a pinned snapshot that will not expire automatically").StringsVar(&c.pins)
+
+	c.svc = svc
+	cmd.Action(svc.repositoryWriterActionWithMaintenance(c.run))
+}
+
+func (c *commandSnapshotImportArchive) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if len(c.description) > maxSnapshotDescriptionLength {
+		return errors.New("description too long")
+	}
+
+	sourceInfo, err := parseFullSource(c.source, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	if err != nil {
+		return errors.Wrapf(err, "invalid source %v", c.source)
+	}
+
+	startTime, err := parseTimestamp(c.startTime)
+	if err != nil {
+		return errors.Wrapf(err, "could not parse time %q", c.startTime)
+	}
+
+	if startTime.IsZero() {
+		st, serr := os.Stat(c.archiveFile)
+		if serr != nil {
+			return errors.Wrap(serr, "unable to stat archive")
+		}
+
+		startTime = st.ModTime()
+	}
+
+	tags, err := getTags(c.tags)
+	if err != nil {
+		return err
+	}
+
+	a, err := archivefs.Open(ctx, c.archiveFile, archivefs.Options{
+		DefaultModTime: startTime,
+		TempDir:        c.tempDir,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "unable to open archive %v", c.archiveFile)
+	}
+
+	defer a.Close() //nolint:errcheck
+
+	log(ctx).Infof("Importing %v as %v ...", c.archiveFile, sourceInfo)
+
+	previous, err := snapshot.FindPreviousManifests(ctx, rep, sourceInfo, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to find previous manifests")
+	}
+
+	policyTree, err := policy.TreeForSource(ctx, rep, sourceInfo)
+	if err != nil {
+		return errors.Wrap(err, "unable to get policy tree")
+	}
+
+	u := upload.NewUploader(rep)
+	u.Progress = c.svc.getProgress()
+	c.svc.onTerminate(u.Cancel)
+
+	manifest, err := u.Upload(ctx, a.Root(), policyTree, sourceInfo, previous...)
+	if err != nil {
+		return errors.Wrap(err, "upload error")
+	}
+
+	// the snapshot represents the point in time when the archive was created.
+	duration := manifest.EndTime.Sub(manifest.StartTime)
+	manifest.StartTime = fs.UTCTimestampFromTime(startTime)
+	manifest.EndTime = manifest.StartTime.Add(duration)
+	manifest.Description = c.description
+	manifest.Tags = tags
+	manifest.UpdatePins(c.pins, nil)
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, manifest); err != nil {
+		return errors.Wrap(err, "cannot save manifest")
+	}
+
+	// imported sources are not present on this machine, so they must never be snapshotted on schedule.
+	if err := policy.SetManual(ctx, rep, sourceInfo); err != nil {
+		return errors.Wrap(err, "unable to set manual field in scheduling policy for source")
+	}
+
+	c.svc.getProgress().Finish()
+
+	log(ctx).Infof("Imported snapshot %v of %v taken at %v", manifest.ID, sourceInfo, formatTimestamp(startTime))
+
+	return nil
+}
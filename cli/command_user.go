@@ -4,9 +4,11 @@ type commandServerUser struct {
 	add    commandServerUserAddSet
 	set    commandServerUserAddSet
 	delete commandServerUserDelete
+	group  commandServerUserGroup
 	hash   commandServerUserHashPassword
 	info   commandServerUserInfo
 	list   commandServerUserList
+	quota  commandServerUserQuota
 }
 
 func (c *commandServerUser) setup(svc appServices, parent commandParent) {
@@ -15,7 +17,9 @@ func (c *commandServerUser) setup(svc appServices, parent commandParent) {
 	c.add.setup(svc, cmd, true)
 	c.set.setup(svc, cmd, false)
 	c.delete.setup(svc, cmd)
+	c.group.setup(svc, cmd)
 	c.hash.setup(svc, cmd)
 	c.info.setup(svc, cmd)
 	c.list.setup(svc, cmd)
+	c.quota.setup(svc, cmd)
 }
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserGroup struct {
+	add    commandServerUserGroupAddRemove
+	remove commandServerUserGroupAddRemove
+	list   commandServerUserGroupList
+}
+
+func (c *commandServerUserGroup) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("group", "Manage user groups, which can be referenced in ACLs as 'group:name'").Alias("groups")
+
+	c.add.setup(svc, cmd, true)
+	c.remove.setup(svc, cmd, false)
+	c.list.setup(svc, cmd)
+}
+
+type commandServerUserGroupAddRemove struct {
+	isAdd bool
+
+	group   string
+	members []string
+}
+
+func (c *commandServerUserGroupAddRemove) setup(svc appServices, parent commandParent, isAdd bool) {
+	var cmd *kingpin.CmdClause
+
+	c.isAdd = isAdd
+
+	if isAdd {
+		cmd = parent.Command("add", "Add users to a group, creating it if needed")
+	} else {
+		cmd = parent.Command("remove", "Remove users from a group, deleting it when it has no members left").Alias("rm")
+	}
+
+	cmd.Arg("group", "Group name").Required().StringVar(&c.group)
+	cmd.Arg("username", "Members specified as 'user@hostname'").Required().StringsVar(&c.members)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserGroupAddRemove) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if c.isAdd {
+		g, err := user.AddGroupMembers(ctx, rep, c.group, c.members...)
+		if err != nil {
+			return errors.Wrap(err, "error adding group members")
+		}
+
+		log(ctx).Infof("Group %q now has members: %v", g.Name, strings.Join(g.Members, ", "))
+
+		return nil
+	}
+
+	g, err := user.RemoveGroupMembers(ctx, rep, c.group, c.members...)
+	if err != nil {
+		return errors.Wrap(err, "error removing group members")
+	}
+
+	if len(g.Members) == 0 {
+		log(ctx).Infof("Group %q deleted.", g.Name)
+	} else {
+		log(ctx).Infof("Group %q now has members: %v", g.Name, strings.Join(g.Members, ", "))
+	}
+
+	return nil
+}
+
+type commandServerUserGroupList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerUserGroupList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List groups").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandServerUserGroupList) run(ctx context.Context, rep repo.Repository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	groups, err := user.ListGroups(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing groups")
+	}
+
+	for _, g := range groups {
+		if c.jo.jsonOutput {
+			jl.emit(g)
+		} else {
+			c.out.printStdout("%v: %v\n", g.Name, strings.Join(g.Members, " "))
+		}
+	}
+
+	return nil
+}
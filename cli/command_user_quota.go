@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+
+	atunits "github.com/alecthomas/units"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandServerUserQuota struct {
+	set        commandServerUserQuotaSet
+	delete     commandServerUserQuotaDelete
+	list       commandServerUserQuotaList
+	resetUsage commandServerUserQuotaResetUsage
+}
+
+func (c *commandServerUserQuota) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("quota", "Manage storage quotas limiting new packed bytes uploaded by users").Alias("quotas")
+
+	c.set.setup(svc, cmd)
+	c.delete.setup(svc, cmd)
+	c.list.setup(svc, cmd)
+	c.resetUsage.setup(svc, cmd)
+}
+
+type commandServerUserQuotaSet struct {
+	pattern   string
+	softLimit atunits.Base2Bytes
+	hardLimit atunits.Base2Bytes
+}
+
+func (c *commandServerUserQuotaSet) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("set", "Set storage quota for users matching a pattern")
+	cmd.Arg("pattern", "Users the quota applies to, 'user@hostname' possibly including wildcards, such as '*@hostname'").Required().StringVar(&c.pattern)
+	cmd.Flag("soft-limit", "Usage above which notifications are sent (e.g. 80GB)").BytesVar(&c.softLimit)
+	cmd.Flag("hard-limit", "Usage above which new uploads are rejected (e.g. 100GB)").BytesVar(&c.hardLimit)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserQuotaSet) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	q := &user.Quota{
+		Pattern:        c.pattern,
+		SoftLimitBytes: int64(c.softLimit),
+		HardLimitBytes: int64(c.hardLimit),
+	}
+
+	if err := user.SetQuota(ctx, rep, q); err != nil {
+		return errors.Wrap(err, "error setting quota")
+	}
+
+	log(ctx).Infof("Set quota for %v. To refresh the server, run 'kopia server refresh'.", q.Pattern)
+
+	return nil
+}
+
+type commandServerUserQuotaDelete struct {
+	pattern string
+}
+
+func (c *commandServerUserQuotaDelete) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("delete", "Delete storage quota").Alias("remove").Alias("rm")
+	cmd.Arg("pattern", "Quota pattern").Required().StringVar(&c.pattern)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserQuotaDelete) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	return errors.Wrap(user.DeleteQuota(ctx, rep, c.pattern), "error deleting quota")
+}
+
+type commandServerUserQuotaResetUsage struct {
+	username string
+}
+
+func (c *commandServerUserQuotaResetUsage) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("reset-usage", "Reset recorded storage usage of a user, for example after deleting their snapshots")
+	cmd.Arg("username", "The username to reset, 'user@hostname'").Required().StringVar(&c.username)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandServerUserQuotaResetUsage) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if err := user.ResetUsage(ctx, rep, c.username); err != nil {
+		return errors.Wrap(err, "error resetting usage")
+	}
+
+	log(ctx).Infof("Reset usage of %v. To refresh the server, run 'kopia server refresh'.", c.username)
+
+	return nil
+}
+
+type commandServerUserQuotaList struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandServerUserQuotaList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List storage quotas and usage").Alias("ls")
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+type quotaListOutput struct {
+	Quotas []*quotaWithUsage `json:"quotas"`
+	Usage  []*user.Usage     `json:"usage"`
+}
+
+type quotaWithUsage struct {
+	*user.Quota
+
+	UsedBytes int64 `json:"usedBytes"`
+}
+
+func (c *commandServerUserQuotaList) run(ctx context.Context, rep repo.Repository) error {
+	quotas, err := user.ListQuotas(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing quotas")
+	}
+
+	usage, err := user.ListUsage(ctx, rep)
+	if err != nil {
+		return errors.Wrap(err, "error listing usage")
+	}
+
+	usageMap := map[string]*user.Usage{}
+	for _, u := range usage {
+		usageMap[u.Username] = u
+	}
+
+	result := quotaListOutput{Usage: append([]*user.Usage{}, usage...), Quotas: []*quotaWithUsage{}}
+
+	for _, q := range quotas {
+		result.Quotas = append(result.Quotas, &quotaWithUsage{q, user.QuotaUsage(q, usageMap)})
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(result))
+		return nil
+	}
+
+	for _, q := range result.Quotas {
+		c.out.printStdout("quota %v used:%v soft:%v hard:%v\n", q.Pattern, units.BytesString(q.UsedBytes), limitString(q.SoftLimitBytes), limitString(q.HardLimitBytes))
+	}
+
+	for _, u := range result.Usage {
+		c.out.printStdout("usage %v used:%v contents:%v updated:%v\n", u.Username, units.BytesString(u.PackedBytes), u.ContentCount, formatTimestamp(u.LastUpdated))
+	}
+
+	return nil
+}
+
+func limitString(v int64) string {
+	if v <= 0 {
+		return "none"
+	}
+
+	return units.BytesString(v)
+}
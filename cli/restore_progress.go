@@ -83,7 +83,8 @@ func (p *cliRestoreProgress) output(suffix string) {
 	}
 
 	var maybeRemaining, maybeSkipped, maybeErrors string
-	if est, ok := p.eta.Estimate(float64(restoredSize), float64(enqueuedSize)); ok {
+	// skipped files are not restored, so they are excluded when estimating throughput and remaining time.
+	if est, ok := p.eta.Estimate(float64(restoredSize), float64(enqueuedSize-skippedSize)); ok {
 		maybeRemaining = fmt.Sprintf(" %v (%.1f%%) remaining %v",
 			units.BytesPerSecondsString(est.SpeedPerSecond),
 			est.PercentComplete,
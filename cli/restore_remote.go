@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot/restore"
+)
+
+const (
+	restoreModeS3     = "s3"
+	restoreModeSFTP   = "sftp"
+	restoreModeWebDAV = "webdav"
+)
+
+// isRemoteRestoreTarget returns true if the target of the restore is not a local path.
+func isRemoteRestoreTarget(mode, target string) bool {
+	switch mode {
+	case restoreModeS3, restoreModeSFTP, restoreModeWebDAV:
+		return true
+	case restoreModeAuto:
+		return strings.HasPrefix(target, "s3://") || strings.HasPrefix(target, "sftp://")
+	default:
+		return false
+	}
+}
+
+// remoteRestoreFlags holds options for restoring directly into blob storage.
+type remoteRestoreFlags struct {
+	s3Endpoint        string
+	s3Region          string
+	s3AccessKeyID     string
+	s3SecretAccessKey string
+	s3SessionToken    string
+	s3DisableTLS      bool
+
+	sftpPassword       string
+	sftpKeyFile        string
+	sftpKnownHostsFile string
+
+	webdavUsername string
+	webdavPassword string
+}
+
+func (c *remoteRestoreFlags) setup(svc appServices, cmd *kingpin.CmdClause) {
+	cmd.Flag("s3-endpoint", "S3 endpoint to use when restoring to S3").Default("s3.amazonaws.com").StringVar(&c.s3Endpoint)
+	cmd.Flag("s3-region", "S3 region to use when restoring to S3").StringVar(&c.s3Region)
+	cmd.Flag("s3-access-key", "S3 access key ID (overrides AWS_ACCESS_KEY_ID environment variable)").Envar(svc.EnvName("AWS_ACCESS_KEY_ID")).StringVar(&c.s3AccessKeyID)
+	cmd.Flag("s3-secret-access-key", "S3 secret access key (overrides AWS_SECRET_ACCESS_KEY environment variable)").Envar(svc.EnvName("AWS_SECRET_ACCESS_KEY")).StringVar(&c.s3SecretAccessKey)
+	cmd.Flag("s3-session-token", "S3 session token (overrides AWS_SESSION_TOKEN environment variable)").Envar(svc.EnvName("AWS_SESSION_TOKEN")).StringVar(&c.s3SessionToken)
+	cmd.Flag("s3-disable-tls", "Disable TLS security (HTTPS) when restoring to S3").BoolVar(&c.s3DisableTLS)
+
+	cmd.Flag("sftp-password", "SFTP/SSH server password").Envar(svc.EnvName("KOPIA_SFTP_PASSWORD")).StringVar(&c.sftpPassword)
+	cmd.Flag("sftp-keyfile", "Path to private key file for SFTP/SSH server").StringVar(&c.sftpKeyFile)
+	cmd.Flag("sftp-known-hosts", "Path to known_hosts file for SFTP/SSH server").StringVar(&c.sftpKnownHostsFile)
+
+	cmd.Flag("webdav-username", "WebDAV username").Envar(svc.EnvName("KOPIA_WEBDAV_USERNAME")).StringVar(&c.webdavUsername)
+	cmd.Flag("webdav-password", "WebDAV password").Envar(svc.EnvName("KOPIA_WEBDAV_PASSWORD")).StringVar(&c.webdavPassword)
+}
+
+// connectionInfo returns the connection info of blob storage for the provided restore mode and target, which is:
+//
+//   - s3: [s3://]bucket[/prefix]
+//   - sftp: sftp://user@host[:port]/path
+//   - webdav: http[s]://host/path
+func (c *remoteRestoreFlags) connectionInfo(mode, target string) (blob.ConnectionInfo, error) {
+	var config map[string]any
+
+	switch mode {
+	case restoreModeS3:
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		if bucket == "" {
+			return blob.ConnectionInfo{}, errors.Errorf("invalid S3 target %q, expected s3://bucket/prefix", target)
+		}
+
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+
+		config = map[string]any{
+			"bucket":          bucket,
+			"prefix":          prefix,
+			"endpoint":        c.s3Endpoint,
+			"region":          c.s3Region,
+			"accessKeyID":     c.s3AccessKeyID,
+			"secretAccessKey": c.s3SecretAccessKey,
+			"sessionToken":    c.s3SessionToken,
+			"doNotUseTLS":     c.s3DisableTLS,
+		}
+
+	case restoreModeSFTP:
+		u, err := url.Parse(target)
+		if err != nil || u.Scheme != "sftp" || u.Host == "" || u.User == nil {
+			return blob.ConnectionInfo{}, errors.Errorf("invalid SFTP target %q, expected sftp://user@host[:port]/path", target)
+		}
+
+		port := 22 //nolint:mnd
+
+		if p := u.Port(); p != "" {
+			if port, err = strconv.Atoi(p); err != nil {
+				return blob.ConnectionInfo{}, errors.Errorf("invalid SFTP port: %v", p)
+			}
+		}
+
+		config = map[string]any{
+			"path":           u.Path,
+			"host":           u.Hostname(),
+			"port":           port,
+			"username":       u.User.Username(),
+			"password":       c.sftpPassword,
+			"keyfile":        c.sftpKeyFile,
+			"knownHostsFile": c.sftpKnownHostsFile,
+		}
+
+	case restoreModeWebDAV:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return blob.ConnectionInfo{}, errors.Errorf("invalid WebDAV target %q, expected http[s]://host/path", target)
+		}
+
+		config = map[string]any{
+			"url":      target,
+			"username": c.webdavUsername,
+			"password": c.webdavPassword,
+		}
+
+	default:
+		return blob.ConnectionInfo{}, errors.Errorf("unsupported remote restore mode: %v", mode)
+	}
+
+	b, err := json.Marshal(map[string]any{"type": mode, "config": config})
+	if err != nil {
+		return blob.ConnectionInfo{}, errors.Wrap(err, "unable to serialize storage configuration")
+	}
+
+	var ci blob.ConnectionInfo
+
+	if err := json.Unmarshal(b, &ci); err != nil {
+		return blob.ConnectionInfo{}, errors.Wrap(err, "unable to parse storage configuration")
+	}
+
+	return ci, nil
+}
+
+func (c *remoteRestoreFlags) output(ctx context.Context, mode, target string) (restore.Output, error) {
+	ci, err := c.connectionInfo(mode, target)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := blob.NewStorage(ctx, ci, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to %v", target)
+	}
+
+	return restore.NewBlobStorageOutput(st), nil
+}
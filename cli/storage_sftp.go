@@ -22,24 +22,8 @@ type storageSFTPFlags struct {
 
 func (c *storageSFTPFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClause) {
 	cmd.Flag("path", "Path to the repository in the SFTP/SSH server").Required().StringVar(&c.options.Path)
-	cmd.Flag("host", "SFTP/SSH server hostname").Required().StringVar(&c.options.Host)
-	cmd.Flag("port", "SFTP/SSH server port").Default("22").IntVar(&c.options.Port)
-	cmd.Flag("username", "SFTP/SSH server username").Required().StringVar(&c.options.Username)
 
-	// one of those 3 must be provided
-	cmd.Flag("sftp-password", "SFTP/SSH server password").StringVar(&c.options.Password)
-	cmd.Flag("keyfile", "path to private key file for SFTP/SSH server").StringVar(&c.options.Keyfile)
-	cmd.Flag("key-data", "private key data").StringVar(&c.options.KeyData)
-
-	// one of those 2 must be provided
-	cmd.Flag("known-hosts", "path to known_hosts file").StringVar(&c.options.KnownHostsFile)
-	cmd.Flag("known-hosts-data", "known_hosts file entries").StringVar(&c.options.KnownHostsData)
-
-	cmd.Flag("embed-credentials", "Embed key and known_hosts in Kopia configuration").BoolVar(&c.embedCredentials)
-
-	cmd.Flag("external", "Launch external passwordless SSH command").BoolVar(&c.options.ExternalSSH)
-	cmd.Flag("ssh-command", "SSH command").Default("ssh").StringVar(&c.options.SSHCommand)
-	cmd.Flag("ssh-args", "Arguments to external SSH command").StringVar(&c.options.SSHArguments)
+	setupSFTPConnectionFlags(cmd, &c.options, &c.embedCredentials)
 
 	cmd.Flag("flat", "Use flat directory structure").BoolVar(&c.connectFlat)
 	cmd.Flag("list-parallelism", "Set list parallelism").Hidden().IntVar(&c.options.ListParallelism)
@@ -50,65 +34,97 @@ func (c *storageSFTPFlags) Setup(_ StorageProviderServices, cmd *kingpin.CmdClau
 func (c *storageSFTPFlags) getOptions(formatVersion int) (*sftp.Options, error) {
 	sftpo := c.options
 
+	if err := resolveSFTPCredentials(&sftpo, c.embedCredentials); err != nil {
+		return nil, err
+	}
+
+	sftpo.DirectoryShards = initialDirectoryShards(c.connectFlat, formatVersion)
+
+	return &sftpo, nil
+}
+
+// setupSFTPConnectionFlags defines flags used to connect to the SFTP/SSH server.
+func setupSFTPConnectionFlags(cmd *kingpin.CmdClause, opt *sftp.Options, embedCredentials *bool) {
+	cmd.Flag("host", "SFTP/SSH server hostname").Required().StringVar(&opt.Host)
+	cmd.Flag("port", "SFTP/SSH server port").Default("22").IntVar(&opt.Port)
+	cmd.Flag("username", "SFTP/SSH server username").Required().StringVar(&opt.Username)
+
+	// one of those 3 must be provided
+	cmd.Flag("sftp-password", "SFTP/SSH server password").StringVar(&opt.Password)
+	cmd.Flag("keyfile", "path to private key file for SFTP/SSH server").StringVar(&opt.Keyfile)
+	cmd.Flag("key-data", "private key data").StringVar(&opt.KeyData)
+
+	// one of those 2 must be provided
+	cmd.Flag("known-hosts", "path to known_hosts file").StringVar(&opt.KnownHostsFile)
+	cmd.Flag("known-hosts-data", "known_hosts file entries").StringVar(&opt.KnownHostsData)
+
+	cmd.Flag("embed-credentials", "Embed key and known_hosts in Kopia configuration").BoolVar(embedCredentials)
+
+	cmd.Flag("external", "Launch external passwordless SSH command").BoolVar(&opt.ExternalSSH)
+	cmd.Flag("ssh-command", "SSH command").Default("ssh").StringVar(&opt.SSHCommand)
+	cmd.Flag("ssh-args", "Arguments to external SSH command").StringVar(&opt.SSHArguments)
+}
+
+// resolveSFTPCredentials ensures the key and known_hosts are provided, making file paths absolute
+// or embedding their contents.
+func resolveSFTPCredentials(opt *sftp.Options, embedCredentials bool) error {
 	//nolint:nestif
-	if !sftpo.ExternalSSH {
-		if c.embedCredentials {
-			if sftpo.KeyData == "" {
-				d, err := os.ReadFile(sftpo.Keyfile)
+	if !opt.ExternalSSH {
+		if embedCredentials {
+			if opt.KeyData == "" {
+				d, err := os.ReadFile(opt.Keyfile)
 				if err != nil {
-					return nil, errors.Wrap(err, "unable to read key file")
+					return errors.Wrap(err, "unable to read key file")
 				}
 
-				sftpo.KeyData = string(d)
-				sftpo.Keyfile = ""
+				opt.KeyData = string(d)
+				opt.Keyfile = ""
 			}
 
-			if sftpo.KnownHostsData == "" && sftpo.KnownHostsFile != "" {
-				d, err := os.ReadFile(sftpo.KnownHostsFile)
+			if opt.KnownHostsData == "" && opt.KnownHostsFile != "" {
+				d, err := os.ReadFile(opt.KnownHostsFile)
 				if err != nil {
-					return nil, errors.Wrap(err, "unable to read known hosts file")
+					return errors.Wrap(err, "unable to read known hosts file")
 				}
 
-				sftpo.KnownHostsData = string(d)
-				sftpo.KnownHostsFile = ""
+				opt.KnownHostsData = string(d)
+				opt.KnownHostsFile = ""
 			}
 		}
 
 		switch {
-		case sftpo.Password != "": // ok
+		case opt.Password != "": // ok
 
-		case sftpo.KeyData != "": // ok
+		case opt.KeyData != "": // ok
 
-		case sftpo.Keyfile != "":
-			a, err := filepath.Abs(sftpo.Keyfile)
+		case opt.Keyfile != "":
+			a, err := filepath.Abs(opt.Keyfile)
 			if err != nil {
-				return nil, errors.Wrap(err, "error getting absolute path")
+				return errors.Wrap(err, "error getting absolute path")
 			}
 
-			sftpo.Keyfile = a
+			opt.Keyfile = a
 
 		default:
-			return nil, errors.New("must provide either --sftp-password, --keyfile or --key-data")
+			return errors.New("must provide either --sftp-password, --keyfile or --key-data")
 		}
 
 		switch {
-		case sftpo.KnownHostsData != "": // ok
+		case opt.KnownHostsData != "": // ok
 
-		case sftpo.KnownHostsFile != "":
-			a, err := filepath.Abs(sftpo.KnownHostsFile)
+		case opt.KnownHostsFile != "":
+			a, err := filepath.Abs(opt.KnownHostsFile)
 			if err != nil {
-				return nil, errors.Wrap(err, "error getting absolute path")
+				return errors.Wrap(err, "error getting absolute path")
 			}
 
-			sftpo.KnownHostsFile = a
+			opt.KnownHostsFile = a
 		default:
-			return nil, errors.New("must provide either --known-hosts or --known-hosts-data")
+			return errors.New("must provide either --known-hosts or --known-hosts-data")
 		}
 	}
 
-	sftpo.DirectoryShards = initialDirectoryShards(c.connectFlat, formatVersion)
-
-	return &sftpo, nil
+	return nil
 }
 
 func (c *storageSFTPFlags) Connect(ctx context.Context, isCreate bool, formatVersion int) (blob.Storage, error) {
@@ -0,0 +1,180 @@
+// Package archivefs implements a read-only fs.Directory on top of tar and zip archives,
+// which allows snapshotting contents of archives without extracting them.
+package archivefs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("archivefs")
+
+// Options provides optional parameters for opening archives.
+type Options struct {
+	// DefaultModTime is the modification time of directories that are not explicitly present in the archive.
+	// Defaults to the modification time of the archive file.
+	DefaultModTime time.Time
+
+	// TempDir is the directory where compressed tar archives are decompressed to allow random access
+	// to their contents. Defaults to the system temporary directory.
+	TempDir string
+}
+
+// Archive is a file system tree read from an archive file.
+type Archive struct {
+	root     fs.Directory
+	f        *os.File
+	tempFile string
+}
+
+// Root returns the root directory of the archive.
+func (a *Archive) Root() fs.Directory {
+	return a.root
+}
+
+// Close releases resources associated with the archive. Entries of the archive can't be read afterwards.
+func (a *Archive) Close() error {
+	err := a.f.Close()
+
+	if a.tempFile != "" {
+		if rerr := os.Remove(a.tempFile); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+
+	return errors.Wrap(err, "error closing archive")
+}
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Open opens the archive file, which can be a zip file or tar file, optionally compressed using gzip or zstd,
+// and returns its contents as a file system tree.
+func Open(ctx context.Context, fname string, opt Options) (_ *Archive, err error) {
+	f, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open archive")
+	}
+
+	a := &Archive{f: f}
+
+	defer func() {
+		if err != nil {
+			a.Close() //nolint:errcheck
+		}
+	}()
+
+	st, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to stat archive")
+	}
+
+	if opt.DefaultModTime.IsZero() {
+		opt.DefaultModTime = st.ModTime()
+	}
+
+	header := make([]byte, len(zstdMagic))
+	if _, err := io.ReadFull(f, header); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "unable to read archive header")
+	}
+
+	b := newTreeBuilder(rootName(fname), opt.DefaultModTime)
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		err = indexZip(ctx, f, st.Size(), b)
+
+	case bytes.HasPrefix(header, gzipMagic), bytes.HasPrefix(header, zstdMagic):
+		var size int64
+
+		if size, err = a.decompressToTempFile(ctx, opt.TempDir, header); err == nil {
+			err = indexTar(ctx, a.f, size, b)
+		}
+
+	default:
+		err = indexTar(ctx, f, st.Size(), b)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.root = b.build()
+
+	return a, nil
+}
+
+// decompressToTempFile decompresses the archive into a temporary file, which replaces the archive file.
+func (a *Archive) decompressToTempFile(ctx context.Context, tempDir string, header []byte) (int64, error) {
+	if _, err := a.f.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "unable to seek archive")
+	}
+
+	var (
+		r   io.Reader
+		err error
+	)
+
+	if bytes.HasPrefix(header, gzipMagic) {
+		r, err = gzip.NewReader(a.f)
+	} else {
+		var zr *zstd.Decoder
+
+		zr, err = zstd.NewReader(a.f)
+		if err == nil {
+			defer zr.Close()
+		}
+
+		r = zr
+	}
+
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to decompress archive")
+	}
+
+	tf, err := os.CreateTemp(tempDir, "kopia-archive-*.tar")
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to create temporary file")
+	}
+
+	log(ctx).Debugf("decompressing %v to %v", a.f.Name(), tf.Name())
+
+	orig := a.f
+	defer orig.Close() //nolint:errcheck
+
+	a.f = tf
+	a.tempFile = tf.Name()
+
+	n, err := io.Copy(tf, r)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to decompress archive")
+	}
+
+	return n, nil
+}
+
+func rootName(fname string) string {
+	n := filepath.Base(fname)
+
+	for _, ext := range []string{".gz", ".tgz", ".zst", ".tar", ".zip"} {
+		if len(n) > len(ext) && filepath.Ext(n) == ext {
+			n = n[:len(n)-len(ext)]
+		}
+	}
+
+	return n
+}
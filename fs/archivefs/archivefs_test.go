@@ -0,0 +1,197 @@
+package archivefs_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/archivefs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+)
+
+var testModTime = time.Date(2015, 6, 1, 10, 20, 30, 0, time.UTC)
+
+func writeTestTar(t *testing.T, w io.Writer) {
+	t.Helper()
+
+	tw := tar.NewWriter(w)
+
+	for _, h := range []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{tar.Header{Name: "dir1/", Typeflag: tar.TypeDir, Mode: 0o750, ModTime: testModTime, Uid: 1000, Gid: 100}, ""},
+		{tar.Header{Name: "dir1/file1.txt", Typeflag: tar.TypeReg, Mode: 0o640, ModTime: testModTime, Uid: 1000, Gid: 100}, "hello world"},
+		{tar.Header{Name: "./implicit/sub/file2.txt", Typeflag: tar.TypeReg, Mode: 0o600, ModTime: testModTime}, "second file"},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir1/file1.txt", ModTime: testModTime, Mode: 0o777}, ""},
+		{tar.Header{Name: "hardlink.txt", Typeflag: tar.TypeLink, Linkname: "dir1/file1.txt", ModTime: testModTime, Mode: 0o640}, ""},
+		{tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, ModTime: testModTime, Mode: 0o640}, ""},
+	} {
+		hdr := h.hdr
+		hdr.Size = int64(len(h.data))
+
+		require.NoError(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(h.data))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+}
+
+func writeTestZip(t *testing.T, w io.Writer) {
+	t.Helper()
+
+	zw := zip.NewWriter(w)
+
+	for _, h := range []struct {
+		name   string
+		mode   os.FileMode
+		method uint16
+		data   string
+	}{
+		{"dir1/", os.ModeDir | 0o750, zip.Store, ""},
+		{"dir1/file1.txt", 0o640, zip.Deflate, "hello world"},
+		{"implicit/sub/file2.txt", 0o600, zip.Store, "second file"},
+		{"link", os.ModeSymlink | 0o777, zip.Store, "dir1/file1.txt"},
+	} {
+		fh := &zip.FileHeader{Name: h.name, Method: h.method, Modified: testModTime}
+		fh.SetMode(h.mode)
+
+		fw, err := zw.CreateHeader(fh)
+		require.NoError(t, err)
+
+		_, err = fw.Write([]byte(h.data))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, zw.Close())
+}
+
+func TestArchives(t *testing.T) {
+	cases := map[string]func(t *testing.T, w io.Writer){
+		"test.tar": writeTestTar,
+		"test.tar.gz": func(t *testing.T, w io.Writer) {
+			t.Helper()
+
+			gw := gzip.NewWriter(w)
+			writeTestTar(t, gw)
+			require.NoError(t, gw.Close())
+		},
+		"test.zip": writeTestZip,
+	}
+
+	for fname, write := range cases {
+		t.Run(fname, func(t *testing.T) {
+			ctx := testlogging.Context(t)
+			td := testutil.TempDirectory(t)
+
+			var buf bytes.Buffer
+
+			write(t, &buf)
+
+			fullName := filepath.Join(td, fname)
+			require.NoError(t, os.WriteFile(fullName, buf.Bytes(), 0o600))
+
+			a, err := archivefs.Open(ctx, fullName, archivefs.Options{TempDir: td})
+			require.NoError(t, err)
+
+			defer a.Close()
+
+			root := a.Root()
+			require.Equal(t, "test", root.Name())
+			require.True(t, root.IsDir())
+
+			d1 := mustChild(ctx, t, root, "dir1")
+			require.True(t, d1.IsDir())
+			require.Equal(t, os.ModeDir|0o750, d1.Mode())
+			require.True(t, d1.ModTime().Equal(testModTime))
+
+			f1 := mustChild(ctx, t, d1.(fs.Directory), "file1.txt")
+			require.Equal(t, os.FileMode(0o640), f1.Mode())
+			require.Equal(t, int64(11), f1.Size())
+			require.True(t, f1.ModTime().Equal(testModTime))
+			verifyFileContents(ctx, t, f1, "hello world")
+
+			// directories not present in the archive get default metadata
+			impl := mustChild(ctx, t, root, "implicit")
+			require.Equal(t, os.ModeDir|0o755, impl.Mode())
+
+			sub := mustChild(ctx, t, impl.(fs.Directory), "sub")
+			verifyFileContents(ctx, t, mustChild(ctx, t, sub.(fs.Directory), "file2.txt"), "second file")
+
+			l := mustChild(ctx, t, root, "link")
+			require.Equal(t, os.ModeSymlink, l.Mode()&os.ModeType)
+
+			target, err := l.(fs.Symlink).Readlink(ctx)
+			require.NoError(t, err)
+			require.Equal(t, "dir1/file1.txt", target)
+
+			if fname != "test.zip" {
+				require.Equal(t, fs.OwnerInfo{UserID: 1000, GroupID: 100}, f1.Owner())
+				verifyFileContents(ctx, t, mustChild(ctx, t, root, "hardlink.txt"), "hello world")
+
+				_, err = root.Child(ctx, "fifo")
+				require.ErrorIs(t, err, fs.ErrEntryNotFound)
+			}
+		})
+	}
+}
+
+func TestOpenInvalidArchive(t *testing.T) {
+	ctx := testlogging.Context(t)
+	td := testutil.TempDirectory(t)
+
+	fname := filepath.Join(td, "bad.zip")
+	require.NoError(t, os.WriteFile(fname, []byte("PK\x03\x04not really a zip file"), 0o600))
+
+	_, err := archivefs.Open(ctx, fname, archivefs.Options{})
+	require.Error(t, err)
+
+	_, err = archivefs.Open(ctx, filepath.Join(td, "no-such-file.tar"), archivefs.Options{})
+	require.Error(t, err)
+}
+
+func mustChild(ctx context.Context, t *testing.T, d fs.Directory, name string) fs.Entry {
+	t.Helper()
+
+	e, err := d.Child(ctx, name)
+	require.NoError(t, err)
+	require.Equal(t, name, e.Name())
+
+	return e
+}
+
+func verifyFileContents(ctx context.Context, t *testing.T, e fs.Entry, want string) {
+	t.Helper()
+
+	f, ok := e.(fs.File)
+	require.True(t, ok, "%v is not a file", e.Name())
+
+	r, err := f.Open(ctx)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+
+	// seek back and re-read the tail of the file
+	_, err = r.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+
+	got, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, want[6:], string(got))
+}
@@ -0,0 +1,90 @@
+package archivefs
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// forwardSeeker implements io.ReadSeeker on top of a stream that can only be read sequentially,
+// such as compressed archive member. Seeking backwards reopens the stream.
+type forwardSeeker struct {
+	open func() (io.Reader, io.Closer, error)
+	size int64
+
+	r   io.Reader
+	c   io.Closer
+	pos int64
+}
+
+func newForwardSeeker(size int64, open func() (io.Reader, io.Closer, error)) *forwardSeeker {
+	return &forwardSeeker{open: open, size: size}
+}
+
+func (s *forwardSeeker) ensureOpen() error {
+	if s.r != nil {
+		return nil
+	}
+
+	r, c, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	s.r, s.c, s.pos = r, c, 0
+
+	return nil
+}
+
+func (s *forwardSeeker) Read(p []byte) (int, error) {
+	if err := s.ensureOpen(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+
+	return n, err //nolint:wrapcheck
+}
+
+func (s *forwardSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+
+	if offset < s.pos {
+		if err := s.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := s.ensureOpen(); err != nil {
+		return 0, err
+	}
+
+	if _, err := io.CopyN(io.Discard, s, offset-s.pos); err != nil && !errors.Is(err, io.EOF) {
+		return 0, errors.Wrap(err, "seek error")
+	}
+
+	return offset, nil
+}
+
+func (s *forwardSeeker) Close() error {
+	c := s.c
+
+	s.r, s.c, s.pos = nil, nil, 0
+
+	if c == nil {
+		return nil
+	}
+
+	//nolint:wrapcheck
+	return c.Close()
+}
@@ -0,0 +1,108 @@
+package archivefs
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// indexTar adds members of the uncompressed tar archive to the tree. Contents of regular files are
+// read directly from the archive, sparse files are decoded by re-reading their headers.
+func indexTar(ctx context.Context, ra io.ReaderAt, size int64, b *treeBuilder) error {
+	sr := io.NewSectionReader(ra, 0, size)
+	tr := tar.NewReader(sr)
+
+	for idx := 0; ; idx++ {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "error reading tar archive")
+		}
+
+		e := archiveEntry{
+			mode:    hdr.FileInfo().Mode(),
+			modTime: hdr.ModTime,
+			owner: fs.OwnerInfo{
+				UserID:  uint32(hdr.Uid), //nolint:gosec
+				GroupID: uint32(hdr.Gid), //nolint:gosec
+			},
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			b.addDir(hdr.Name, e)
+
+		case tar.TypeReg, tar.TypeGNUSparse:
+			e.size = hdr.Size
+
+			if isSparse(hdr) {
+				b.addFile(hdr.Name, e, sparseTarMemberOpener(ra, size, idx, hdr.Size))
+				continue
+			}
+
+			offset, err := sr.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return errors.Wrap(err, "unable to determine offset in tar archive")
+			}
+
+			b.addFile(hdr.Name, e, func() (io.ReadSeeker, io.Closer, error) {
+				return io.NewSectionReader(ra, offset, hdr.Size), nil, nil
+			})
+
+		case tar.TypeSymlink:
+			b.addSymlink(hdr.Name, e, hdr.Linkname)
+
+		case tar.TypeLink:
+			if !b.addHardLink(hdr.Name, e, hdr.Linkname) {
+				log(ctx).Warnf("skipping hard link %v, target %v not found", hdr.Name, hdr.Linkname)
+			}
+
+		case tar.TypeXGlobalHeader:
+
+		default:
+			log(ctx).Warnf("skipping unsupported tar entry %v of type %q", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
+
+func isSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sparseTarMemberOpener returns a function that opens the sparse tar member with a given index,
+// whose contents are not stored contiguously in the archive.
+func sparseTarMemberOpener(ra io.ReaderAt, size int64, idx int, memberSize int64) openFunc {
+	return func() (io.ReadSeeker, io.Closer, error) {
+		fs := newForwardSeeker(memberSize, func() (io.Reader, io.Closer, error) {
+			tr := tar.NewReader(io.NewSectionReader(ra, 0, size))
+
+			for range idx + 1 {
+				if _, err := tr.Next(); err != nil {
+					return nil, nil, errors.Wrap(err, "error reading tar archive")
+				}
+			}
+
+			return tr, nil, nil
+		})
+
+		return fs, fs, nil
+	}
+}
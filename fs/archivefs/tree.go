@@ -0,0 +1,280 @@
+package archivefs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+const implicitDirMode = os.ModeDir | 0o755
+
+// archiveEntry is an implementation of fs.Entry describing an archive member.
+type archiveEntry struct {
+	name    string
+	mode    os.FileMode
+	size    int64
+	modTime time.Time
+	owner   fs.OwnerInfo
+}
+
+func (e *archiveEntry) Name() string {
+	return e.name
+}
+
+func (e *archiveEntry) IsDir() bool {
+	return e.mode.IsDir()
+}
+
+func (e *archiveEntry) Mode() os.FileMode {
+	return e.mode
+}
+
+func (e *archiveEntry) ModTime() time.Time {
+	return e.modTime
+}
+
+func (e *archiveEntry) Size() int64 {
+	return e.size
+}
+
+func (e *archiveEntry) Sys() any {
+	return nil
+}
+
+func (e *archiveEntry) Owner() fs.OwnerInfo {
+	return e.owner
+}
+
+func (e *archiveEntry) Device() fs.DeviceInfo {
+	return fs.DeviceInfo{}
+}
+
+func (e *archiveEntry) LocalFilesystemPath() string {
+	return ""
+}
+
+func (e *archiveEntry) Close() {
+}
+
+type archiveDirectory struct {
+	archiveEntry
+
+	entries []fs.Entry // sorted by name
+}
+
+func (d *archiveDirectory) Child(_ context.Context, name string) (fs.Entry, error) {
+	if e := fs.FindByName(d.entries, name); e != nil {
+		return e, nil
+	}
+
+	return nil, fs.ErrEntryNotFound
+}
+
+func (d *archiveDirectory) Iterate(_ context.Context) (fs.DirectoryIterator, error) {
+	return fs.StaticIterator(append([]fs.Entry{}, d.entries...), nil), nil
+}
+
+func (d *archiveDirectory) SupportsMultipleIterations() bool {
+	return true
+}
+
+// openFunc opens the contents of an archive member.
+type openFunc func() (io.ReadSeeker, io.Closer, error)
+
+type archiveFile struct {
+	archiveEntry
+
+	open openFunc
+}
+
+func (f *archiveFile) Open(_ context.Context) (fs.Reader, error) {
+	r, c, err := f.open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %v", f.name)
+	}
+
+	return &fileReader{r, c, f}, nil
+}
+
+type fileReader struct {
+	io.ReadSeeker
+
+	closer io.Closer
+	f      *archiveFile
+}
+
+func (r *fileReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+
+	//nolint:wrapcheck
+	return r.closer.Close()
+}
+
+func (r *fileReader) Entry() (fs.Entry, error) {
+	return r.f, nil
+}
+
+type archiveSymlink struct {
+	archiveEntry
+
+	target string
+}
+
+func (s *archiveSymlink) Readlink(_ context.Context) (string, error) {
+	return s.target, nil
+}
+
+func (s *archiveSymlink) Resolve(_ context.Context) (fs.Entry, error) {
+	return nil, errors.New("resolving symbolic links is not supported in archives")
+}
+
+// treeBuilder builds the directory tree from archive members, which can appear in any order.
+type treeBuilder struct {
+	defaultModTime time.Time
+	root           *dirNode
+	files          map[string]*archiveFile // by normalized path, used to resolve hard links
+}
+
+type dirNode struct {
+	archiveEntry
+
+	children map[string]any // *dirNode or fs.Entry
+}
+
+func newTreeBuilder(rootName string, defaultModTime time.Time) *treeBuilder {
+	return &treeBuilder{
+		defaultModTime: defaultModTime,
+		root: &dirNode{
+			archiveEntry: archiveEntry{name: rootName, mode: implicitDirMode, modTime: defaultModTime},
+			children:     map[string]any{},
+		},
+		files: map[string]*archiveFile{},
+	}
+}
+
+// normalizePath returns the cleaned relative path of an archive member or an empty string for the root.
+func normalizePath(p string) string {
+	p = path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+
+	return strings.TrimPrefix(p, "/")
+}
+
+// dir returns the directory node at a given normalized path, creating missing directories.
+// The root directory can be referred to by an empty path or ".".
+func (b *treeBuilder) dir(p string) *dirNode {
+	if p == "" || p == "." {
+		return b.root
+	}
+
+	parent := b.dir(path.Dir(p))
+	name := path.Base(p)
+
+	if d, ok := parent.children[name].(*dirNode); ok {
+		return d
+	}
+
+	// replaces any non-directory entry with the same name.
+	d := &dirNode{
+		archiveEntry: archiveEntry{name: name, mode: implicitDirMode, modTime: b.defaultModTime},
+		children:     map[string]any{},
+	}
+
+	parent.children[name] = d
+
+	return d
+}
+
+// addDir adds a directory with given metadata.
+func (b *treeBuilder) addDir(p string, e archiveEntry) {
+	if p = normalizePath(p); p == "" {
+		e.name = b.root.name
+		b.root.archiveEntry = e
+
+		return
+	}
+
+	d := b.dir(p)
+	e.name = d.name
+	d.archiveEntry = e
+}
+
+// add adds a non-directory entry at a given path, replacing any earlier entry with the same name.
+func (b *treeBuilder) add(p string, e fs.Entry) {
+	p = normalizePath(p)
+	if p == "" {
+		return
+	}
+
+	b.dir(path.Dir(p)).children[path.Base(p)] = e
+
+	if f, ok := e.(*archiveFile); ok {
+		b.files[p] = f
+	} else {
+		delete(b.files, p)
+	}
+}
+
+// addFile adds a regular file.
+func (b *treeBuilder) addFile(p string, e archiveEntry, open openFunc) {
+	e.name = path.Base(normalizePath(p))
+	b.add(p, &archiveFile{e, open})
+}
+
+// addSymlink adds a symbolic link.
+func (b *treeBuilder) addSymlink(p string, e archiveEntry, target string) {
+	e.name = path.Base(normalizePath(p))
+	e.size = int64(len(target))
+	b.add(p, &archiveSymlink{e, target})
+}
+
+// addHardLink adds a file sharing contents with an earlier file, returns false if the target can't be found.
+func (b *treeBuilder) addHardLink(p string, e archiveEntry, target string) bool {
+	f := b.files[normalizePath(target)]
+	if f == nil {
+		return false
+	}
+
+	e.name = path.Base(normalizePath(p))
+	e.size = f.size
+	b.add(p, &archiveFile{e, f.open})
+
+	return true
+}
+
+func (b *treeBuilder) build() fs.Directory {
+	return buildDir(b.root)
+}
+
+func buildDir(n *dirNode) *archiveDirectory {
+	d := &archiveDirectory{archiveEntry: n.archiveEntry}
+
+	for _, c := range n.children {
+		if cd, ok := c.(*dirNode); ok {
+			d.entries = append(d.entries, buildDir(cd))
+		} else {
+			d.entries = append(d.entries, c.(fs.Entry)) //nolint:forcetypeassert
+		}
+	}
+
+	sort.Slice(d.entries, func(i, j int) bool {
+		return d.entries[i].Name() < d.entries[j].Name()
+	})
+
+	return d
+}
+
+var (
+	_ fs.Directory = (*archiveDirectory)(nil)
+	_ fs.File      = (*archiveFile)(nil)
+	_ fs.Symlink   = (*archiveSymlink)(nil)
+)
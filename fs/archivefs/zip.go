@@ -0,0 +1,92 @@
+package archivefs
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// maxZipSymlinkTargetLength is the maximum length of symbolic link target stored in a zip file.
+const maxZipSymlinkTargetLength = 4096
+
+// indexZip adds members of the zip archive to the tree. Contents of stored (uncompressed) files
+// are read directly from the archive.
+func indexZip(ctx context.Context, ra io.ReaderAt, size int64, b *treeBuilder) error {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return errors.Wrap(err, "error reading zip archive")
+	}
+
+	for _, zf := range zr.File {
+		fi := zf.FileInfo()
+
+		e := archiveEntry{
+			mode:    fi.Mode(),
+			modTime: zf.Modified,
+		}
+
+		switch {
+		case fi.IsDir():
+			b.addDir(zf.Name, e)
+
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := readZipSymlink(zf)
+			if err != nil {
+				return err
+			}
+
+			b.addSymlink(zf.Name, e, target)
+
+		case fi.Mode().IsRegular():
+			e.size = int64(zf.UncompressedSize64) //nolint:gosec
+			b.addFile(zf.Name, e, zipMemberOpener(ra, zf))
+
+		default:
+			log(ctx).Warnf("skipping unsupported zip entry %v with mode %v", zf.Name, fi.Mode())
+		}
+	}
+
+	return nil
+}
+
+func readZipSymlink(zf *zip.File) (string, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to open %v", zf.Name)
+	}
+	defer r.Close() //nolint:errcheck
+
+	b, err := io.ReadAll(io.LimitReader(r, maxZipSymlinkTargetLength))
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read %v", zf.Name)
+	}
+
+	return string(b), nil
+}
+
+func zipMemberOpener(ra io.ReaderAt, zf *zip.File) openFunc {
+	return func() (io.ReadSeeker, io.Closer, error) {
+		if zf.Method == zip.Store {
+			offset, err := zf.DataOffset()
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "unable to determine data offset")
+			}
+
+			return io.NewSectionReader(ra, offset, int64(zf.UncompressedSize64)), nil, nil //nolint:gosec
+		}
+
+		fs := newForwardSeeker(int64(zf.UncompressedSize64), func() (io.Reader, io.Closer, error) { //nolint:gosec
+			r, err := zf.Open()
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "unable to open zip member")
+			}
+
+			return r, r, nil
+		})
+
+		return fs, fs, nil
+	}
+}
@@ -0,0 +1,258 @@
+// Package overlayfs implements a read-only fs.Directory that merges a lower directory (typically a snapshot)
+// with changes recorded in an upper directory on the local filesystem.
+//
+// Entries present in the upper directory shadow entries with the same name in the lower directory,
+// directories present in both are merged. Deletions of lower entries are recorded as empty whiteout files
+// named '.wh.<name>' and a directory containing '.wh..wh..opq' hides all lower entries, which are the same
+// conventions as used by OCI image layers.
+package overlayfs
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+)
+
+const (
+	// WhiteoutPrefix is the prefix of files in the upper directory that mark deleted lower entries.
+	WhiteoutPrefix = ".wh."
+
+	// OpaqueMarker is the name of file in the upper directory that hides all lower entries in that directory.
+	OpaqueMarker = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// WhiteoutName returns the name of whiteout file that marks the deletion of the entry with a given name.
+func WhiteoutName(name string) string {
+	return WhiteoutPrefix + name
+}
+
+// IsWhiteout determines whether the provided name is a whiteout or opaque marker.
+func IsWhiteout(name string) bool {
+	return strings.HasPrefix(name, WhiteoutPrefix)
+}
+
+// MergesLower returns true if the provided entry is a merged directory that has contents in the lower directory.
+func MergesLower(e fs.Entry) bool {
+	d, ok := e.(*overlayDirectory)
+
+	return ok && d.lower != nil
+}
+
+// LowerChild returns the entry of the lower directory with a given name that is visible in the merged directory
+// unless shadowed by the upper directory or nil if there's no such entry.
+func LowerChild(ctx context.Context, dir fs.Directory, name string) (fs.Entry, error) {
+	d, ok := dir.(*overlayDirectory)
+	if !ok {
+		return nil, errors.New("not an overlay directory")
+	}
+
+	return d.lowerChild(ctx, name)
+}
+
+// New returns a directory that merges the lower directory with the contents of the upper directory, which
+// does not need to exist.
+func New(ctx context.Context, lower fs.Directory, upperDir string) (fs.Directory, error) {
+	var upper fs.Directory
+
+	if _, err := os.Stat(upperDir); err == nil {
+		if upper, err = localfs.Directory(upperDir); err != nil {
+			return nil, errors.Wrap(err, "unable to open upper directory")
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "unable to stat upper directory")
+	}
+
+	return newDirectory(ctx, lower.Name(), lower, upper)
+}
+
+// overlayDirectory is a directory present in the lower directory, upper directory or both.
+type overlayDirectory struct {
+	fs.Entry // upper entry if present, lower otherwise
+
+	name   string
+	lower  fs.Directory // nil if not present or hidden
+	upper  fs.Directory // nil if not present
+	opaque bool
+}
+
+func newDirectory(ctx context.Context, name string, lower, upper fs.Directory) (*overlayDirectory, error) {
+	d := &overlayDirectory{name: name, lower: lower, upper: upper}
+
+	if upper == nil {
+		d.Entry = lower
+
+		return d, nil
+	}
+
+	d.Entry = upper
+
+	opq, err := childOrNil(ctx, upper, OpaqueMarker)
+	if err != nil {
+		return nil, err
+	}
+
+	if opq != nil {
+		d.opaque = true
+		d.lower = nil
+	}
+
+	return d, nil
+}
+
+func (d *overlayDirectory) Name() string {
+	return d.name
+}
+
+func (d *overlayDirectory) LocalFilesystemPath() string {
+	return ""
+}
+
+func (d *overlayDirectory) SupportsMultipleIterations() bool {
+	return true
+}
+
+func (d *overlayDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	if IsWhiteout(name) {
+		return nil, fs.ErrEntryNotFound
+	}
+
+	var u fs.Entry
+
+	if d.upper != nil {
+		var err error
+
+		if u, err = childOrNil(ctx, d.upper, name); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := d.lowerChild(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case u != nil:
+		return d.wrap(ctx, u, l)
+	case l != nil:
+		return d.wrap(ctx, nil, l)
+	default:
+		return nil, fs.ErrEntryNotFound
+	}
+}
+
+func (d *overlayDirectory) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	var (
+		entries []fs.Entry
+		seen    = map[string]bool{}
+	)
+
+	if d.upper != nil {
+		if err := fs.IterateEntries(ctx, d.upper, func(ctx context.Context, u fs.Entry) error {
+			if IsWhiteout(u.Name()) {
+				seen[strings.TrimPrefix(u.Name(), WhiteoutPrefix)] = true
+				return nil
+			}
+
+			seen[u.Name()] = true
+
+			l, err := d.lowerChild(ctx, u.Name())
+			if err != nil {
+				return err
+			}
+
+			e, err := d.wrap(ctx, u, l)
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, e)
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrap(err, "error reading upper directory")
+		}
+	}
+
+	if d.lower != nil {
+		if err := fs.IterateEntries(ctx, d.lower, func(ctx context.Context, l fs.Entry) error {
+			if seen[l.Name()] {
+				return nil
+			}
+
+			e, err := d.wrap(ctx, nil, l)
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, e)
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrap(err, "error reading lower directory")
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return fs.StaticIterator(entries, nil), nil
+}
+
+// lowerChild returns the lower entry with a given name unless it has been hidden by a whiteout.
+func (d *overlayDirectory) lowerChild(ctx context.Context, name string) (fs.Entry, error) {
+	if d.lower == nil {
+		return nil, nil
+	}
+
+	if d.upper != nil {
+		wh, err := childOrNil(ctx, d.upper, WhiteoutName(name))
+		if err != nil || wh != nil {
+			return nil, err
+		}
+	}
+
+	return childOrNil(ctx, d.lower, name)
+}
+
+// wrap returns the merged entry given upper and lower entries with the same name, either of which can be nil.
+func (d *overlayDirectory) wrap(ctx context.Context, u, l fs.Entry) (fs.Entry, error) {
+	if u != nil {
+		ud, ok := u.(fs.Directory)
+		if !ok {
+			return u, nil
+		}
+
+		ld, _ := l.(fs.Directory)
+
+		return newDirectory(ctx, u.Name(), ld, ud)
+	}
+
+	if ld, ok := l.(fs.Directory); ok {
+		return newDirectory(ctx, l.Name(), ld, nil)
+	}
+
+	return l, nil
+}
+
+func childOrNil(ctx context.Context, d fs.Directory, name string) (fs.Entry, error) {
+	e, err := d.Child(ctx, name)
+	if errors.Is(err, fs.ErrEntryNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get %v", name)
+	}
+
+	return e, nil
+}
+
+var _ fs.Directory = (*overlayDirectory)(nil)
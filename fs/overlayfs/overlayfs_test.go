@@ -0,0 +1,144 @@
+package overlayfs_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/overlayfs"
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+)
+
+func newLower() *mockfs.Directory {
+	lower := mockfs.NewDirectory()
+	lower.AddFile("unchanged", []byte("unchanged"), 0o644)
+	lower.AddFile("modified", []byte("original"), 0o644)
+	lower.AddFile("deleted", []byte("deleted"), 0o644)
+	lower.AddDir("merged", 0o755)
+	lower.AddFile("merged/lower-file", []byte("lower"), 0o644)
+	lower.AddDir("replaced", 0o755)
+	lower.AddFile("replaced/hidden", []byte("hidden"), 0o644)
+	lower.AddDir("deleted-dir", 0o755)
+
+	return lower
+}
+
+func TestOverlay(t *testing.T) {
+	ctx := testlogging.Context(t)
+	upper := testutil.TempDirectory(t)
+
+	mustWriteFile(t, filepath.Join(upper, "modified"), "modified contents")
+	mustWriteFile(t, filepath.Join(upper, "added"), "added")
+	mustWriteFile(t, filepath.Join(upper, overlayfs.WhiteoutName("deleted")), "")
+	mustWriteFile(t, filepath.Join(upper, overlayfs.WhiteoutName("deleted-dir")), "")
+	require.NoError(t, os.Mkdir(filepath.Join(upper, "merged"), 0o755))
+	mustWriteFile(t, filepath.Join(upper, "merged", "upper-file"), "upper")
+	require.NoError(t, os.Mkdir(filepath.Join(upper, "replaced"), 0o755))
+	mustWriteFile(t, filepath.Join(upper, "replaced", overlayfs.OpaqueMarker), "")
+	mustWriteFile(t, filepath.Join(upper, "replaced", "new"), "new")
+
+	root, err := overlayfs.New(ctx, newLower(), upper)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"added", "merged", "modified", "replaced", "unchanged"}, entryNames(ctx, t, root))
+
+	verifyContents(ctx, t, root, "unchanged", "unchanged")
+	verifyContents(ctx, t, root, "modified", "modified contents")
+	verifyContents(ctx, t, root, "added", "added")
+
+	for _, n := range []string{"deleted", "deleted-dir", overlayfs.WhiteoutName("deleted")} {
+		_, err = root.Child(ctx, n)
+		require.ErrorIs(t, err, fs.ErrEntryNotFound, n)
+	}
+
+	merged := mustDir(ctx, t, root, "merged")
+	require.True(t, overlayfs.MergesLower(merged))
+	require.Equal(t, []string{"lower-file", "upper-file"}, entryNames(ctx, t, merged))
+	verifyContents(ctx, t, merged, "lower-file", "lower")
+
+	replaced := mustDir(ctx, t, root, "replaced")
+	require.False(t, overlayfs.MergesLower(replaced))
+	require.Equal(t, []string{"new"}, entryNames(ctx, t, replaced))
+
+	_, err = replaced.Child(ctx, "hidden")
+	require.ErrorIs(t, err, fs.ErrEntryNotFound)
+
+	l, err := overlayfs.LowerChild(ctx, root, "modified")
+	require.NoError(t, err)
+	require.NotNil(t, l)
+
+	l, err = overlayfs.LowerChild(ctx, root, "deleted")
+	require.NoError(t, err)
+	require.Nil(t, l)
+}
+
+func TestOverlayWithoutUpperDirectory(t *testing.T) {
+	ctx := testlogging.Context(t)
+	lower := newLower()
+
+	root, err := overlayfs.New(ctx, lower, filepath.Join(testutil.TempDirectory(t), "no-such-dir"))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"deleted", "deleted-dir", "merged", "modified", "replaced", "unchanged"}, entryNames(ctx, t, root))
+	require.Equal(t, lower.Mode(), root.Mode())
+	require.True(t, root.ModTime().Equal(lower.ModTime()))
+}
+
+func mustWriteFile(t *testing.T, fname, contents string) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(fname, []byte(contents), 0o600))
+	require.NoError(t, os.Chtimes(fname, time.Now(), time.Now()))
+}
+
+func mustDir(ctx context.Context, t *testing.T, d fs.Directory, name string) fs.Directory {
+	t.Helper()
+
+	e, err := d.Child(ctx, name)
+	require.NoError(t, err)
+
+	dir, ok := e.(fs.Directory)
+	require.True(t, ok, "%v is not a directory", name)
+	require.Equal(t, name, dir.Name())
+
+	return dir
+}
+
+func entryNames(ctx context.Context, t *testing.T, d fs.Directory) []string {
+	t.Helper()
+
+	entries, err := fs.GetAllEntries(ctx, d)
+	require.NoError(t, err)
+
+	var names []string
+
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names
+}
+
+func verifyContents(ctx context.Context, t *testing.T, d fs.Directory, name, want string) {
+	t.Helper()
+
+	e, err := d.Child(ctx, name)
+	require.NoError(t, err)
+
+	r, err := e.(fs.File).Open(ctx) //nolint:forcetypeassert
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, want, string(got))
+}
@@ -0,0 +1,203 @@
+// Package sftpfs implements a read-only fs.Directory on top of an SFTP connection,
+// which allows snapshotting remote hosts without running kopia on them.
+package sftpfs
+
+import (
+	"context"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// sftpEntry is an implementation of fs.Entry describing a file on the SFTP server.
+type sftpEntry struct {
+	os.FileInfo
+
+	client   *sftp.Client
+	fullPath string
+}
+
+func (e *sftpEntry) Owner() fs.OwnerInfo {
+	if st, ok := e.Sys().(*sftp.FileStat); ok {
+		return fs.OwnerInfo{UserID: st.UID, GroupID: st.GID}
+	}
+
+	return fs.OwnerInfo{}
+}
+
+func (e *sftpEntry) Device() fs.DeviceInfo {
+	return fs.DeviceInfo{}
+}
+
+func (e *sftpEntry) LocalFilesystemPath() string {
+	return ""
+}
+
+func (e *sftpEntry) Close() {
+}
+
+type sftpDirectory struct {
+	sftpEntry
+}
+
+func (d *sftpDirectory) Size() int64 {
+	// force directory size to always be zero, same as local filesystem.
+	return 0
+}
+
+func (d *sftpDirectory) SupportsMultipleIterations() bool {
+	return true
+}
+
+func (d *sftpDirectory) Child(_ context.Context, name string) (fs.Entry, error) {
+	fullPath := path.Join(d.fullPath, name)
+
+	fi, err := d.client.Lstat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fs.ErrEntryNotFound
+		}
+
+		return nil, errors.Wrapf(err, "unable to get child %q", fullPath)
+	}
+
+	return newEntry(d.client, fullPath, fi), nil
+}
+
+func (d *sftpDirectory) Iterate(_ context.Context) (fs.DirectoryIterator, error) {
+	infos, err := d.client.ReadDir(d.fullPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read directory %q", d.fullPath)
+	}
+
+	entries := make([]fs.Entry, 0, len(infos))
+
+	for _, fi := range infos {
+		entries = append(entries, newEntry(d.client, path.Join(d.fullPath, fi.Name()), fi))
+	}
+
+	return fs.StaticIterator(entries, nil), nil
+}
+
+type sftpFile struct {
+	sftpEntry
+}
+
+func (f *sftpFile) Open(_ context.Context) (fs.Reader, error) {
+	r, err := f.client.Open(f.fullPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %q", f.fullPath)
+	}
+
+	return &sftpReader{r, f}, nil
+}
+
+type sftpReader struct {
+	*sftp.File
+
+	f *sftpFile
+}
+
+func (r *sftpReader) Entry() (fs.Entry, error) {
+	fi, err := r.Stat()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to stat %q", r.f.fullPath)
+	}
+
+	return newEntry(r.f.client, r.f.fullPath, fi), nil
+}
+
+type sftpSymlink struct {
+	sftpEntry
+}
+
+func (s *sftpSymlink) Readlink(_ context.Context) (string, error) {
+	target, err := s.client.ReadLink(s.fullPath)
+
+	return target, errors.Wrapf(err, "unable to read link %q", s.fullPath)
+}
+
+func (s *sftpSymlink) Resolve(ctx context.Context) (fs.Entry, error) {
+	target, err := s.Readlink(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(s.fullPath), target)
+	}
+
+	fi, err := s.client.Stat(target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot resolve symlink for %q", s.fullPath)
+	}
+
+	return newEntry(s.client, target, fi), nil
+}
+
+type sftpErrorEntry struct {
+	sftpEntry
+
+	err error
+}
+
+func (e *sftpErrorEntry) ErrorInfo() error {
+	return e.err
+}
+
+func newEntry(client *sftp.Client, fullPath string, fi os.FileInfo) fs.Entry {
+	e := sftpEntry{fi, client, fullPath}
+
+	switch fi.Mode() & os.ModeType {
+	case os.ModeDir:
+		return &sftpDirectory{e}
+
+	case os.ModeSymlink:
+		return &sftpSymlink{e}
+
+	case 0:
+		return &sftpFile{e}
+
+	default:
+		return &sftpErrorEntry{e, fs.ErrUnknown}
+	}
+}
+
+// NewEntry returns fs.Entry for the specified path on the SFTP server.
+// The entry and all its descendants can only be accessed while the client remains open.
+func NewEntry(client *sftp.Client, fullPath string) (fs.Entry, error) {
+	fullPath = path.Clean(fullPath)
+
+	fi, err := client.Lstat(fullPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to determine entry type of %q", fullPath)
+	}
+
+	return newEntry(client, fullPath, fi), nil
+}
+
+// Directory returns fs.Directory for the specified path on the SFTP server.
+func Directory(client *sftp.Client, fullPath string) (fs.Directory, error) {
+	e, err := NewEntry(client, fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	d, ok := e.(fs.Directory)
+	if !ok {
+		return nil, errors.Errorf("not a directory: %v", fullPath)
+	}
+
+	return d, nil
+}
+
+var (
+	_ fs.Directory  = (*sftpDirectory)(nil)
+	_ fs.File       = (*sftpFile)(nil)
+	_ fs.Symlink    = (*sftpSymlink)(nil)
+	_ fs.ErrorEntry = (*sftpErrorEntry)(nil)
+)
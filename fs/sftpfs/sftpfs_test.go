@@ -0,0 +1,116 @@
+package sftpfs_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/sftpfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+)
+
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// newTestClient returns SFTP client connected to an in-process server exposing the local filesystem.
+func newTestClient(t *testing.T) *sftp.Client {
+	t.Helper()
+
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+
+	srv, err := sftp.NewServer(pipeConn{serverReader, serverWriter}, sftp.ReadOnly())
+	require.NoError(t, err)
+
+	go srv.Serve() //nolint:errcheck
+
+	cli, err := sftp.NewClientPipe(clientReader, clientWriter)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		// closing the server ends the client session.
+		srv.Close()
+		cli.Close()
+	})
+
+	return cli
+}
+
+func TestSFTPDirectory(t *testing.T) {
+	ctx := testlogging.Context(t)
+	td := testutil.TempDirectory(t)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(td, "dir1", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(td, "dir1", "file1.txt"), []byte("hello world"), 0o640))
+	require.NoError(t, os.WriteFile(filepath.Join(td, "file2.txt"), []byte("second file"), 0o600))
+	require.NoError(t, os.Symlink("dir1/file1.txt", filepath.Join(td, "link")))
+
+	cli := newTestClient(t)
+
+	root, err := sftpfs.Directory(cli, td)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Base(td), root.Name())
+	require.True(t, root.IsDir())
+	require.Empty(t, root.LocalFilesystemPath())
+
+	entries, err := fs.GetAllEntries(ctx, root)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	require.ElementsMatch(t, []string{"dir1", "file2.txt", "link"}, names)
+
+	dir1, err := root.Child(ctx, "dir1")
+	require.NoError(t, err)
+	require.Implements(t, (*fs.Directory)(nil), dir1)
+	require.Equal(t, int64(0), dir1.Size())
+
+	f, err := dir1.(fs.Directory).Child(ctx, "file1.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), f.Size())
+	require.Equal(t, os.FileMode(0o640), f.Mode().Perm())
+	require.Equal(t, uint32(os.Getuid()), f.Owner().UserID) //nolint:gosec
+
+	r, err := f.(fs.File).Open(ctx)
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+
+	re, err := r.Entry()
+	require.NoError(t, err)
+	require.Equal(t, "file1.txt", re.Name())
+	require.NoError(t, r.Close())
+
+	link, err := root.Child(ctx, "link")
+	require.NoError(t, err)
+
+	target, err := link.(fs.Symlink).Readlink(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "dir1/file1.txt", target)
+
+	resolved, err := link.(fs.Symlink).Resolve(ctx)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), resolved.Size())
+
+	_, err = root.Child(ctx, "no-such-file")
+	require.ErrorIs(t, err, fs.ErrEntryNotFound)
+
+	_, err = sftpfs.Directory(cli, filepath.Join(td, "file2.txt"))
+	require.Error(t, err)
+
+	_, err = sftpfs.NewEntry(cli, filepath.Join(td, "no-such-file"))
+	require.Error(t, err)
+}
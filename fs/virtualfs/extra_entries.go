@@ -0,0 +1,102 @@
+package virtualfs
+
+import (
+	"context"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// directoryWithExtraEntries is a fs.Directory that lists the entries of the wrapped directory
+// followed by additional virtual entries.
+type directoryWithExtraEntries struct {
+	fs.Directory
+	extra []fs.Entry
+}
+
+func (d *directoryWithExtraEntries) extraEntry(name string) fs.Entry {
+	for _, e := range d.extra {
+		if e.Name() == name {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (d *directoryWithExtraEntries) Child(ctx context.Context, name string) (fs.Entry, error) {
+	if e := d.extraEntry(name); e != nil {
+		return e, nil
+	}
+
+	//nolint:wrapcheck
+	return d.Directory.Child(ctx, name)
+}
+
+func (d *directoryWithExtraEntries) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	inner, err := d.Directory.Iterate(ctx)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	return &extraEntriesIterator{d: d, inner: inner}, nil
+}
+
+type extraEntriesIterator struct {
+	d         *directoryWithExtraEntries
+	inner     fs.DirectoryIterator
+	nextExtra int
+}
+
+func (it *extraEntriesIterator) Next(ctx context.Context) (fs.Entry, error) {
+	if it.inner != nil {
+		for {
+			e, err := it.inner.Next(ctx)
+			if err != nil {
+				//nolint:wrapcheck
+				return nil, err
+			}
+
+			if e == nil {
+				it.inner.Close()
+				it.inner = nil
+
+				break
+			}
+
+			// extra entries shadow entries with the same name.
+			if it.d.extraEntry(e.Name()) == nil {
+				return e, nil
+			}
+		}
+	}
+
+	if it.nextExtra < len(it.d.extra) {
+		e := it.d.extra[it.nextExtra]
+		it.nextExtra++
+
+		return e, nil
+	}
+
+	return nil, nil
+}
+
+func (it *extraEntriesIterator) Close() {
+	if it.inner != nil {
+		it.inner.Close()
+		it.inner = nil
+	}
+}
+
+// NewDirectoryWithExtraEntries returns a directory that has the same metadata and entries as the
+// provided directory, with the addition of the provided extra entries. Extra entries take precedence
+// over entries of the provided directory with the same name.
+func NewDirectoryWithExtraEntries(dir fs.Directory, extra []fs.Entry) fs.Directory {
+	if len(extra) == 0 {
+		return dir
+	}
+
+	return &directoryWithExtraEntries{dir, extra}
+}
+
+var _ fs.Directory = &directoryWithExtraEntries{}
@@ -0,0 +1,122 @@
+package virtualfs
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// EntryLookupFunc returns the entry at the provided slash-separated path relative to the root
+// of the tree being built. An empty path denotes the root itself.
+type EntryLookupFunc func(ctx context.Context, relPath string) (fs.Entry, error)
+
+// pathTreeNode represents a directory on the way to one or more selected paths.
+type pathTreeNode struct {
+	selected bool
+	children map[string]*pathTreeNode
+}
+
+func (n *pathTreeNode) child(name string) *pathTreeNode {
+	if n.children == nil {
+		n.children = map[string]*pathTreeNode{}
+	}
+
+	c := n.children[name]
+	if c == nil {
+		c = &pathTreeNode{}
+		n.children[name] = c
+	}
+
+	return c
+}
+
+// NewDirectoryFromPaths returns a directory that contains only the provided paths (slash-separated,
+// relative to the root) together with the parent directories needed to reach them.
+//
+// Selected paths are returned by lookup unchanged, so a selected directory includes its entire subtree.
+// Intermediate directories preserve the metadata (mode, modification time, owner) of the entries
+// returned by lookup, but list only the selected children.
+func NewDirectoryFromPaths(ctx context.Context, relPaths []string, lookup EntryLookupFunc) (fs.Directory, error) {
+	root := &pathTreeNode{}
+
+	for _, p := range relPaths {
+		cleaned := path.Clean(p)
+		if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return nil, errors.Errorf("invalid path %q, must be relative to the root", p)
+		}
+
+		if cleaned == "." {
+			root.selected = true
+			continue
+		}
+
+		n := root
+		for _, part := range strings.Split(cleaned, "/") {
+			n = n.child(part)
+		}
+
+		n.selected = true
+	}
+
+	e, err := buildPathTree(ctx, root, "", lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return nil, errors.New("root is not a directory")
+	}
+
+	return dir, nil
+}
+
+func buildPathTree(ctx context.Context, n *pathTreeNode, relPath string, lookup EntryLookupFunc) (fs.Entry, error) {
+	e, err := lookup(ctx, relPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get entry for %q", relPath)
+	}
+
+	if n.selected {
+		return e, nil
+	}
+
+	if !e.IsDir() {
+		return nil, errors.Errorf("%q is not a directory", relPath)
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var entries []fs.Entry
+
+	for _, name := range names {
+		ce, err := buildPathTree(ctx, n.children[name], path.Join(relPath, name), lookup)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, ce)
+	}
+
+	return &staticDirectory{
+		virtualEntry: virtualEntry{
+			name:    e.Name(),
+			mode:    e.Mode(),
+			size:    e.Size(),
+			modTime: e.ModTime(),
+			owner:   e.Owner(),
+			device:  e.Device(),
+		},
+		entries: entries,
+	}, nil
+}
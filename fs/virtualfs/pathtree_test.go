@@ -0,0 +1,99 @@
+package virtualfs
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func mockLookup(root *mockfs.Directory) EntryLookupFunc {
+	return func(ctx context.Context, relPath string) (fs.Entry, error) {
+		var e fs.Entry = root
+
+		if relPath == "" {
+			return e, nil
+		}
+
+		for _, part := range strings.Split(relPath, "/") {
+			d, ok := e.(fs.Directory)
+			if !ok {
+				return nil, fs.ErrEntryNotFound
+			}
+
+			c, err := d.Child(ctx, part)
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			e = c
+		}
+
+		return e, nil
+	}
+}
+
+func listNames(t *testing.T, d fs.Directory) []string {
+	t.Helper()
+
+	entries, err := fs.GetAllEntries(testlogging.Context(t), d)
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names
+}
+
+func TestNewDirectoryFromPaths(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	root := mockfs.NewDirectory()
+	a := root.AddDir("a", 0o750)
+	a.AddFile("f1", []byte{1}, 0o640)
+	a.AddFile("f2", []byte{2}, 0o640)
+	b := a.AddDir("b", 0o700)
+	b.AddFile("f3", []byte{3}, 0o600)
+	root.AddDir("c", 0o755).AddFile("f4", []byte{4}, 0o644)
+	root.AddFile("f5", []byte{5}, 0o644)
+
+	d, err := NewDirectoryFromPaths(ctx, []string{"a/f2", "./c", "a/b/f3"}, mockLookup(root))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"a", "c"}, listNames(t, d))
+
+	ae, err := d.Child(ctx, "a")
+	require.NoError(t, err)
+
+	// intermediate directory preserves metadata but lists only the selected children.
+	require.Equal(t, a.Mode(), ae.Mode())
+	require.Equal(t, []string{"b", "f2"}, listNames(t, ae.(fs.Directory)))
+
+	// selected directory is included with its full contents.
+	ce, err := d.Child(ctx, "c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"f4"}, listNames(t, ce.(fs.Directory)))
+}
+
+func TestNewDirectoryFromPaths_Errors(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	root := mockfs.NewDirectory()
+	root.AddFile("f1", []byte{1}, 0o644)
+
+	_, err := NewDirectoryFromPaths(ctx, []string{"../outside"}, mockLookup(root))
+	require.ErrorContains(t, err, "must be relative")
+
+	_, err = NewDirectoryFromPaths(ctx, []string{"missing"}, mockLookup(root))
+	require.ErrorIs(t, err, fs.ErrEntryNotFound)
+
+	_, err = NewDirectoryFromPaths(ctx, []string{"f1/nested"}, mockLookup(root))
+	require.ErrorContains(t, err, "not a directory")
+}
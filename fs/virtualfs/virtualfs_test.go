@@ -200,3 +200,35 @@ func TestStreamingDirectory_ReturnsCallbackError(t *testing.T) {
 	})
 	require.ErrorIs(t, err, errCallback)
 }
+
+func TestDirectoryWithExtraEntries(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	base := NewStaticDirectory("root", []fs.Entry{
+		NewStaticDirectory("a", nil),
+		StreamingFileFromReader("b", io.NopCloser(bytes.NewReader(nil))),
+	})
+
+	extraB := StreamingFileFromReader("b", io.NopCloser(bytes.NewReader([]byte("extra"))))
+	extraC := StreamingFileFromReader("c", io.NopCloser(bytes.NewReader(nil)))
+
+	d := NewDirectoryWithExtraEntries(base, []fs.Entry{extraB, extraC})
+	require.Equal(t, "root", d.Name())
+
+	entries, err := fs.GetAllEntries(ctx, d)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, "a", entries[0].Name())
+	require.Same(t, extraB, entries[1])
+	require.Same(t, extraC, entries[2])
+
+	e, err := d.Child(ctx, "b")
+	require.NoError(t, err)
+	require.Same(t, extraB, e)
+
+	e, err = d.Child(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, "a", e.Name())
+
+	require.Same(t, base, NewDirectoryWithExtraEntries(base, nil))
+}
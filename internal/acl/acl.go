@@ -24,6 +24,9 @@
 	OwnHost = "OWN_HOST"
 )
 
+// GroupPrefix is the prefix of Entry.User which grants access to members of a named user group.
+const GroupPrefix = "group:"
+
 // TargetRule specifies a list of key and values that must match labels on the target manifest.
 // The value can have two special placeholders - OWN_USER and OWN_VALUE representing the matched user
 // and host respectively if wildcards are being used.
@@ -65,7 +68,7 @@ func (r TargetRule) matches(target map[string]string, username, hostname string)
 // user certain level of access to a target.
 type Entry struct {
 	ManifestID manifest.ID `json:"-"`
-	User       string      `json:"user"`   // supports wildcards such as "*@*", "user@host", "*@host, user@*"
+	User       string      `json:"user"`   // supports wildcards such as "*@*", "user@host", "*@host, user@*" or "group:name"
 	Target     TargetRule  `json:"target"` // supports OwnUser and OwnHost in labels
 	Access     AccessLevel `json:"access,omitempty"`
 }
@@ -121,9 +124,12 @@ func (e *Entry) Validate() error {
 		return errors.New("nil acl")
 	}
 
-	parts := strings.Split(e.User, "@")
-	if len(parts) != 2 { //nolint:mnd
-		return errors.New("user must be 'username@hostname' possibly including wildcards")
+	if group, ok := strings.CutPrefix(e.User, GroupPrefix); ok {
+		if err := user.ValidateGroupName(group); err != nil {
+			return errors.Wrap(err, "invalid group")
+		}
+	} else if parts := strings.Split(e.User, "@"); len(parts) != 2 { //nolint:mnd
+		return errors.New("user must be 'username@hostname' possibly including wildcards or 'group:name'")
 	}
 
 	typ := e.Target[manifest.TypeLabelKey]
@@ -4,6 +4,7 @@
 import (
 	"context"
 	"maps"
+	"slices"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -24,7 +25,11 @@ func matchOrWildcard(rule, actual string) bool {
 	return rule == actual
 }
 
-func userMatches(rule, username, hostname string) bool {
+func userMatches(rule, username, hostname string, groups []string) bool {
+	if group, ok := strings.CutPrefix(rule, GroupPrefix); ok {
+		return slices.Contains(groups, group)
+	}
+
 	ruleParts := strings.Split(rule, "@")
 	if len(ruleParts) != 2 { //nolint:mnd
 		return false
@@ -35,10 +40,15 @@ func userMatches(rule, username, hostname string) bool {
 
 // EntriesForUser computes the list of ACL entries matching the given user.
 func EntriesForUser(entries []*Entry, username, hostname string) []*Entry {
+	return EntriesForUserInGroups(entries, username, hostname, nil)
+}
+
+// EntriesForUserInGroups computes the list of ACL entries matching the given user, who is a member of the provided groups.
+func EntriesForUserInGroups(entries []*Entry, username, hostname string, groups []string) []*Entry {
 	result := []*Entry{}
 
 	for _, e := range entries {
-		if userMatches(e.User, username, hostname) {
+		if userMatches(e.User, username, hostname, groups) {
 			result = append(result, e)
 		}
 	}
@@ -49,10 +59,16 @@ func EntriesForUser(entries []*Entry, username, hostname string) []*Entry {
 // EffectivePermissions computes the effective access level for a given user@hostname to subject
 // for a given set of ACL Entries.
 func EffectivePermissions(username, hostname string, target map[string]string, entries []*Entry) AccessLevel {
+	return EffectivePermissionsInGroups(username, hostname, nil, target, entries)
+}
+
+// EffectivePermissionsInGroups computes the effective access level for a given user@hostname, who is a member
+// of the provided groups, to subject for a given set of ACL Entries.
+func EffectivePermissionsInGroups(username, hostname string, groups []string, target map[string]string, entries []*Entry) AccessLevel {
 	highest := AccessLevelNone
 
 	for _, e := range entries {
-		if !userMatches(e.User, username, hostname) {
+		if !userMatches(e.User, username, hostname, groups) {
 			continue
 		}
 
@@ -149,6 +149,45 @@ func TestEffectivePermissions(t *testing.T) {
 	}
 }
 
+func TestEffectivePermissionsInGroups(t *testing.T) {
+	entries := []*acl.Entry{
+		{
+			User:   "group:ops",
+			Target: acl.TargetRule{manifest.TypeLabelKey: snapshot.ManifestType},
+			Access: acl.AccessLevelRead,
+		},
+		{
+			User:   "group:admins",
+			Target: acl.TargetRule{manifest.TypeLabelKey: policy.ManifestType},
+			Access: acl.AccessLevelFull,
+		},
+	}
+
+	snapshotTarget := map[string]string{manifest.TypeLabelKey: snapshot.ManifestType}
+	policyTarget := map[string]string{manifest.TypeLabelKey: policy.ManifestType}
+
+	cases := []struct {
+		groups       []string
+		wantSnapshot acl.AccessLevel
+		wantPolicy   acl.AccessLevel
+		wantEntries  int
+	}{
+		{nil, acl.AccessLevelNone, acl.AccessLevelNone, 0},
+		{[]string{"other"}, acl.AccessLevelNone, acl.AccessLevelNone, 0},
+		{[]string{"ops"}, acl.AccessLevelRead, acl.AccessLevelNone, 1},
+		{[]string{"admins", "ops"}, acl.AccessLevelRead, acl.AccessLevelFull, 2},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.wantSnapshot, acl.EffectivePermissionsInGroups(actualUser, actualHostname, tc.groups, snapshotTarget, entries), "%v", tc.groups)
+		require.Equal(t, tc.wantPolicy, acl.EffectivePermissionsInGroups(actualUser, actualHostname, tc.groups, policyTarget, entries), "%v", tc.groups)
+		require.Len(t, acl.EntriesForUserInGroups(entries, actualUser, actualHostname, tc.groups), tc.wantEntries, "%v", tc.groups)
+	}
+
+	// group rules never match users outside of groups.
+	require.Equal(t, acl.AccessLevelNone, acl.EffectivePermissions(actualUser, actualHostname, snapshotTarget, entries))
+}
+
 func TestLoadEntries(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
 
@@ -326,7 +365,37 @@ func TestACLEntryValidation(t *testing.T) {
 				},
 				Access: acl.AccessLevelFull,
 			},
-			WantErr: "user must be 'username@hostname' possibly including wildcards",
+			WantErr: "user must be 'username@hostname' possibly including wildcards or 'group:name'",
+		},
+		{
+			Entry: &acl.Entry{
+				User: "group:admins",
+				Target: acl.TargetRule{
+					"type": "snapshot",
+				},
+				Access: acl.AccessLevelFull,
+			},
+			WantErr: "",
+		},
+		{
+			Entry: &acl.Entry{
+				User: "group:",
+				Target: acl.TargetRule{
+					"type": "snapshot",
+				},
+				Access: acl.AccessLevelFull,
+			},
+			WantErr: "invalid group: group name is required",
+		},
+		{
+			Entry: &acl.Entry{
+				User: "group:Admins!",
+				Target: acl.TargetRule{
+					"type": "snapshot",
+				},
+				Access: acl.AccessLevelFull,
+			},
+			WantErr: "invalid group: group name must consist of lowercase letters, digits, dashes, underscores or periods",
 		},
 		{
 			Entry: &acl.Entry{
@@ -28,6 +28,9 @@
 //nolint:gosec
 const CSRFTokenHeader = "X-Kopia-Csrf-Token"
 
+// RepositoryHeader is the name of the header selecting one of the named repositories hosted by the server.
+const RepositoryHeader = "X-Kopia-Repository"
+
 // KopiaAPIClient provides helper methods for communicating with Kopia API server.
 type KopiaAPIClient struct {
 	BaseURL    string
@@ -200,8 +203,14 @@ type Options struct {
 	Username string
 	Password string
 
+	// BearerToken is sent instead of username and password when provided.
+	BearerToken string
+
 	TrustedServerCertificateFingerprint string
 
+	// Repository selects a named repository hosted by the server instead of the default one.
+	Repository string
+
 	LogRequests bool
 }
 
@@ -230,11 +239,18 @@ func NewKopiaAPIClient(options Options) (*KopiaAPIClient, error) {
 		}
 	}
 
-	// wrap with a round-tripper that provides basic authentication
-	if options.Username != "" || options.Password != "" {
+	// wrap with a round-tripper that provides bearer token or basic authentication
+	switch {
+	case options.BearerToken != "":
+		transport = bearerAuthTransport{transport, options.BearerToken}
+	case options.Username != "" || options.Password != "":
 		transport = basicAuthTransport{transport, options.Username, options.Password}
 	}
 
+	if options.Repository != "" {
+		transport = repositoryTransport{transport, options.Repository}
+	}
+
 	if options.LogRequests {
 		transport = loggingTransport{transport}
 	}
@@ -267,6 +283,30 @@ func (t basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	return t.base.RoundTrip(req)
 }
 
+type bearerAuthTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t bearerAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+t.token)
+
+	//nolint:wrapcheck
+	return t.base.RoundTrip(req)
+}
+
+type repositoryTransport struct {
+	base       http.RoundTripper
+	repository string
+}
+
+func (t repositoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set(RepositoryHeader, t.repository)
+
+	//nolint:wrapcheck
+	return t.base.RoundTrip(req)
+}
+
 type loggingTransport struct {
 	base http.RoundTripper
 }
@@ -0,0 +1,263 @@
+// Package apitoken provides management of scoped API tokens used to automate server control API calls.
+package apitoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// ManifestType is the type of the manifest used to represent API tokens.
+const ManifestType = "apitoken"
+
+// TokenIDLabel is the manifest label identifying API tokens by their ID.
+const TokenIDLabel = "tokenID"
+
+// Prefix is the prefix of all API tokens, which distinguishes them from other bearer tokens.
+const Prefix = "kopia-token-"
+
+const (
+	tokenIDLength     = 8
+	tokenSecretLength = 32
+	tokenSeparator    = "."
+)
+
+// Scope determines the server control API calls that can be made with a token.
+type Scope string
+
+// Supported scopes.
+const (
+	ScopeReadStatus      Scope = "read-status"
+	ScopeTriggerSnapshot Scope = "trigger-snapshot"
+	ScopeCancelSnapshot  Scope = "cancel-snapshot"
+	ScopePauseSource     Scope = "pause-source"
+	ScopeRefresh         Scope = "refresh"
+)
+
+// ErrTokenNotFound is returned to indicate that a token was not found in the system.
+var ErrTokenNotFound = errors.New("token not found")
+
+// AllScopes returns the list of all supported scopes.
+func AllScopes() []Scope {
+	return []Scope{ScopeReadStatus, ScopeTriggerSnapshot, ScopeCancelSnapshot, ScopePauseSource, ScopeRefresh}
+}
+
+// Token describes a single API token. The secret part of the token is only stored as a hash.
+type Token struct {
+	ManifestID manifest.ID `json:"-"`
+
+	ID          string                `json:"id"`
+	Description string                `json:"description,omitempty"`
+	Scopes      []Scope               `json:"scopes"`
+	Sources     []snapshot.SourceInfo `json:"sources,omitempty"`
+	CreatedBy   string                `json:"createdBy,omitempty"`
+	CreatedTime time.Time             `json:"created"`
+	ExpiresTime time.Time             `json:"expires,omitempty"`
+	SecretHash  []byte                `json:"secretHash"`
+}
+
+// HasScope returns true if the token grants the provided scope.
+func (t *Token) HasScope(s Scope) bool {
+	return slices.Contains(t.Scopes, s)
+}
+
+// AllowsSource returns true if the token can be used to act on a given source.
+// Tokens without sources can be used with all sources.
+func (t *Token) AllowsSource(src snapshot.SourceInfo) bool {
+	if len(t.Sources) == 0 {
+		return true
+	}
+
+	for _, s := range t.Sources {
+		if s.Host != src.Host {
+			continue
+		}
+
+		if s.UserName != "" && s.UserName != src.UserName {
+			continue
+		}
+
+		if s.Path != "" && s.Path != src.Path {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// IsExpired returns true if the token has expired at the provided time.
+func (t *Token) IsExpired(now time.Time) bool {
+	return !t.ExpiresTime.IsZero() && !now.Before(t.ExpiresTime)
+}
+
+// Verify returns an error if the provided secret does not match the token or the token has expired.
+func (t *Token) Verify(secret string, now time.Time) error {
+	h := sha256.Sum256([]byte(secret))
+
+	if subtle.ConstantTimeCompare(h[:], t.SecretHash) != 1 {
+		return errors.New("invalid token secret")
+	}
+
+	if t.IsExpired(now) {
+		return errors.Errorf("token %v expired at %v", t.ID, t.ExpiresTime)
+	}
+
+	return nil
+}
+
+// Parse splits the provided bearer token into the token ID and secret.
+func Parse(bearer string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(bearer, Prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, secret, ok = strings.Cut(rest, tokenSeparator)
+
+	return id, secret, ok && id != "" && secret != ""
+}
+
+// ValidateScopes returns an error if any of the provided scopes is not supported.
+func ValidateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(AllScopes(), s) {
+			return errors.Errorf("unsupported scope %q", s)
+		}
+	}
+
+	return nil
+}
+
+// CreateToken creates a new token with random ID and secret, stores it in the repository and returns it
+// along with the bearer token, which is not stored anywhere and can't be retrieved later.
+func CreateToken(ctx context.Context, w repo.RepositoryWriter, t *Token) (string, error) {
+	if err := ValidateScopes(t.Scopes); err != nil {
+		return "", err
+	}
+
+	id, err := randomHex(tokenIDLength)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := randomHex(tokenSecretLength)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.Sum256([]byte(secret))
+
+	t.ID = id
+	t.SecretHash = h[:]
+
+	mid, err := w.PutManifest(ctx, map[string]string{
+		manifest.TypeLabelKey: ManifestType,
+		TokenIDLabel:          t.ID,
+	}, t)
+	if err != nil {
+		return "", errors.Wrap(err, "error saving API token")
+	}
+
+	t.ManifestID = mid
+
+	return Prefix + id + tokenSeparator + secret, nil
+}
+
+// LoadTokenMap returns the map of all tokens in the repository by ID, using old map as a cache.
+func LoadTokenMap(ctx context.Context, rep repo.Repository, old map[string]*Token) (map[string]*Token, error) {
+	if rep == nil {
+		return nil, nil
+	}
+
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: ManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing API token manifests")
+	}
+
+	result := map[string]*Token{}
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, TokenIDLabel) {
+		id := m.Labels[TokenIDLabel]
+
+		// same token as before
+		if o := old[id]; o != nil && o.ManifestID == m.ID {
+			result[id] = o
+			continue
+		}
+
+		t := &Token{}
+		if _, err := rep.GetManifest(ctx, m.ID, t); err != nil {
+			return nil, errors.Wrapf(err, "error loading API token %v", id)
+		}
+
+		t.ManifestID = m.ID
+
+		result[id] = t
+	}
+
+	return result, nil
+}
+
+// ListTokens gets the list of all tokens in the repository ordered by creation time.
+func ListTokens(ctx context.Context, rep repo.Repository) ([]*Token, error) {
+	tokens, err := LoadTokenMap(ctx, rep, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.SortedFunc(maps.Values(tokens), func(t1, t2 *Token) int {
+		return t1.CreatedTime.Compare(t2.CreatedTime)
+	}), nil
+}
+
+// RevokeToken removes the token with a given ID.
+// Returns ErrTokenNotFound when the token does not exist.
+func RevokeToken(ctx context.Context, w repo.RepositoryWriter, id string) error {
+	manifests, err := w.FindManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: ManifestType,
+		TokenIDLabel:          id,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error looking for API token")
+	}
+
+	if len(manifests) == 0 {
+		return errors.Wrap(ErrTokenNotFound, id)
+	}
+
+	for _, m := range manifests {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error revoking API token %v", id)
+		}
+	}
+
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating random bytes")
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,88 @@
+package apitoken_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/apitoken"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestTokenManager(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tok := &apitoken.Token{
+		Description: "ci",
+		Scopes:      []apitoken.Scope{apitoken.ScopeTriggerSnapshot, apitoken.ScopeReadStatus},
+		CreatedTime: now,
+		ExpiresTime: now.Add(time.Hour),
+	}
+
+	bearer, err := apitoken.CreateToken(ctx, env.RepositoryWriter, tok)
+	require.NoError(t, err)
+	require.NotEmpty(t, tok.ID)
+
+	id, secret, ok := apitoken.Parse(bearer)
+	require.True(t, ok)
+	require.Equal(t, tok.ID, id)
+
+	_, err = apitoken.CreateToken(ctx, env.RepositoryWriter, &apitoken.Token{Scopes: []apitoken.Scope{"no-such-scope"}})
+	require.Error(t, err)
+
+	_, err = apitoken.CreateToken(ctx, env.RepositoryWriter, &apitoken.Token{})
+	require.Error(t, err)
+
+	tokens, err := apitoken.ListTokens(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+
+	loaded := tokens[0]
+	require.Equal(t, tok.ID, loaded.ID)
+	require.Equal(t, tok.Scopes, loaded.Scopes)
+	require.True(t, loaded.HasScope(apitoken.ScopeTriggerSnapshot))
+	require.False(t, loaded.HasScope(apitoken.ScopeCancelSnapshot))
+
+	require.NoError(t, loaded.Verify(secret, now))
+	require.Error(t, loaded.Verify(secret+"x", now))
+	require.Error(t, loaded.Verify(secret, now.Add(time.Hour)))
+
+	require.NoError(t, apitoken.RevokeToken(ctx, env.RepositoryWriter, tok.ID))
+	require.ErrorIs(t, apitoken.RevokeToken(ctx, env.RepositoryWriter, tok.ID), apitoken.ErrTokenNotFound)
+
+	tokens, err = apitoken.ListTokens(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+}
+
+func TestTokenAllowsSource(t *testing.T) {
+	src := snapshot.SourceInfo{UserName: "user", Host: "host", Path: "/data"}
+
+	cases := []struct {
+		sources []snapshot.SourceInfo
+		want    bool
+	}{
+		{nil, true},
+		{[]snapshot.SourceInfo{{Host: "host"}}, true},
+		{[]snapshot.SourceInfo{{UserName: "user", Host: "host"}}, true},
+		{[]snapshot.SourceInfo{{UserName: "user", Host: "host", Path: "/data"}}, true},
+		{[]snapshot.SourceInfo{{UserName: "user", Host: "host", Path: "/other"}}, false},
+		{[]snapshot.SourceInfo{{UserName: "other", Host: "host"}}, false},
+		{[]snapshot.SourceInfo{{Host: "other"}, {Host: "host", Path: "/data"}}, true},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, (&apitoken.Token{Sources: tc.sources}).AllowsSource(src), "%v", tc.sources)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "abc.def", apitoken.Prefix, apitoken.Prefix + "abc", apitoken.Prefix + ".def", apitoken.Prefix + "abc."} {
+		_, _, ok := apitoken.Parse(s)
+		require.False(t, ok, s)
+	}
+}
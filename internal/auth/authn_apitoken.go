@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/apitoken"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+)
+
+const defaultAPITokenRefreshFrequency = 10 * time.Second
+
+// APITokenVerifier verifies bearer API tokens against the 'apitoken' manifests stored in the repository.
+type APITokenVerifier struct {
+	refreshFrequency time.Duration // +checklocksignore
+
+	mu sync.Mutex
+	// +checklocks:mu
+	lastRep repo.Repository
+	// +checklocks:mu
+	nextRefreshTime time.Time
+	// +checklocks:mu
+	tokens map[string]*apitoken.Token
+}
+
+// Verify returns the token matching the provided bearer token if it is valid and has not expired or been revoked.
+func (v *APITokenVerifier) Verify(ctx context.Context, rep repo.Repository, bearer string) (*apitoken.Token, error) {
+	id, secret, ok := apitoken.Parse(bearer)
+	if !ok {
+		return nil, errors.New("malformed API token")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// if the server switched to serving another repository, discard cache.
+	if rep != v.lastRep {
+		v.tokens = nil
+		v.lastRep = rep
+
+		// ensure tokens are reloaded below
+		v.nextRefreshTime = time.Time{}
+	}
+
+	// see if we're due for a refresh, which picks up revoked tokens.
+	if clock.Now().After(v.nextRefreshTime) {
+		v.nextRefreshTime = clock.Now().Add(v.refreshFrequency)
+
+		newTokens, err := apitoken.LoadTokenMap(ctx, rep, v.tokens)
+		if err != nil {
+			log(ctx).Errorf("unable to load API tokens: %v", err)
+		} else {
+			v.tokens = newTokens
+		}
+	}
+
+	t := v.tokens[id]
+	if t == nil {
+		return nil, errors.Wrap(apitoken.ErrTokenNotFound, id)
+	}
+
+	if err := t.Verify(secret, clock.Now()); err != nil {
+		return nil, errors.Wrap(err, "invalid API token")
+	}
+
+	return t, nil
+}
+
+// Refresh ensures tokens are reloaded from the repository on next use.
+func (v *APITokenVerifier) Refresh(_ context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.nextRefreshTime = time.Time{}
+
+	return nil
+}
+
+// NewAPITokenVerifier returns a verifier of API tokens stored in the repository.
+func NewAPITokenVerifier() *APITokenVerifier {
+	return &APITokenVerifier{
+		refreshFrequency: defaultAPITokenRefreshFrequency,
+	}
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+)
+
+// UsernameFromClientCertificate returns the 'user@host' identity of the client of the provided TLS connection
+// if it presented a client certificate that has been verified against the client CAs trusted by the server.
+//
+// The identity is the first e-mail address in the subject alternative names of the certificate that has
+// the form 'user@host' or, if there is none, the common name of the certificate subject if it has that form.
+func UsernameFromClientCertificate(cs *tls.ConnectionState) (string, bool) {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return usernameFromCertificate(cs.VerifiedChains[0][0])
+}
+
+func usernameFromCertificate(cert *x509.Certificate) (string, bool) {
+	for _, email := range cert.EmailAddresses {
+		if isUsernameAtHostname(email) {
+			return email, true
+		}
+	}
+
+	if isUsernameAtHostname(cert.Subject.CommonName) {
+		return cert.Subject.CommonName, true
+	}
+
+	return "", false
+}
+
+func isUsernameAtHostname(s string) bool {
+	u, h, ok := strings.Cut(s, "@")
+
+	return ok && u != "" && h != "" && !strings.Contains(h, "@")
+}
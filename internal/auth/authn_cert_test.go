@@ -0,0 +1,64 @@
+package auth_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+)
+
+func TestUsernameFromClientCertificate(t *testing.T) {
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+	}
+
+	cases := []struct {
+		desc   string
+		cs     *tls.ConnectionState
+		want   string
+		wantOK bool
+	}{
+		{"no TLS", nil, "", false},
+		{"no client certificate", &tls.ConnectionState{}, "", false},
+		{
+			"unverified certificate",
+			&tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "foo@bar"}}}},
+			"", false,
+		},
+		{
+			"e-mail address",
+			verified(&x509.Certificate{EmailAddresses: []string{"foo@bar"}, Subject: pkix.Name{CommonName: "other@host"}}),
+			"foo@bar", true,
+		},
+		{
+			"first valid e-mail address",
+			verified(&x509.Certificate{EmailAddresses: []string{"@bar", "foo@", "a@b@c", "foo@bar"}}),
+			"foo@bar", true,
+		},
+		{
+			"common name",
+			verified(&x509.Certificate{Subject: pkix.Name{CommonName: "foo@bar"}}),
+			"foo@bar", true,
+		},
+		{
+			"no identity",
+			verified(&x509.Certificate{Subject: pkix.Name{CommonName: "some-client"}}),
+			"", false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, ok := auth.UsernameFromClientCertificate(tc.cs)
+			require.Equal(t, tc.wantOK, ok)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	// DefaultOIDCUsernameClaim is the ID token claim used as 'user@host' by default.
+	DefaultOIDCUsernameClaim = "email"
+
+	// oidcEmailVerifiedClaim is the claim which must be true for the 'email' claim to be used as the user identity,
+	// since providers may allow users to set unverified e-mail addresses.
+	oidcEmailVerifiedClaim = "email_verified"
+
+	// DefaultOIDCGroupsClaim is the ID token claim listing groups of the user by default.
+	DefaultOIDCGroupsClaim = "groups"
+
+	oidcDiscoveryPath         = "/.well-known/openid-configuration"
+	oidcMinKeyRefreshInterval = 10 * time.Second
+	oidcMaxResponseSize       = 1 << 20
+)
+
+// DefaultOIDCScopes are the scopes requested during the authorization-code flow by default.
+//
+//nolint:gochecknoglobals
+var DefaultOIDCScopes = []string{"openid", "email", "profile"}
+
+// OIDCOptions configures OpenID Connect authentication.
+type OIDCOptions struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// UsernameClaim is the claim holding the user identity. Values without '@' are suffixed with '@'+DefaultHostname.
+	// The 'email' claim is only accepted when the 'email_verified' claim is true.
+	UsernameClaim   string
+	DefaultHostname string
+
+	// GroupsClaim is the claim holding the list of groups of the user, which can be referenced
+	// in ACL entries as 'group:<name>'.
+	GroupsClaim string
+
+	HTTPClient *http.Client
+}
+
+// OIDCAuthenticator authenticates users of the UI using OpenID Connect authorization-code flow
+// and callers of the API using bearer ID tokens issued by the same provider.
+type OIDCAuthenticator struct {
+	opt    OIDCOptions
+	oauth  *oauth2.Config
+	issuer string
+
+	jwksURL string
+
+	mu sync.Mutex
+	// +checklocks:mu
+	keys map[string]any
+	// +checklocks:mu
+	nextKeyRefreshTime time.Time
+}
+
+type oidcDiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyID string `json:"kid"`
+	Type  string `json:"kty"`
+	Use   string `json:"use"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// NewOIDCAuthenticator discovers the configuration of the provided OpenID Connect issuer and returns an authenticator for it.
+func NewOIDCAuthenticator(ctx context.Context, opt OIDCOptions) (*OIDCAuthenticator, error) {
+	if opt.IssuerURL == "" || opt.ClientID == "" {
+		return nil, errors.New("OIDC issuer URL and client ID must be specified")
+	}
+
+	if opt.UsernameClaim == "" {
+		opt.UsernameClaim = DefaultOIDCUsernameClaim
+	}
+
+	if opt.GroupsClaim == "" {
+		opt.GroupsClaim = DefaultOIDCGroupsClaim
+	}
+
+	if len(opt.Scopes) == 0 {
+		opt.Scopes = DefaultOIDCScopes
+	}
+
+	if opt.HTTPClient == nil {
+		opt.HTTPClient = http.DefaultClient
+	}
+
+	var doc oidcDiscoveryDocument
+
+	if err := oidcGetJSON(ctx, opt.HTTPClient, strings.TrimSuffix(opt.IssuerURL, "/")+oidcDiscoveryPath, &doc); err != nil {
+		return nil, errors.Wrap(err, "unable to discover OIDC configuration")
+	}
+
+	if doc.Issuer != opt.IssuerURL {
+		return nil, errors.Errorf("OIDC issuer mismatch: got %q, want %q", doc.Issuer, opt.IssuerURL)
+	}
+
+	if doc.JWKSURI == "" {
+		return nil, errors.New("OIDC configuration does not specify jwks_uri")
+	}
+
+	return &OIDCAuthenticator{
+		opt:     opt,
+		issuer:  doc.Issuer,
+		jwksURL: doc.JWKSURI,
+		oauth: &oauth2.Config{
+			ClientID:     opt.ClientID,
+			ClientSecret: opt.ClientSecret,
+			RedirectURL:  opt.RedirectURL,
+			Scopes:       opt.Scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  doc.AuthorizationEndpoint,
+				TokenURL: doc.TokenEndpoint,
+			},
+		},
+	}, nil
+}
+
+// OIDCIdentity is the identity of the subject of an ID token.
+type OIDCIdentity struct {
+	Username string   // 'user@host'
+	Groups   []string // sorted groups of the user asserted by the provider
+}
+
+// OIDCLogin holds the per-login values which bind the authorization code to the browser which started the login.
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string // PKCE code verifier
+}
+
+// NewOIDCLogin returns new random values for a single login.
+func NewOIDCLogin() OIDCLogin {
+	return OIDCLogin{
+		State:    oauth2.GenerateVerifier(),
+		Nonce:    oauth2.GenerateVerifier(),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+}
+
+// AuthCodeURL returns the URL of the provider's login page which redirects back with an authorization code and the state of the login.
+func (a *OIDCAuthenticator) AuthCodeURL(l OIDCLogin) string {
+	return a.oauth.AuthCodeURL(l.State, oauth2.SetAuthURLParam("nonce", l.Nonce), oauth2.S256ChallengeOption(l.Verifier))
+}
+
+// Exchange exchanges the authorization code for an ID token and returns the identity of its subject.
+// The ID token must include the nonce of the login.
+func (a *OIDCAuthenticator) Exchange(ctx context.Context, l OIDCLogin, code string) (OIDCIdentity, error) {
+	tok, err := a.oauth.Exchange(context.WithValue(ctx, oauth2.HTTPClient, a.opt.HTTPClient), code, oauth2.VerifierOption(l.Verifier))
+	if err != nil {
+		return OIDCIdentity{}, errors.Wrap(err, "unable to exchange authorization code")
+	}
+
+	idToken, ok := tok.Extra("id_token").(string)
+	if !ok || idToken == "" {
+		return OIDCIdentity{}, errors.New("token response does not include id_token")
+	}
+
+	claims, err := a.parseToken(ctx, idToken)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	if nonce, _ := claims["nonce"].(string); l.Nonce == "" || subtle.ConstantTimeCompare([]byte(nonce), []byte(l.Nonce)) != 1 {
+		return OIDCIdentity{}, errors.New("invalid token: nonce mismatch")
+	}
+
+	return a.identityFromClaims(claims)
+}
+
+// ValidateToken validates the provided ID token (signature, issuer, audience and expiration) and returns
+// the identity of its subject.
+func (a *OIDCAuthenticator) ValidateToken(ctx context.Context, token string) (OIDCIdentity, error) {
+	claims, err := a.parseToken(ctx, token)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	return a.identityFromClaims(claims)
+}
+
+func (a *OIDCAuthenticator) parseToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	if _, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		return a.getKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.opt.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	); err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+
+	return claims, nil
+}
+
+func (a *OIDCAuthenticator) identityFromClaims(claims jwt.MapClaims) (OIDCIdentity, error) {
+	username, err := a.usernameFromClaims(claims)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	var groups []string
+
+	if values, ok := claims[a.opt.GroupsClaim].([]any); ok {
+		for _, g := range values {
+			if s, ok := g.(string); ok && s != "" {
+				groups = append(groups, s)
+			}
+		}
+	}
+
+	slices.Sort(groups)
+
+	return OIDCIdentity{Username: username, Groups: slices.Compact(groups)}, nil
+}
+
+func (a *OIDCAuthenticator) usernameFromClaims(claims jwt.MapClaims) (string, error) {
+	username, _ := claims[a.opt.UsernameClaim].(string)
+	if username == "" {
+		return "", errors.Errorf("token does not include %q claim", a.opt.UsernameClaim)
+	}
+
+	if a.opt.UsernameClaim == DefaultOIDCUsernameClaim {
+		if verified, _ := claims[oidcEmailVerifiedClaim].(bool); !verified {
+			return "", errors.Errorf("%q claim is not verified", a.opt.UsernameClaim)
+		}
+	}
+
+	if !strings.Contains(username, "@") {
+		if a.opt.DefaultHostname == "" {
+			return "", errors.Errorf("%q claim is not in the form user@host", a.opt.UsernameClaim)
+		}
+
+		username += "@" + a.opt.DefaultHostname
+	}
+
+	if !isUsernameAtHostname(username) {
+		return "", errors.Errorf("%q claim is not in the form user@host", a.opt.UsernameClaim)
+	}
+
+	return username, nil
+}
+
+// getKey returns the provider key with a given ID, re-fetching the provider keys if the key is not known,
+// which happens after the provider rotates its keys.
+func (a *OIDCAuthenticator) getKey(ctx context.Context, kid string) (any, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if k, ok := a.keys[kid]; ok {
+		return k, nil
+	}
+
+	if clock.Now().Before(a.nextKeyRefreshTime) {
+		return nil, errors.Errorf("unknown key %q", kid)
+	}
+
+	a.nextKeyRefreshTime = clock.Now().Add(oidcMinKeyRefreshInterval)
+
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a.keys = keys
+
+	if k, ok := a.keys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, errors.Errorf("unknown key %q", kid)
+}
+
+func (a *OIDCAuthenticator) fetchKeys(ctx context.Context) (map[string]any, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err := oidcGetJSON(ctx, a.opt.HTTPClient, a.jwksURL, &jwks); err != nil {
+		return nil, errors.Wrap(err, "unable to fetch OIDC keys")
+	}
+
+	keys := map[string]any{}
+
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pk, err := k.publicKey()
+		if err != nil {
+			log(ctx).Warnf("ignoring OIDC key %q: %v", k.KeyID, err)
+			continue
+		}
+
+		keys[k.KeyID] = pk
+	}
+
+	return keys, nil
+}
+
+// Refresh forces provider keys to be re-fetched on next use.
+func (a *OIDCAuthenticator) Refresh(_ context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keys = nil
+	a.nextKeyRefreshTime = time.Time{}
+
+	return nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Type {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curves := map[string]elliptic.Curve{
+			"P-256": elliptic.P256(),
+			"P-384": elliptic.P384(),
+			"P-521": elliptic.P521(),
+		}
+
+		curve, ok := curves[k.Curve]
+		if !ok {
+			return nil, errors.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported key type %q", k.Type)
+	}
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func oidcGetJSON(ctx context.Context, cli *http.Client, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return errors.Wrap(err, "unable to create request")
+	}
+
+	resp, err := cli.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status code %v from %v", resp.StatusCode, url)
+	}
+
+	return errors.Wrap(json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(v), "unable to decode response")
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/oidctesting"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestOIDCAuthenticator_ValidateToken(t *testing.T) {
+	ctx := testlogging.Context(t)
+	iss := oidctesting.NewIssuer(t)
+
+	a, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:       iss.URL,
+		ClientID:        oidctesting.TestClientID,
+		DefaultHostname: "corp",
+	})
+	require.NoError(t, err)
+
+	otherIssuer := oidctesting.NewIssuer(t)
+
+	cases := []struct {
+		desc    string
+		token   string
+		want    auth.OIDCIdentity
+		wantErr bool
+	}{
+		{"e-mail", iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true}), auth.OIDCIdentity{Username: "alice@example.com"}, false},
+		{"default hostname", iss.IDToken(jwt.MapClaims{"email": "alice", "email_verified": true}), auth.OIDCIdentity{Username: "alice@corp"}, false},
+		{"groups", iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "groups": []string{"users", "kopia-admins", "users"}}), auth.OIDCIdentity{Username: "alice@example.com", Groups: []string{"kopia-admins", "users"}}, false},
+		{"unverified e-mail", iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": false}), auth.OIDCIdentity{}, true},
+		{"e-mail without verification", iss.IDToken(jwt.MapClaims{"email": "alice@example.com"}), auth.OIDCIdentity{}, true},
+		{"missing username", iss.IDToken(jwt.MapClaims{"name": "Alice"}), auth.OIDCIdentity{}, true},
+		{"wrong audience", iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "aud": "other-client"}), auth.OIDCIdentity{}, true},
+		{"expired", iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "exp": time.Now().Add(-time.Hour).Unix()}), auth.OIDCIdentity{}, true},
+		{"wrong issuer", otherIssuer.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true}), auth.OIDCIdentity{}, true},
+		{"malformed", "not-a-token", auth.OIDCIdentity{}, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := a.ValidateToken(ctx, tc.token)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestOIDCAuthenticator_AuthorizationCodeFlow(t *testing.T) {
+	ctx := testlogging.Context(t)
+	iss := oidctesting.NewIssuer(t)
+
+	a, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:    iss.URL,
+		ClientID:     oidctesting.TestClientID,
+		ClientSecret: oidctesting.TestClientSecret,
+		RedirectURL:  "https://kopia.example.com/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	iss.SetLoginClaims(jwt.MapClaims{"email": "bob@example.com", "email_verified": true})
+
+	cli := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// authorize returns the authorization code the provider redirects back with.
+	authorize := func(t *testing.T, l auth.OIDCLogin) string {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.AuthCodeURL(l), http.NoBody)
+		require.NoError(t, err)
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+
+		loc, err := url.Parse(resp.Header.Get("Location"))
+		require.NoError(t, err)
+		require.Equal(t, l.State, loc.Query().Get("state"))
+
+		return loc.Query().Get("code")
+	}
+
+	l := auth.NewOIDCLogin()
+	code := authorize(t, l)
+
+	id, err := a.Exchange(ctx, l, code)
+	require.NoError(t, err)
+	require.Equal(t, "bob@example.com", id.Username)
+
+	// codes can't be reused.
+	_, err = a.Exchange(ctx, l, code)
+	require.Error(t, err)
+
+	// codes can only be exchanged with the PKCE verifier of the login.
+	l = auth.NewOIDCLogin()
+	code = authorize(t, l)
+
+	_, err = a.Exchange(ctx, auth.OIDCLogin{State: l.State, Nonce: l.Nonce, Verifier: auth.NewOIDCLogin().Verifier}, code)
+	require.Error(t, err)
+
+	// ID tokens must include the nonce of the login.
+	l = auth.NewOIDCLogin()
+	code = authorize(t, l)
+
+	_, err = a.Exchange(ctx, auth.OIDCLogin{State: l.State, Nonce: auth.NewOIDCLogin().Nonce, Verifier: l.Verifier}, code)
+	require.ErrorContains(t, err, "nonce")
+}
+
+func TestNewOIDCAuthenticator_Invalid(t *testing.T) {
+	ctx := testlogging.Context(t)
+	iss := oidctesting.NewIssuer(t)
+
+	_, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{IssuerURL: iss.URL})
+	require.Error(t, err)
+
+	_, err = auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{IssuerURL: iss.URL + "/other", ClientID: oidctesting.TestClientID})
+	require.Error(t, err)
+}
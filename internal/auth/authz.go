@@ -13,7 +13,9 @@
 
 // Authorizer gets authorization info for logged in user.
 type Authorizer interface {
-	Authorize(ctx context.Context, rep repo.Repository, username string) AuthorizationInfo
+	// Authorize returns authorization info of the user, who is a member of the provided groups
+	// asserted by the identity provider in addition to groups stored in the repository.
+	Authorize(ctx context.Context, rep repo.Repository, username string, groups []string) AuthorizationInfo
 	Refresh(ctx context.Context) error
 }
 
@@ -70,6 +72,11 @@ func (la legacyAuthorizationInfo) ManifestAccessLevel(labels map[string]string)
 		}
 	}
 
+	// other manifest types may carry the same labels, but are managed by the server.
+	if t := labels[manifest.TypeLabelKey]; t != snapshot.ManifestType && t != policy.ManifestType {
+		return AccessLevelNone
+	}
+
 	// full access to policies/snapshots for the username@hostname
 	if labels[snapshot.UsernameLabel]+"@"+labels[snapshot.HostnameLabel] == la.usernameAtHostname {
 		return AccessLevelFull
@@ -81,7 +88,7 @@ func (la legacyAuthorizationInfo) ManifestAccessLevel(labels map[string]string)
 
 type legacyAuthorizer struct{}
 
-func (legacyAuthorizer) Authorize(_ context.Context, _ repo.Repository, username string) AuthorizationInfo {
+func (legacyAuthorizer) Authorize(_ context.Context, _ repo.Repository, username string, _ []string) AuthorizationInfo {
 	return legacyAuthorizationInfo{usernameAtHostname: username}
 }
 
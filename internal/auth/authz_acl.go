@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -97,11 +98,13 @@ type aclCache struct {
 	nextRefreshTime time.Time
 	// +checklocks:mu
 	aclEntries []*acl.Entry
+	// +checklocks:mu
+	groups map[string]*user.Group
 }
 
 // Authorize returns authorization info based on ACLs stored in the repository falling back to legacy authorizer
 // if no ACL entries are defined.
-func (ac *aclCache) Authorize(ctx context.Context, rep repo.Repository, usernameAtHostname string) AuthorizationInfo {
+func (ac *aclCache) Authorize(ctx context.Context, rep repo.Repository, usernameAtHostname string, providerGroups []string) AuthorizationInfo {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
 
@@ -132,13 +135,25 @@ func (ac *aclCache) Authorize(ctx context.Context, rep repo.Repository, username
 		} else {
 			ac.aclEntries = newMap
 		}
+
+		newGroups, err := user.LoadGroupMap(ctx, rep, ac.groups)
+		if err != nil {
+			log(ctx).Errorf("unable to load groups: %v", err)
+		} else {
+			ac.groups = newGroups
+		}
 	}
 
 	if len(ac.aclEntries) == 0 {
 		return legacyAuthorizationInfo{usernameAtHostname}
 	}
 
-	return aclEntriesAuthorizer{acl.EntriesForUser(ac.aclEntries, u, h), u, h}
+	groups := append(user.GroupsOfUser(ac.groups, usernameAtHostname), providerGroups...)
+
+	slices.Sort(groups)
+	groups = slices.Compact(groups)
+
+	return aclEntriesAuthorizer{acl.EntriesForUserInGroups(ac.aclEntries, u, h, groups), u, h, groups}
 }
 
 func (ac *aclCache) Refresh(_ context.Context) error {
@@ -155,14 +170,15 @@ type aclEntriesAuthorizer struct {
 	entries  []*acl.Entry
 	username string
 	hostname string
+	groups   []string
 }
 
 func (a aclEntriesAuthorizer) ContentAccessLevel() AccessLevel {
-	return acl.EffectivePermissions(a.username, a.hostname, ContentRule, a.entries)
+	return acl.EffectivePermissionsInGroups(a.username, a.hostname, a.groups, ContentRule, a.entries)
 }
 
 func (a aclEntriesAuthorizer) ManifestAccessLevel(labels map[string]string) AccessLevel {
-	return acl.EffectivePermissions(a.username, a.hostname, labels, a.entries)
+	return acl.EffectivePermissionsInGroups(a.username, a.hostname, a.groups, labels, a.entries)
 }
 
 // DefaultAuthorizer returns Authorizer that will fetch ACLs from the repository
@@ -9,6 +9,7 @@
 	"github.com/kopia/kopia/internal/acl"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/repo"
 )
 
@@ -47,6 +48,14 @@
 	"path":     "/path",
 }
 
+// server-managed manifest with labels matching the user, which must not grant any access.
+var fooAtBarAPIToken = map[string]string{
+	"type":     "apitoken",
+	"username": "foo",
+	"hostname": "bar",
+	"tokenID":  "some-token",
+}
+
 var fooAtBarPolicy = map[string]string{
 	"type":       "policy",
 	"username":   "foo",
@@ -169,7 +178,7 @@ func verifyLegacyAuthorizer(ctx context.Context, t *testing.T, rep repo.Reposito
 
 	for _, tc := range cases {
 		t.Run(tc.usernameAtHost, func(t *testing.T) {
-			a := authorizer.Authorize(ctx, rep, tc.usernameAtHost)
+			a := authorizer.Authorize(ctx, rep, tc.usernameAtHost, nil)
 
 			if got, want := a.ContentAccessLevel(), auth.AccessLevelFull; got != want {
 				t.Errorf("invalid content access level: %v, want %v", got, want)
@@ -184,6 +193,7 @@ func verifyLegacyAuthorizer(ctx context.Context, t *testing.T, rep repo.Reposito
 			verifyManifestAccessLevel(t, a, bazPolicy, tc.bazPolicyAccess)
 			verifyManifestAccessLevel(t, a, fooAtBarSnapshot, tc.fooAtBarSnapshotAccess)
 			verifyManifestAccessLevel(t, a, fooAtBazSnapshot, tc.fooAtBazSnapshotAccess)
+			verifyManifestAccessLevel(t, a, fooAtBarAPIToken, auth.AccessLevelNone)
 		})
 	}
 }
@@ -195,3 +205,26 @@ func verifyManifestAccessLevel(t *testing.T, a auth.AuthorizationInfo, labels ma
 		t.Errorf("invalid access level to %v: %v, want %v", labels, got, want)
 	}
 }
+
+func TestDefaultAuthorizer_GroupACLs(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	require.NoError(t, acl.AddACL(ctx, env.RepositoryWriter, &acl.Entry{
+		User:   "group:ops",
+		Target: acl.TargetRule{"type": "snapshot"},
+		Access: acl.AccessLevelRead,
+	}, false))
+
+	_, err := user.AddGroupMembers(ctx, env.RepositoryWriter, "ops", "foo@bar")
+	require.NoError(t, err)
+
+	a := auth.DefaultAuthorizer()
+
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "foo@bar", nil), fooAtBazSnapshot, auth.AccessLevelRead)
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "foo@bar", nil), fooAtBarPolicy, auth.AccessLevelNone)
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "foo@baz", nil), fooAtBazSnapshot, auth.AccessLevelNone)
+
+	// groups asserted by the identity provider are matched like groups stored in the repository.
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "foo@baz", []string{"ops"}), fooAtBazSnapshot, auth.AccessLevelRead)
+	verifyManifestAccessLevel(t, a.Authorize(ctx, env.RepositoryWriter, "foo@baz", []string{"dev"}), fooAtBazSnapshot, auth.AccessLevelNone)
+}
@@ -0,0 +1,185 @@
+// Package changejournal keeps track of directories that have been modified under a root directory,
+// which allows snapshots to skip scanning of subtrees that are known to be unchanged.
+//
+// Changes are tagged with generation numbers. Callers obtain the current generation using Mark()
+// before starting a snapshot and later use Since() with that generation to learn which
+// directories may have been modified since.
+package changejournal
+
+import (
+	"math"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/logging"
+)
+
+var log = logging.Module("changejournal")
+
+// ErrNotSupported is returned when change journal is not supported on the current platform.
+var ErrNotSupported = errors.New("change journal is not supported on this platform")
+
+// alwaysChanged is the generation assigned to directories that cannot be tracked.
+const alwaysChanged = math.MaxUint64
+
+// Journal tracks directories modified under a root directory.
+type Journal struct {
+	mu sync.Mutex
+
+	// +checklocks:mu
+	gen uint64
+
+	// generation of the most recent change of each directory or any of its descendants, keyed by
+	// slash-separated path relative to the root.
+	// +checklocks:mu
+	dirty map[string]uint64
+
+	// generation of the most recent change that affects entire subtree of a given directory, such as
+	// modification of ignore files or renames of directories.
+	// +checklocks:mu
+	subtreeDirty map[string]uint64
+
+	// generation at which journal has lost track of changes, for example due to event queue overflow.
+	// +checklocks:mu
+	invalidGen uint64
+
+	closeFunc func() error
+}
+
+func newJournal() *Journal {
+	return &Journal{
+		gen:          1,
+		dirty:        map[string]uint64{},
+		subtreeDirty: map[string]uint64{},
+	}
+}
+
+// Mark returns the current generation and starts a new one. Changes observed after Mark() returns
+// are guaranteed to be reported by views created using Since() with the returned generation.
+func (j *Journal) Mark() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	g := j.gen
+	j.gen++
+
+	return g
+}
+
+// Since returns a view of changes made after the provided generation was returned by Mark().
+func (j *Journal) Since(gen uint64) *View {
+	return &View{j: j, gen: gen}
+}
+
+// Close stops tracking changes.
+func (j *Journal) Close() error {
+	if j.closeFunc == nil {
+		return nil
+	}
+
+	return j.closeFunc()
+}
+
+// directoryChanged records a change to the contents or metadata of the provided directory.
+func (j *Journal) directoryChanged(relPath string, entireSubtree bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.directoryChangedLocked(relPath, entireSubtree, j.gen)
+}
+
+// untracked records that changes to the provided directory and its descendants can't be observed.
+func (j *Journal) untracked(relPath string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.directoryChangedLocked(relPath, true, alwaysChanged)
+}
+
+// +checklocks:j.mu
+func (j *Journal) directoryChangedLocked(relPath string, entireSubtree bool, gen uint64) {
+	if entireSubtree {
+		j.subtreeDirty[relPath] = gen
+	}
+
+	for p := relPath; ; p = parentPath(p) {
+		j.dirty[p] = gen
+
+		if p == "." {
+			return
+		}
+	}
+}
+
+// invalidate records that some changes have been lost.
+func (j *Journal) invalidate() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.invalidGen = j.gen
+}
+
+// invalidateForever records that the journal can no longer be used.
+func (j *Journal) invalidateForever() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.invalidGen = alwaysChanged
+}
+
+// View represents changes made after a particular generation.
+type View struct {
+	j   *Journal
+	gen uint64
+}
+
+// IsValid returns true if the journal has not lost track of any change since the view generation.
+func (v *View) IsValid() bool {
+	v.j.mu.Lock()
+	defer v.j.mu.Unlock()
+
+	return v.isValidLocked()
+}
+
+// +checklocksread:v.j.mu
+func (v *View) isValidLocked() bool {
+	return v.gen != 0 && v.j.invalidGen <= v.gen
+}
+
+// IsUnchanged returns true if the directory with the provided slash-separated path relative
+// to the root and all its descendants are known not to have changed since the view generation.
+func (v *View) IsUnchanged(relPath string) bool {
+	v.j.mu.Lock()
+	defer v.j.mu.Unlock()
+
+	if !v.isValidLocked() {
+		return false
+	}
+
+	relPath = path.Clean(relPath)
+
+	if v.j.dirty[relPath] > v.gen {
+		return false
+	}
+
+	for p := relPath; ; p = parentPath(p) {
+		if v.j.subtreeDirty[p] > v.gen {
+			return false
+		}
+
+		if p == "." {
+			return true
+		}
+	}
+}
+
+func parentPath(relPath string) string {
+	if !strings.Contains(relPath, "/") {
+		return "."
+	}
+
+	return path.Dir(relPath)
+}
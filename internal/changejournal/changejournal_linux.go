@@ -0,0 +1,253 @@
+//go:build linux
+
+package changejournal
+
+import (
+	"context"
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+		unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+		unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+	eventBufferSize = 1 << 16
+)
+
+// Options provides options for the change journal.
+type Options struct {
+	// Names of files whose modification affects entire subtree of the containing directory,
+	// such as ignore files.
+	SubtreeFileNames []string
+}
+
+type watcher struct {
+	j       *Journal
+	f       *os.File
+	root    string
+	subtree map[string]bool
+
+	// only accessed by Start() and later by the event loop goroutine.
+	wdPath map[int32]string
+	pathWd map[string]int32
+}
+
+// Start starts tracking changes under the provided root directory using inotify.
+//
+// All directories under the root are watched, so the number of directories must not exceed
+// the value of fs.inotify.max_user_watches, otherwise an error is returned.
+func Start(ctx context.Context, root string, opt Options) (*Journal, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to initialize inotify")
+	}
+
+	w := &watcher{
+		j:       newJournal(),
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		root:    root,
+		subtree: map[string]bool{},
+		wdPath:  map[int32]string{},
+		pathWd:  map[string]int32{},
+	}
+
+	for _, n := range opt.SubtreeFileNames {
+		w.subtree[n] = true
+	}
+
+	if err := w.addRecursive("."); err != nil {
+		w.f.Close() //nolint:errcheck
+
+		return nil, err
+	}
+
+	log(ctx).Debugw("started change journal", "root", root, "watches", len(w.wdPath))
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		w.run(ctx)
+	}()
+
+	w.j.closeFunc = func() error {
+		err := w.f.Close()
+
+		<-done
+
+		return errors.Wrap(err, "error closing inotify")
+	}
+
+	return w.j, nil
+}
+
+// addRecursive adds watches for the provided directory and all its subdirectories.
+func (w *watcher) addRecursive(relPath string) error {
+	//nolint:wrapcheck
+	return filepath.WalkDir(filepath.Join(w.root, filepath.FromSlash(relPath)), func(p string, d fs.DirEntry, err error) error {
+		rel, rerr := filepath.Rel(w.root, p)
+		if rerr != nil {
+			return errors.Wrap(rerr, "unable to determine relative path")
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if err != nil {
+			// directory that can't be read won't be tracked and is always considered changed.
+			w.j.untracked(rel)
+
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		//nolint:gosec
+		wd, err := unix.InotifyAddWatch(int(w.f.Fd()), p, watchMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOSPC) {
+				w.j.invalidateForever()
+
+				return errors.Wrap(err, "too many directories to watch, consider increasing fs.inotify.max_user_watches")
+			}
+
+			w.j.untracked(rel)
+
+			return fs.SkipDir
+		}
+
+		wd32 := int32(wd) //nolint:gosec
+
+		// the same inode may have been watched under a different name.
+		if old, ok := w.wdPath[wd32]; ok {
+			delete(w.pathWd, old)
+		}
+
+		w.wdPath[wd32] = rel
+		w.pathWd[rel] = wd32
+
+		return nil
+	})
+}
+
+// forgetRecursive removes watches for the provided directory and all its subdirectories.
+func (w *watcher) forgetRecursive(relPath string, removeWatch bool) {
+	for p, wd := range w.pathWd {
+		if p != relPath && !strings.HasPrefix(p, relPath+"/") {
+			continue
+		}
+
+		if removeWatch {
+			unix.InotifyRmWatch(int(w.f.Fd()), uint32(wd)) //nolint:errcheck,gosec
+		}
+
+		delete(w.pathWd, p)
+		delete(w.wdPath, wd)
+	}
+}
+
+func (w *watcher) run(ctx context.Context) {
+	buf := make([]byte, eventBufferSize)
+
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log(ctx).Errorf("error reading inotify events: %v", err)
+			}
+
+			w.j.invalidateForever()
+
+			return
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:])) //nolint:gosec
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+
+			nameStart := off + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+nameLen]), "\x00")
+
+			off = nameStart + nameLen
+
+			w.handleEvent(ctx, wd, mask, name)
+		}
+	}
+}
+
+func (w *watcher) handleEvent(ctx context.Context, wd int32, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		log(ctx).Infof("change journal event queue overflow, next snapshot will scan all files")
+		w.j.invalidate()
+
+		return
+	}
+
+	dir, ok := w.wdPath[wd]
+	if !ok {
+		return
+	}
+
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.wdPath, wd)
+
+		if w.pathWd[dir] == wd {
+			delete(w.pathWd, dir)
+		}
+
+		return
+	}
+
+	if name == "" {
+		if dir == "." && mask&(unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+			log(ctx).Infof("root directory %v has been removed or renamed, change journal disabled", w.root)
+			w.j.invalidateForever()
+
+			return
+		}
+
+		w.j.directoryChanged(dir, false)
+
+		return
+	}
+
+	child := path.Join(dir, name)
+
+	if mask&unix.IN_ISDIR != 0 {
+		switch {
+		case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			// directory may have been moved from a different location, so its entire subtree must be rescanned.
+			w.forgetRecursive(child, true)
+
+			if err := w.addRecursive(child); err != nil {
+				log(ctx).Errorf("unable to watch %v: %v", child, err)
+			}
+
+			w.j.directoryChanged(child, true)
+
+		case mask&unix.IN_MOVED_FROM != 0:
+			w.forgetRecursive(child, true)
+
+		case mask&unix.IN_DELETE != 0:
+			w.forgetRecursive(child, false)
+		}
+	}
+
+	w.j.directoryChanged(dir, w.subtree[name])
+}
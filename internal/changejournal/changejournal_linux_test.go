@@ -0,0 +1,102 @@
+//go:build linux
+
+package changejournal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestInotifyJournal(t *testing.T) {
+	ctx := testlogging.Context(t)
+	root := t.TempDir()
+
+	for _, d := range []string{"a/b/c", "d/e", "f"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, d), 0o700))
+	}
+
+	j, err := Start(ctx, root, Options{SubtreeFileNames: []string{".kopiaignore"}})
+	require.NoError(t, err)
+
+	defer j.Close()
+
+	v := j.Since(j.Mark())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a/b/c/file"), []byte{1}, 0o600))
+
+	waitForChange(t, v, "a/b/c")
+	require.False(t, v.IsUnchanged("a"))
+	require.True(t, v.IsUnchanged("d"))
+	require.True(t, v.IsUnchanged("d/e"))
+
+	// directories created after the journal has started are watched.
+	v = j.Since(j.Mark())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "d/new/sub"), 0o700))
+	waitForChange(t, v, "d/new/sub")
+
+	v = j.Since(j.Mark())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "d/new/sub/file"), []byte{1}, 0o600))
+	waitForChange(t, v, "d/new/sub")
+	require.True(t, v.IsUnchanged("a"))
+
+	// ignore files affect the entire subtree.
+	v = j.Since(j.Mark())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a/.kopiaignore"), []byte("*.tmp"), 0o600))
+	waitForChange(t, v, "a")
+	require.False(t, v.IsUnchanged("a/b/c"))
+	require.True(t, v.IsUnchanged("f"))
+
+	// renamed directories are tracked at their new location.
+	v = j.Since(j.Mark())
+
+	require.NoError(t, os.Rename(filepath.Join(root, "d/e"), filepath.Join(root, "f/e2")))
+	waitForChange(t, v, "f/e2")
+	require.False(t, v.IsUnchanged("d"))
+
+	v = j.Since(j.Mark())
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "f/e2/file"), []byte{1}, 0o600))
+	waitForChange(t, v, "f/e2")
+	require.True(t, v.IsUnchanged("d"))
+
+	require.NoError(t, j.Close())
+	require.False(t, j.Since(j.Mark()).IsValid())
+}
+
+func TestInotifyJournalRemovedRoot(t *testing.T) {
+	ctx := testlogging.Context(t)
+	root := filepath.Join(t.TempDir(), "root")
+
+	require.NoError(t, os.MkdirAll(root, 0o700))
+
+	j, err := Start(ctx, root, Options{})
+	require.NoError(t, err)
+
+	defer j.Close()
+
+	v := j.Since(j.Mark())
+	require.True(t, v.IsValid())
+
+	require.NoError(t, os.Remove(root))
+
+	require.Eventually(t, func() bool {
+		return !v.IsValid()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func waitForChange(t *testing.T, v *View, relPath string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return !v.IsUnchanged(relPath)
+	}, 5*time.Second, 10*time.Millisecond, relPath)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package changejournal
+
+import "context"
+
+// Options provides options for the change journal.
+type Options struct {
+	// Names of files whose modification affects entire subtree of the containing directory,
+	// such as ignore files.
+	SubtreeFileNames []string
+}
+
+// Start returns ErrNotSupported on this platform.
+func Start(_ context.Context, _ string, _ Options) (*Journal, error) {
+	return nil, ErrNotSupported
+}
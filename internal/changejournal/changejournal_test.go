@@ -0,0 +1,71 @@
+package changejournal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournalGenerations(t *testing.T) {
+	j := newJournal()
+
+	j.directoryChanged("a/b", false)
+
+	g1 := j.Mark()
+
+	v := j.Since(g1)
+	require.True(t, v.IsValid())
+	require.True(t, v.IsUnchanged("."))
+	require.True(t, v.IsUnchanged("a/b"))
+
+	j.directoryChanged("a/b/c", false)
+
+	require.False(t, v.IsUnchanged("."))
+	require.False(t, v.IsUnchanged("a"))
+	require.False(t, v.IsUnchanged("a/b"))
+	require.False(t, v.IsUnchanged("a/b/c"))
+	require.True(t, v.IsUnchanged("a/b/d"))
+	require.True(t, v.IsUnchanged("x"))
+
+	g2 := j.Mark()
+	require.Greater(t, g2, g1)
+	require.True(t, j.Since(g2).IsUnchanged("a/b/c"))
+
+	// zero generation is never valid.
+	require.False(t, j.Since(0).IsValid())
+	require.False(t, j.Since(0).IsUnchanged("x"))
+}
+
+func TestJournalSubtreeChanges(t *testing.T) {
+	j := newJournal()
+	g := j.Mark()
+	v := j.Since(g)
+
+	j.directoryChanged("a", true)
+
+	require.False(t, v.IsUnchanged("a"))
+	require.False(t, v.IsUnchanged("a/b/c"))
+	require.True(t, v.IsUnchanged("b"))
+
+	j.untracked("b/c")
+
+	require.False(t, j.Since(j.Mark()).IsUnchanged("b/c/d"))
+	require.True(t, j.Since(j.Mark()).IsUnchanged("b/x"))
+}
+
+func TestJournalInvalidate(t *testing.T) {
+	j := newJournal()
+	g1 := j.Mark()
+
+	j.invalidate()
+
+	require.False(t, j.Since(g1).IsValid())
+	require.False(t, j.Since(g1).IsUnchanged("a"))
+
+	g2 := j.Mark()
+	require.True(t, j.Since(g2).IsValid())
+
+	j.invalidateForever()
+
+	require.False(t, j.Since(j.Mark()).IsValid())
+}
@@ -0,0 +1,628 @@
+//go:build !windows && !openbsd && !freebsd
+
+package fusemount
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	gofusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/overlayfs"
+)
+
+// overlay implements copy-on-write semantics on top of a read-only directory, all modifications
+// are stored in the upper directory in the format understood by overlayfs.
+type overlay struct {
+	lower    fs.Directory
+	upperDir string
+
+	// serializes modifications of the upper directory.
+	mu sync.Mutex
+}
+
+// overlayNode is a FUSE node of any type in the overlay, which is identified by its path relative to the root.
+type overlayNode struct {
+	gofusefs.Inode
+
+	ov *overlay
+}
+
+// NewOverlayNode returns writable FUSE Node for a given fs.Directory, which stores all modifications in the
+// provided upper directory. If the upper directory does not exist, it's created with the attributes of dir.
+func NewOverlayNode(dir fs.Directory, upperDir string) (gofusefs.InodeEmbedder, error) {
+	if _, err := os.Stat(upperDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(upperDir, dir.Mode().Perm()|0o700); err != nil {
+			return nil, errors.Wrap(err, "unable to create overlay directory")
+		}
+
+		if err := os.Chtimes(upperDir, dir.ModTime(), dir.ModTime()); err != nil {
+			return nil, errors.Wrap(err, "unable to set modification time of overlay directory")
+		}
+	}
+
+	return &overlayNode{ov: &overlay{lower: dir, upperDir: upperDir}}, nil
+}
+
+func (o *overlay) upperPath(rel string) string {
+	return filepath.Join(o.upperDir, filepath.FromSlash(rel))
+}
+
+// lookup returns the merged entry at a given relative path.
+func (o *overlay) lookup(ctx context.Context, rel string) (fs.Entry, error) {
+	root, err := overlayfs.New(ctx, o.lower, o.upperDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open overlay")
+	}
+
+	var e fs.Entry = root
+
+	for _, p := range strings.Split(rel, "/") {
+		if p == "" {
+			continue
+		}
+
+		d, ok := e.(fs.Directory)
+		if !ok {
+			return nil, fs.ErrEntryNotFound
+		}
+
+		if e, err = d.Child(ctx, p); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+	}
+
+	return e, nil
+}
+
+// existsInLower determines whether the lower directory has an entry at a given path that is not hidden
+// by a whiteout, regardless of whether it's shadowed by the upper directory.
+func (o *overlay) existsInLower(ctx context.Context, rel string) (bool, error) {
+	parent, err := o.lookup(ctx, parentPath(rel))
+	if err != nil {
+		return false, err
+	}
+
+	d, ok := parent.(fs.Directory)
+	if !ok {
+		return false, nil
+	}
+
+	l, err := overlayfs.LowerChild(ctx, d, path.Base(rel))
+
+	return l != nil, errors.Wrap(err, "unable to look up lower entry")
+}
+
+// copyUp ensures the entry at a given path and all its parent directories are present in the upper directory.
+func (o *overlay) copyUp(ctx context.Context, rel string) error {
+	up := o.upperPath(rel)
+
+	if _, err := os.Lstat(up); err == nil {
+		return nil
+	}
+
+	if err := o.copyUp(ctx, parentPath(rel)); err != nil {
+		return err
+	}
+
+	e, err := o.lookup(ctx, rel)
+	if err != nil {
+		return err
+	}
+
+	switch e := e.(type) {
+	case fs.Directory:
+		// directories must remain writable by the owner to allow modifications of their contents.
+		if err := os.Mkdir(up, e.Mode().Perm()|0o700); err != nil {
+			return errors.Wrap(err, "unable to create directory")
+		}
+
+	case fs.Symlink:
+		target, err := e.Readlink(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to read symlink")
+		}
+
+		//nolint:wrapcheck
+		return os.Symlink(target, up)
+
+	case fs.File:
+		if err := copyFileContents(ctx, e, up); err != nil {
+			return err
+		}
+
+	default:
+		return errors.Errorf("unsupported entry type: %v", e.Mode())
+	}
+
+	return errors.Wrap(os.Chtimes(up, e.ModTime(), e.ModTime()), "unable to set modification time")
+}
+
+func copyFileContents(ctx context.Context, f fs.File, dest string) error {
+	r, err := f.Open(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to open file")
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	tmp := dest + ".kopia-copyup"
+
+	w, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to create file")
+	}
+
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp, f.Mode().Perm())
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, dest)
+	}
+
+	if err != nil {
+		os.Remove(tmp) //nolint:errcheck
+
+		return errors.Wrap(err, "unable to copy file")
+	}
+
+	return nil
+}
+
+// prepareNewEntry ensures the parent directory is present in the upper directory and removes any whiteout
+// for the entry, returns true if the new entry replaces a deleted entry from the lower directory.
+func (o *overlay) prepareNewEntry(ctx context.Context, rel string) (replacesLower bool, err error) {
+	if err := o.copyUp(ctx, parentPath(rel)); err != nil {
+		return false, err
+	}
+
+	wh := o.upperPath(path.Join(parentPath(rel), overlayfs.WhiteoutName(path.Base(rel))))
+
+	if err := os.Remove(wh); err == nil {
+		return true, nil
+	} else if !os.IsNotExist(err) {
+		return false, errors.Wrap(err, "unable to remove whiteout")
+	}
+
+	return false, nil
+}
+
+// remove removes the entry at a given path, adding a whiteout if the lower directory has the same entry.
+func (o *overlay) remove(ctx context.Context, rel string) error {
+	if err := o.copyUp(ctx, parentPath(rel)); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(o.upperPath(rel)); err != nil {
+		return errors.Wrap(err, "unable to remove")
+	}
+
+	inLower, err := o.existsInLower(ctx, rel)
+	if err != nil || !inLower {
+		return err
+	}
+
+	wh := o.upperPath(path.Join(parentPath(rel), overlayfs.WhiteoutName(path.Base(rel))))
+
+	//nolint:wrapcheck
+	return os.WriteFile(wh, nil, 0o600)
+}
+
+func parentPath(rel string) string {
+	if p := path.Dir(rel); p != "." {
+		return p
+	}
+
+	return ""
+}
+
+func (n *overlayNode) relPath(name ...string) string {
+	return path.Join(append([]string{n.Path(n.Root())}, name...)...)
+}
+
+func (n *overlayNode) entry(ctx context.Context) (fs.Entry, syscall.Errno) {
+	e, err := n.ov.lookup(ctx, n.relPath())
+	return e, toErrno(ctx, n.relPath(), err)
+}
+
+func (n *overlayNode) newChild(ctx context.Context, name string, out *fuse.EntryOut) (*gofusefs.Inode, syscall.Errno) {
+	e, err := n.ov.lookup(ctx, n.relPath(name))
+	if err != nil {
+		return nil, toErrno(ctx, n.relPath(name), err)
+	}
+
+	populateAttributes(&out.Attr, e)
+
+	return n.NewInode(ctx, &overlayNode{ov: n.ov}, gofusefs.StableAttr{Mode: entryToFuseMode(e)}), gofusefs.OK
+}
+
+func toErrno(ctx context.Context, rel string, err error) syscall.Errno {
+	if err == nil {
+		return gofusefs.OK
+	}
+
+	if errors.Is(err, fs.ErrEntryNotFound) || os.IsNotExist(err) {
+		return syscall.ENOENT
+	}
+
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+
+	log(ctx).Errorf("overlay error on %v: %v", rel, err)
+
+	return syscall.EIO
+}
+
+func (n *overlayNode) Getattr(ctx context.Context, _ gofusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	e, errno := n.entry(ctx)
+	if errno != gofusefs.OK {
+		return errno
+	}
+
+	populateAttributes(&out.Attr, e)
+
+	out.Ino = n.StableAttr().Ino
+
+	return gofusefs.OK
+}
+
+func (n *overlayNode) Setattr(ctx context.Context, _ gofusefs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath()
+	if err := n.ov.copyUp(ctx, rel); err != nil {
+		return toErrno(ctx, rel, err)
+	}
+
+	up := n.ov.upperPath(rel)
+
+	if mode, ok := in.GetMode(); ok {
+		if err := os.Chmod(up, os.FileMode(mode).Perm()); err != nil {
+			return toErrno(ctx, rel, err)
+		}
+	}
+
+	if size, ok := in.GetSize(); ok {
+		if err := os.Truncate(up, int64(size)); err != nil { //nolint:gosec
+			return toErrno(ctx, rel, err)
+		}
+	}
+
+	uid, uok := in.GetUID()
+	gid, gok := in.GetGID()
+
+	if uok || gok {
+		suid, sgid := -1, -1
+		if uok {
+			suid = int(uid)
+		}
+
+		if gok {
+			sgid = int(gid)
+		}
+
+		if err := os.Lchown(up, suid, sgid); err != nil {
+			return toErrno(ctx, rel, err)
+		}
+	}
+
+	mtime, mok := in.GetMTime()
+	atime, aok := in.GetATime()
+
+	if mok || aok {
+		var zero time.Time
+
+		if !mok {
+			mtime = zero
+		}
+
+		if !aok {
+			atime = zero
+		}
+
+		if err := os.Chtimes(up, atime, mtime); err != nil {
+			return toErrno(ctx, rel, err)
+		}
+	}
+
+	return n.Getattr(ctx, nil, out)
+}
+
+func (n *overlayNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofusefs.Inode, syscall.Errno) {
+	return n.newChild(ctx, name, out)
+}
+
+func (n *overlayNode) Readdir(ctx context.Context) (gofusefs.DirStream, syscall.Errno) {
+	e, errno := n.entry(ctx)
+	if errno != gofusefs.OK {
+		return nil, errno
+	}
+
+	d, ok := e.(fs.Directory)
+	if !ok {
+		return nil, syscall.ENOTDIR
+	}
+
+	var result []fuse.DirEntry
+
+	if err := fs.IterateEntries(ctx, d, func(_ context.Context, e fs.Entry) error {
+		result = append(result, fuse.DirEntry{
+			Name: e.Name(),
+			Mode: entryToFuseMode(e),
+		})
+
+		return nil
+	}); err != nil {
+		return nil, toErrno(ctx, n.relPath(), err)
+	}
+
+	return gofusefs.NewListDirStream(result), gofusefs.OK
+}
+
+func (n *overlayNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	e, errno := n.entry(ctx)
+	if errno != gofusefs.OK {
+		return nil, errno
+	}
+
+	sl, ok := e.(fs.Symlink)
+	if !ok {
+		return nil, syscall.EINVAL
+	}
+
+	v, err := sl.Readlink(ctx)
+	if err != nil {
+		return nil, toErrno(ctx, n.relPath(), err)
+	}
+
+	return []byte(v), gofusefs.OK
+}
+
+func isWriteOpen(flags uint32) bool {
+	return flags&syscall.O_ACCMODE != syscall.O_RDONLY || flags&syscall.O_TRUNC != 0
+}
+
+func (n *overlayNode) Open(ctx context.Context, flags uint32) (gofusefs.FileHandle, uint32, syscall.Errno) {
+	rel := n.relPath()
+
+	if isWriteOpen(flags) {
+		n.ov.mu.Lock()
+		err := n.ov.copyUp(ctx, rel)
+		n.ov.mu.Unlock()
+
+		if err != nil {
+			return nil, 0, toErrno(ctx, rel, err)
+		}
+	}
+
+	e, errno := n.entry(ctx)
+	if errno != gofusefs.OK {
+		return nil, 0, errno
+	}
+
+	f, ok := e.(fs.File)
+	if !ok {
+		return nil, 0, syscall.EISDIR
+	}
+
+	if e.LocalFilesystemPath() == "" {
+		// unmodified file from the lower directory.
+		reader, err := f.Open(ctx)
+		if err != nil {
+			return nil, 0, toErrno(ctx, rel, err)
+		}
+
+		return &fuseFileHandle{reader: reader, file: f}, 0, gofusefs.OK
+	}
+
+	fd, err := syscall.Open(n.ov.upperPath(rel), int(flags)&^syscall.O_CREAT, 0)
+	if err != nil {
+		return nil, 0, toErrno(ctx, rel, err)
+	}
+
+	return gofusefs.NewLoopbackFile(fd), 0, gofusefs.OK
+}
+
+func (n *overlayNode) Create(ctx context.Context, name string, flags, mode uint32, out *fuse.EntryOut) (*gofusefs.Inode, gofusefs.FileHandle, uint32, syscall.Errno) {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath(name)
+
+	if _, err := n.ov.prepareNewEntry(ctx, rel); err != nil {
+		return nil, nil, 0, toErrno(ctx, rel, err)
+	}
+
+	fd, err := syscall.Open(n.ov.upperPath(rel), int(flags)|syscall.O_CREAT, mode)
+	if err != nil {
+		return nil, nil, 0, toErrno(ctx, rel, err)
+	}
+
+	ch, errno := n.newChild(ctx, name, out)
+	if errno != gofusefs.OK {
+		syscall.Close(fd) //nolint:errcheck
+
+		return nil, nil, 0, errno
+	}
+
+	return ch, gofusefs.NewLoopbackFile(fd), 0, gofusefs.OK
+}
+
+func (n *overlayNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*gofusefs.Inode, syscall.Errno) {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath(name)
+
+	replacesLower, err := n.ov.prepareNewEntry(ctx, rel)
+	if err != nil {
+		return nil, toErrno(ctx, rel, err)
+	}
+
+	up := n.ov.upperPath(rel)
+
+	if err := os.Mkdir(up, os.FileMode(mode).Perm()); err != nil {
+		return nil, toErrno(ctx, rel, err)
+	}
+
+	if replacesLower {
+		// new directory must not expose contents of the deleted directory.
+		if err := os.WriteFile(filepath.Join(up, overlayfs.OpaqueMarker), nil, 0o600); err != nil {
+			return nil, toErrno(ctx, rel, err)
+		}
+	}
+
+	return n.newChild(ctx, name, out)
+}
+
+func (n *overlayNode) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (*gofusefs.Inode, syscall.Errno) {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath(name)
+
+	if _, err := n.ov.prepareNewEntry(ctx, rel); err != nil {
+		return nil, toErrno(ctx, rel, err)
+	}
+
+	if err := os.Symlink(target, n.ov.upperPath(rel)); err != nil {
+		return nil, toErrno(ctx, rel, err)
+	}
+
+	return n.newChild(ctx, name, out)
+}
+
+func (n *overlayNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath(name)
+
+	e, err := n.ov.lookup(ctx, rel)
+	if err != nil {
+		return toErrno(ctx, rel, err)
+	}
+
+	if e.IsDir() {
+		return syscall.EISDIR
+	}
+
+	return toErrno(ctx, rel, n.ov.remove(ctx, rel))
+}
+
+func (n *overlayNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	rel := n.relPath(name)
+
+	e, err := n.ov.lookup(ctx, rel)
+	if err != nil {
+		return toErrno(ctx, rel, err)
+	}
+
+	d, ok := e.(fs.Directory)
+	if !ok {
+		return syscall.ENOTDIR
+	}
+
+	entries, err := fs.GetAllEntries(ctx, d)
+	if err != nil {
+		return toErrno(ctx, rel, err)
+	}
+
+	if len(entries) > 0 {
+		return syscall.ENOTEMPTY
+	}
+
+	return toErrno(ctx, rel, n.ov.remove(ctx, rel))
+}
+
+func (n *overlayNode) Rename(ctx context.Context, name string, newParent gofusefs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if flags != 0 {
+		return syscall.EINVAL
+	}
+
+	n.ov.mu.Lock()
+	defer n.ov.mu.Unlock()
+
+	src := n.relPath(name)
+	dst := path.Join(newParent.EmbeddedInode().Path(n.Root()), newName)
+
+	e, err := n.ov.lookup(ctx, src)
+	if err != nil {
+		return toErrno(ctx, src, err)
+	}
+
+	// directories from the lower directory can't be moved without copying their entire contents,
+	// EXDEV makes tools such as 'mv' fall back to copying and deleting.
+	if overlayfs.MergesLower(e) {
+		return syscall.EXDEV
+	}
+
+	if err := n.ov.copyUp(ctx, src); err != nil {
+		return toErrno(ctx, src, err)
+	}
+
+	if _, err := n.ov.prepareNewEntry(ctx, dst); err != nil {
+		return toErrno(ctx, dst, err)
+	}
+
+	replacesLower, err := n.ov.existsInLower(ctx, dst)
+	if err != nil {
+		return toErrno(ctx, dst, err)
+	}
+
+	if err := os.Rename(n.ov.upperPath(src), n.ov.upperPath(dst)); err != nil {
+		return toErrno(ctx, dst, err)
+	}
+
+	if replacesLower && e.IsDir() {
+		if err := os.WriteFile(filepath.Join(n.ov.upperPath(dst), overlayfs.OpaqueMarker), nil, 0o600); err != nil {
+			return toErrno(ctx, dst, err)
+		}
+	}
+
+	inLower, err := n.ov.existsInLower(ctx, src)
+	if err != nil || !inLower {
+		return toErrno(ctx, src, err)
+	}
+
+	wh := n.ov.upperPath(path.Join(parentPath(src), overlayfs.WhiteoutName(path.Base(src))))
+
+	return toErrno(ctx, src, os.WriteFile(wh, nil, 0o600))
+}
+
+var (
+	_ gofusefs.NodeGetattrer  = (*overlayNode)(nil)
+	_ gofusefs.NodeSetattrer  = (*overlayNode)(nil)
+	_ gofusefs.NodeLookuper   = (*overlayNode)(nil)
+	_ gofusefs.NodeReaddirer  = (*overlayNode)(nil)
+	_ gofusefs.NodeReadlinker = (*overlayNode)(nil)
+	_ gofusefs.NodeOpener     = (*overlayNode)(nil)
+	_ gofusefs.NodeCreater    = (*overlayNode)(nil)
+	_ gofusefs.NodeMkdirer    = (*overlayNode)(nil)
+	_ gofusefs.NodeSymlinker  = (*overlayNode)(nil)
+	_ gofusefs.NodeUnlinker   = (*overlayNode)(nil)
+	_ gofusefs.NodeRmdirer    = (*overlayNode)(nil)
+	_ gofusefs.NodeRenamer    = (*overlayNode)(nil)
+)
@@ -0,0 +1,78 @@
+//go:build !windows && !openbsd && !freebsd
+
+package fusemount
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs/overlayfs"
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+)
+
+func TestOverlayCopyUpAndRemove(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	lower := mockfs.NewDirectory()
+	lower.AddDir("dir1", 0o555)
+	lower.AddDir("dir1/dir2", 0o755)
+	f := lower.AddFile("dir1/dir2/file", []byte("some data"), 0o444)
+	lower.AddSymlink("dir1/link", "dir2/file", 0o777)
+
+	upper := filepath.Join(testutil.TempDirectory(t), "upper")
+
+	_, err := NewOverlayNode(lower, upper)
+	require.NoError(t, err)
+
+	o := &overlay{lower: lower, upperDir: upper}
+
+	// copying up a file creates all its parent directories with owner write access.
+	require.NoError(t, o.copyUp(ctx, "dir1/dir2/file"))
+
+	b, err := os.ReadFile(filepath.Join(upper, "dir1", "dir2", "file"))
+	require.NoError(t, err)
+	require.Equal(t, "some data", string(b))
+
+	st, err := os.Stat(filepath.Join(upper, "dir1", "dir2", "file"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o444), st.Mode().Perm())
+	require.True(t, st.ModTime().Equal(f.ModTime()))
+
+	st, err = os.Stat(filepath.Join(upper, "dir1"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), st.Mode().Perm())
+
+	require.NoError(t, o.copyUp(ctx, "dir1/link"))
+
+	target, err := os.Readlink(filepath.Join(upper, "dir1", "link"))
+	require.NoError(t, err)
+	require.Equal(t, "dir2/file", target)
+
+	// removing an entry present in the lower directory leaves a whiteout.
+	require.NoError(t, o.remove(ctx, "dir1/dir2/file"))
+	require.NoFileExists(t, filepath.Join(upper, "dir1", "dir2", "file"))
+	require.FileExists(t, filepath.Join(upper, "dir1", "dir2", overlayfs.WhiteoutName("file")))
+
+	_, err = o.lookup(ctx, "dir1/dir2/file")
+	require.Error(t, err)
+
+	// re-creating it removes the whiteout.
+	replacesLower, err := o.prepareNewEntry(ctx, "dir1/dir2/file")
+	require.NoError(t, err)
+	require.True(t, replacesLower)
+	require.NoFileExists(t, filepath.Join(upper, "dir1", "dir2", overlayfs.WhiteoutName("file")))
+
+	// removing entries that only exist in the upper directory does not leave whiteouts.
+	require.NoError(t, os.WriteFile(filepath.Join(upper, "new-file"), nil, 0o600))
+	require.NoError(t, o.remove(ctx, "new-file"))
+	require.NoFileExists(t, filepath.Join(upper, overlayfs.WhiteoutName("new-file")))
+
+	inLower, err := o.existsInLower(ctx, "dir1/dir2")
+	require.NoError(t, err)
+	require.True(t, inLower)
+}
@@ -0,0 +1,502 @@
+//go:build linux
+
+// Package linuxsnapshot creates point-in-time snapshots of Linux file systems
+// (btrfs subvolumes, ZFS datasets and LVM thin volumes) using the standard command-line tools.
+package linuxsnapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+var log = logging.Module("linuxsnapshot")
+
+const (
+	snapshotNamePrefix = "kopia-"
+	mountinfoFile      = "/proc/self/mountinfo"
+
+	// btrfs assigns this inode number to the root directory of each subvolume.
+	btrfsSubvolumeRootInode = 256
+)
+
+// CommandRunner runs the provided command and returns its standard output.
+type CommandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// Snapshot represents a point-in-time file system snapshot.
+type Snapshot struct {
+	// Path is the location of the source directory inside the snapshot.
+	Path string
+
+	cleanup []func(ctx context.Context) error
+}
+
+// Release removes the snapshot and releases all associated resources.
+func (s *Snapshot) Release(ctx context.Context) error {
+	var firstErr error
+
+	// run cleanup steps in reverse order of creation
+	for i := len(s.cleanup) - 1; i >= 0; i-- {
+		if err := s.cleanup[i](ctx); err != nil {
+			log(ctx).Errorf("snapshot cleanup failed: %v", err)
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	s.cleanup = nil
+
+	return firstErr
+}
+
+// MountInfo describes a single mounted file system.
+type MountInfo struct {
+	// Root is the directory within the file system that is mounted, which is not "/" for bind mounts.
+	Root       string
+	MountPoint string
+	FSType     string
+	Source     string
+	Options    string
+}
+
+// Creator creates file system snapshots.
+type Creator struct {
+	Run           CommandRunner
+	ReadMountInfo func() (io.ReadCloser, error)
+	IsSubvolume   func(path string) (bool, error)
+	TempDir       func() (string, error)
+}
+
+// New returns a Creator that executes the system commands.
+func New() *Creator {
+	return &Creator{
+		Run: runCommand,
+		ReadMountInfo: func() (io.ReadCloser, error) {
+			//nolint:wrapcheck
+			return os.Open(mountinfoFile)
+		},
+		IsSubvolume: isBtrfsSubvolumeRoot,
+		TempDir: func() (string, error) {
+			//nolint:wrapcheck
+			return os.MkdirTemp("", "kopia-snapshot-mount")
+		},
+	}
+}
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	c := exec.CommandContext(ctx, name, args...)
+	c.Stderr = &stderr
+
+	out, err := c.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%v %v: %v", name, strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// Create creates a snapshot of the file system containing the provided directory
+// using the specified provider (one of policy.LinuxSnapshotProvider*).
+func (c *Creator) Create(ctx context.Context, dir, provider string) (*Snapshot, error) {
+	dir = filepath.Clean(dir)
+
+	mi, err := c.findMount(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider == "" || provider == policy.LinuxSnapshotProviderAuto {
+		provider, err = c.detectProvider(ctx, mi)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{}
+
+	switch provider {
+	case policy.LinuxSnapshotProviderBtrfs:
+		err = c.createBtrfs(ctx, s, mi, dir, id)
+	case policy.LinuxSnapshotProviderZFS:
+		err = c.createZFS(ctx, s, mi, dir, id)
+	case policy.LinuxSnapshotProviderLVM:
+		err = c.createLVM(ctx, s, mi, dir, id)
+	default:
+		return nil, errors.Errorf("unsupported snapshot provider: %q", provider)
+	}
+
+	if err != nil {
+		s.Release(ctx) //nolint:errcheck
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (c *Creator) detectProvider(ctx context.Context, mi MountInfo) (string, error) {
+	// btrfs and ZFS providers are named after their file system types.
+	switch mi.FSType {
+	case policy.LinuxSnapshotProviderBtrfs, policy.LinuxSnapshotProviderZFS:
+		return mi.FSType, nil
+	}
+
+	if _, _, err := c.lvmVolume(ctx, mi.Source); err == nil {
+		return policy.LinuxSnapshotProviderLVM, nil
+	}
+
+	return "", errors.Errorf("file system %v (%v) at %v does not support snapshots", mi.Source, mi.FSType, mi.MountPoint)
+}
+
+// btrfs: read-only snapshot of the subvolume containing the directory, created inside that subvolume.
+func (c *Creator) createBtrfs(ctx context.Context, s *Snapshot, mi MountInfo, dir, id string) error {
+	subvol := dir
+
+	for {
+		ok, err := c.IsSubvolume(subvol)
+		if err != nil {
+			return errors.Wrapf(err, "unable to determine btrfs subvolume of %v", dir)
+		}
+
+		if ok || subvol == mi.MountPoint {
+			break
+		}
+
+		subvol = filepath.Dir(subvol)
+	}
+
+	rel, err := filepath.Rel(subvol, dir)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine relative path")
+	}
+
+	target := filepath.Join(subvol, "."+snapshotNamePrefix+id)
+
+	log(ctx).Infof("creating btrfs snapshot of %v at %v", subvol, target)
+
+	if _, err := c.Run(ctx, "btrfs", "subvolume", "snapshot", "-r", subvol, target); err != nil {
+		return errors.Wrap(err, "error creating btrfs snapshot")
+	}
+
+	s.cleanup = append(s.cleanup, func(ctx context.Context) error {
+		log(ctx).Infof("removing btrfs snapshot %v", target)
+
+		_, err := c.Run(ctx, "btrfs", "subvolume", "delete", target)
+
+		return errors.Wrap(err, "error removing btrfs snapshot")
+	})
+
+	s.Path = filepath.Join(target, rel)
+
+	return nil
+}
+
+// ZFS: snapshot of the dataset, accessed through the hidden .zfs/snapshot directory.
+func (c *Creator) createZFS(ctx context.Context, s *Snapshot, mi MountInfo, dir, id string) error {
+	rel, err := filepath.Rel(mi.MountPoint, dir)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine relative path")
+	}
+
+	// the .zfs directory is only present where the root of the dataset is mounted,
+	// which is not the case for bind mounts of its subdirectories.
+	datasetMountPoint := mi.MountPoint
+
+	if mi.Root != "/" {
+		dm, err := c.findDatasetMount(mi.Source)
+		if err != nil {
+			return err
+		}
+
+		datasetMountPoint = dm.MountPoint
+	}
+
+	name := snapshotNamePrefix + id
+	fullName := mi.Source + "@" + name
+
+	log(ctx).Infof("creating ZFS snapshot %v", fullName)
+
+	if _, err := c.Run(ctx, "zfs", "snapshot", fullName); err != nil {
+		return errors.Wrap(err, "error creating ZFS snapshot")
+	}
+
+	s.cleanup = append(s.cleanup, func(ctx context.Context) error {
+		log(ctx).Infof("removing ZFS snapshot %v", fullName)
+
+		_, err := c.Run(ctx, "zfs", "destroy", fullName)
+
+		return errors.Wrap(err, "error removing ZFS snapshot")
+	})
+
+	s.Path = filepath.Join(datasetMountPoint, ".zfs", "snapshot", name, mi.Root, rel)
+
+	return nil
+}
+
+// LVM: thin snapshot of the logical volume, activated and mounted read-only in a temporary directory.
+func (c *Creator) createLVM(ctx context.Context, s *Snapshot, mi MountInfo, dir, id string) error {
+	rel, err := filepath.Rel(mi.MountPoint, dir)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine relative path")
+	}
+
+	vg, lv, err := c.lvmVolume(ctx, mi.Source)
+	if err != nil {
+		return err
+	}
+
+	snapLV := vg + "/" + snapshotNamePrefix + id
+
+	log(ctx).Infof("creating LVM thin snapshot %v of %v/%v", snapLV, vg, lv)
+
+	if _, err := c.Run(ctx, "lvcreate", "--snapshot", "--name", snapshotNamePrefix+id, vg+"/"+lv); err != nil {
+		return errors.Wrap(err, "error creating LVM snapshot")
+	}
+
+	s.cleanup = append(s.cleanup, func(ctx context.Context) error {
+		log(ctx).Infof("removing LVM snapshot %v", snapLV)
+
+		_, err := c.Run(ctx, "lvremove", "--yes", snapLV)
+
+		return errors.Wrap(err, "error removing LVM snapshot")
+	})
+
+	// thin snapshots are created with activation skip flag set.
+	if _, err := c.Run(ctx, "lvchange", "--activate", "y", "--ignoreactivationskip", snapLV); err != nil {
+		return errors.Wrap(err, "error activating LVM snapshot")
+	}
+
+	mountDir, err := c.TempDir()
+	if err != nil {
+		return errors.Wrap(err, "unable to create mount directory")
+	}
+
+	s.cleanup = append(s.cleanup, func(context.Context) error {
+		return errors.Wrap(os.Remove(mountDir), "error removing mount directory")
+	})
+
+	mountOpts := "ro"
+	if mi.FSType == "xfs" {
+		// the snapshot has the same file system UUID as the origin.
+		mountOpts += ",nouuid"
+	}
+
+	if _, err := c.Run(ctx, "mount", "-t", mi.FSType, "-o", mountOpts, "/dev/"+snapLV, mountDir); err != nil {
+		return errors.Wrap(err, "error mounting LVM snapshot")
+	}
+
+	s.cleanup = append(s.cleanup, func(ctx context.Context) error {
+		_, err := c.Run(ctx, "umount", mountDir)
+
+		return errors.Wrap(err, "error unmounting LVM snapshot")
+	})
+
+	// the snapshot is mounted from the root of the file system, not the mounted directory.
+	s.Path = filepath.Join(mountDir, mi.Root, rel)
+
+	return nil
+}
+
+// lvmVolume returns the volume group and name of the thin logical volume backing the provided device.
+func (c *Creator) lvmVolume(ctx context.Context, device string) (vg, lv string, err error) {
+	if !strings.HasPrefix(device, "/dev/") {
+		return "", "", errors.Errorf("%v is not a block device", device)
+	}
+
+	out, err := c.Run(ctx, "lvs", "--noheadings", "--separator", "|", "-o", "vg_name,lv_name,pool_lv", device)
+	if err != nil {
+		return "", "", errors.Wrap(err, "not a logical volume")
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(out)), "|")
+	if len(parts) != 3 { //nolint:mnd
+		return "", "", errors.Errorf("unexpected output of lvs: %q", out)
+	}
+
+	if strings.TrimSpace(parts[2]) == "" {
+		return "", "", errors.Errorf("%v is not a thin logical volume", device)
+	}
+
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+func (c *Creator) readMounts() ([]MountInfo, error) {
+	f, err := c.ReadMountInfo()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read mount information")
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return ParseMountInfo(f)
+}
+
+func (c *Creator) findMount(dir string) (MountInfo, error) {
+	mounts, err := c.readMounts()
+	if err != nil {
+		return MountInfo{}, err
+	}
+
+	mi, ok := FindMount(mounts, dir)
+	if !ok {
+		return MountInfo{}, errors.Errorf("unable to find file system containing %v", dir)
+	}
+
+	return mi, nil
+}
+
+// findDatasetMount returns the mount of the root of the provided ZFS dataset.
+func (c *Creator) findDatasetMount(dataset string) (MountInfo, error) {
+	mounts, err := c.readMounts()
+	if err != nil {
+		return MountInfo{}, err
+	}
+
+	for _, m := range mounts {
+		if m.Source == dataset && m.Root == "/" {
+			return m, nil
+		}
+	}
+
+	return MountInfo{}, errors.Errorf("root of ZFS dataset %v is not mounted", dataset)
+}
+
+// ParseMountInfo parses the contents of /proc/self/mountinfo.
+func ParseMountInfo(r io.Reader) ([]MountInfo, error) {
+	var result []MountInfo
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		left, right, ok := strings.Cut(s.Text(), " - ")
+		if !ok {
+			continue
+		}
+
+		lf := strings.Fields(left)
+		rf := strings.Fields(right)
+
+		//nolint:mnd
+		if len(lf) < 5 || len(rf) < 2 {
+			continue
+		}
+
+		mi := MountInfo{
+			Root:       unescapeMountInfo(lf[3]),
+			MountPoint: unescapeMountInfo(lf[4]),
+			FSType:     rf[0],
+			Source:     unescapeMountInfo(rf[1]),
+		}
+
+		if len(rf) > 2 { //nolint:mnd
+			mi.Options = rf[2]
+		}
+
+		result = append(result, mi)
+	}
+
+	return result, errors.Wrap(s.Err(), "error reading mount information")
+}
+
+// FindMount returns the last mounted file system containing the provided path.
+func FindMount(mounts []MountInfo, dir string) (MountInfo, bool) {
+	var (
+		best  MountInfo
+		found bool
+	)
+
+	for _, m := range mounts {
+		if !isWithin(m.MountPoint, dir) {
+			continue
+		}
+
+		// later mounts shadow earlier ones at the same mount point.
+		if !found || len(m.MountPoint) >= len(best.MountPoint) {
+			best = m
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+func isWithin(mountPoint, dir string) bool {
+	if mountPoint == "/" || mountPoint == dir {
+		return true
+	}
+
+	return strings.HasPrefix(dir, mountPoint+"/")
+}
+
+// unescapeMountInfo decodes octal escapes (such as \040 for space) used in mountinfo.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+
+				i += 3
+
+				continue
+			}
+		}
+
+		sb.WriteByte(s[i])
+	}
+
+	return sb.String()
+}
+
+func randomID() (string, error) {
+	var b [8]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.Wrap(err, "error reading random bytes")
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// isBtrfsSubvolumeRoot determines whether the provided directory is the root of a btrfs subvolume.
+func isBtrfsSubvolumeRoot(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, errors.Wrap(err, "stat")
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false, errors.New("unable to get inode number")
+	}
+
+	return st.Ino == btrfsSubvolumeRootInode, nil
+}
@@ -0,0 +1,211 @@
+//go:build linux
+
+package linuxsnapshot
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+const testMountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+35 22 0:31 / /data rw,relatime shared:12 - btrfs /dev/sdb1 rw,subvol=/
+36 22 0:32 / /tank rw,relatime shared:13 - zfs tank/home rw,xattr
+37 22 253:3 / /srv/my\040files rw,relatime shared:14 - xfs /dev/mapper/vg0-files rw
+38 35 0:31 /sub /data/nested rw,relatime shared:12 - btrfs /dev/sdb1 rw,subvol=/sub
+39 22 0:32 /projects /work rw,relatime shared:13 - zfs tank/home rw,xattr
+40 22 253:3 /shared\040dir /exports rw,relatime shared:14 - xfs /dev/mapper/vg0-files rw
+`
+
+type fakeCommands struct {
+	calls   []string
+	outputs map[string]string
+	fail    map[string]bool
+}
+
+func (f *fakeCommands) run(_ context.Context, name string, args ...string) ([]byte, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	f.calls = append(f.calls, cmd)
+
+	if f.fail[name] {
+		return nil, errors.Errorf("%v failed", name)
+	}
+
+	return []byte(f.outputs[name]), nil
+}
+
+func newTestCreator(t *testing.T, f *fakeCommands, subvolumes ...string) *Creator {
+	t.Helper()
+
+	mountDir := filepath.Join(t.TempDir(), "mnt")
+
+	return &Creator{
+		Run: f.run,
+		ReadMountInfo: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(testMountInfo)), nil
+		},
+		IsSubvolume: func(path string) (bool, error) {
+			for _, s := range subvolumes {
+				if s == path {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+		TempDir: func() (string, error) {
+			return mountDir, os.Mkdir(mountDir, 0o700)
+		},
+	}
+}
+
+func TestFindMount(t *testing.T) {
+	mounts, err := ParseMountInfo(strings.NewReader(testMountInfo))
+	require.NoError(t, err)
+	require.Len(t, mounts, 7)
+	require.Equal(t, "/shared dir", mounts[6].Root)
+
+	cases := map[string]string{
+		"/":                   "/",
+		"/home/user":          "/",
+		"/data":               "/data",
+		"/data/x/y":           "/data",
+		"/data/nested/z":      "/data/nested",
+		"/database":           "/",
+		"/srv/my files/a":     "/srv/my files",
+		"/tank/home/projects": "/tank",
+		"/work/a":             "/work",
+	}
+
+	for dir, want := range cases {
+		mi, ok := FindMount(mounts, dir)
+		require.True(t, ok, dir)
+		require.Equal(t, want, mi.MountPoint, dir)
+	}
+}
+
+func TestCreateBtrfs(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{}
+
+	s, err := newTestCreator(t, f, "/data/x").Create(ctx, "/data/x/y", policy.LinuxSnapshotProviderAuto)
+	require.NoError(t, err)
+	require.Len(t, f.calls, 1)
+	require.True(t, strings.HasPrefix(f.calls[0], "btrfs subvolume snapshot -r /data/x /data/x/.kopia-"))
+	require.True(t, strings.HasPrefix(s.Path, "/data/x/.kopia-"))
+	require.True(t, strings.HasSuffix(s.Path, "/y"))
+
+	require.NoError(t, s.Release(ctx))
+	require.Len(t, f.calls, 2)
+	require.True(t, strings.HasPrefix(f.calls[1], "btrfs subvolume delete /data/x/.kopia-"))
+}
+
+func TestCreateZFS(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{}
+
+	s, err := newTestCreator(t, f).Create(ctx, "/tank/projects", "")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(f.calls[0], "zfs snapshot tank/home@kopia-"))
+	require.True(t, strings.HasPrefix(s.Path, "/tank/.zfs/snapshot/kopia-"))
+	require.True(t, strings.HasSuffix(s.Path, "/projects"))
+
+	require.NoError(t, s.Release(ctx))
+	require.True(t, strings.HasPrefix(f.calls[1], "zfs destroy tank/home@kopia-"))
+}
+
+func TestCreateLVM(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{
+		outputs: map[string]string{
+			"lvs": "  vg0|files|pool0\n",
+		},
+	}
+
+	s, err := newTestCreator(t, f).Create(ctx, "/srv/my files/a", policy.LinuxSnapshotProviderAuto)
+	require.NoError(t, err)
+
+	mountDir := filepath.Dir(s.Path)
+	require.Equal(t, "a", filepath.Base(s.Path))
+	require.DirExists(t, mountDir)
+
+	var names []string
+	for _, c := range f.calls {
+		names = append(names, strings.Fields(c)[0])
+	}
+
+	require.Equal(t, []string{"lvs", "lvs", "lvcreate", "lvchange", "mount"}, names)
+	require.Contains(t, f.calls[4], "-o ro,nouuid")
+
+	f.calls = nil
+
+	require.NoError(t, s.Release(ctx))
+	require.Len(t, f.calls, 2)
+	require.Equal(t, "umount "+mountDir, f.calls[0])
+	require.True(t, strings.HasPrefix(f.calls[1], "lvremove --yes vg0/kopia-"))
+	require.NoDirExists(t, mountDir)
+}
+
+func TestCreateBindMounts(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{
+		outputs: map[string]string{
+			"lvs": "vg0|files|pool0",
+		},
+	}
+
+	// snapshot of ZFS dataset is accessed where the dataset root is mounted.
+	s, err := newTestCreator(t, f).Create(ctx, "/work/a", policy.LinuxSnapshotProviderAuto)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(s.Path, "/tank/.zfs/snapshot/kopia-"))
+	require.True(t, strings.HasSuffix(s.Path, "/projects/a"))
+	require.NoError(t, s.Release(ctx))
+
+	// LVM snapshot is mounted from the root of the file system.
+	s, err = newTestCreator(t, f).Create(ctx, "/exports/b", policy.LinuxSnapshotProviderAuto)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(s.Path, "/mnt/shared dir/b"), s.Path)
+	require.NoError(t, s.Release(ctx))
+}
+
+func TestCreateLVMCleanupOnFailure(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{
+		outputs: map[string]string{
+			"lvs": "vg0|files|pool0",
+		},
+		fail: map[string]bool{
+			"lvchange": true,
+		},
+	}
+
+	_, err := newTestCreator(t, f).Create(ctx, "/srv/my files", policy.LinuxSnapshotProviderLVM)
+	require.ErrorContains(t, err, "error activating LVM snapshot")
+
+	// the snapshot that was created must be removed.
+	require.True(t, strings.HasPrefix(f.calls[len(f.calls)-1], "lvremove --yes vg0/kopia-"))
+}
+
+func TestCreateUnsupported(t *testing.T) {
+	ctx := testlogging.Context(t)
+	f := &fakeCommands{
+		fail: map[string]bool{
+			"lvs": true,
+		},
+	}
+
+	_, err := newTestCreator(t, f).Create(ctx, "/home/user", policy.LinuxSnapshotProviderAuto)
+	require.ErrorContains(t, err, "does not support snapshots")
+
+	_, err = newTestCreator(t, f).Create(ctx, "/home/user", "no-such-provider")
+	require.ErrorContains(t, err, "unsupported snapshot provider")
+}
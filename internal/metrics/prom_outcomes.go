@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// outcomeRegistry holds gauges describing outcomes of snapshots and maintenance, which are also registered
+// with the default registry. It allows writing just the outcomes to a file scraped by the node exporter
+// without conflicting with process metrics exported by it.
+//
+//nolint:gochecknoglobals
+var outcomeRegistry = prometheus.NewRegistry()
+
+// repositoryLabel identifies the repository of the outcome, so that outcomes of the same source or maintenance
+// mode in repositories served by one server don't overwrite each other. It's empty for the default repository.
+const repositoryLabel = "repository"
+
+type repositoryLabelKeyType string
+
+const repositoryLabelKey repositoryLabelKeyType = "outcomeRepository"
+
+var sourceLabels = []string{repositoryLabel, "username", "hostname", "path"} //nolint:gochecknoglobals
+
+//nolint:gochecknoglobals
+var (
+	snapshotLastRunTime = newOutcomeGaugeVec(
+		"snapshot_last_run_timestamp_seconds", "Time when the last snapshot of the source finished.", sourceLabels...)
+	snapshotLastRunSuccess = newOutcomeGaugeVec(
+		"snapshot_last_run_success", "Whether the last snapshot of the source succeeded (1) or failed (0).", sourceLabels...)
+	snapshotLastSuccessTime = newOutcomeGaugeVec(
+		"snapshot_last_success_timestamp_seconds", "Time when the last successful snapshot of the source finished.", sourceLabels...)
+	snapshotLastDuration = newOutcomeGaugeVec(
+		"snapshot_last_duration_seconds", "Duration of the last snapshot of the source.", sourceLabels...)
+	snapshotLastUploadedBytes = newOutcomeGaugeVec(
+		"snapshot_last_uploaded_bytes", "Number of bytes uploaded by the last snapshot of the source.", sourceLabels...)
+	snapshotLastFiles = newOutcomeGaugeVec(
+		"snapshot_last_files", "Number of files in the last snapshot of the source.", sourceLabels...)
+	snapshotLastErrors = newOutcomeGaugeVec(
+		"snapshot_last_errors", "Number of errors encountered by the last snapshot of the source, including ignored errors.", sourceLabels...)
+
+	maintenanceLastRunTime = newOutcomeGaugeVec(
+		"maintenance_last_run_timestamp_seconds", "Time when the last maintenance of the given mode finished.", repositoryLabel, "mode")
+	maintenanceLastRunSuccess = newOutcomeGaugeVec(
+		"maintenance_last_run_success", "Whether the last maintenance of the given mode succeeded (1) or failed (0).", repositoryLabel, "mode")
+	maintenanceLastSuccessTime = newOutcomeGaugeVec(
+		"maintenance_last_success_timestamp_seconds", "Time when the last successful maintenance of the given mode finished.", repositoryLabel, "mode")
+	maintenanceLastDuration = newOutcomeGaugeVec(
+		"maintenance_last_duration_seconds", "Duration of the last maintenance of the given mode.", repositoryLabel, "mode")
+)
+
+func newOutcomeGaugeVec(name, help string, labels ...string) *prometheus.GaugeVec {
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: prometheusPrefix + name,
+		Help: help,
+	}, labels)
+
+	prometheus.MustRegister(g)
+	outcomeRegistry.MustRegister(g)
+
+	return g
+}
+
+// SnapshotOutcome describes the outcome of a snapshot of a single source.
+type SnapshotOutcome struct {
+	Repository string // name of the repository served by the server, empty for the default repository
+
+	UserName string
+	Host     string
+	Path     string
+
+	StartTime time.Time
+	EndTime   time.Time
+
+	// Success is false when the snapshot failed or was incomplete.
+	Success bool
+
+	UploadedBytes int64
+	Files         int64
+	Errors        int64
+}
+
+// RecordSnapshotOutcome updates the Prometheus gauges of the source of the snapshot.
+func RecordSnapshotOutcome(o *SnapshotOutcome) {
+	labels := prometheus.Labels{repositoryLabel: o.Repository, "username": o.UserName, "hostname": o.Host, "path": o.Path}
+
+	snapshotLastRunTime.With(labels).Set(unixSeconds(o.EndTime))
+	snapshotLastRunSuccess.With(labels).Set(boolToFloat(o.Success))
+	snapshotLastDuration.With(labels).Set(o.EndTime.Sub(o.StartTime).Seconds())
+	snapshotLastUploadedBytes.With(labels).Set(float64(o.UploadedBytes))
+	snapshotLastFiles.With(labels).Set(float64(o.Files))
+	snapshotLastErrors.With(labels).Set(float64(o.Errors))
+
+	if o.Success {
+		snapshotLastSuccessTime.With(labels).Set(unixSeconds(o.EndTime))
+	}
+}
+
+// WithOutcomeRepository returns a context in which maintenance outcomes are recorded for the provided repository.
+func WithOutcomeRepository(ctx context.Context, repository string) context.Context {
+	return context.WithValue(ctx, repositoryLabelKey, repository)
+}
+
+// RecordMaintenanceOutcome updates the Prometheus gauges of the provided maintenance mode
+// of the repository set by WithOutcomeRepository.
+func RecordMaintenanceOutcome(ctx context.Context, mode string, startTime, endTime time.Time, success bool) {
+	repository, _ := ctx.Value(repositoryLabelKey).(string)
+	labels := prometheus.Labels{repositoryLabel: repository, "mode": mode}
+
+	maintenanceLastRunTime.With(labels).Set(unixSeconds(endTime))
+	maintenanceLastRunSuccess.With(labels).Set(boolToFloat(success))
+	maintenanceLastDuration.With(labels).Set(endTime.Sub(startTime).Seconds())
+
+	if success {
+		maintenanceLastSuccessTime.With(labels).Set(unixSeconds(endTime))
+	}
+}
+
+// WriteOutcomesToTextfile writes the gauges describing snapshot and maintenance outcomes to the provided file
+// in the text format understood by the node exporter textfile collector. The file is replaced atomically.
+func WriteOutcomesToTextfile(filename string) error {
+	return errors.Wrap(prometheus.WriteToTextfile(filename, outcomeRegistry), "unable to write metrics")
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1e3 //nolint:mnd
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
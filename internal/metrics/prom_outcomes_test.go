@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/metrics"
+)
+
+func TestWriteOutcomesToTextfile(t *testing.T) {
+	startTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	metrics.RecordSnapshotOutcome(&metrics.SnapshotOutcome{
+		UserName:      "user",
+		Host:          "host",
+		Path:          "/ok",
+		StartTime:     startTime,
+		EndTime:       startTime.Add(90 * time.Second),
+		Success:       true,
+		UploadedBytes: 1000,
+		Files:         10,
+	})
+
+	metrics.RecordSnapshotOutcome(&metrics.SnapshotOutcome{
+		UserName:  "user",
+		Host:      "host",
+		Path:      "/failed",
+		StartTime: startTime,
+		EndTime:   startTime.Add(time.Second),
+		Errors:    3,
+	})
+
+	// the same source in another repository served by the server.
+	metrics.RecordSnapshotOutcome(&metrics.SnapshotOutcome{
+		Repository: "other",
+		UserName:   "user",
+		Host:       "host",
+		Path:       "/ok",
+		StartTime:  startTime,
+		EndTime:    startTime.Add(time.Second),
+	})
+
+	ctx := context.Background()
+
+	metrics.RecordMaintenanceOutcome(ctx, "quick", startTime, startTime.Add(time.Minute), true)
+	metrics.RecordMaintenanceOutcome(ctx, "full", startTime, startTime.Add(time.Minute), false)
+	metrics.RecordMaintenanceOutcome(metrics.WithOutcomeRepository(ctx, "other"), "quick", startTime, startTime.Add(time.Minute), false)
+
+	fname := filepath.Join(t.TempDir(), "kopia.prom")
+	require.NoError(t, metrics.WriteOutcomesToTextfile(fname))
+
+	b, err := os.ReadFile(fname)
+	require.NoError(t, err)
+
+	s := string(b)
+
+	require.Contains(t, s, `kopia_snapshot_last_run_success{hostname="host",path="/ok",repository="",username="user"} 1`+"\n")
+	require.Contains(t, s, `kopia_snapshot_last_duration_seconds{hostname="host",path="/ok",repository="",username="user"} 90`+"\n")
+	require.Contains(t, s, `kopia_snapshot_last_uploaded_bytes{hostname="host",path="/ok",repository="",username="user"} 1000`+"\n")
+	require.Contains(t, s, `kopia_snapshot_last_success_timestamp_seconds{hostname="host",path="/ok",repository="",username="user"} 1.704164735e+09`+"\n")
+	require.Contains(t, s, `kopia_snapshot_last_run_success{hostname="host",path="/failed",repository="",username="user"} 0`+"\n")
+	require.Contains(t, s, `kopia_snapshot_last_errors{hostname="host",path="/failed",repository="",username="user"} 3`+"\n")
+	require.NotContains(t, s, `kopia_snapshot_last_success_timestamp_seconds{hostname="host",path="/failed"`)
+	require.Contains(t, s, `kopia_snapshot_last_run_success{hostname="host",path="/ok",repository="other",username="user"} 0`+"\n")
+
+	require.Contains(t, s, `kopia_maintenance_last_run_success{mode="quick",repository=""} 1`+"\n")
+	require.Contains(t, s, `kopia_maintenance_last_run_success{mode="full",repository=""} 0`+"\n")
+	require.Contains(t, s, `kopia_maintenance_last_run_success{mode="quick",repository="other"} 0`+"\n")
+	require.NotContains(t, s, `kopia_maintenance_last_success_timestamp_seconds{mode="full"`)
+
+	// process metrics are not included.
+	require.NotContains(t, s, "go_goroutines")
+}
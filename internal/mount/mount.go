@@ -4,11 +4,17 @@
 import (
 	"context"
 
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
 
 var log = logging.Module("mount")
 
+var errOverlayNotSupported = errors.New("overlay mounts are only supported using FUSE")
+
 // Controller allows controlling mounts.
 type Controller interface {
 	Unmount(ctx context.Context) error
@@ -25,4 +31,19 @@ type Options struct {
 	FuseAllowNonEmptyMount bool
 	// Use WebDAV even on platforms that support FUSE.
 	PreferWebDAV bool
+	// OverlayDir makes the mount writable, storing all modifications in the given local directory.
+	// Supported only on FUSE.
+	OverlayDir string
+	// TimeTravel presents the directory returned by snapshotfs.AllSourcesEntry() organized by path,
+	// with each directory containing a virtual '.snapshots' directory listing all its versions.
+	TimeTravel bool
+}
+
+// rootDirectory returns the directory to be mounted according to the options.
+func (o *Options) rootDirectory(entry fs.Directory) fs.Directory {
+	if o.TimeTravel {
+		return snapshotfs.TimeTravelView(entry)
+	}
+
+	return entry
 }
@@ -20,7 +20,18 @@
 //nolint:gochecknoglobals
 var cacheTimeout = 30 * time.Second
 
+// overlay mounts are writable, so attributes are cached only briefly.
+//
+//nolint:gochecknoglobals
+var overlayCacheTimeout = time.Second
+
 func (mo *Options) toFuseMountOptions() *gofusefs.Options {
+	timeout := &cacheTimeout
+	if mo.OverlayDir != "" {
+		// writable filesystem, attributes must reflect changes made outside of the mount.
+		timeout = &overlayCacheTimeout
+	}
+
 	o := &gofusefs.Options{
 		MountOptions: fuse.MountOptions{
 			AllowOther: mo.FuseAllowOther,
@@ -28,9 +39,9 @@ func (mo *Options) toFuseMountOptions() *gofusefs.Options {
 			FsName:     "kopia",
 			Debug:      os.Getenv("KOPIA_DEBUG_FUSE") != "",
 		},
-		EntryTimeout:    &cacheTimeout,
-		AttrTimeout:     &cacheTimeout,
-		NegativeTimeout: &cacheTimeout,
+		EntryTimeout:    timeout,
+		AttrTimeout:     timeout,
+		NegativeTimeout: timeout,
 	}
 
 	o.Options = append(o.Options, "noatime")
@@ -43,6 +54,8 @@ func (mo *Options) toFuseMountOptions() *gofusefs.Options {
 
 // Directory mounts the given directory using FUSE.
 func Directory(ctx context.Context, entry fs.Directory, mountPoint string, mountOptions Options) (Controller, error) {
+	entry = mountOptions.rootDirectory(entry)
+
 	isTempDir := false
 
 	if mountPoint == "*" {
@@ -57,11 +70,23 @@ func Directory(ctx context.Context, entry fs.Directory, mountPoint string, mount
 	}
 
 	if mountOptions.PreferWebDAV {
+		if mountOptions.OverlayDir != "" {
+			return nil, errOverlayNotSupported
+		}
+
 		return newPosixWedavController(ctx, entry, mountPoint, isTempDir)
 	}
 
 	rootNode := fusemount.NewDirectoryNode(entry)
 
+	if mountOptions.OverlayDir != "" {
+		var err error
+
+		if rootNode, err = fusemount.NewOverlayNode(entry, mountOptions.OverlayDir); err != nil {
+			return nil, errors.Wrap(err, "unable to create overlay")
+		}
+	}
+
 	fuseServer, err := gofusefs.Mount(mountPoint, rootNode, mountOptions.toFuseMountOptions())
 	if err != nil {
 		return nil, errors.Wrap(err, "mounting error")
@@ -14,12 +14,16 @@
 )
 
 // Directory mounts a given directory under a provided drive letter.
-func Directory(ctx context.Context, entry fs.Directory, driveLetter string, _ Options) (Controller, error) {
+func Directory(ctx context.Context, entry fs.Directory, driveLetter string, mountOptions Options) (Controller, error) {
 	if !isValidWindowsDriveOrAsterisk(driveLetter) {
 		return nil, errors.New("must be a valid drive letter or asterisk")
 	}
 
-	c, err := DirectoryWebDAV(ctx, entry)
+	if mountOptions.OverlayDir != "" {
+		return nil, errOverlayNotSupported
+	}
+
+	c, err := DirectoryWebDAV(ctx, mountOptions.rootDirectory(entry))
 	if err != nil {
 		return nil, err
 	}
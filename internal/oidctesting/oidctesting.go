@@ -0,0 +1,237 @@
+// Package oidctesting implements an in-process OpenID Connect issuer for testing.
+package oidctesting
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	// TestClientID is the client ID registered with the test issuer.
+	TestClientID = "kopia-test-client"
+
+	// TestClientSecret is the client secret registered with the test issuer.
+	TestClientSecret = "kopia-test-secret"
+
+	testKeyID      = "test-key"
+	testTokenTTL   = time.Hour
+	authorizePath  = "/authorize"
+	tokenPath      = "/token"
+	jwksPath       = "/jwks"
+	discoveryPath  = "/.well-known/openid-configuration"
+	codeQueryParam = "code"
+)
+
+// Issuer is an in-process OpenID Connect issuer, which immediately authorizes every login as
+// the user with claims provided by SetLoginClaims. Logins must use PKCE with the S256 method.
+type Issuer struct {
+	URL string
+
+	t   *testing.T
+	key *ecdsa.PrivateKey
+
+	mu sync.Mutex
+	// +checklocks:mu
+	loginClaims jwt.MapClaims
+	// +checklocks:mu
+	codes map[string]authorization
+}
+
+// authorization is the login authorized by an authorization code.
+type authorization struct {
+	claims        jwt.MapClaims
+	nonce         string
+	codeChallenge string
+}
+
+// NewIssuer starts a new test issuer which is stopped at the end of the test.
+func NewIssuer(t *testing.T) *Issuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	iss := &Issuer{
+		t:     t,
+		key:   key,
+		codes: map[string]authorization{},
+	}
+
+	m := http.NewServeMux()
+	m.HandleFunc(discoveryPath, iss.handleDiscovery)
+	m.HandleFunc(jwksPath, iss.handleJWKS)
+	m.HandleFunc(authorizePath, iss.handleAuthorize)
+	m.HandleFunc(tokenPath, iss.handleToken)
+
+	hs := httptest.NewServer(m)
+	t.Cleanup(hs.Close)
+
+	iss.URL = hs.URL
+
+	return iss
+}
+
+// SetLoginClaims sets the claims of ID tokens issued for subsequent logins.
+func (i *Issuer) SetLoginClaims(claims jwt.MapClaims) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.loginClaims = claims
+}
+
+// IDToken returns a signed ID token with the provided claims. The issuer, audience and expiration
+// claims are added unless provided.
+func (i *Issuer) IDToken(claims jwt.MapClaims) string {
+	i.t.Helper()
+
+	now := clock.Now()
+
+	c := jwt.MapClaims{
+		"iss": i.URL,
+		"aud": TestClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(testTokenTTL).Unix(),
+	}
+
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodES256, c)
+	tok.Header["kid"] = testKeyID
+
+	s, err := tok.SignedString(i.key)
+	require.NoError(i.t, err)
+
+	return s
+}
+
+func (i *Issuer) handleDiscovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + authorizePath,
+		"token_endpoint":         i.URL + tokenPath,
+		"jwks_uri":               i.URL + jwksPath,
+	})
+}
+
+func (i *Issuer) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	enc := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	writeJSON(w, map[string]any{
+		"keys": []map[string]string{
+			{
+				"kid": testKeyID,
+				"kty": "EC",
+				"use": "sig",
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   enc(i.key.X.FillBytes(make([]byte, 32))), //nolint:mnd
+				"y":   enc(i.key.Y.FillBytes(make([]byte, 32))), //nolint:mnd
+			},
+		},
+	})
+}
+
+// handleAuthorize logs in the user without any interaction and redirects back to the client with a new authorization code.
+func (i *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	if q.Get("client_id") != TestClientID {
+		http.Error(w, "invalid client", http.StatusBadRequest)
+		return
+	}
+
+	redirectURL, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "missing code_challenge", http.StatusBadRequest)
+		return
+	}
+
+	code := uuid.NewString()
+
+	i.mu.Lock()
+	i.codes[code] = authorization{i.loginClaims, q.Get("nonce"), q.Get("code_challenge")}
+	i.mu.Unlock()
+
+	rq := redirectURL.Query()
+	rq.Set(codeQueryParam, code)
+	rq.Set("state", q.Get("state"))
+	redirectURL.RawQuery = rq.Encode()
+
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
+
+func (i *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	if clientID != TestClientID || clientSecret != TestClientSecret {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PostFormValue(codeQueryParam)
+
+	i.mu.Lock()
+	a, ok := i.codes[code]
+	delete(i.codes, code)
+	i.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+
+	if oauth2.S256ChallengeFromVerifier(r.PostFormValue("code_verifier")) != a.codeChallenge {
+		http.Error(w, "invalid code_verifier", http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{}
+
+	for k, v := range a.claims {
+		claims[k] = v
+	}
+
+	if a.nonce != "" {
+		claims["nonce"] = a.nonce
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": uuid.NewString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(testTokenTTL.Seconds()),
+		"id_token":     i.IDToken(claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck
+}
@@ -0,0 +1,195 @@
+// Package pullsource manages snapshot sources which the server snapshots by reading files from remote hosts,
+// which don't need to run kopia.
+package pullsource
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// ManifestType is the type of the manifest used to represent pull sources.
+const ManifestType = "pullsource"
+
+// SourceLabel is the manifest label identifying pull sources by the snapshot source they produce.
+const SourceLabel = "source"
+
+// ProtocolSFTP is the protocol used to read files from remote hosts over SFTP.
+const ProtocolSFTP = "sftp"
+
+// ErrPullSourceNotFound is returned to indicate that a pull source was not found in the system.
+var ErrPullSourceNotFound = errors.New("pull source not found")
+
+// Source describes a snapshot source whose files are read from a remote host using the provided protocol.
+// Source.Path is the path of the root directory on the remote host.
+type Source struct {
+	ManifestID manifest.ID `json:"-"`
+
+	Source   snapshot.SourceInfo `json:"source"`
+	Protocol string              `json:"protocol"`
+
+	// Config holds protocol-specific connection options. Since the manifest is not encrypted separately
+	// from other metadata, the options must refer to credentials stored on the server instead of including them.
+	Config json.RawMessage `json:"config"`
+}
+
+// Opener opens the root directory at the provided path on a remote host.
+// The returned closer must be called once the directory is no longer used.
+type Opener func(ctx context.Context, config json.RawMessage, path string) (fs.Directory, io.Closer, error)
+
+// ConfigValidator returns an error if the protocol-specific connection options are invalid.
+type ConfigValidator func(config json.RawMessage) error
+
+type protocolHandler struct {
+	open     Opener
+	validate ConfigValidator
+}
+
+//nolint:gochecknoglobals
+var (
+	protocolsMu sync.Mutex
+	// +checklocks:protocolsMu
+	protocols = map[string]protocolHandler{}
+)
+
+// RegisterProtocol registers the opener and optional config validator for the provided protocol.
+// It should typically be called from init() functions.
+func RegisterProtocol(protocol string, o Opener, v ConfigValidator) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+
+	protocols[protocol] = protocolHandler{o, v}
+}
+
+func getProtocol(protocol string) (protocolHandler, error) {
+	protocolsMu.Lock()
+	defer protocolsMu.Unlock()
+
+	h, ok := protocols[protocol]
+	if !ok {
+		return protocolHandler{}, errors.Errorf("unsupported pull source protocol %q", protocol)
+	}
+
+	return h, nil
+}
+
+// Open connects to the remote host and returns the root directory of the source.
+func (s *Source) Open(ctx context.Context) (fs.Directory, io.Closer, error) {
+	h, err := getProtocol(s.Protocol)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h.open(ctx, s.Config, s.Source.Path)
+}
+
+// Validate returns an error if the pull source is invalid.
+func (s *Source) Validate() error {
+	if s.Source.Host == "" || s.Source.UserName == "" || s.Source.Path == "" {
+		return errors.New("pull source must specify username, hostname and path")
+	}
+
+	if !strings.HasPrefix(s.Source.Path, "/") {
+		return errors.New("pull source path must be absolute")
+	}
+
+	h, err := getProtocol(s.Protocol)
+	if err != nil {
+		return err
+	}
+
+	if h.validate == nil {
+		return nil
+	}
+
+	return h.validate(s.Config)
+}
+
+// LoadMap returns the map of all pull sources in the repository by snapshot source.
+func LoadMap(ctx context.Context, rep repo.Repository) (map[snapshot.SourceInfo]*Source, error) {
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: ManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing pull source manifests")
+	}
+
+	result := map[snapshot.SourceInfo]*Source{}
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, SourceLabel) {
+		s := &Source{}
+		if _, err := rep.GetManifest(ctx, m.ID, s); err != nil {
+			return nil, errors.Wrapf(err, "error loading pull source manifest %v", m.Labels[SourceLabel])
+		}
+
+		s.ManifestID = m.ID
+
+		result[s.Source] = s
+	}
+
+	return result, nil
+}
+
+// List gets the list of all pull sources in the system sorted by source.
+func List(ctx context.Context, rep repo.Repository) ([]*Source, error) {
+	sources, err := LoadMap(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.SortedFunc(maps.Values(sources), func(s1, s2 *Source) int {
+		return strings.Compare(s1.Source.String(), s2.Source.String())
+	}), nil
+}
+
+// Set creates or updates the pull source.
+func Set(ctx context.Context, w repo.RepositoryWriter, s *Source) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	id, err := w.ReplaceManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: ManifestType,
+		SourceLabel:           s.Source.String(),
+	}, s)
+	if err != nil {
+		return errors.Wrap(err, "error saving pull source")
+	}
+
+	s.ManifestID = id
+
+	return nil
+}
+
+// Delete removes the pull source, existing snapshots of the source are not affected.
+// Returns ErrPullSourceNotFound when the pull source does not exist.
+func Delete(ctx context.Context, w repo.RepositoryWriter, src snapshot.SourceInfo) error {
+	manifests, err := w.FindManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: ManifestType,
+		SourceLabel:           src.String(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error looking for pull source")
+	}
+
+	if len(manifests) == 0 {
+		return errors.Wrap(ErrPullSourceNotFound, src.String())
+	}
+
+	for _, m := range manifests {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error deleting pull source %v", src)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+//go:build !no_extra_providers
+
+package pullsource
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/sftpfs"
+	"github.com/kopia/kopia/repo/blob/sftp"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// NewSFTP returns a pull source which reads the provided path on a remote host over SFTP.
+// The source is attributed to the SFTP username and host.
+//
+// The server authenticates with the private key file at opt.Keyfile, which must be accessible to the server.
+// Passwords and key data are not supported, since they would be stored in the repository in plain text,
+// and neither are external SSH commands.
+func NewSFTP(opt *sftp.Options, path string) (*Source, error) {
+	if err := validateSFTPOptions(opt); err != nil {
+		return nil, err
+	}
+
+	cfg, err := json.Marshal(opt)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal SFTP options")
+	}
+
+	return &Source{
+		Source: snapshot.SourceInfo{
+			UserName: opt.Username,
+			Host:     opt.Host,
+			Path:     path,
+		},
+		Protocol: ProtocolSFTP,
+		Config:   cfg,
+	}, nil
+}
+
+func validateSFTPOptions(opt *sftp.Options) error {
+	switch {
+	case opt.ExternalSSH:
+		return errors.New("external SSH commands are not supported")
+
+	case opt.Password != "" || opt.KeyData != "":
+		return errors.New("passwords and key data are not supported, use a key file accessible to the server")
+
+	case opt.Keyfile == "" || !filepath.IsAbs(opt.Keyfile):
+		return errors.New("absolute path of a key file accessible to the server is required")
+
+	default:
+		return nil
+	}
+}
+
+func parseSFTPOptions(config json.RawMessage) (*sftp.Options, error) {
+	var opt sftp.Options
+
+	if err := json.Unmarshal(config, &opt); err != nil {
+		return nil, errors.Wrap(err, "invalid SFTP options")
+	}
+
+	if err := validateSFTPOptions(&opt); err != nil {
+		return nil, errors.Wrap(err, "invalid SFTP options")
+	}
+
+	return &opt, nil
+}
+
+func validateSFTPConfig(config json.RawMessage) error {
+	_, err := parseSFTPOptions(config)
+
+	return err
+}
+
+func openSFTP(ctx context.Context, config json.RawMessage, path string) (fs.Directory, io.Closer, error) {
+	// options are validated again, since pull sources may have been saved before validation was added.
+	opt, err := parseSFTPOptions(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cli, closer, err := sftp.NewClient(ctx, opt)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to connect to SFTP server")
+	}
+
+	dir, err := sftpfs.Directory(cli, path)
+	if err != nil {
+		closer.Close() //nolint:errcheck
+
+		return nil, nil, errors.Wrapf(err, "unable to open %v on SFTP server", path)
+	}
+
+	return dir, closer, nil
+}
+
+func init() {
+	RegisterProtocol(ProtocolSFTP, openSFTP, validateSFTPConfig)
+}
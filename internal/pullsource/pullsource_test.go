@@ -0,0 +1,116 @@
+package pullsource_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/virtualfs"
+	"github.com/kopia/kopia/internal/pullsource"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob/sftp"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func init() {
+	pullsource.RegisterProtocol("test-virtual", func(_ context.Context, config json.RawMessage, path string) (fs.Directory, io.Closer, error) {
+		var name string
+
+		if err := json.Unmarshal(config, &name); err != nil {
+			return nil, nil, err
+		}
+
+		return virtualfs.NewStaticDirectory(name+":"+path, nil), nopCloser{}, nil
+	}, func(config json.RawMessage) error {
+		var name string
+
+		return json.Unmarshal(config, &name)
+	})
+}
+
+func TestPullSourceValidate(t *testing.T) {
+	si := snapshot.SourceInfo{UserName: "user", Host: "host", Path: "/data"}
+
+	require.NoError(t, (&pullsource.Source{Source: si, Protocol: "test-virtual", Config: json.RawMessage(`"name"`)}).Validate())
+	require.Error(t, (&pullsource.Source{Source: si, Protocol: "test-virtual", Config: json.RawMessage(`{}`)}).Validate())
+	require.Error(t, (&pullsource.Source{Source: si, Protocol: "no-such-protocol"}).Validate())
+	require.Error(t, (&pullsource.Source{Source: snapshot.SourceInfo{Host: "host", Path: "/data"}, Protocol: "test-virtual", Config: json.RawMessage(`"name"`)}).Validate())
+	require.Error(t, (&pullsource.Source{Source: snapshot.SourceInfo{UserName: "user", Host: "host", Path: "data"}, Protocol: "test-virtual", Config: json.RawMessage(`"name"`)}).Validate())
+}
+
+func TestPullSources(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	si1 := snapshot.SourceInfo{UserName: "user", Host: "host1", Path: "/data"}
+	si2 := snapshot.SourceInfo{UserName: "user", Host: "host2", Path: "/data"}
+
+	require.NoError(t, pullsource.Set(ctx, env.RepositoryWriter, &pullsource.Source{Source: si2, Protocol: "test-virtual", Config: json.RawMessage(`"old"`)}))
+	require.NoError(t, pullsource.Set(ctx, env.RepositoryWriter, &pullsource.Source{Source: si1, Protocol: "test-virtual", Config: json.RawMessage(`"one"`)}))
+	require.NoError(t, pullsource.Set(ctx, env.RepositoryWriter, &pullsource.Source{Source: si2, Protocol: "test-virtual", Config: json.RawMessage(`"two"`)}))
+	require.Error(t, pullsource.Set(ctx, env.RepositoryWriter, &pullsource.Source{Source: si1, Protocol: "no-such-protocol"}))
+
+	sources, err := pullsource.List(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+	require.Equal(t, si1, sources[0].Source)
+	require.Equal(t, si2, sources[1].Source)
+
+	dir, closer, err := sources[1].Open(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "two:/data", dir.Name())
+	require.NoError(t, closer.Close())
+
+	require.NoError(t, pullsource.Delete(ctx, env.RepositoryWriter, si1))
+	require.ErrorIs(t, pullsource.Delete(ctx, env.RepositoryWriter, si1), pullsource.ErrPullSourceNotFound)
+
+	m, err := pullsource.LoadMap(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, m, 1)
+	require.NotNil(t, m[si2])
+}
+
+func TestNewSFTP(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	ps, err := pullsource.NewSFTP(&sftp.Options{Host: "remote", Port: 22, Username: "alice", Keyfile: "/etc/kopia/id_ed25519"}, "/home/alice")
+	require.NoError(t, err)
+	require.Equal(t, snapshot.SourceInfo{UserName: "alice", Host: "remote", Path: "/home/alice"}, ps.Source)
+	require.Equal(t, pullsource.ProtocolSFTP, ps.Protocol)
+	require.NoError(t, ps.Validate())
+
+	var opt sftp.Options
+
+	require.NoError(t, json.Unmarshal(ps.Config, &opt))
+	require.Equal(t, "/etc/kopia/id_ed25519", opt.Keyfile)
+
+	// credentials can't be stored in the repository and external commands can't be executed by the server.
+	for _, opt := range []*sftp.Options{
+		{Host: "remote", Username: "alice", Password: "secret"},
+		{Host: "remote", Username: "alice", KeyData: "private-key"},
+		{Host: "remote", Username: "alice", Keyfile: "/etc/kopia/id_ed25519", Password: "secret"},
+		{Host: "remote", Username: "alice", Keyfile: "id_ed25519"},
+		{Host: "remote", Username: "alice", Keyfile: "/etc/kopia/id_ed25519", ExternalSSH: true, SSHCommand: "/bin/sh"},
+	} {
+		_, err := pullsource.NewSFTP(opt, "/home/alice")
+		require.Error(t, err)
+
+		cfg, err := json.Marshal(opt)
+		require.NoError(t, err)
+
+		ps := &pullsource.Source{Source: snapshot.SourceInfo{UserName: "alice", Host: "remote", Path: "/home/alice"}, Protocol: pullsource.ProtocolSFTP, Config: cfg}
+		require.Error(t, ps.Validate())
+
+		// pull sources saved before options were validated are not opened either.
+		_, _, err = ps.Open(ctx)
+		require.ErrorContains(t, err, "invalid SFTP options")
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"html/template"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// browsePathPrefix is the URL prefix of the browsable tree of snapshots, which is organized
+// as /browse/<user@host>/<source>/<snapshot>/<path>.
+const browsePathPrefix = "/browse/"
+
+// browseSnapshotRootDepth is the number of path elements leading to the root of a snapshot.
+const browseSnapshotRootDepth = 3
+
+var browseDirectoryTemplate = template.Must(template.New("browse").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+{{if .ZipArchiveURL}}<p><a href="{{.ZipArchiveURL}}">Download as ZIP</a></p>{{end}}
+<table>
+<tr><th>Name</th><th>Mode</th><th>Size</th><th>Modified</th></tr>
+{{if .ParentURL}}<tr><td><a href="{{.ParentURL}}">../</a></td><td></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td>{{if .URL}}<a href="{{.URL}}">{{.Name}}{{if eq .Type "d"}}/{{end}}</a>{{else}}{{.Name}} -&gt; {{.LinkTarget}}{{end}}</td><td>{{.Mode}}</td><td>{{if ne .Type "d"}}{{.Size}}{{end}}</td><td>{{.MTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// handleBrowse serves the tree of snapshot sources, snapshots and their contents visible to the
+// authenticated user. Directories are listed as HTML or JSON (with '?format=json' or 'Accept: application/json')
+// and can be downloaded as ZIP archives with '?download=zip', files are served with support for range requests.
+func handleBrowse(ctx context.Context, rc requestContext) {
+	if rc.rep == nil {
+		http.Error(rc.w, "not connected", http.StatusServiceUnavailable)
+		return
+	}
+
+	parts := browsePathElements(rc.req.URL.Path)
+
+	e, err := findBrowseEntry(ctx, &browseDirectory{snapshotfs.AllSourcesEntry(rc.rep), browseSourceFilter(ctx, rc)}, parts)
+	if errors.Is(err, fs.ErrEntryNotFound) {
+		http.Error(rc.w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		userLog(ctx).Errorf("unable to browse %v: %v", rc.req.URL.Path, err)
+		http.Error(rc.w, "internal server error", http.StatusInternalServerError)
+
+		return
+	}
+
+	switch e := e.(type) {
+	case fs.Directory:
+		if rc.queryParam("download") == "zip" {
+			serveBrowseZipArchive(ctx, rc, e, parts)
+			return
+		}
+
+		serveBrowseDirectory(ctx, rc, e, parts)
+
+	case fs.File:
+		serveBrowseFile(ctx, rc, e)
+
+	default:
+		http.Error(rc.w, "unsupported entry type", http.StatusBadRequest)
+	}
+}
+
+func browsePathElements(p string) []string {
+	var result []string
+
+	for _, part := range strings.Split(strings.TrimPrefix(p, browsePathPrefix), "/") {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
+
+func findBrowseEntry(ctx context.Context, root fs.Directory, parts []string) (fs.Entry, error) {
+	var current fs.Entry = root
+
+	for _, part := range parts {
+		dir, ok := current.(fs.Directory)
+		if !ok || part == "." || part == ".." {
+			return nil, fs.ErrEntryNotFound
+		}
+
+		e, err := dir.Child(ctx, part)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %v", part)
+		}
+
+		current = e
+	}
+
+	return current, nil
+}
+
+// browseSourceFilter returns a function that determines whether the user making the request
+// can read the snapshots of a given source. The UI user can read all snapshots.
+func browseSourceFilter(ctx context.Context, rc requestContext) func(src snapshot.SourceInfo) bool {
+	if requireUIUser(ctx, rc) {
+		return func(snapshot.SourceInfo) bool { return true }
+	}
+
+	authz := rc.srv.getAuthorizer().Authorize(ctx, rc.rep, rc.username, rc.groups)
+	if authz == nil {
+		authz = auth.NoAccess()
+	}
+
+	return func(src snapshot.SourceInfo) bool {
+		return authz.ManifestAccessLevel(map[string]string{
+			manifest.TypeLabelKey:  snapshot.ManifestType,
+			snapshot.UsernameLabel: src.UserName,
+			snapshot.HostnameLabel: src.Host,
+			snapshot.PathLabel:     src.Path,
+		}) >= auth.AccessLevelRead
+	}
+}
+
+// browseDirectory wraps the directories returned by snapshotfs.AllSourcesEntry() and the
+// user@host directories below it to hide sources the user is not allowed to read.
+type browseDirectory struct {
+	fs.Directory
+
+	canRead func(src snapshot.SourceInfo) bool
+}
+
+func (d *browseDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	e, err := d.Directory.Child(ctx, name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return d.filter(ctx, e)
+}
+
+func (d *browseDirectory) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	entries, err := fs.GetAllEntries(ctx, d.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list directory")
+	}
+
+	var result []fs.Entry
+
+	for _, e := range entries {
+		f, err := d.filter(ctx, e)
+		if errors.Is(err, fs.ErrEntryNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, f)
+	}
+
+	return fs.StaticIterator(result, nil), nil
+}
+
+// filter returns the provided entry if it's visible to the user or fs.ErrEntryNotFound.
+func (d *browseDirectory) filter(ctx context.Context, e fs.Entry) (fs.Entry, error) {
+	if src, ok := snapshotfs.SnapshotSourceOf(e); ok {
+		if !d.canRead(src) {
+			return nil, fs.ErrEntryNotFound
+		}
+
+		return e, nil
+	}
+
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return e, nil
+	}
+
+	// user@host directories are only visible if they have any visible sources.
+	userHost := &browseDirectory{dir, d.canRead}
+
+	entries, err := fs.GetAllEntries(ctx, userHost)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list %v", e.Name())
+	}
+
+	if len(entries) == 0 {
+		return nil, fs.ErrEntryNotFound
+	}
+
+	return userHost, nil
+}
+
+func browseURL(parts []string) string {
+	u := browsePathPrefix
+
+	for _, p := range parts {
+		u += url.PathEscape(p) + "/"
+	}
+
+	return u
+}
+
+func serveBrowseDirectory(ctx context.Context, rc requestContext, dir fs.Directory, parts []string) {
+	entries, err := fs.GetAllEntries(ctx, dir)
+	if err != nil {
+		userLog(ctx).Errorf("unable to list %v: %v", rc.req.URL.Path, err)
+		http.Error(rc.w, "unable to list directory", http.StatusInternalServerError)
+
+		return
+	}
+
+	// snapshot directories don't guarantee any particular order of entries, list them by name.
+	slices.SortFunc(entries, func(a, b fs.Entry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	resp := &serverapi.BrowseResponse{
+		Path:    "/" + path.Join(parts...),
+		Entries: []*serverapi.BrowseEntry{},
+	}
+
+	dirURL := browseURL(parts)
+
+	if len(parts) >= browseSnapshotRootDepth {
+		resp.ZipArchiveURL = dirURL + "?download=zip"
+	}
+
+	for _, e := range entries {
+		be := &serverapi.BrowseEntry{
+			Name:  e.Name(),
+			Mode:  e.Mode().String(),
+			Size:  e.Size(),
+			MTime: e.ModTime(),
+			URL:   dirURL + url.PathEscape(e.Name()),
+		}
+
+		switch e := e.(type) {
+		case fs.Directory:
+			be.Type = "d"
+			be.URL += "/"
+		case fs.Symlink:
+			// symbolic links are listed with their targets, but can't be opened.
+			be.Type = "s"
+			be.URL = ""
+
+			if be.LinkTarget, err = e.Readlink(ctx); err != nil {
+				userLog(ctx).Errorf("unable to read link %v: %v", e.Name(), err)
+			}
+		default:
+			be.Type = "f"
+		}
+
+		resp.Entries = append(resp.Entries, be)
+	}
+
+	if rc.queryParam("format") == "json" || strings.Contains(rc.req.Header.Get("Accept"), "application/json") {
+		rc.w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(rc.w).Encode(resp); err != nil {
+			userLog(ctx).Errorf("error writing response: %v", err)
+		}
+
+		return
+	}
+
+	data := struct {
+		*serverapi.BrowseResponse
+
+		ParentURL string
+	}{BrowseResponse: resp}
+
+	if len(parts) > 0 {
+		data.ParentURL = browseURL(parts[:len(parts)-1])
+	}
+
+	rc.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if err := browseDirectoryTemplate.Execute(rc.w, data); err != nil {
+		userLog(ctx).Errorf("error writing response: %v", err)
+	}
+}
+
+func serveBrowseFile(ctx context.Context, rc requestContext, f fs.File) {
+	r, err := f.Open(ctx)
+	if err != nil {
+		userLog(ctx).Errorf("unable to open %v: %v", rc.req.URL.Path, err)
+		http.Error(rc.w, "unable to open file", http.StatusInternalServerError)
+
+		return
+	}
+
+	defer r.Close() //nolint:errcheck
+
+	// files in snapshots are written by repository users, so they must never be rendered on the origin of the UI,
+	// where scripts in them could call the UI API on behalf of the UI user.
+	rc.w.Header().Set("Content-Type", "application/octet-stream")
+	rc.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name()}))
+	rc.w.Header().Set("X-Content-Type-Options", "nosniff")
+	rc.w.Header().Set("Content-Security-Policy", "sandbox")
+
+	http.ServeContent(rc.w, rc.req, f.Name(), f.ModTime(), r)
+}
+
+func serveBrowseZipArchive(ctx context.Context, rc requestContext, dir fs.Directory, parts []string) {
+	if len(parts) < browseSnapshotRootDepth {
+		http.Error(rc.w, "only directories inside snapshots can be downloaded", http.StatusBadRequest)
+		return
+	}
+
+	rc.w.Header().Set("Content-Type", "application/zip")
+	rc.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": dir.Name() + ".zip"}))
+
+	// errors after this point can't be reported to the client, since the response has started.
+	if _, err := restore.Entry(ctx, rc.rep, restore.NewZipOutput(nopWriteCloser{rc.w}, zip.Deflate), dir, restore.Options{
+		RestoreDirEntryAtDepth: math.MaxInt32,
+	}); err != nil {
+		userLog(ctx).Errorf("error writing ZIP archive of %v: %v", rc.req.URL.Path, err)
+	}
+}
+
+// nopWriteCloser allows the response to be used as restore output, which closes its writer when done.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,180 @@
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestBrowse(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	ownSource := snapshot.SourceInfo{UserName: servertesting.TestUsername, Host: servertesting.TestHostname, Path: "/data"}
+	otherSource := snapshot.SourceInfo{UserName: "other", Host: "other-host", Path: "/other"}
+
+	require.NoError(t, repo.WriteSession(ctx, env.Repository, repo.WriteSessionOptions{Purpose: "Test"}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		u := upload.NewUploader(w)
+
+		dir := mockfs.NewDirectory()
+		dir.AddFile("file1", []byte("0123456789"), 0o644)
+		dir.AddFile("page.html", []byte("<script>alert(1)</script>"), 0o644)
+		subdir := dir.AddDir("dir1", 0o755)
+		subdir.AddFile("file2", []byte("file2 contents"), 0o644)
+		subdir.AddSymlink("link2", "file2", 0o777)
+
+		for _, src := range []snapshot.SourceInfo{ownSource, otherSource} {
+			man, err := u.Upload(ctx, dir, nil, src)
+			require.NoError(t, err)
+
+			_, err = snapshot.SaveSnapshot(ctx, w, man)
+			require.NoError(t, err)
+		}
+
+		return nil
+	}))
+
+	srvInfo := servertesting.StartServer(t, env, false)
+
+	get := func(t *testing.T, username, password, urlPath string, header http.Header) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srvInfo.BaseURL+urlPath, http.NoBody)
+		require.NoError(t, err)
+
+		req.SetBasicAuth(username, password)
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { resp.Body.Close() })
+
+		return resp
+	}
+
+	listNames := func(t *testing.T, username, password, urlPath string) []string {
+		t.Helper()
+
+		resp := get(t, username, password, urlPath+"?format=json", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var br serverapi.BrowseResponse
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&br))
+
+		var names []string
+
+		for _, e := range br.Entries {
+			names = append(names, e.Name)
+		}
+
+		return names
+	}
+
+	remoteUser := servertesting.TestUsername + "@" + servertesting.TestHostname
+
+	// UI user can see all sources, other users only see sources they can read.
+	require.ElementsMatch(t, []string{remoteUser, "other@other-host"}, listNames(t, servertesting.TestUIUsername, servertesting.TestUIPassword, "/browse/"))
+	require.Equal(t, []string{remoteUser}, listNames(t, remoteUser, servertesting.TestPassword, "/browse/"))
+	require.Equal(t, []string{"data"}, listNames(t, remoteUser, servertesting.TestPassword, "/browse/"+remoteUser+"/"))
+
+	require.Equal(t, http.StatusNotFound, get(t, remoteUser, servertesting.TestPassword, "/browse/other@other-host/other/", nil).StatusCode)
+	require.Equal(t, http.StatusUnauthorized, get(t, remoteUser, "bad-password", "/browse/", nil).StatusCode)
+
+	snapshots := listNames(t, remoteUser, servertesting.TestPassword, "/browse/"+remoteUser+"/data/")
+	require.Len(t, snapshots, 1)
+
+	snapshotURL := "/browse/" + remoteUser + "/data/" + snapshots[0] + "/"
+
+	require.Equal(t, []string{"dir1", "file1", "page.html"}, listNames(t, remoteUser, servertesting.TestPassword, snapshotURL))
+
+	// directory listing in HTML
+	resp := get(t, remoteUser, servertesting.TestPassword, snapshotURL+"dir1/", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `href="/browse/`+remoteUser+`/data/`)
+	require.Contains(t, string(body), `file2`)
+	require.Contains(t, string(body), `link2 -&gt; file2`)
+	require.NotContains(t, string(body), `href="`+snapshotURL+`dir1/link2"`)
+
+	// symbolic links are listed with their targets and without URLs, since they can't be opened.
+	resp = get(t, remoteUser, servertesting.TestPassword, snapshotURL+"dir1/?format=json", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var br serverapi.BrowseResponse
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&br))
+	require.Len(t, br.Entries, 2)
+	require.Equal(t, "link2", br.Entries[1].Name)
+	require.Equal(t, "s", br.Entries[1].Type)
+	require.Equal(t, "file2", br.Entries[1].LinkTarget)
+	require.Empty(t, br.Entries[1].URL)
+
+	// range requests
+	resp = get(t, remoteUser, servertesting.TestPassword, snapshotURL+"file1", http.Header{"Range": {"bytes=2-5"}})
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "2345", string(body))
+
+	// files are downloaded instead of being rendered, so that HTML files can't run scripts on the UI origin.
+	resp = get(t, servertesting.TestUIUsername, servertesting.TestUIPassword, snapshotURL+"page.html", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	require.Equal(t, `attachment; filename=page.html`, resp.Header.Get("Content-Disposition"))
+	require.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+	require.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+
+	// ZIP download
+	resp = get(t, remoteUser, servertesting.TestPassword, snapshotURL+"?download=zip", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/zip", resp.Header.Get("Content-Type"))
+
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+
+	contents := map[string]string{}
+
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+
+		contents[f.Name] = string(b)
+	}
+
+	require.Equal(t, map[string]string{
+		"file1":      "0123456789",
+		"page.html":  "<script>alert(1)</script>",
+		"dir1/file2": "file2 contents",
+	}, contents)
+
+	require.Equal(t, http.StatusBadRequest, get(t, remoteUser, servertesting.TestPassword, "/browse/"+remoteUser+"/?download=zip", nil).StatusCode)
+}
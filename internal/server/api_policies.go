@@ -118,6 +118,8 @@ func handlePolicyDelete(ctx context.Context, rc requestContext) (any, *apiError)
 	if err := repo.WriteSession(ctx, rc.rep, repo.WriteSessionOptions{
 		Purpose: "PolicyDelete",
 	}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		rc.addAuditTargets(policyManifestIDs(ctx, w, sourceInfo)...)
+
 		return errors.Wrap(policy.RemovePolicy(ctx, w, sourceInfo), "unable to delete policy")
 	}); err != nil {
 		return nil, internalServerError(err)
@@ -143,7 +145,13 @@ func handlePolicyPut(ctx context.Context, rc requestContext) (any, *apiError) {
 	if err := repo.WriteSession(ctx, rc.rep, repo.WriteSessionOptions{
 		Purpose: "PolicyPut",
 	}, func(ctx context.Context, w repo.RepositoryWriter) error {
-		return errors.Wrap(policy.SetPolicy(ctx, w, sourceInfo, newPolicy), "unable to set policy")
+		if err := policy.SetPolicy(ctx, w, sourceInfo, newPolicy); err != nil {
+			return errors.Wrap(err, "unable to set policy")
+		}
+
+		rc.addAuditTargets(policyManifestIDs(ctx, w, sourceInfo)...)
+
+		return nil
 	}); err != nil {
 		return nil, internalServerError(err)
 	}
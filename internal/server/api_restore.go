@@ -4,12 +4,15 @@
 	"archive/zip"
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/internal/uitask"
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/snapshot/restore"
 	"github.com/kopia/kopia/snapshot/snapshotfs"
 )
@@ -23,9 +26,25 @@ func restoreCounters(s restore.Stats) map[string]uitask.CounterValue {
 		"Ignored Errors":       uitask.SimpleCounter(int64(s.IgnoredErrorCount)),
 		"Skipped Files":        uitask.SimpleCounter(int64(s.SkippedCount)),
 		"Skipped Bytes":        uitask.BytesCounter(s.SkippedTotalFileSize),
+		"Excluded Entries":     uitask.SimpleCounter(int64(s.ExcludedCount)),
+		"Unchanged Bytes":      uitask.BytesCounter(s.DeltaSkippedTotalFileSize),
+		"Verified Entries":     uitask.SimpleCounter(int64(s.VerifiedCount)),
+		"Verify Mismatches":    uitask.ErrorCounter(int64(s.VerifyMismatchCount)),
+		"Unverified Entries":   uitask.SimpleCounter(int64(s.VerifySkippedCount)),
 	}
 }
 
+// restoreProgressInfo returns the description of restore throughput and estimated remaining time.
+func restoreProgressInfo(s restore.Stats, eta timetrack.Estimator) string {
+	// skipped files are not restored, so they are excluded when estimating throughput and remaining time.
+	est, ok := eta.Estimate(float64(s.RestoredTotalFileSize), float64(s.EnqueuedTotalFileSize-s.SkippedTotalFileSize))
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%v (%.1f%%) remaining %v", units.BytesPerSecondsString(est.SpeedPerSecond), est.PercentComplete, est.Remaining)
+}
+
 func handleRestore(ctx context.Context, rc requestContext) (any, *apiError) {
 	var req serverapi.RestoreRequest
 
@@ -94,9 +113,11 @@ func handleRestore(ctx context.Context, rc requestContext) (any, *apiError) {
 		taskIDChan <- ctrl.CurrentTaskID()
 
 		opt := req.Options
+		eta := timetrack.Start()
 
 		opt.ProgressCallback = func(_ context.Context, s restore.Stats) {
 			ctrl.ReportCounters(restoreCounters(s))
+			ctrl.ReportProgressInfo(restoreProgressInfo(s, eta))
 		}
 
 		cancelChan := make(chan struct{})
@@ -107,11 +128,17 @@ func handleRestore(ctx context.Context, rc requestContext) (any, *apiError) {
 		})
 
 		st, err := restore.Entry(ctx, rep, out, rootEntry, opt)
-		if err == nil {
-			ctrl.ReportCounters(restoreCounters(st))
+		if err != nil {
+			return errors.Wrap(err, "error restoring")
+		}
+
+		ctrl.ReportCounters(restoreCounters(st))
+
+		if st.VerifyMismatchCount > 0 {
+			return errors.Errorf("verification failed for %v restored entries", st.VerifyMismatchCount)
 		}
 
-		return errors.Wrap(err, "error restoring")
+		return nil
 	})
 
 	taskID := <-taskIDChan
@@ -104,9 +104,13 @@ func handleDeleteSnapshots(ctx context.Context, rc requestContext) (any, *apiErr
 			if err := w.DeleteManifest(ctx, m); err != nil {
 				return errors.Wrap(err, "unable to delete snapshot")
 			}
+
+			rc.addAuditTargets(string(m))
 		}
 
 		if req.DeleteSourceAndPolicy {
+			rc.addAuditTargets(policyManifestIDs(ctx, w, req.SourceInfo)...)
+
 			if err := policy.RemovePolicy(ctx, w, req.SourceInfo); err != nil {
 				return errors.Wrap(err, "unable to remove policy")
 			}
@@ -156,6 +160,9 @@ func handleEditSnapshots(ctx context.Context, rc requestContext) (any, *apiError
 				if err := snapshot.UpdateSnapshot(ctx, w, snap); err != nil {
 					return errors.Wrap(err, "error updating snapshot")
 				}
+
+				// updating the snapshot replaces the old manifest with a new one.
+				rc.addAuditTargets(string(id), string(snap.ID))
 			}
 
 			snaps = append(snaps, convertSnapshotManifest(snap))
@@ -194,19 +201,19 @@ func forAllSourceManagersMatchingURLFilter(ctx context.Context, managers map[sna
 }
 
 func handleUpload(ctx context.Context, rc requestContext) (any, *apiError) {
-	return forAllSourceManagersMatchingURLFilter(ctx, rc.srv.snapshotAllSourceManagers(), (*sourceManager).upload, rc.req.URL.Query())
+	return forAllSourceManagersMatchingURLFilter(ctx, rc.sourceManagers(), (*sourceManager).upload, rc.req.URL.Query())
 }
 
 func handleCancel(ctx context.Context, rc requestContext) (any, *apiError) {
-	return forAllSourceManagersMatchingURLFilter(ctx, rc.srv.snapshotAllSourceManagers(), (*sourceManager).cancel, rc.req.URL.Query())
+	return forAllSourceManagersMatchingURLFilter(ctx, rc.sourceManagers(), (*sourceManager).cancel, rc.req.URL.Query())
 }
 
 func handlePause(ctx context.Context, rc requestContext) (any, *apiError) {
-	return forAllSourceManagersMatchingURLFilter(ctx, rc.srv.snapshotAllSourceManagers(), (*sourceManager).pause, rc.req.URL.Query())
+	return forAllSourceManagersMatchingURLFilter(ctx, rc.sourceManagers(), (*sourceManager).pause, rc.req.URL.Query())
 }
 
 func handleResume(ctx context.Context, rc requestContext) (any, *apiError) {
-	return forAllSourceManagersMatchingURLFilter(ctx, rc.srv.snapshotAllSourceManagers(), (*sourceManager).resume, rc.req.URL.Query())
+	return forAllSourceManagersMatchingURLFilter(ctx, rc.sourceManagers(), (*sourceManager).resume, rc.req.URL.Query())
 }
 
 func uniqueSnapshots(rows []*serverapi.Snapshot) []*serverapi.Snapshot {
@@ -25,7 +25,7 @@ func handleSourcesList(_ context.Context, rc requestContext) (any, *apiError) {
 		MultiUser:     multiUser,
 	}
 
-	for src, v := range rc.srv.snapshotAllSourceManagers() {
+	for src, v := range rc.sourceManagers() {
 		if sourceMatchesURLFilter(src, rc.req.URL.Query()) {
 			resp.Sources = append(resp.Sources, v.Status())
 		}
@@ -14,15 +14,19 @@
 	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
+	"github.com/kopia/kopia/internal/apitoken"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/contentlog"
 	"github.com/kopia/kopia/internal/contentlog/logparam"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/grpcapi"
+	"github.com/kopia/kopia/internal/pullsource"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/repo"
@@ -35,6 +39,23 @@
 	"github.com/kopia/kopia/snapshot/policy"
 )
 
+// serverInternalManifestTypes are types of manifests which are only managed by the server or by direct
+// repository connections. Repository clients can't write or delete them regardless of ACLs,
+// since they control authentication and behavior of the server.
+//
+//nolint:gochecknoglobals
+var serverInternalManifestTypes = map[string]bool{
+	apitoken.ManifestType:   true,
+	pullsource.ManifestType: true,
+	user.GroupManifestType:  true,
+	user.QuotaManifestType:  true,
+	user.UsageManifestType:  true,
+}
+
+func isServerInternalManifest(labels map[string]string) bool {
+	return serverInternalManifestTypes[labels[manifest.TypeLabelKey]]
+}
+
 type grpcServerState struct {
 	sendMutex sync.RWMutex
 
@@ -71,6 +92,15 @@ func (s *Server) authenticateGRPCSession(ctx context.Context, rep repo.Repositor
 		username := u[0] + "@" + h[0]
 		password := p[0]
 
+		if pr, ok := peer.FromContext(ctx); ok {
+			if ti, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+				if certUsername, ok := auth.UsernameFromClientCertificate(&ti.State); ok && certUsername == username {
+					// the client presented a verified certificate issued to the user, the password is not needed.
+					return username, nil
+				}
+			}
+		}
+
 		if s.authenticator.IsValid(ctx, rep, username, password) {
 			return username, nil
 		}
@@ -83,6 +113,16 @@ func (s *Server) authenticateGRPCSession(ctx context.Context, rep repo.Repositor
 
 // Session handles GRPC session from a repository client.
 func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
+	target, err := s.sessionServer(srv.Context())
+	if err != nil {
+		return err
+	}
+
+	return target.serveSession(srv)
+}
+
+// serveSession handles GRPC session for the repository hosted by the server.
+func (s *Server) serveSession(srv grpcapi.KopiaRepository_SessionServer) error {
 	ctx := srv.Context()
 
 	s.serverMutex.RLock()
@@ -101,7 +141,7 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 		return err
 	}
 
-	authz := s.authorizer.Authorize(ctx, dr, usernameAtHostname)
+	authz := s.authorizer.Authorize(ctx, dr, usernameAtHostname, nil)
 	if authz == nil {
 		authz = auth.NoAccess()
 	}
@@ -120,11 +160,37 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 		return err
 	}
 
+	var sessionWriter repo.DirectRepositoryWriter
+
+	// contents claimed by the session are released after the final flush of the write session.
+	defer func() {
+		if sessionWriter != nil {
+			s.quotas.releaseClaims(sessionWriter)
+		}
+	}()
+
 	//nolint:wrapcheck
 	return repo.DirectWriteSession(ctx, dr, opt, func(ctx context.Context, dw repo.DirectRepositoryWriter) error {
+		sessionWriter = dw
+
 		// channel to which workers will be sending errors, only holds 1 slot and sends are non-blocking.
 		lastErr := make(chan error, 1)
 
+		var (
+			wg sync.WaitGroup
+			al sessionAuditLog
+		)
+
+		stopAuditFlush := al.flushPeriodically(ctx, dw)
+
+		defer func() {
+			stopAuditFlush()
+
+			// write audit events of requests still being handled, even when the client has disconnected.
+			wg.Wait()
+			al.flush(context.WithoutCancel(ctx), dw)
+		}()
+
 		for req, err := srv.Recv(); err == nil; req, err = srv.Recv() {
 			// propagate any error from the goroutines
 			select {
@@ -145,10 +211,13 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 				return errors.Wrap(err, "unable to acquire semaphore")
 			}
 
+			wg.Add(1)
+
 			go func() {
+				defer wg.Done()
 				defer s.sem.Release(1)
 
-				s.handleSessionRequest(ctx, dw, authz, usernameAtHostname, req, func(resp *grpcapi.SessionResponse) {
+				s.handleSessionRequest(ctx, dw, &al, authz, usernameAtHostname, req, func(resp *grpcapi.SessionResponse) {
 					if err := s.send(srv, req.GetRequestId(), resp); err != nil {
 						select {
 						case lastErr <- err:
@@ -165,7 +234,7 @@ func (s *Server) Session(srv grpcapi.KopiaRepository_SessionServer) error {
 
 var tracer = otel.Tracer("kopia/grpc")
 
-func (s *Server) handleSessionRequest(ctx context.Context, dw repo.DirectRepositoryWriter, authz auth.AuthorizationInfo, usernameAtHostname string, req *grpcapi.SessionRequest, respond func(*grpcapi.SessionResponse)) {
+func (s *Server) handleSessionRequest(ctx context.Context, dw repo.DirectRepositoryWriter, al *sessionAuditLog, authz auth.AuthorizationInfo, usernameAtHostname string, req *grpcapi.SessionRequest, respond func(*grpcapi.SessionResponse)) {
 	if req.GetTraceContext() != nil {
 		var tc propagation.TraceContext
 
@@ -180,28 +249,39 @@ func (s *Server) handleSessionRequest(ctx context.Context, dw repo.DirectReposit
 		respond(handleGetContentRequest(ctx, dw, authz, inner.GetContent))
 
 	case *grpcapi.SessionRequest_WriteContent:
-		respond(handleWriteContentRequest(ctx, dw, authz, inner.WriteContent))
+		respond(s.handleWriteContentRequest(ctx, dw, authz, usernameAtHostname, inner.WriteContent))
 
 	case *grpcapi.SessionRequest_Flush:
-		respond(handleFlushRequest(ctx, dw, authz, inner.Flush))
+		resp := s.handleFlushRequest(ctx, dw, authz, usernameAtHostname, inner.Flush)
+		al.flush(ctx, dw)
+		respond(resp)
 
 	case *grpcapi.SessionRequest_GetManifest:
 		respond(handleGetManifestRequest(ctx, dw, authz, inner.GetManifest))
 
 	case *grpcapi.SessionRequest_PutManifest:
-		respond(handlePutManifestRequest(ctx, dw, authz, inner.PutManifest))
+		resp := handlePutManifestRequest(ctx, dw, authz, inner.PutManifest)
+		auditGRPCRequest(ctx, al, dw, usernameAtHostname, "PutManifest", resp, resp.GetPutManifest().GetManifestId())
+		respond(resp)
 
 	case *grpcapi.SessionRequest_FindManifests:
 		handleFindManifestsRequest(ctx, dw, authz, inner.FindManifests, respond)
 
 	case *grpcapi.SessionRequest_DeleteManifest:
-		respond(handleDeleteManifestRequest(ctx, dw, authz, inner.DeleteManifest))
+		resp := handleDeleteManifestRequest(ctx, dw, authz, inner.DeleteManifest)
+		auditGRPCRequest(ctx, al, dw, usernameAtHostname, "DeleteManifest", resp, inner.DeleteManifest.GetManifestId())
+		respond(resp)
 
 	case *grpcapi.SessionRequest_PrefetchContents:
 		respond(handlePrefetchContentsRequest(ctx, dw, authz, inner.PrefetchContents))
 
 	case *grpcapi.SessionRequest_ApplyRetentionPolicy:
-		respond(handleApplyRetentionPolicyRequest(ctx, dw, authz, usernameAtHostname, inner.ApplyRetentionPolicy))
+		resp := handleApplyRetentionPolicyRequest(ctx, dw, authz, usernameAtHostname, inner.ApplyRetentionPolicy)
+		if inner.ApplyRetentionPolicy.GetReallyDelete() {
+			auditGRPCRequest(ctx, al, dw, usernameAtHostname, "ApplyRetentionPolicy", resp, resp.GetApplyRetentionPolicy().GetManifestIds()...)
+		}
+
+		respond(resp)
 
 	case *grpcapi.SessionRequest_SendNotification:
 		respond(s.handleSendNotificationRequest(ctx, dw, authz, inner.SendNotification))
@@ -280,7 +360,7 @@ func handleGetContentRequest(ctx context.Context, dw repo.DirectRepositoryWriter
 	}
 }
 
-func handleWriteContentRequest(ctx context.Context, dw repo.DirectRepositoryWriter, authz auth.AuthorizationInfo, req *grpcapi.WriteContentRequest) *grpcapi.SessionResponse {
+func (s *Server) handleWriteContentRequest(ctx context.Context, dw repo.DirectRepositoryWriter, authz auth.AuthorizationInfo, usernameAtHostname string, req *grpcapi.WriteContentRequest) *grpcapi.SessionResponse {
 	ctx, span := tracer.Start(ctx, "GRPCSession.WriteContent")
 	defer span.End()
 
@@ -293,11 +373,41 @@ func handleWriteContentRequest(ctx context.Context, dw repo.DirectRepositoryWrit
 		return accessDeniedResponse()
 	}
 
-	contentID, err := dw.ContentManager().WriteContent(ctx, gather.FromSlice(req.GetData()), content.IDPrefix(req.GetPrefix()), compression.HeaderID(req.GetCompression()))
+	data := gather.FromSlice(req.GetData())
+	prefix := content.IDPrefix(req.GetPrefix())
+
+	// only new contents count towards storage quotas, deduplicated ones are free.
+	var (
+		claimedID  content.ID
+		trackUsage bool
+	)
+
+	if s.quotas.enabled(ctx, dw) {
+		claimedID, trackUsage = s.quotas.claimNewContent(ctx, dw, data, prefix)
+	}
+
+	if trackUsage {
+		if err := s.quotas.checkHardLimit(usernameAtHostname); err != nil {
+			s.quotas.releaseClaim(claimedID)
+			userLog(ctx).Warnf("rejected write: %v", err)
+
+			return errorResponse(err)
+		}
+	}
+
+	contentID, err := dw.ContentManager().WriteContent(ctx, data, prefix, compression.HeaderID(req.GetCompression()))
 	if err != nil {
+		if trackUsage {
+			s.quotas.releaseClaim(claimedID)
+		}
+
 		return errorResponse(err)
 	}
 
+	if trackUsage {
+		s.trackContentUsage(ctx, dw, usernameAtHostname, contentID)
+	}
+
 	return &grpcapi.SessionResponse{
 		Response: &grpcapi.SessionResponse_WriteContent{
 			WriteContent: &grpcapi.WriteContentResponse{
@@ -307,16 +417,24 @@ func handleWriteContentRequest(ctx context.Context, dw repo.DirectRepositoryWrit
 	}
 }
 
-func handleFlushRequest(ctx context.Context, dw repo.DirectRepositoryWriter, authz auth.AuthorizationInfo, _ *grpcapi.FlushRequest) *grpcapi.SessionResponse {
+func (s *Server) handleFlushRequest(ctx context.Context, dw repo.DirectRepositoryWriter, authz auth.AuthorizationInfo, usernameAtHostname string, _ *grpcapi.FlushRequest) *grpcapi.SessionResponse {
 	if authz.ContentAccessLevel() < auth.AccessLevelAppend {
 		return accessDeniedResponse()
 	}
 
+	// usage manifests are saved as part of the flush.
+	if err := s.quotas.persist(ctx, dw, usernameAtHostname); err != nil {
+		return errorResponse(err)
+	}
+
 	err := dw.Flush(ctx)
 	if err != nil {
 		return errorResponse(err)
 	}
 
+	// contents written by the session are now visible to other sessions.
+	s.quotas.releaseClaims(dw)
+
 	return &grpcapi.SessionResponse{
 		Response: &grpcapi.SessionResponse_Flush{
 			Flush: &grpcapi.FlushResponse{},
@@ -353,7 +471,7 @@ func handlePutManifestRequest(ctx context.Context, dw repo.DirectRepositoryWrite
 	ctx, span := tracer.Start(ctx, "GRPCSession.PutManifest")
 	defer span.End()
 
-	if authz.ManifestAccessLevel(req.GetLabels()) < auth.AccessLevelAppend {
+	if isServerInternalManifest(req.GetLabels()) || authz.ManifestAccessLevel(req.GetLabels()) < auth.AccessLevelAppend {
 		return accessDeniedResponse()
 	}
 
@@ -428,7 +546,7 @@ func handleDeleteManifestRequest(ctx context.Context, dw repo.DirectRepositoryWr
 		return errorResponse(err)
 	}
 
-	if authz.ManifestAccessLevel(em.Labels) < auth.AccessLevelFull {
+	if isServerInternalManifest(em.Labels) || authz.ManifestAccessLevel(em.Labels) < auth.AccessLevelFull {
 		return accessDeniedResponse()
 	}
 
@@ -529,6 +647,8 @@ func (s *Server) handleSendNotificationRequest(ctx context.Context, rep repo.Rep
 		return errorResponse(err)
 	}
 
+	s.publishNotificationEvent(req.GetTemplateName(), eventArgs, notification.Severity(req.GetSeverity()))
+
 	return &grpcapi.SessionResponse{
 		Response: &grpcapi.SessionResponse_SendNotification{
 			SendNotification: &grpcapi.SendNotificationResponse{},
@@ -7,6 +7,7 @@
 
 	"github.com/gorilla/mux"
 
+	"github.com/kopia/kopia/internal/apitoken"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/mount"
 	"github.com/kopia/kopia/internal/uitask"
@@ -37,6 +38,9 @@ type serverInterface interface {
 	SetRepository(ctx context.Context, rep repo.Repository) error
 	InitRepositoryAsync(ctx context.Context, mode string, initializer InitRepositoryFunc, wait bool) (string, error)
 	rootContext() context.Context
+	getRepositoryRegistry() *repositoryRegistry
+	getRepositoryName() string
+	getEventBroker() *eventBroker
 }
 
 type requestContext struct {
@@ -45,6 +49,37 @@ type requestContext struct {
 	body []byte
 	rep  repo.Repository
 	srv  serverInterface
+
+	// username is the authenticated user making the request.
+	username string
+
+	// groups are the groups of the user asserted by the identity provider.
+	groups []string
+
+	// apiToken is the API token used to authenticate the request, if any.
+	apiToken *apitoken.Token
+
+	// audit collects details of the request recorded in the audit log.
+	audit *auditRecord
+}
+
+// sourceManagers returns the source managers the request can act on, which excludes sources
+// the API token used by the request is not allowed to access.
+func (r *requestContext) sourceManagers() map[snapshot.SourceInfo]*sourceManager {
+	all := r.srv.snapshotAllSourceManagers()
+	if r.apiToken == nil {
+		return all
+	}
+
+	result := map[snapshot.SourceInfo]*sourceManager{}
+
+	for src, sm := range all {
+		if r.apiToken.AllowsSource(src) {
+			result[src] = sm
+		}
+	}
+
+	return result
 }
 
 func (r *requestContext) muxVar(s string) string {
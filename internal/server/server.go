@@ -20,10 +20,13 @@
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/apitoken"
 	"github.com/kopia/kopia/internal/auth"
 	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/metrics"
 	"github.com/kopia/kopia/internal/mount"
 	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/pullsource"
 	"github.com/kopia/kopia/internal/scheduler"
 	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/uitask"
@@ -71,6 +74,8 @@ type Server struct {
 	options       Options
 	authenticator auth.Authenticator
 	authorizer    auth.Authorizer
+	apiTokens     *auth.APITokenVerifier
+	quotas        quotaManager
 
 	initTaskMutex sync.Mutex
 	// +checklocks:initTaskMutex
@@ -98,11 +103,22 @@ type Server struct {
 	// +checklocks:serverMutex
 	sourceManagers map[snapshot.SourceInfo]*sourceManager
 	// +checklocks:serverMutex
+	pullSources map[snapshot.SourceInfo]*pullsource.Source
+	// +checklocks:serverMutex
 	mounts map[object.ID]mount.Controller
 
 	taskmgr              *uitask.Manager
 	authCookieSigningKey []byte
 
+	// publishes task, upload, maintenance and notification events to the clients of the event stream.
+	events *eventBroker
+
+	// repositories hosted by the server process, shared with the servers of named repositories.
+	repos *repositoryRegistry
+
+	// name of the repository hosted by this server, empty for the default repository.
+	repositoryName string
+
 	// channel to which we can post to trigger scheduler re-evaluation.
 	schedulerRefresh chan string
 
@@ -156,6 +172,9 @@ func (s *Server) SetupHTMLUIAPIHandlers(m *mux.Router) {
 	m.HandleFunc("/api/v1/mounts/{rootObjectID}", s.handleUI(handleMountGet)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/mounts", s.handleUI(handleMountList)).Methods(http.MethodGet)
 
+	m.HandleFunc("/api/v1/repos", s.handleUIPossiblyNotConnected(handleRepositoriesList)).Methods(http.MethodGet)
+	m.HandleFunc("/api/v1/repos/select", s.handleUIPossiblyNotConnected(handleRepositorySelect)).Methods(http.MethodPost)
+
 	m.HandleFunc("/api/v1/current-user", s.handleUIPossiblyNotConnected(handleCurrentUser)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/ui-preferences", s.handleUIPossiblyNotConnected(handleGetUIPreferences)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/ui-preferences", s.handleUIPossiblyNotConnected(handleSetUIPreferences)).Methods(http.MethodPut)
@@ -166,40 +185,70 @@ func (s *Server) SetupHTMLUIAPIHandlers(m *mux.Router) {
 	m.HandleFunc("/api/v1/tasks/{taskID}/logs", s.handleUIPossiblyNotConnected(handleTaskLogs)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/tasks/{taskID}/cancel", s.handleUIPossiblyNotConnected(handleTaskCancel)).Methods(http.MethodPost)
 
+	// event stream, consumed by EventSource which can't send CSRF tokens, authorization is checked by the handler.
+	m.HandleFunc("/api/v1/events", s.requireAuth(csrfTokenNotRequired, handleEvents)).Methods(http.MethodGet)
+
 	m.HandleFunc("/api/v1/notificationProfiles", s.handleUI(handleNotificationProfileCreate)).Methods(http.MethodPost)
 	m.HandleFunc("/api/v1/notificationProfiles/{profileName}", s.handleUI(handleNotificationProfileDelete)).Methods(http.MethodDelete)
 	m.HandleFunc("/api/v1/notificationProfiles/{profileName}", s.handleUI(handleNotificationProfileGet)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/notificationProfiles", s.handleUI(handleNotificationProfileList)).Methods(http.MethodGet)
 
 	m.HandleFunc("/api/v1/testNotificationProfile", s.handleUI(handleNotificationProfileTest)).Methods(http.MethodPost)
+
+	m.PathPrefix(browsePathPrefix).HandlerFunc(s.requireAuth(csrfTokenNotRequired, handleBrowse)).Methods(http.MethodGet)
+
+	if s.options.OIDC != nil {
+		m.HandleFunc(oidcLoginPath, s.handleOIDCLogin).Methods(http.MethodGet)
+		m.HandleFunc(oidcCallbackPath, s.handleOIDCCallback).Methods(http.MethodGet)
+	}
 }
 
 // SetupControlAPIHandlers registers control API handlers.
 func (s *Server) SetupControlAPIHandlers(m *mux.Router) {
 	// server control API, requires authentication as `server-control` and no CSRF token.
-	m.HandleFunc("/api/v1/control/sources", s.handleServerControlAPI(handleSourcesList)).Methods(http.MethodGet)
-	m.HandleFunc("/api/v1/control/status", s.handleServerControlAPIPossiblyNotConnected(handleRepoStatus)).Methods(http.MethodGet)
+	// some of the calls can also be made with API tokens granting the listed scopes.
+	m.HandleFunc("/api/v1/control/sources", s.handleServerControlAPI(handleSourcesList, apitoken.ScopeReadStatus)).Methods(http.MethodGet)
+	m.HandleFunc("/api/v1/control/status", s.handleServerControlAPIPossiblyNotConnected(handleRepoStatus, apitoken.ScopeReadStatus)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/control/flush", s.handleServerControlAPI(handleFlush)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/refresh", s.handleServerControlAPI(handleRefresh)).Methods(http.MethodPost)
+	m.HandleFunc("/api/v1/control/refresh", s.handleServerControlAPI(handleRefresh, apitoken.ScopeRefresh)).Methods(http.MethodPost)
 	m.HandleFunc("/api/v1/control/shutdown", s.handleServerControlAPIPossiblyNotConnected(handleShutdown)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/trigger-snapshot", s.handleServerControlAPI(handleUpload)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/cancel-snapshot", s.handleServerControlAPI(handleCancel)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/pause-source", s.handleServerControlAPI(handlePause)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/resume-source", s.handleServerControlAPI(handleResume)).Methods(http.MethodPost)
-	m.HandleFunc("/api/v1/control/throttle", s.handleServerControlAPI(handleRepoGetThrottle)).Methods(http.MethodGet)
+	m.HandleFunc("/api/v1/control/trigger-snapshot", s.handleServerControlAPI(handleUpload, apitoken.ScopeTriggerSnapshot)).Methods(http.MethodPost)
+	m.HandleFunc("/api/v1/control/cancel-snapshot", s.handleServerControlAPI(handleCancel, apitoken.ScopeCancelSnapshot)).Methods(http.MethodPost)
+	m.HandleFunc("/api/v1/control/pause-source", s.handleServerControlAPI(handlePause, apitoken.ScopePauseSource)).Methods(http.MethodPost)
+	m.HandleFunc("/api/v1/control/resume-source", s.handleServerControlAPI(handleResume, apitoken.ScopePauseSource)).Methods(http.MethodPost)
+	m.HandleFunc("/api/v1/control/throttle", s.handleServerControlAPI(handleRepoGetThrottle, apitoken.ScopeReadStatus)).Methods(http.MethodGet)
 	m.HandleFunc("/api/v1/control/throttle", s.handleServerControlAPI(handleRepoSetThrottle)).Methods(http.MethodPut)
+	m.HandleFunc("/api/v1/control/events", s.requireAuth(csrfTokenNotRequired, handleEvents)).Methods(http.MethodGet)
 }
 
 func (s *Server) rootContext() context.Context {
 	return s.rootctx
 }
 
-func (s *Server) isAuthenticated(rc requestContext) bool {
+func (s *Server) isAuthenticated(rc *requestContext) bool {
 	authn := rc.srv.getAuthenticator()
 	if authn == nil {
+		rc.username, _, _ = rc.req.BasicAuth()
 		return true
 	}
 
+	if token, ok := bearerToken(rc.req); ok && strings.HasPrefix(token, apitoken.Prefix) {
+		return s.isAPITokenValid(rc, token)
+	}
+
+	if s.options.OIDC != nil {
+		if token, ok := bearerToken(rc.req); ok {
+			return s.isOIDCBearerTokenValid(rc, token)
+		}
+
+		if id, ok := s.oidcSession(rc.req); ok {
+			rc.username = id.Username
+			rc.groups = id.Groups
+
+			return true
+		}
+	}
+
 	username, password, ok := rc.req.BasicAuth()
 	if !ok {
 		rc.w.Header().Set("WWW-Authenticate", `Basic realm="Kopia"`)
@@ -208,10 +257,17 @@ func (s *Server) isAuthenticated(rc requestContext) bool {
 		return false
 	}
 
-	if c, err := rc.req.Cookie(kopiaAuthCookie); err == nil && c != nil {
+	if certUsername, ok := auth.UsernameFromClientCertificate(rc.req.TLS); ok && certUsername == username {
+		// the client presented a verified certificate issued to the user, the password is not needed.
+		rc.username = username
+		return true
+	}
+
+	if c, err := rc.req.Cookie(s.cookieName(kopiaAuthCookie)); err == nil && c != nil {
 		if rc.srv.isAuthCookieValid(username, c.Value) {
 			// found a short-term JWT cookie that matches given username, trust it.
 			// this avoids potentially expensive password hashing inside the authenticator.
+			rc.username = username
 			return true
 		}
 	}
@@ -226,6 +282,8 @@ func (s *Server) isAuthenticated(rc requestContext) bool {
 		return false
 	}
 
+	rc.username = username
+
 	now := clock.Now()
 
 	ac, err := rc.srv.generateShortTermAuthCookie(username, now)
@@ -233,7 +291,7 @@ func (s *Server) isAuthenticated(rc requestContext) bool {
 		userLog(rc.req.Context()).Errorf("unable to generate short-term auth cookie: %v", err)
 	} else {
 		http.SetCookie(rc.w, &http.Cookie{
-			Name:    kopiaAuthCookie,
+			Name:    s.cookieName(kopiaAuthCookie),
 			Value:   ac,
 			Expires: now.Add(kopiaAuthCookieTTL),
 			Path:    "/",
@@ -248,10 +306,32 @@ func (s *Server) isAuthenticated(rc requestContext) bool {
 	return true
 }
 
+// cookieAudience returns the audience of cookies issued by the server, which includes the name of the
+// named repository, so that cookies issued for one repository are not accepted for another one.
+func (s *Server) cookieAudience(aud string) string {
+	if s.getRepositoryName() == "" {
+		return aud
+	}
+
+	return aud + ":" + s.getRepositoryName()
+}
+
+// cookieName returns the name of a cookie issued by the server. All repositories are served under the same paths,
+// so cookies of named repositories include the repository name to avoid replacing cookies of other repositories.
+func (s *Server) cookieName(name string) string {
+	if s.getRepositoryName() == "" {
+		return name
+	}
+
+	return name + "-" + s.getRepositoryName()
+}
+
 func (s *Server) isAuthCookieValid(username, cookieValue string) bool {
 	tok, err := jwt.ParseWithClaims(cookieValue, &jwt.RegisteredClaims{}, func(_ *jwt.Token) (any, error) {
 		return s.authCookieSigningKey, nil
-	})
+	},
+		jwt.WithAudience(s.cookieAudience(kopiaAuthCookieAudience)),
+	)
 	if err != nil {
 		return false
 	}
@@ -271,7 +351,7 @@ func (s *Server) generateShortTermAuthCookie(username string, now time.Time) (st
 		NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
 		ExpiresAt: jwt.NewNumericDate(now.Add(kopiaAuthCookieTTL)),
 		IssuedAt:  jwt.NewNumericDate(now),
-		Audience:  jwt.ClaimStrings{kopiaAuthCookieAudience},
+		Audience:  jwt.ClaimStrings{s.cookieAudience(kopiaAuthCookieAudience)},
 		ID:        uuid.New().String(),
 		Issuer:    kopiaAuthCookieIssuer,
 	}).SignedString(s.authCookieSigningKey)
@@ -282,10 +362,11 @@ func (s *Server) captureRequestContext(w http.ResponseWriter, r *http.Request) r
 	defer s.serverMutex.RUnlock()
 
 	return requestContext{
-		w:   w,
-		req: r,
-		rep: s.rep,
-		srv: s,
+		w:     w,
+		req:   r,
+		rep:   s.rep,
+		srv:   s,
+		audit: &auditRecord{},
 	}
 }
 
@@ -310,11 +391,12 @@ func (s *Server) requireAuth(checkCSRFToken csrfTokenOption, f func(ctx context.
 		rc := s.captureRequestContext(w, r)
 
 		//nolint:contextcheck
-		if !s.isAuthenticated(rc) {
+		if !s.isAuthenticated(&rc) {
 			return
 		}
 
-		if checkCSRFToken == csrfTokenRequired {
+		// requests authenticated with bearer tokens don't carry ambient credentials and can't be forged.
+		if _, isBearer := bearerToken(r); checkCSRFToken == csrfTokenRequired && !isBearer {
 			if !s.validateCSRFToken(r) {
 				http.Error(w, "Invalid or missing CSRF token.\n", http.StatusUnauthorized)
 				return
@@ -327,18 +409,18 @@ func (s *Server) requireAuth(checkCSRFToken csrfTokenOption, f func(ctx context.
 
 type isAuthorizedFunc func(ctx context.Context, rc requestContext) bool
 
-func (s *Server) handleServerControlAPI(f apiRequestFunc) http.HandlerFunc {
+func (s *Server) handleServerControlAPI(f apiRequestFunc, tokenScopes ...apitoken.Scope) http.HandlerFunc {
 	return s.handleServerControlAPIPossiblyNotConnected(func(ctx context.Context, rc requestContext) (any, *apiError) {
 		if rc.rep == nil {
 			return nil, requestError(serverapi.ErrorNotConnected, "not connected")
 		}
 
 		return f(ctx, rc)
-	})
+	}, tokenScopes...)
 }
 
-func (s *Server) handleServerControlAPIPossiblyNotConnected(f apiRequestFunc) http.HandlerFunc {
-	return s.handleRequestPossiblyNotConnected(requireServerControlUser, csrfTokenNotRequired, func(ctx context.Context, rc requestContext) (any, *apiError) {
+func (s *Server) handleServerControlAPIPossiblyNotConnected(f apiRequestFunc, tokenScopes ...apitoken.Scope) http.HandlerFunc {
+	return s.handleRequestPossiblyNotConnected(requireServerControlUserOrAPIToken(tokenScopes), csrfTokenNotRequired, func(ctx context.Context, rc requestContext) (any, *apiError) {
 		return f(ctx, rc)
 	})
 }
@@ -400,12 +482,15 @@ func (s *Server) handleRequestPossiblyNotConnected(isAuthorized isAuthorizedFunc
 		// when the request finishes.
 		ctx = context.WithoutCancel(ctx)
 
-		if isAuthorized(ctx, rc) {
+		authorized := isAuthorized(ctx, rc)
+		if authorized {
 			v, err = f(ctx, rc)
 		} else {
 			err = accessDeniedError()
 		}
 
+		s.auditHTTPRequest(ctx, &rc, authorized, err)
+
 		if err == nil {
 			if b, ok := v.([]byte); ok {
 				if _, err := rc.w.Write(b); err != nil {
@@ -480,6 +565,20 @@ func (s *Server) refreshLocked(ctx context.Context) error {
 		}
 	}
 
+	if err := s.apiTokens.Refresh(ctx); err != nil {
+		userLog(ctx).Errorf("unable to refresh API tokens: %v", err)
+	}
+
+	if err := s.quotas.Refresh(ctx); err != nil {
+		userLog(ctx).Errorf("unable to refresh quotas: %v", err)
+	}
+
+	if s.options.OIDC != nil {
+		if err := s.options.OIDC.Refresh(ctx); err != nil {
+			userLog(ctx).Errorf("unable to refresh OIDC keys: %v", err)
+		}
+	}
+
 	if err := s.syncSourcesLocked(ctx); err != nil {
 		return errors.Wrap(err, "unable to sync sources")
 	}
@@ -584,7 +683,7 @@ func (s *Server) sendSnapshotReport(st notifydata.MultiSnapshotStatus) {
 	// send the notification without blocking if we still have the repository
 	// it's possible that repository was closed in the meantime.
 	if rep != nil {
-		notification.Send(s.rootctx, rep, "snapshot-report", st, s.reportSeverity(st), s.notificationTemplateOptions())
+		s.sendNotification(s.rootctx, rep, "snapshot-report", st, s.reportSeverity(st))
 	}
 }
 
@@ -645,6 +744,8 @@ func (s *Server) SetRepository(ctx context.Context, rep repo.Repository) error {
 	}
 
 	s.rep = rep
+	s.quotas.reset()
+
 	if s.rep == nil {
 		return nil
 	}
@@ -684,6 +785,8 @@ func (s *Server) stopAllSourceManagersLocked(ctx context.Context) {
 func (s *Server) syncSourcesLocked(ctx context.Context) error {
 	sources := map[snapshot.SourceInfo]bool{}
 
+	s.pullSources = nil
+
 	if s.rep != nil {
 		snapshotSources, err := snapshot.ListSources(ctx, s.rep)
 		if err != nil {
@@ -715,25 +818,51 @@ func (s *Server) syncSourcesLocked(ctx context.Context) error {
 				sources[pol.Target()] = true
 			}
 		}
+
+		pullSources, err := pullsource.LoadMap(ctx, s.rep)
+		if err != nil {
+			return errors.Wrap(err, "unable to list pull sources")
+		}
+
+		for src := range pullSources {
+			sources[src] = true
+		}
+
+		s.pullSources = pullSources
 	}
 
 	// copy existing sources to a map, from which we will remove sources that are found
 	// in the repository
 	oldSourceManagers := maps.Clone(s.sourceManagers)
 
+	var restartedSourceManagers []*sourceManager
+
 	for src := range sources {
-		if sm, ok := oldSourceManagers[src]; ok {
+		if sm, ok := oldSourceManagers[src]; ok && sm.isRunningReadOnly() == !s.isLocal(src) {
 			// pre-existing source, already has a manager
 			delete(oldSourceManagers, src)
+			sm.setPullSource(s.pullSources[src])
 			sm.refreshStatus(ctx)
 		} else {
+			if ok {
+				// source was added or removed from pull sources, restart its manager.
+				delete(oldSourceManagers, src)
+				sm.stop(ctx)
+				restartedSourceManagers = append(restartedSourceManagers, sm)
+			}
+
 			sm := newSourceManager(src, s, s.rep)
+			sm.setPullSource(s.pullSources[src])
 			s.sourceManagers[src] = sm
 
 			sm.start(ctx, s.isLocal(src))
 		}
 	}
 
+	for _, sm := range restartedSourceManagers {
+		sm.waitUntilStopped()
+	}
+
 	// whatever is left in oldSourceManagers are managers for sources that don't exist anymore.
 	// stop source manager for sources no longer in the repo.
 	for _, sm := range oldSourceManagers {
@@ -802,6 +931,11 @@ func (s *Server) ServeStaticFiles(m *mux.Router, fs http.FileSystem) {
 	indexBytes := maybeReadIndexBytes(fs)
 
 	m.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shouldRedirectToOIDCLogin(r) {
+			http.Redirect(w, r, oidcLoginPath+"?"+url.Values{oidcRedirectQueryParam: {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+			return
+		}
+
 		if s.isKnownUIRoute(r.URL.Path) {
 			r2 := new(http.Request)
 			*r2 = *r
@@ -814,7 +948,7 @@ func (s *Server) ServeStaticFiles(m *mux.Router, fs http.FileSystem) {
 		rc := s.captureRequestContext(w, r)
 
 		//nolint:contextcheck
-		if !s.isAuthenticated(rc) {
+		if !s.isAuthenticated(&rc) {
 			return
 		}
 
@@ -870,6 +1004,19 @@ type Options struct {
 	MinMaintenanceInterval   time.Duration
 	EnableErrorNotifications bool
 	NotifyTemplateOptions    notifytemplate.Options
+
+	// track filesystem changes of local sources to avoid scanning unchanged directories.
+	EnableChangeJournal bool
+
+	// authenticate UI users and API callers using OpenID Connect in addition to Authenticator.
+	OIDC *auth.OIDCAuthenticator
+
+	// redirect UI users without an OIDC session to the provider instead of asking for a password.
+	OIDCOnly bool
+
+	// OIDC groups whose members are allowed to access the UI API and the server control API.
+	OIDCUIGroup            string
+	OIDCServerControlGroup string
 }
 
 // InitRepositoryFunc is a function that attempts to connect to/open repository.
@@ -1007,18 +1154,45 @@ func(ctx context.Context, ctrl uitask.Controller) error {
 }
 
 func (s *Server) runMaintenanceTask(ctx context.Context, dr repo.DirectRepository) error {
-	return errors.Wrap(s.taskmgr.Run(ctx, "Maintenance", "Periodic maintenance", func(ctx context.Context, _ uitask.Controller) error {
+	ev := &serverapi.MaintenanceEvent{
+		Status:    serverapi.MaintenanceStarted,
+		StartTime: clock.Now(),
+	}
+
+	// outcomes of maintenance of named repositories are exported separately.
+	ctx = metrics.WithOutcomeRepository(ctx, s.getRepositoryName())
+
+	err := s.taskmgr.Run(ctx, "Maintenance", "Periodic maintenance", func(ctx context.Context, ctrl uitask.Controller) error {
+		ev.TaskID = ctrl.CurrentTaskID()
+		s.publishMaintenanceEvent(ev)
+
 		return repo.DirectWriteSession(ctx, dr, repo.WriteSessionOptions{
 			Purpose: "periodicMaintenance",
 		}, func(ctx context.Context, w repo.DirectRepositoryWriter) error {
 			return snapshotmaintenance.Run(ctx, w, maintenance.ModeAuto, false, maintenance.SafetyFull)
 		})
-	}), "unable to run maintenance")
+	})
+
+	endTime := clock.Now()
+
+	ev.Status = serverapi.MaintenanceFinished
+	ev.EndTime = &endTime
+
+	if err != nil {
+		ev.Error = err.Error()
+	}
+
+	s.publishMaintenanceEvent(ev)
+
+	return errors.Wrap(err, "unable to run maintenance")
 }
 
+// isLocal returns true if the source can be snapshotted by this server, either because it's on the local host
+// or because it's a pull source read from a remote host.
+//
 // +checklocksread:s.serverMutex
 func (s *Server) isLocal(src snapshot.SourceInfo) bool {
-	return s.rep.ClientOptions().Hostname == src.Host && !s.rep.ClientOptions().ReadOnly
+	return (s.rep.ClientOptions().Hostname == src.Host || s.pullSources[src] != nil) && !s.rep.ClientOptions().ReadOnly
 }
 
 func (s *Server) getOrCreateSourceManager(ctx context.Context, src snapshot.SourceInfo) *sourceManager {
@@ -1028,6 +1202,7 @@ func (s *Server) getOrCreateSourceManager(ctx context.Context, src snapshot.Sour
 	if s.sourceManagers[src] == nil {
 		userLog(ctx).Debugf("creating source manager for %v", src)
 		sm := newSourceManager(src, s, s.rep)
+		sm.setPullSource(s.pullSources[src])
 		s.sourceManagers[src] = sm
 
 		sm.start(ctx, s.isLocal(src))
@@ -1052,6 +1227,13 @@ func (s *Server) deleteSourceManager(ctx context.Context, src snapshot.SourceInf
 	return true
 }
 
+func (s *Server) currentRepository() repo.Repository {
+	s.serverMutex.RLock()
+	defer s.serverMutex.RUnlock()
+
+	return s.rep
+}
+
 func (s *Server) snapshotAllSourceManagers() map[snapshot.SourceInfo]*sourceManager {
 	s.serverMutex.RLock()
 	defer s.serverMutex.RUnlock()
@@ -1139,14 +1321,18 @@ func New(ctx context.Context, options *Options) (*Server, error) {
 		grpcServerState:      makeGRPCServerState(options.MaxConcurrency),
 		authenticator:        options.Authenticator,
 		authorizer:           options.Authorizer,
+		apiTokens:            auth.NewAPITokenVerifier(),
 		taskmgr:              uitask.NewManager(options.PersistentLogs),
 		mounts:               map[object.ID]mount.Controller{},
 		authCookieSigningKey: []byte(options.AuthCookieSigningKey),
 		nextRefreshTime:      clock.Now().Add(options.RefreshInterval),
 		schedulerRefresh:     make(chan string, 1),
+		events:               newEventBroker(),
 	}
 
 	s.parallelSnapshotsChanged = sync.NewCond(&s.parallelSnapshotsMutex)
+	s.repos = newRepositoryRegistry(s)
+	s.taskmgr.OnChange = s.publishTaskEvent
 
 	return s, nil
 }
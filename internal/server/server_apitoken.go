@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+)
+
+// isAPITokenValid authenticates the request made with an API token. API tokens don't authenticate any user,
+// the calls they can make are determined by the token scopes.
+func (s *Server) isAPITokenValid(rc *requestContext, token string) bool {
+	t, err := s.apiTokens.Verify(rc.req.Context(), rc.rep, token)
+	if err != nil {
+		rc.w.Header().Set("WWW-Authenticate", `Bearer realm="Kopia", error="invalid_token"`)
+		http.Error(rc.w, "Access denied.\n", http.StatusUnauthorized)
+
+		userLog(rc.req.Context()).Warnf("invalid API token from client %s for %v %v: %v", rc.req.RemoteAddr, rc.req.Method, rc.req.URL.Path, err)
+
+		return false
+	}
+
+	rc.apiToken = t
+
+	return true
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/peer"
+
+	"github.com/kopia/kopia/internal/blobcrypto"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/grpcapi"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+// AuditBlobPrefix is the prefix given to audit log blobs stored in the repository.
+const AuditBlobPrefix blob.ID = "_audit_"
+
+// Outcomes of audited operations.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+// Protocols used to make audited operations.
+const (
+	AuditProtocolHTTP = "http"
+	AuditProtocolGRPC = "grpc"
+)
+
+const (
+	// maximum number of audit events buffered by a gRPC session before they are written.
+	maxBufferedAuditEvents = 100
+
+	// interval at which audit events buffered by gRPC sessions are written.
+	auditFlushInterval = 1 * time.Minute
+
+	// separates the audit blob ID from the index of the event in it in audit event IDs.
+	auditEventIndexSeparator = "."
+)
+
+// ErrAuditEventNotFound is returned when the requested audit event does not exist.
+var ErrAuditEventNotFound = errors.New("audit event not found")
+
+// nonMutatingRoutes are API routes using methods other than GET which don't change any state
+// and are not recorded in the audit log.
+var nonMutatingRoutes = map[string]bool{
+	"/api/v1/policy/resolve": true,
+	"/api/v1/estimate":       true,
+	"/api/v1/paths/resolve":  true,
+	"/api/v1/repo/exists":    true,
+}
+
+// AuditEvent describes a single mutating operation performed through the server.
+// Events are stored in the repository in encrypted blobs holding one or more events, which are never modified.
+type AuditEvent struct {
+	ID         string    `json:"id,omitempty"`
+	Time       time.Time `json:"time"`
+	User       string    `json:"user,omitempty"`
+	APITokenID string    `json:"apiTokenID,omitempty"`
+	SourceIP   string    `json:"sourceIP"`
+	Protocol   string    `json:"protocol"`
+	Operation  string    `json:"operation"`
+	Targets    []string  `json:"targets,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// auditRecord collects the details of an audited HTTP request while it's being processed.
+type auditRecord struct {
+	targets []string
+}
+
+// addAuditTargets records the IDs of manifests affected by the request in the audit log.
+func (r *requestContext) addAuditTargets(targets ...string) {
+	if r.audit == nil {
+		return
+	}
+
+	r.audit.targets = append(r.audit.targets, targets...)
+}
+
+func isAuditedRequest(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return false
+	}
+
+	return !nonMutatingRoutes[routeTemplate(r)]
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if t, err := route.GetPathTemplate(); err == nil {
+			return t
+		}
+	}
+
+	return r.URL.Path
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// auditHTTPRequest records the outcome of a mutating HTTP request in the audit log.
+// Requests authenticated with API tokens are always recorded, so that all uses of tokens can be reviewed.
+func (s *Server) auditHTTPRequest(ctx context.Context, rc *requestContext, authorized bool, apiErr *apiError) {
+	if !isAuditedRequest(rc.req) && rc.apiToken == nil {
+		return
+	}
+
+	ev := &AuditEvent{
+		User:      rc.username,
+		SourceIP:  remoteIP(rc.req.RemoteAddr),
+		Protocol:  AuditProtocolHTTP,
+		Operation: rc.req.Method + " " + routeTemplate(rc.req),
+		Outcome:   AuditOutcomeSuccess,
+	}
+
+	if rc.audit != nil {
+		ev.Targets = rc.audit.targets
+	}
+
+	if rc.apiToken != nil {
+		ev.APITokenID = rc.apiToken.ID
+	}
+
+	switch {
+	case !authorized:
+		ev.Outcome = AuditOutcomeDenied
+	case apiErr != nil:
+		ev.Outcome = AuditOutcomeFailure
+		ev.Error = apiErr.message
+	}
+
+	recordAuditEvent(ctx, rc.rep, ev)
+}
+
+// auditGRPCRequest records the outcome of a mutating gRPC session request in the audit log of the session.
+func auditGRPCRequest(ctx context.Context, al *sessionAuditLog, dw repo.DirectRepositoryWriter, usernameAtHostname, method string, resp *grpcapi.SessionResponse, targets ...string) {
+	ev := &AuditEvent{
+		User:      usernameAtHostname,
+		Protocol:  AuditProtocolGRPC,
+		Operation: method,
+		Targets:   targets,
+		Outcome:   AuditOutcomeSuccess,
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		ev.SourceIP = remoteIP(p.Addr.String())
+	}
+
+	if e := resp.GetError(); e != nil {
+		if e.GetCode() == grpcapi.ErrorResponse_ACCESS_DENIED {
+			ev.Outcome = AuditOutcomeDenied
+		} else {
+			ev.Outcome = AuditOutcomeFailure
+			ev.Error = e.GetMessage()
+		}
+	}
+
+	al.add(ctx, dw, ev)
+}
+
+// sessionAuditLog buffers audit events of a gRPC session. Snapshot clients put a manifest for each
+// snapshot and checkpoint, so instead of writing a blob for each of them, events are written in batches
+// when the client flushes the session, when the session ends, when maxBufferedAuditEvents accumulate
+// and every auditFlushInterval.
+type sessionAuditLog struct {
+	mu     sync.Mutex
+	events []*AuditEvent
+}
+
+func (l *sessionAuditLog) add(ctx context.Context, dw repo.DirectRepositoryWriter, ev *AuditEvent) {
+	logAuditEvent(ctx, ev)
+
+	l.mu.Lock()
+	l.events = append(l.events, ev)
+	shouldFlush := len(l.events) >= maxBufferedAuditEvents
+	l.mu.Unlock()
+
+	if shouldFlush {
+		l.flush(ctx, dw)
+	}
+}
+
+// flushPeriodically writes buffered audit events every auditFlushInterval until the returned function is called.
+func (l *sessionAuditLog) flushPeriodically(ctx context.Context, dw repo.DirectRepositoryWriter) func() {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(auditFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				l.flush(ctx, dw)
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// flush writes buffered audit events to the repository.
+func (l *sessionAuditLog) flush(ctx context.Context, dw repo.DirectRepositoryWriter) {
+	l.mu.Lock()
+	events := l.events
+	l.events = nil
+	l.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	if err := writeAuditEvents(ctx, dw, events); err != nil {
+		userLog(ctx).Errorf("unable to write %v audit events: %v", len(events), err)
+	}
+}
+
+func logAuditEvent(ctx context.Context, ev *AuditEvent) {
+	ev.Time = clock.Now()
+
+	userLog(ctx).Infof("audit: %v %v by %q (token %q) from %v targets %v: %v %v",
+		ev.Protocol, ev.Operation, ev.User, ev.APITokenID, ev.SourceIP, ev.Targets, ev.Outcome, ev.Error)
+}
+
+func recordAuditEvent(ctx context.Context, rep repo.Repository, ev *AuditEvent) {
+	logAuditEvent(ctx, ev)
+
+	// audit blobs are written directly to the blob storage, bypassing write sessions, similar to repository logs.
+	dw, ok := rep.(repo.DirectRepositoryWriter)
+	if !ok {
+		userLog(ctx).Debugf("audit event not persisted, repository is not connected or does not support direct writes")
+		return
+	}
+
+	if err := writeAuditEvents(ctx, dw, []*AuditEvent{ev}); err != nil {
+		userLog(ctx).Errorf("unable to write audit event: %v", err)
+	}
+}
+
+// writeAuditEvents writes the provided events, ordered by time, to a single audit blob.
+func writeAuditEvents(ctx context.Context, dw repo.DirectRepositoryWriter, events []*AuditEvent) error {
+	payload, err := json.Marshal(events)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal audit events")
+	}
+
+	var encrypted gather.WriteBuffer
+	defer encrypted.Close()
+
+	// prefix blob IDs with the time of the first event, so that listing returns them in chronological order.
+	prefix := blob.ID(fmt.Sprintf("%v%v_", AuditBlobPrefix, events[0].Time.UnixNano()))
+
+	blobID, err := blobcrypto.Encrypt(dw.ContentReader().ContentFormat(), gather.FromSlice(payload), prefix, "", &encrypted)
+	if err != nil {
+		return errors.Wrap(err, "unable to encrypt audit events")
+	}
+
+	return errors.Wrap(dw.BlobStorage().PutBlob(ctx, blobID, encrypted.Bytes(), blob.PutOptions{}), "unable to write audit blob")
+}
+
+// ListAuditEvents returns all audit events stored in the repository ordered by time.
+func ListAuditEvents(ctx context.Context, dr repo.DirectRepository) ([]*AuditEvent, error) {
+	blobs, err := blob.ListAllBlobs(ctx, dr.BlobReader(), AuditBlobPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing audit blobs")
+	}
+
+	var result []*AuditEvent
+
+	for _, bm := range blobs {
+		events, err := readAuditEvents(ctx, dr, bm.BlobID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, events...)
+	}
+
+	slices.SortStableFunc(result, func(a, b *AuditEvent) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	return result, nil
+}
+
+// GetAuditEvent returns the audit event with the provided ID.
+func GetAuditEvent(ctx context.Context, dr repo.DirectRepository, id string) (*AuditEvent, error) {
+	// event IDs are made of the ID of the audit blob and the index of the event in it.
+	blobID, _, ok := strings.Cut(id, auditEventIndexSeparator)
+	if !ok {
+		return nil, errors.Wrap(ErrAuditEventNotFound, id)
+	}
+
+	events, err := readAuditEvents(ctx, dr, AuditBlobPrefix+blob.ID(blobID))
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		return nil, errors.Wrap(ErrAuditEventNotFound, id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ev := range events {
+		if ev.ID == id {
+			return ev, nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrAuditEventNotFound, id)
+}
+
+func readAuditEvents(ctx context.Context, dr repo.DirectRepository, blobID blob.ID) ([]*AuditEvent, error) {
+	var data, decrypted gather.WriteBuffer
+	defer data.Close()
+	defer decrypted.Close()
+
+	if err := dr.BlobReader().GetBlob(ctx, blobID, 0, -1, &data); err != nil {
+		return nil, errors.Wrapf(err, "error reading audit blob %v", blobID)
+	}
+
+	if err := blobcrypto.Decrypt(dr.ContentReader().ContentFormat(), data.Bytes(), blobID, &decrypted); err != nil {
+		return nil, errors.Wrapf(err, "error decrypting audit blob %v", blobID)
+	}
+
+	var events []*AuditEvent
+	if err := json.NewDecoder(decrypted.Bytes().Reader()).Decode(&events); err != nil {
+		return nil, errors.Wrapf(err, "invalid audit blob %v", blobID)
+	}
+
+	for i, ev := range events {
+		ev.ID = strings.TrimPrefix(string(blobID), string(AuditBlobPrefix)) + auditEventIndexSeparator + strconv.Itoa(i)
+	}
+
+	return events, nil
+}
+
+// policyManifestIDs returns the IDs of policy manifests defined for the provided source.
+func policyManifestIDs(ctx context.Context, rep repo.Repository, si snapshot.SourceInfo) []string {
+	entries, err := rep.FindManifests(ctx, policy.LabelsForSource(si))
+	if err != nil {
+		userLog(ctx).Errorf("unable to find policy manifests for %v: %v", si, err)
+		return nil
+	}
+
+	var result []string
+
+	for _, e := range entries {
+		result = append(result, string(e.ID))
+	}
+
+	return result
+}
@@ -0,0 +1,129 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	srvInfo := servertesting.StartServer(t, env, true)
+
+	cli, err := apiclient.NewKopiaAPIClient(apiclient.Options{
+		BaseURL:                             srvInfo.BaseURL,
+		TrustedServerCertificateFingerprint: srvInfo.TrustedServerCertificateFingerprint,
+		Username:                            servertesting.TestUIUsername,
+		Password:                            servertesting.TestUIPassword,
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, cli.FetchCSRFTokenForTesting(ctx))
+
+	si := env.LocalPathSourceInfo(testutil.TempDirectory(t))
+
+	// audited HTTP request
+	mustSetPolicy(t, cli, si, &policy.Policy{})
+
+	// non-mutating requests are not audited.
+	mustListSources(t, cli, nil)
+
+	rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, srvInfo, repo.ClientOptions{
+		Username: servertesting.TestUsername,
+		Hostname: servertesting.TestHostname,
+	}, content.CachingOptions{
+		CacheDirectory: testutil.TempDirectory(t),
+	}, servertesting.TestPassword, &repo.Options{})
+	require.NoError(t, err)
+
+	var manifestID manifest.ID
+
+	require.NoError(t, repo.WriteSession(ctx, rep, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		var err error
+
+		manifestID, err = w.PutManifest(ctx, map[string]string{
+			manifest.TypeLabelKey:  snapshot.ManifestType,
+			snapshot.UsernameLabel: servertesting.TestUsername,
+			snapshot.HostnameLabel: servertesting.TestHostname,
+			snapshot.PathLabel:     testPathname,
+		}, map[string]string{"foo": "bar"})
+		if err != nil {
+			return err
+		}
+
+		return w.DeleteManifest(ctx, manifestID)
+	}))
+
+	// writing manifests belonging to another user is denied.
+	require.Error(t, repo.WriteSession(ctx, rep, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		_, err := w.PutManifest(ctx, map[string]string{
+			manifest.TypeLabelKey:  snapshot.ManifestType,
+			snapshot.UsernameLabel: "another-user",
+			snapshot.HostnameLabel: servertesting.TestHostname,
+			snapshot.PathLabel:     testPathname,
+		}, map[string]string{"foo": "bar"})
+
+		return err
+	}))
+
+	// audit events of gRPC sessions are written when the client flushes or when the session ends,
+	// which happens asynchronously after the client disconnects.
+	require.NoError(t, rep.Close(ctx))
+
+	var events []*server.AuditEvent
+
+	require.Eventually(t, func() bool {
+		events, err = server.ListAuditEvents(ctx, env.RepositoryWriter)
+		require.NoError(t, err)
+
+		return len(events) == 4
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// events of the HTTP request and of each gRPC session are written in separate blobs.
+	auditBlobs, err := blob.ListAllBlobs(ctx, env.RepositoryWriter.BlobReader(), server.AuditBlobPrefix)
+	require.NoError(t, err)
+	require.Len(t, auditBlobs, 3)
+
+	require.Equal(t, servertesting.TestUIUsername, events[0].User)
+	require.Equal(t, server.AuditProtocolHTTP, events[0].Protocol)
+	require.Equal(t, "PUT /api/v1/policy", events[0].Operation)
+	require.Equal(t, server.AuditOutcomeSuccess, events[0].Outcome)
+	require.Equal(t, "127.0.0.1", events[0].SourceIP)
+	require.Len(t, events[0].Targets, 1)
+
+	userAtHost := servertesting.TestUsername + "@" + servertesting.TestHostname
+
+	require.Equal(t, userAtHost, events[1].User)
+	require.Equal(t, server.AuditProtocolGRPC, events[1].Protocol)
+	require.Equal(t, "PutManifest", events[1].Operation)
+	require.Equal(t, []string{string(manifestID)}, events[1].Targets)
+	require.Equal(t, server.AuditOutcomeSuccess, events[1].Outcome)
+
+	require.Equal(t, "DeleteManifest", events[2].Operation)
+	require.Equal(t, []string{string(manifestID)}, events[2].Targets)
+	require.Equal(t, server.AuditOutcomeSuccess, events[2].Outcome)
+
+	require.Equal(t, "PutManifest", events[3].Operation)
+	require.Equal(t, server.AuditOutcomeDenied, events[3].Outcome)
+
+	ev, err := server.GetAuditEvent(ctx, env.RepositoryWriter, events[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, events[1], ev)
+
+	_, err = server.GetAuditEvent(ctx, env.RepositoryWriter, "no-such-event")
+	require.ErrorIs(t, err, server.ErrAuditEventNotFound)
+}
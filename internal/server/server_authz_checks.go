@@ -8,8 +8,10 @@
 	"encoding/hex"
 	"io"
 	"net/http"
+	"slices"
 
 	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/apitoken"
 )
 
 // kopiaSessionCookie is the name of the session cookie that Kopia server will generate for all
@@ -63,13 +65,15 @@ func requireUIUser(_ context.Context, rc requestContext) bool {
 		return true
 	}
 
+	if g := rc.srv.getOptions().OIDCUIGroup; g != "" && slices.Contains(rc.groups, g) {
+		return true
+	}
+
 	if rc.srv.getOptions().UIUser == "" {
 		return false
 	}
 
-	user, _, _ := rc.req.BasicAuth()
-
-	return user == rc.srv.getOptions().UIUser
+	return rc.username == rc.srv.getOptions().UIUser
 }
 
 func requireServerControlUser(_ context.Context, rc requestContext) bool {
@@ -77,13 +81,37 @@ func requireServerControlUser(_ context.Context, rc requestContext) bool {
 		return true
 	}
 
+	if g := rc.srv.getOptions().OIDCServerControlGroup; g != "" && slices.Contains(rc.groups, g) {
+		return true
+	}
+
 	if rc.srv.getOptions().ServerControlUser == "" {
 		return false
 	}
 
-	user, _, _ := rc.req.BasicAuth()
+	return rc.username == rc.srv.getOptions().ServerControlUser
+}
+
+// requireServerControlUserOrAPIToken returns a function that allows the server control user and callers
+// authenticated with API tokens granting any of the provided scopes.
+func requireServerControlUserOrAPIToken(tokenScopes []apitoken.Scope) isAuthorizedFunc {
+	return func(ctx context.Context, rc requestContext) bool {
+		if rc.apiToken == nil {
+			return requireServerControlUser(ctx, rc)
+		}
+
+		for _, s := range tokenScopes {
+			if rc.apiToken.HasScope(s) {
+				userLog(ctx).Infof("API token %v (%v) used by client %s for %v %v", rc.apiToken.ID, rc.apiToken.Description, rc.req.RemoteAddr, rc.req.Method, rc.req.URL.Path)
+
+				return true
+			}
+		}
 
-	return user == rc.srv.getOptions().ServerControlUser
+		userLog(ctx).Warnf("API token %v (%v) used by client %s without scope required for %v %v", rc.apiToken.ID, rc.apiToken.Description, rc.req.RemoteAddr, rc.req.Method, rc.req.URL.Path)
+
+		return false
+	}
 }
 
 func anyAuthenticatedUser(_ context.Context, _ requestContext) bool {
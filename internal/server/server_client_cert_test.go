@@ -0,0 +1,161 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+func TestServerClientCertificateAuthentication(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	caCert, caKey := generateTestCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	apiServerInfo := servertesting.StartServerWithClientCA(t, env, pool)
+
+	clientCert, clientKey := generateTestCertificate(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "test-client"},
+		EmailAddresses: []string{servertesting.TestUsername + "@" + servertesting.TestHostname},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, caKey)
+
+	// certificate issued by a CA not trusted by the server.
+	untrustedCert, untrustedKey := generateTestCertificate(t, &x509.Certificate{
+		EmailAddresses: []string{servertesting.TestUsername + "@" + servertesting.TestHostname},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil, nil)
+
+	dir := testutil.TempDirectory(t)
+	clientCertFile, clientKeyFile := writeTestCertificate(t, dir, "client", clientCert, clientKey)
+
+	connect := func(username, password string, certFile, keyFile string) error {
+		t.Helper()
+
+		asi := *apiServerInfo
+		asi.ClientCertificateFile = certFile
+		asi.ClientKeyFile = keyFile
+
+		rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, &asi, repo.ClientOptions{
+			Username: username,
+			Hostname: servertesting.TestHostname,
+		}, content.CachingOptions{
+			CacheDirectory: testutil.TempDirectory(t),
+		}, password, &repo.Options{})
+		if err == nil {
+			rep.Close(ctx)
+		}
+
+		return err
+	}
+
+	// the certificate authenticates the user without a valid password.
+	require.NoError(t, connect(servertesting.TestUsername, "bad-password", clientCertFile, clientKeyFile))
+
+	// the certificate does not authenticate other users.
+	require.Error(t, connect("other-user", "bad-password", clientCertFile, clientKeyFile))
+
+	// without a certificate the password is still required.
+	require.Error(t, connect(servertesting.TestUsername, "bad-password", "", ""))
+	require.NoError(t, connect(servertesting.TestUsername, servertesting.TestPassword, "", ""))
+
+	// certificates issued by untrusted CAs are rejected.
+	untrustedCertFile, untrustedKeyFile := writeTestCertificate(t, dir, "untrusted", untrustedCert, untrustedKey)
+	require.Error(t, connect(servertesting.TestUsername, "bad-password", untrustedCertFile, untrustedKeyFile))
+
+	// HTTP requests are authenticated by the certificate as well.
+	httpGet := func(username string, cert tls.Certificate) int {
+		t.Helper()
+
+		cli := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: true, //nolint:gosec
+					Certificates:       []tls.Certificate{cert},
+				},
+			},
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiServerInfo.BaseURL+"/browse/", http.NoBody)
+		require.NoError(t, err)
+
+		req.SetBasicAuth(username, "bad-password")
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	tlsCert := tls.Certificate{Certificate: [][]byte{clientCert.Raw}, PrivateKey: clientKey}
+
+	require.Equal(t, http.StatusOK, httpGet(servertesting.TestUsername+"@"+servertesting.TestHostname, tlsCert))
+	require.Equal(t, http.StatusUnauthorized, httpGet("other@"+servertesting.TestHostname, tlsCert))
+	require.Equal(t, http.StatusUnauthorized, httpGet(servertesting.TestUsername+"@"+servertesting.TestHostname, tls.Certificate{}))
+}
+
+// generateTestCertificate generates a certificate based on the provided template, signed by the
+// provided issuer or self-signed if the issuer is nil.
+func generateTestCertificate(t *testing.T, template, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	if issuer == nil {
+		issuer, issuerKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+func writeTestCertificate(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kopia/kopia/internal/apitoken"
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/uitask"
+	"github.com/kopia/kopia/notification"
+	"github.com/kopia/kopia/notification/notifydata"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+const (
+	// eventSubscriberBufferSize is the number of events buffered for each subscriber,
+	// events are dropped for subscribers that fall behind.
+	eventSubscriberBufferSize = 256
+
+	// eventStreamKeepAliveInterval is the interval between comments sent to idle event streams
+	// to keep proxies from closing the connection.
+	eventStreamKeepAliveInterval = 30 * time.Second
+)
+
+// serverEvent is a single event published to the subscribers of the event stream.
+type serverEvent struct {
+	id        uint64
+	eventType string
+	source    *snapshot.SourceInfo // if set, the event is only sent to subscribers that can read the source
+	data      []byte
+}
+
+// eventBroker fans out server events to the clients of the event stream.
+// Publishing never blocks, so slow subscribers lose events instead of slowing down the server.
+type eventBroker struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	nextID uint64
+	// +checklocks:mu
+	subscribers map[chan *serverEvent]struct{}
+	// +checklocks:mu
+	closed bool
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: map[chan *serverEvent]struct{}{},
+	}
+}
+
+// publish sends the event with the provided JSON-encoded payload to all subscribers.
+func (b *eventBroker) publish(eventType string, src *snapshot.SourceInfo, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.subscribers) == 0 {
+		return
+	}
+
+	b.nextID++
+
+	ev := &serverEvent{b.nextID, eventType, src, data}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving published events and a function to stop receiving them.
+// The channel is closed when the broker is closed.
+func (b *eventBroker) subscribe() (ch <-chan *serverEvent, unsubscribe func()) {
+	c := make(chan *serverEvent, eventSubscriberBufferSize)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(c)
+		return c, func() {}
+	}
+
+	b.subscribers[c] = struct{}{}
+
+	return c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[c]; ok {
+			delete(b.subscribers, c)
+			close(c)
+		}
+	}
+}
+
+// close disconnects all subscribers.
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for c := range b.subscribers {
+		delete(b.subscribers, c)
+		close(c)
+	}
+}
+
+// CloseEventStreams disconnects all clients of the event stream, which would otherwise prevent
+// graceful shutdown of the HTTP server. Clients can't subscribe to events afterwards.
+func (s *Server) CloseEventStreams() {
+	s.events.close()
+}
+
+func (s *Server) getEventBroker() *eventBroker {
+	return s.events
+}
+
+func (s *Server) publishTaskEvent(info uitask.Info) {
+	s.events.publish(serverapi.EventTypeTask, nil, info)
+}
+
+func (s *Server) publishUploadEvent(src snapshot.SourceInfo, taskID string, counters upload.Counters, final bool) {
+	s.events.publish(serverapi.EventTypeUpload, &src, &serverapi.UploadEvent{
+		Source:   src,
+		TaskID:   taskID,
+		Counters: counters,
+		Final:    final,
+	})
+}
+
+func (s *Server) publishMaintenanceEvent(ev *serverapi.MaintenanceEvent) {
+	s.events.publish(serverapi.EventTypeMaintenance, nil, ev)
+}
+
+// sendNotification sends the notification using notification.Send() and publishes it to the event stream.
+func (s *Server) sendNotification(ctx context.Context, rep repo.Repository, templateName string, eventArgs notifydata.TypedEventArgs, sev notification.Severity) {
+	notification.Send(ctx, rep, templateName, eventArgs, sev, s.notificationTemplateOptions())
+
+	s.publishNotificationEvent(templateName, eventArgs, sev)
+}
+
+func (s *Server) publishNotificationEvent(templateName string, eventArgs notifydata.TypedEventArgs, sev notification.Severity) {
+	args, err := json.Marshal(eventArgs)
+	if err != nil {
+		return
+	}
+
+	s.events.publish(serverapi.EventTypeNotification, nil, &serverapi.NotificationEvent{
+		TemplateName:  templateName,
+		Severity:      notification.SeverityToString[sev],
+		EventArgsType: eventArgs.EventArgsType().String(),
+		EventArgs:     args,
+	})
+}
+
+// eventFilter returns a function that determines which events can be sent to the client making the request
+// or nil if the client is not allowed to receive events.
+//
+// The UI user, the server control user and API tokens granting the 'read-status' scope receive all events,
+// except that API tokens limited to some sources only receive events of those sources. Other users only receive
+// events of sources they are allowed to read, which requires the repository to be connected.
+func eventFilter(ctx context.Context, rc requestContext) func(ev *serverEvent) bool {
+	switch {
+	case rc.apiToken != nil:
+		if !rc.apiToken.HasScope(apitoken.ScopeReadStatus) {
+			return nil
+		}
+
+		tok := rc.apiToken
+
+		return func(ev *serverEvent) bool {
+			if ev.source == nil {
+				return len(tok.Sources) == 0
+			}
+
+			return tok.AllowsSource(*ev.source)
+		}
+
+	case requireUIUser(ctx, rc), requireServerControlUser(ctx, rc):
+		return func(*serverEvent) bool { return true }
+
+	case rc.rep == nil:
+		return nil
+
+	default:
+		canRead := browseSourceFilter(ctx, rc)
+
+		return func(ev *serverEvent) bool {
+			return ev.source != nil && canRead(*ev.source)
+		}
+	}
+}
+
+// handleEvents streams server events to the client using server-sent events (text/event-stream).
+// Each event carries its type in the 'event' field and the JSON-encoded payload in the 'data' field.
+// The stream does not replay past events, clients should fetch the current state after connecting.
+func handleEvents(ctx context.Context, rc requestContext) {
+	allowed := eventFilter(ctx, rc)
+	if allowed == nil {
+		http.Error(rc.w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := rc.w.(http.Flusher)
+	if !ok {
+		http.Error(rc.w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := rc.srv.getEventBroker().subscribe()
+	defer unsubscribe()
+
+	rc.w.Header().Set("Content-Type", "text/event-stream")
+	rc.w.Header().Set("Cache-Control", "no-cache")
+	rc.w.Header().Set("X-Accel-Buffering", "no")
+	rc.w.WriteHeader(http.StatusOK)
+
+	// the initial comment lets the client know the subscription is active.
+	fmt.Fprint(rc.w, ": connected\n\n") //nolint:errcheck
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprintf(rc.w, ": keep-alive %v\n\n", clock.Now().Unix()); err != nil {
+				return
+			}
+
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if !allowed(ev) {
+				continue
+			}
+
+			if _, err := fmt.Fprintf(rc.w, "id: %v\nevent: %v\ndata: %s\n\n", ev.id, ev.eventType, ev.data); err != nil {
+				userLog(ctx).Debugf("unable to write event: %v", err)
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
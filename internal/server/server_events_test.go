@@ -0,0 +1,167 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/internal/uitask"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+type streamedEvent struct {
+	eventType string
+	data      string
+}
+
+// openEventStream connects to the event stream as the provided user and returns the channel receiving the events.
+func openEventStream(ctx context.Context, t *testing.T, baseURL, username, password string) (int, <-chan streamedEvent) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v1/events", http.NoBody)
+	require.NoError(t, err)
+
+	req.SetBasicAuth(username, password)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	ch := make(chan streamedEvent, 1000)
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		close(ch)
+
+		return resp.StatusCode, ch
+	}
+
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		var ev streamedEvent
+
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			switch l := s.Text(); {
+			case strings.HasPrefix(l, "event: "):
+				ev.eventType = strings.TrimPrefix(l, "event: ")
+			case strings.HasPrefix(l, "data: "):
+				ev.data = strings.TrimPrefix(l, "data: ")
+			case l == "" && ev.eventType != "":
+				ch <- ev
+				ev = streamedEvent{}
+			}
+		}
+	}()
+
+	return resp.StatusCode, ch
+}
+
+// waitForEvent returns the first event of the given type for which the provided function returns true.
+func waitForEvent[T any](t *testing.T, ch <-chan streamedEvent, eventType string, match func(v T) bool) T {
+	t.Helper()
+
+	timeout := time.After(30 * time.Second)
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			require.True(t, ok, "event stream closed")
+
+			if ev.eventType != eventType {
+				continue
+			}
+
+			var v T
+
+			require.NoError(t, json.Unmarshal([]byte(ev.data), &v))
+
+			if match(v) {
+				return v
+			}
+
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v event", eventType)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	srvInfo := servertesting.StartServer(t, env, false)
+
+	status, _ := openEventStream(ctx, t, srvInfo.BaseURL, servertesting.TestUIUsername, "wrong-password")
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	status, uiEvents := openEventStream(ctx, t, srvInfo.BaseURL, servertesting.TestUIUsername, servertesting.TestUIPassword)
+	require.Equal(t, http.StatusOK, status)
+
+	// repository users only receive events of sources they can read, the local source belongs to another user.
+	status, userEvents := openEventStream(ctx, t, srvInfo.BaseURL, servertesting.TestUsername+"@"+servertesting.TestHostname, servertesting.TestPassword)
+	require.Equal(t, http.StatusOK, status)
+
+	cli, err := apiclient.NewKopiaAPIClient(apiclient.Options{
+		BaseURL:  srvInfo.BaseURL,
+		Username: servertesting.TestUIUsername,
+		Password: servertesting.TestUIPassword,
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, cli.FetchCSRFTokenForTesting(ctx))
+
+	dir := testutil.TempDirectory(t)
+	si := env.LocalPathSourceInfo(dir)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file-a"), []byte{1, 2}, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file-b"), []byte{1, 2, 3}, 0o644))
+
+	mustCreateSource(t, cli, dir, &policy.Policy{})
+
+	_, err = serverapi.UploadSnapshots(ctx, cli, &si)
+	require.NoError(t, err)
+
+	started := waitForEvent(t, uiEvents, serverapi.EventTypeTask, func(ti uitask.Info) bool {
+		return ti.Kind == "Snapshot" && ti.Status == uitask.StatusRunning
+	})
+
+	ue := waitForEvent(t, uiEvents, serverapi.EventTypeUpload, func(ue serverapi.UploadEvent) bool {
+		return ue.Final
+	})
+
+	require.Equal(t, si, ue.Source)
+	require.Equal(t, started.TaskID, ue.TaskID)
+	require.Equal(t, int32(2), ue.Counters.TotalHashedFiles)
+	require.Equal(t, int64(5), ue.Counters.TotalHashedBytes)
+
+	finished := waitForEvent(t, uiEvents, serverapi.EventTypeTask, func(ti uitask.Info) bool {
+		return ti.TaskID == started.TaskID && ti.Status.IsFinished()
+	})
+
+	require.Equal(t, uitask.StatusSuccess, finished.Status)
+	require.Equal(t, finished, mustGetTask(t, cli, started.TaskID))
+
+	select {
+	case ev := <-userEvents:
+		t.Fatalf("unexpected event sent to repository user: %v", ev)
+	case <-time.After(time.Second):
+	}
+}
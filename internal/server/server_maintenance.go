@@ -10,7 +10,6 @@
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
-	"github.com/kopia/kopia/notification/notifytemplate"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/maintenance"
 )
@@ -36,7 +35,7 @@ type maintenanceManagerServerInterface interface {
 	runMaintenanceTask(ctx context.Context, dr repo.DirectRepository) error
 	refreshScheduler(reason string)
 	enableErrorNotifications() bool
-	notificationTemplateOptions() notifytemplate.Options
+	sendNotification(ctx context.Context, rep repo.Repository, templateName string, eventArgs notifydata.TypedEventArgs, sev notification.Severity)
 }
 
 func (s *srvMaintenance) trigger() {
@@ -169,12 +168,11 @@ func maybeStartMaintenanceManager(
 					m.afterFailedRun()
 
 					if srv.enableErrorNotifications() {
-						notification.Send(ctx,
+						srv.sendNotification(ctx,
 							rep,
 							"generic-error",
 							notifydata.NewErrorInfo("Maintenance", "Scheduled Maintenance", t0, clock.Now(), err),
 							notification.SeverityError,
-							srv.notificationTemplateOptions(),
 						)
 					}
 				}
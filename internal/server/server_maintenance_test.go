@@ -12,7 +12,8 @@
 
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/repotesting"
-	"github.com/kopia/kopia/notification/notifytemplate"
+	"github.com/kopia/kopia/notification"
+	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/maintenance"
 )
@@ -52,8 +53,7 @@ func (s *testServer) enableErrorNotifications() bool {
 	return false
 }
 
-func (s *testServer) notificationTemplateOptions() notifytemplate.Options {
-	return notifytemplate.DefaultOptions
+func (s *testServer) sendNotification(ctx context.Context, rep repo.Repository, templateName string, eventArgs notifydata.TypedEventArgs, sev notification.Severity) {
 }
 
 func TestServerMaintenance(t *testing.T) {
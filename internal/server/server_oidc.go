@@ -0,0 +1,205 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/clock"
+)
+
+const (
+	oidcLoginPath          = "/oidc/login"
+	oidcCallbackPath       = "/oidc/callback"
+	oidcRedirectQueryParam = "redirect"
+
+	kopiaOIDCSessionCookie    = "Kopia-OIDC-Session"
+	kopiaOIDCSessionTTL       = 8 * time.Hour
+	kopiaOIDCSessionAudience  = "kopia-oidc"
+	kopiaOIDCStateCookie      = "Kopia-OIDC-State"
+	kopiaOIDCStateTTL         = 10 * time.Minute
+	kopiaOIDCStateSeparator   = "|"
+	kopiaOIDCStateParts       = 4 // state, nonce, PKCE verifier and redirect path
+	kopiaOIDCDefaultRedirect  = "/"
+	bearerAuthorizationPrefix = "Bearer "
+)
+
+// bearerToken returns the bearer token in the Authorization header of the request.
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) <= len(bearerAuthorizationPrefix) || !strings.EqualFold(h[0:len(bearerAuthorizationPrefix)], bearerAuthorizationPrefix) {
+		return "", false
+	}
+
+	return h[len(bearerAuthorizationPrefix):], true
+}
+
+// oidcSessionClaims are the claims of the session cookie, whose subject is the user of the session.
+type oidcSessionClaims struct {
+	jwt.RegisteredClaims
+
+	Groups []string `json:"groups,omitempty"`
+}
+
+func (s *Server) isOIDCBearerTokenValid(rc *requestContext, token string) bool {
+	id, err := s.options.OIDC.ValidateToken(rc.req.Context(), token)
+	if err != nil {
+		rc.w.Header().Set("WWW-Authenticate", `Bearer realm="Kopia", error="invalid_token"`)
+		http.Error(rc.w, "Access denied.\n", http.StatusUnauthorized)
+
+		userLog(rc.req.Context()).Warnf("invalid bearer token from client %s: %v", rc.req.RemoteAddr, err)
+
+		return false
+	}
+
+	rc.username = id.Username
+	rc.groups = id.Groups
+
+	return true
+}
+
+// oidcSession returns the identity of the session established by logging in through the OIDC provider.
+func (s *Server) oidcSession(r *http.Request) (auth.OIDCIdentity, bool) {
+	c, err := r.Cookie(s.cookieName(kopiaOIDCSessionCookie))
+	if err != nil {
+		return auth.OIDCIdentity{}, false
+	}
+
+	var sc oidcSessionClaims
+
+	if _, err := jwt.ParseWithClaims(c.Value, &sc, func(_ *jwt.Token) (any, error) {
+		return s.authCookieSigningKey, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(s.cookieAudience(kopiaOIDCSessionAudience)),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	); err != nil {
+		return auth.OIDCIdentity{}, false
+	}
+
+	return auth.OIDCIdentity{Username: sc.Subject, Groups: sc.Groups}, sc.Subject != ""
+}
+
+// shouldRedirectToOIDCLogin determines whether a request for the UI comes from a browser that
+// has not logged in yet and should be sent to the OIDC provider. This only happens when OIDC is the
+// only way of logging in to the UI, otherwise browsers are asked for a password and users start
+// OIDC login by visiting /oidc/login.
+func (s *Server) shouldRedirectToOIDCLogin(r *http.Request) bool {
+	if s.options.OIDC == nil || !s.options.OIDCOnly || r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+		return false
+	}
+
+	_, ok := s.oidcSession(r)
+
+	return !ok
+}
+
+// handleOIDCLogin redirects the browser to the login page of the OIDC provider.
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	l := auth.NewOIDCLogin()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(kopiaOIDCStateCookie),
+		Value:    strings.Join([]string{l.State, l.Nonce, l.Verifier, safeLocalRedirect(r.URL.Query().Get(oidcRedirectQueryParam))}, kopiaOIDCStateSeparator),
+		Path:     oidcCallbackPath,
+		MaxAge:   int(kopiaOIDCStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, s.options.OIDC.AuthCodeURL(l), http.StatusFound)
+}
+
+// handleOIDCCallback completes the login by exchanging the authorization code for the ID token
+// and establishes the session of the user.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	c, err := r.Cookie(s.cookieName(kopiaOIDCStateCookie))
+	if err != nil {
+		http.Error(w, "Missing login state.\n", http.StatusBadRequest)
+		return
+	}
+
+	// the redirect path is last, since it may contain the separator.
+	parts := strings.SplitN(c.Value, kopiaOIDCStateSeparator, kopiaOIDCStateParts)
+	if len(parts) != kopiaOIDCStateParts {
+		http.Error(w, "Invalid login state.\n", http.StatusBadRequest)
+		return
+	}
+
+	l := auth.OIDCLogin{State: parts[0], Nonce: parts[1], Verifier: parts[2]}
+	redirect := parts[3]
+
+	if subtle.ConstantTimeCompare([]byte(l.State), []byte(r.URL.Query().Get("state"))) != 1 {
+		http.Error(w, "Invalid login state.\n", http.StatusBadRequest)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:   s.cookieName(kopiaOIDCStateCookie),
+		Path:   oidcCallbackPath,
+		MaxAge: -1,
+	})
+
+	id, err := s.options.OIDC.Exchange(ctx, l, r.URL.Query().Get("code"))
+	if err != nil {
+		userLog(ctx).Warnf("failed OIDC login by client %s: %v", r.RemoteAddr, err)
+		http.Error(w, "Access denied.\n", http.StatusUnauthorized)
+
+		return
+	}
+
+	now := clock.Now()
+
+	session, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &oidcSessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.Username,
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(kopiaOIDCSessionTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Audience:  jwt.ClaimStrings{s.cookieAudience(kopiaOIDCSessionAudience)},
+			ID:        uuid.New().String(),
+			Issuer:    kopiaAuthCookieIssuer,
+		},
+		Groups: id.Groups,
+	}).SignedString(s.authCookieSigningKey)
+	if err != nil {
+		userLog(ctx).Errorf("unable to generate OIDC session cookie: %v", err)
+		http.Error(w, "Internal server error.\n", http.StatusInternalServerError)
+
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(kopiaOIDCSessionCookie),
+		Value:    session,
+		Path:     "/",
+		Expires:  now.Add(kopiaOIDCSessionTTL),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if s.options.LogRequests {
+		userLog(ctx).Infof("successful OIDC login by client %s for user %s", r.RemoteAddr, id.Username)
+	}
+
+	http.Redirect(w, r, safeLocalRedirect(redirect), http.StatusFound)
+}
+
+// safeLocalRedirect returns the provided path if it refers to this server, to prevent open redirects.
+func safeLocalRedirect(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return kopiaOIDCDefaultRedirect
+	}
+
+	return p
+}
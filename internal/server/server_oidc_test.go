@@ -0,0 +1,191 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/oidctesting"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/servertesting"
+)
+
+func TestServerOIDCAuthentication(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	iss := oidctesting.NewIssuer(t)
+
+	// the provider redirects to this URL, which the test rewrites to point at the test server.
+	const redirectURL = "http://kopia.invalid/oidc/callback"
+
+	oidc, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:    iss.URL,
+		ClientID:     oidctesting.TestClientID,
+		ClientSecret: oidctesting.TestClientSecret,
+		RedirectURL:  redirectURL,
+	})
+	require.NoError(t, err)
+
+	srvInfo := servertesting.StartServerWithOIDC(t, env, oidc, false)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	cli := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	get := func(t *testing.T, u string, header http.Header) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+		require.NoError(t, err)
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	// follows redirects of the login flow, sending the provider's redirect to the test server.
+	login := func(t *testing.T) *http.Response {
+		t.Helper()
+
+		resp := get(t, srvInfo.BaseURL+"/oidc/login?redirect=%2F", nil)
+
+		for resp.StatusCode == http.StatusFound {
+			loc, err := resp.Location()
+			require.NoError(t, err)
+
+			if after, ok := strings.CutPrefix(loc.String(), redirectURL); ok {
+				loc, err = url.Parse(srvInfo.BaseURL + "/oidc/callback" + after)
+				require.NoError(t, err)
+			}
+
+			resp = get(t, loc.String(), nil)
+		}
+
+		return resp
+	}
+
+	bearer := func(token string) http.Header {
+		return http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	t.Run("UIPasswordLogin", func(t *testing.T) {
+		// without --oidc-only browsers are asked for a password instead of being redirected to the provider.
+		resp := get(t, srvInfo.BaseURL+"/", nil)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.NotEmpty(t, resp.Header.Get("WWW-Authenticate"))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srvInfo.BaseURL+"/", http.NoBody)
+		require.NoError(t, err)
+
+		req.SetBasicAuth(servertesting.TestUIUsername, servertesting.TestUIPassword)
+
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("UILogin", func(t *testing.T) {
+		iss.SetLoginClaims(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "groups": []string{servertesting.TestOIDCUIGroup}})
+
+		require.Equal(t, http.StatusOK, login(t).StatusCode)
+
+		// the session cookie authenticates subsequent requests.
+		require.Equal(t, http.StatusOK, get(t, srvInfo.BaseURL+"/", nil).StatusCode)
+	})
+
+	t.Run("UILoginNotUIUser", func(t *testing.T) {
+		jar, err = cookiejar.New(nil)
+		require.NoError(t, err)
+
+		cli.Jar = jar
+
+		iss.SetLoginClaims(jwt.MapClaims{"email": "bob@example.com", "email_verified": true})
+
+		require.Equal(t, http.StatusForbidden, login(t).StatusCode)
+	})
+
+	t.Run("CallbackWithoutState", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, get(t, srvInfo.BaseURL+"/oidc/callback?code=x&state=y", nil).StatusCode)
+	})
+
+	t.Run("BearerToken", func(t *testing.T) {
+		cli.Jar = nil
+
+		adminToken := iss.IDToken(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "groups": []string{servertesting.TestOIDCUIGroup}})
+		userToken := iss.IDToken(jwt.MapClaims{"email": "bob@example.com", "email_verified": true})
+
+		// bearer token requests don't require CSRF tokens.
+		require.Equal(t, http.StatusOK, get(t, srvInfo.BaseURL+"/api/v1/sources", bearer(adminToken)).StatusCode)
+		require.Equal(t, http.StatusForbidden, get(t, srvInfo.BaseURL+"/api/v1/sources", bearer(userToken)).StatusCode)
+		require.Equal(t, http.StatusUnauthorized, get(t, srvInfo.BaseURL+"/api/v1/sources", bearer("invalid")).StatusCode)
+
+		// UI pages are not redirected to login when bearer tokens are used.
+		require.Equal(t, http.StatusOK, get(t, srvInfo.BaseURL+"/", bearer(adminToken)).StatusCode)
+	})
+
+	t.Run("BasicAuth", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srvInfo.BaseURL+"/api/v1/control/status", http.NoBody)
+		require.NoError(t, err)
+
+		req.SetBasicAuth(servertesting.TestUIUsername, servertesting.TestUIPassword)
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		// passwords still authenticate users, the UI user is not the server control user.
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+func TestServerOIDCOnlyRedirectsToLogin(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	iss := oidctesting.NewIssuer(t)
+
+	oidc, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:    iss.URL,
+		ClientID:     oidctesting.TestClientID,
+		ClientSecret: oidctesting.TestClientSecret,
+		RedirectURL:  "http://kopia.invalid/oidc/callback",
+	})
+	require.NoError(t, err)
+
+	srvInfo := servertesting.StartServerWithOIDC(t, env, oidc, true)
+
+	cli := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srvInfo.BaseURL+"/", http.NoBody)
+	require.NoError(t, err)
+
+	resp, err := cli.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	require.Equal(t, "/oidc/login?redirect=%2F", resp.Header.Get("Location"))
+}
@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/pullsource"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// numPullSourceConnections counts open connections of the "test-local" pull source protocol.
+var numPullSourceConnections atomic.Int32
+
+type testPullSourceConnection struct{}
+
+func (testPullSourceConnection) Close() error {
+	numPullSourceConnections.Add(-1)
+	return nil
+}
+
+func init() {
+	// test-local protocol reads files from the local filesystem, simulating a remote host.
+	pullsource.RegisterProtocol("test-local", func(_ context.Context, _ json.RawMessage, path string) (fs.Directory, io.Closer, error) {
+		dir, err := localfs.Directory(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		numPullSourceConnections.Add(1)
+
+		return dir, testPullSourceConnection{}, nil
+	}, nil)
+}
+
+func TestPullSources(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file-a"), []byte{1, 2, 3}, 0o644))
+
+	si := snapshot.SourceInfo{UserName: "remote-user", Host: "remote-host", Path: dir}
+
+	require.NoError(t, pullsource.Set(ctx, env.RepositoryWriter, &pullsource.Source{Source: si, Protocol: "test-local"}))
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	srvInfo := servertesting.StartServer(t, env, false)
+
+	cli, err := apiclient.NewKopiaAPIClient(apiclient.Options{
+		BaseURL:  srvInfo.BaseURL,
+		Username: servertesting.TestUIUsername,
+		Password: servertesting.TestUIPassword,
+	})
+	require.NoError(t, err)
+	require.NoError(t, cli.FetchCSRFTokenForTesting(ctx))
+
+	// pull sources are snapshotted by the server even though they are on another host.
+	sources := mustListSources(t, cli, &si)
+	require.Len(t, sources, 1)
+	require.NotEqual(t, "REMOTE", sources[0].Status)
+
+	uresp, err := serverapi.UploadSnapshots(ctx, cli, &si)
+	require.NoError(t, err)
+	require.True(t, uresp.Sources[si.String()].Success)
+
+	require.Eventually(t, func() bool {
+		snaps, err := serverapi.ListSnapshots(ctx, cli, si, true)
+		require.NoError(t, err)
+
+		return len(snaps.Snapshots) == 1
+	}, 30*time.Second, 100*time.Millisecond)
+
+	// the connection is closed after the snapshot.
+	require.Eventually(t, func() bool {
+		return numPullSourceConnections.Load() == 0
+	}, 10*time.Second, 100*time.Millisecond)
+
+	// once the pull source is removed, the source is only known from its snapshots.
+	rep2 := env.MustOpenAnother(t)
+	require.NoError(t, pullsource.Delete(ctx, rep2, si))
+	require.NoError(t, rep2.Flush(ctx))
+
+	require.NoError(t, cli.Post(ctx, "refresh", &serverapi.Empty{}, &serverapi.Empty{}))
+
+	require.Eventually(t, func() bool {
+		sources := mustListSources(t, cli, &si)
+
+		return len(sources) == 1 && sources[0].Status == "REMOTE"
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestServerPullSourceManifestsDenied(t *testing.T) {
+	verifyServerInternalManifestDenied(t, pullsource.ManifestType)
+}
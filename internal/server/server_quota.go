@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/notification"
+	"github.com/kopia/kopia/notification/notifydata"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+const quotaRefreshFrequency = 10 * time.Second
+
+// ErrQuotaExceeded is returned when a user attempts to upload new data after reaching the hard limit of their quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// quotaManager enforces storage quotas on new packed bytes uploaded through gRPC sessions.
+// Usage is only tracked while at least one quota is defined and is attributed to the user
+// whose session first uploaded each content, deduplicated contents are free.
+//
+// Sessions don't see contents written by other sessions until they are flushed, so new contents are
+// claimed by the session writing them until they are committed to the index. Checking for existing
+// contents is repeated when claims are released in the meantime, so sessions concurrently writing the
+// same content are charged for it only once, instead of tolerating the over-count and recomputing usage
+// later, which is not possible since contents don't record who uploaded them.
+type quotaManager struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	nextRefreshTime time.Time
+	// +checklocks:mu
+	usageLoaded bool
+	// +checklocks:mu
+	quotas []*user.Quota
+	// +checklocks:mu
+	persisted map[string]*user.Usage
+	// +checklocks:mu
+	pending map[string]*user.Usage
+	// +checklocks:mu
+	softLimitNotified map[string]bool
+	// +checklocks:mu
+	claimed map[content.ID]repo.DirectRepositoryWriter
+	// +checklocks:mu
+	releasedClaims int64 // incremented when sessions release claims of contents they committed
+}
+
+// maybeRefreshLocked reloads quotas periodically, and usage when it was not loaded yet.
+//
+// +checklocks:m.mu
+func (m *quotaManager) maybeRefreshLocked(ctx context.Context, rep repo.Repository) {
+	if clock.Now().Before(m.nextRefreshTime) {
+		return
+	}
+
+	m.nextRefreshTime = clock.Now().Add(quotaRefreshFrequency)
+
+	quotas, err := user.ListQuotas(ctx, rep)
+	if err != nil {
+		userLog(ctx).Errorf("unable to load quotas: %v", err)
+		return
+	}
+
+	m.quotas = quotas
+
+	if m.usageLoaded || len(quotas) == 0 {
+		return
+	}
+
+	usage, err := user.LoadUsageMap(ctx, rep)
+	if err != nil {
+		userLog(ctx).Errorf("unable to load usage: %v", err)
+		return
+	}
+
+	m.persisted = usage
+	m.usageLoaded = true
+}
+
+// enabled returns true if there are any quotas defined and usage must be tracked.
+func (m *quotaManager) enabled(ctx context.Context, rep repo.Repository) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maybeRefreshLocked(ctx, rep)
+
+	return len(m.quotas) > 0 && m.usageLoaded
+}
+
+// currentUsageLocked returns persisted usage combined with usage not yet written to the repository.
+//
+// +checklocks:m.mu
+func (m *quotaManager) currentUsageLocked() map[string]*user.Usage {
+	result := map[string]*user.Usage{}
+
+	for k, v := range m.persisted {
+		result[k] = &user.Usage{Username: k, PackedBytes: v.PackedBytes, ContentCount: v.ContentCount}
+	}
+
+	for k, v := range m.pending {
+		u := result[k]
+		if u == nil {
+			u = &user.Usage{Username: k}
+			result[k] = u
+		}
+
+		u.PackedBytes += v.PackedBytes
+		u.ContentCount += v.ContentCount
+	}
+
+	return result
+}
+
+// checkHardLimit returns ErrQuotaExceeded if any quota applicable to the user has reached its hard limit.
+func (m *quotaManager) checkHardLimit(usernameAtHostname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := m.currentUsageLocked()
+
+	for _, q := range m.quotas {
+		if q.HardLimitBytes <= 0 || !q.Matches(usernameAtHostname) {
+			continue
+		}
+
+		if used := user.QuotaUsage(q, usage); used >= q.HardLimitBytes {
+			return errors.Wrapf(ErrQuotaExceeded, "%v has used %v of %v allowed for %v",
+				usernameAtHostname, units.BytesString(used), units.BytesString(q.HardLimitBytes), q.Pattern)
+		}
+	}
+
+	return nil
+}
+
+// addUsage attributes new packed bytes to the user and returns the quotas whose soft limit was exceeded for the first time.
+func (m *quotaManager) addUsage(usernameAtHostname string, packedBytes int64) []*user.Quota {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.pending == nil {
+		m.pending = map[string]*user.Usage{}
+	}
+
+	p := m.pending[usernameAtHostname]
+	if p == nil {
+		p = &user.Usage{Username: usernameAtHostname}
+		m.pending[usernameAtHostname] = p
+	}
+
+	p.PackedBytes += packedBytes
+	p.ContentCount++
+
+	usage := m.currentUsageLocked()
+
+	if m.softLimitNotified == nil {
+		m.softLimitNotified = map[string]bool{}
+	}
+
+	var exceeded []*user.Quota
+
+	for _, q := range m.quotas {
+		if q.SoftLimitBytes <= 0 || !q.Matches(usernameAtHostname) {
+			continue
+		}
+
+		over := user.QuotaUsage(q, usage) >= q.SoftLimitBytes
+		if over && !m.softLimitNotified[q.Pattern] {
+			exceeded = append(exceeded, q)
+		}
+
+		m.softLimitNotified[q.Pattern] = over
+	}
+
+	return exceeded
+}
+
+// persist writes usage of the provided user that was not yet saved to the repository.
+func (m *quotaManager) persist(ctx context.Context, w repo.RepositoryWriter, usernameAtHostname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.pending[usernameAtHostname]
+	if p == nil {
+		return nil
+	}
+
+	u := &user.Usage{Username: usernameAtHostname}
+	if old := m.persisted[usernameAtHostname]; old != nil {
+		u.PackedBytes = old.PackedBytes
+		u.ContentCount = old.ContentCount
+	}
+
+	u.PackedBytes += p.PackedBytes
+	u.ContentCount += p.ContentCount
+	u.LastUpdated = clock.Now()
+
+	if err := user.SetUsage(ctx, w, u); err != nil {
+		return errors.Wrap(err, "unable to save usage")
+	}
+
+	if m.persisted == nil {
+		m.persisted = map[string]*user.Usage{}
+	}
+
+	m.persisted[usernameAtHostname] = u
+	delete(m.pending, usernameAtHostname)
+
+	return nil
+}
+
+// Refresh ensures quotas and usage are reloaded from the repository on next use, which picks up usage resets.
+func (m *quotaManager) Refresh(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextRefreshTime = time.Time{}
+	m.usageLoaded = false
+
+	return nil
+}
+
+// reset discards all state when the server switches to another repository.
+func (m *quotaManager) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextRefreshTime = time.Time{}
+	m.usageLoaded = false
+	m.quotas = nil
+	m.persisted = nil
+	m.pending = nil
+	m.softLimitNotified = nil
+	m.claimed = nil
+	m.releasedClaims++
+}
+
+// claimNewContent returns true if writing the provided data in the session will result in new packed bytes,
+// as opposed to deduplicating against an existing content or one claimed by another session, in which case
+// the content is claimed by the session until releaseClaims is called after flushing it.
+//
+// The content is hashed and looked up without holding the lock, so that sessions don't wait for each other.
+// If any claims were released during the lookup, the content may have been committed by another session
+// in the meantime and the lookup is repeated.
+func (m *quotaManager) claimNewContent(ctx context.Context, dw repo.DirectRepositoryWriter, data gather.Bytes, prefix content.IDPrefix) (content.ID, bool) {
+	contentID, err := content.IDFromHash(prefix, dw.ContentReader().ContentFormat().HashFunc()(nil, data))
+	if err != nil {
+		return content.EmptyID, false
+	}
+
+	for {
+		released, claimed := m.claimState(contentID)
+		if claimed {
+			return contentID, false
+		}
+
+		if info, err := dw.ContentInfo(ctx, contentID); err == nil && !info.Deleted {
+			return contentID, false
+		}
+
+		if isNew, ok := m.tryClaim(dw, contentID, released); ok {
+			return contentID, isNew
+		}
+	}
+}
+
+// claimState returns the number of times claims were released and whether the content is claimed by any session.
+func (m *quotaManager) claimState(contentID content.ID) (released int64, claimed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, claimed = m.claimed[contentID]
+
+	return m.releasedClaims, claimed
+}
+
+// tryClaim claims the content for the session unless another session claimed it, returning false as the second
+// value when claims were released since claimState returned the provided count.
+func (m *quotaManager) tryClaim(dw repo.DirectRepositoryWriter, contentID content.ID, released int64) (isNew, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, claimed := m.claimed[contentID]; claimed {
+		return false, true
+	}
+
+	if m.releasedClaims != released {
+		return false, false
+	}
+
+	if m.claimed == nil {
+		m.claimed = map[content.ID]repo.DirectRepositoryWriter{}
+	}
+
+	m.claimed[contentID] = dw
+
+	return true, true
+}
+
+// releaseClaim releases the claim of a content which was not written.
+func (m *quotaManager) releaseClaim(contentID content.ID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.claimed, contentID)
+}
+
+// releaseClaims releases contents claimed by the session, after they were committed to the index
+// or abandoned when the session ended.
+func (m *quotaManager) releaseClaims(dw repo.DirectRepositoryWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.releasedClaims++
+
+	for contentID, w := range m.claimed {
+		if w == dw {
+			delete(m.claimed, contentID)
+		}
+	}
+}
+
+// trackContentUsage attributes packed bytes of the newly written content to the user,
+// sending notifications for soft limits that were exceeded.
+func (s *Server) trackContentUsage(ctx context.Context, dw repo.DirectRepositoryWriter, usernameAtHostname string, contentID content.ID) {
+	info, err := dw.ContentInfo(ctx, contentID)
+	if err != nil {
+		userLog(ctx).Errorf("unable to get info for content %v: %v", contentID, err)
+		return
+	}
+
+	for _, q := range s.quotas.addUsage(usernameAtHostname, int64(info.PackedLength)) {
+		userLog(ctx).Warnf("soft storage quota limit for %v exceeded by %v", q.Pattern, usernameAtHostname)
+
+		now := clock.Now()
+
+		s.sendNotification(ctx, dw, "generic-error",
+			notifydata.NewErrorInfo("Storage Quota", fmt.Sprintf("Storage quota for %v", q.Pattern), now, now,
+				errors.Errorf("usage by %v exceeded the soft limit of %v (hard limit: %v)",
+					usernameAtHostname, units.BytesString(q.SoftLimitBytes), formatHardLimit(q))),
+			notification.SeverityWarning,
+		)
+	}
+}
+
+func formatHardLimit(q *user.Quota) string {
+	if q.HardLimitBytes <= 0 {
+		return "none"
+	}
+
+	return units.BytesString(q.HardLimitBytes)
+}
@@ -0,0 +1,154 @@
+package server_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/internal/user"
+	"github.com/kopia/kopia/notification/notifyprofile"
+	"github.com/kopia/kopia/notification/sender"
+	"github.com/kopia/kopia/notification/sender/webhook"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestServerQuotas(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	var numNotifications atomic.Int32
+
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		numNotifications.Add(1)
+	}))
+	defer webhookServer.Close()
+
+	require.NoError(t, notifyprofile.SaveProfile(ctx, env.RepositoryWriter, notifyprofile.Config{
+		ProfileName: "quota-profile",
+		MethodConfig: sender.MethodConfig{
+			Type: "webhook",
+			Config: &webhook.Options{
+				Endpoint: webhookServer.URL,
+				Method:   "POST",
+			},
+		},
+	}))
+
+	// the first upload crosses both limits, further new uploads are rejected.
+	require.NoError(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{
+		Pattern:        "*@" + servertesting.TestHostname,
+		SoftLimitBytes: 1,
+		HardLimitBytes: 1,
+	}))
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	srvInfo := servertesting.StartServer(t, env, true)
+
+	rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, srvInfo, repo.ClientOptions{
+		Username: servertesting.TestUsername,
+		Hostname: servertesting.TestHostname,
+	}, content.CachingOptions{
+		CacheDirectory: testutil.TempDirectory(t),
+	}, servertesting.TestPassword, &repo.Options{})
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	writeObject := func(data string) error {
+		return repo.WriteSession(ctx, rep, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+			ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+			defer ow.Close()
+
+			if _, err := ow.Write([]byte(data)); err != nil {
+				return err
+			}
+
+			_, err := ow.Result()
+
+			return err
+		})
+	}
+
+	require.NoError(t, writeObject("first object"))
+	require.Equal(t, int32(1), numNotifications.Load())
+
+	require.ErrorContains(t, writeObject("second object"), "storage quota exceeded")
+
+	// deduplicated contents don't count towards the quota.
+	require.NoError(t, writeObject("first object"))
+
+	// no more notifications after the soft limit was exceeded.
+	require.Equal(t, int32(1), numNotifications.Load())
+
+	usage, err := user.ListUsage(ctx, env.MustOpenAnother(t))
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	require.Equal(t, servertesting.TestUsername+"@"+servertesting.TestHostname, usage[0].Username)
+	require.Equal(t, int64(1), usage[0].ContentCount)
+	require.Positive(t, usage[0].PackedBytes)
+}
+
+func TestServerQuotaConcurrentSessions(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	require.NoError(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{
+		Pattern:        "*@" + servertesting.TestHostname,
+		HardLimitBytes: 1 << 30,
+	}))
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	srvInfo := servertesting.StartServer(t, env, true)
+
+	rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, srvInfo, repo.ClientOptions{
+		Username: servertesting.TestUsername,
+		Hostname: servertesting.TestHostname,
+	}, content.CachingOptions{
+		CacheDirectory: testutil.TempDirectory(t),
+	}, servertesting.TestPassword, &repo.Options{})
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	// both sessions write the same content before either of them flushes.
+	var writers []repo.RepositoryWriter
+
+	for range 2 {
+		_, w, err := rep.NewWriter(ctx, repo.WriteSessionOptions{})
+		require.NoError(t, err)
+
+		defer w.Close(ctx)
+
+		ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+
+		_, err = ow.Write([]byte("same object"))
+		require.NoError(t, err)
+
+		_, err = ow.Result()
+		require.NoError(t, err)
+		require.NoError(t, ow.Close())
+
+		writers = append(writers, w)
+	}
+
+	for _, w := range writers {
+		require.NoError(t, w.Flush(ctx))
+	}
+
+	usage, err := user.ListUsage(ctx, env.MustOpenAnother(t))
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	require.Equal(t, int64(1), usage[0].ContentCount)
+}
+
+func TestServerQuotaManifestsDenied(t *testing.T) {
+	verifyServerInternalManifestDenied(t, user.QuotaManifestType)
+	verifyServerInternalManifestDenied(t, user.UsageManifestType)
+}
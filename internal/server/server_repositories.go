@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/serverapi"
+)
+
+const (
+	// kopiaRepositoryCookie holds the name of the repository selected in the UI.
+	kopiaRepositoryCookie = "Kopia-Repository"
+
+	// grpcRepositoryMetadataKey is the gRPC metadata key with the name of the repository of the session.
+	grpcRepositoryMetadataKey = "kopia-repository"
+)
+
+var validRepositoryName = regexp.MustCompile(`^[a-z0-9][a-z0-9\-_.]*$`)
+
+type namedRepository struct {
+	srv     *Server
+	handler http.Handler
+}
+
+// repositoryRegistry keeps track of repositories hosted by a single server process.
+// The default repository is served by the server that owns the registry, named repositories
+// are served by separate Server instances, each with its own users, ACLs and source managers.
+type repositoryRegistry struct {
+	defaultServer *Server
+
+	mu sync.RWMutex
+	// +checklocks:mu
+	named map[string]*namedRepository
+}
+
+func newRepositoryRegistry(defaultServer *Server) *repositoryRegistry {
+	return &repositoryRegistry{
+		defaultServer: defaultServer,
+		named:         map[string]*namedRepository{},
+	}
+}
+
+func (r *repositoryRegistry) get(name string) *namedRepository {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.named[name]
+}
+
+// servers returns all servers keyed by repository name, the default server has an empty name.
+func (r *repositoryRegistry) servers() map[string]*Server {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := map[string]*Server{"": r.defaultServer}
+
+	for name, nr := range r.named {
+		result[name] = nr.srv
+	}
+
+	return result
+}
+
+// AddNamedRepository registers a server hosting another repository under the provided name.
+// Requests are routed to the handler of the named server by RepositoryRouterHandler() and gRPC
+// sessions by Session(). Must be called before the server starts handling requests.
+func (s *Server) AddNamedRepository(name string, other *Server, handler http.Handler) error {
+	if !validRepositoryName.MatchString(name) {
+		return errors.Errorf("invalid repository name %q, must consist of lowercase letters, digits, '-', '_' and '.'", name)
+	}
+
+	if other == s || other.repos.defaultServer != other {
+		return errors.Errorf("server for repository %q is already in use", name)
+	}
+
+	s.repos.mu.Lock()
+	defer s.repos.mu.Unlock()
+
+	if s.repos.named[name] != nil {
+		return errors.Errorf("repository %q already exists", name)
+	}
+
+	s.repos.named[name] = &namedRepository{other, handler}
+
+	other.repos = s.repos
+	other.repositoryName = name
+
+	return nil
+}
+
+// RepositoryRouterHandler returns a handler which routes requests for named repositories to their handlers
+// and all other requests to the provided handler of the default repository.
+//
+// The repository is selected by the X-Kopia-Repository header, which fails the request if the repository is not found,
+// or by the cookie set when selecting the repository in the UI.
+func (s *Server) RepositoryRouterHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.Header.Get(apiclient.RepositoryHeader); name != "" {
+			nr := s.repos.get(name)
+			if nr == nil {
+				http.Error(w, "Repository not found.\n", http.StatusNotFound)
+				return
+			}
+
+			nr.handler.ServeHTTP(w, r)
+
+			return
+		}
+
+		if c, err := r.Cookie(kopiaRepositoryCookie); err == nil {
+			if nr := s.repos.get(c.Value); nr != nil {
+				nr.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// sessionServer returns the server hosting the repository requested by the gRPC session.
+func (s *Server) sessionServer(ctx context.Context) (*Server, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	names := md.Get(grpcRepositoryMetadataKey)
+	if len(names) == 0 || names[0] == "" {
+		return s, nil
+	}
+
+	nr := s.repos.get(names[0])
+	if nr == nil {
+		return nil, status.Errorf(codes.NotFound, "repository %q not found", names[0])
+	}
+
+	return nr.srv, nil
+}
+
+func (s *Server) getRepositoryRegistry() *repositoryRegistry {
+	return s.repos
+}
+
+func (s *Server) getRepositoryName() string {
+	return s.repositoryName
+}
+
+func handleRepositoriesList(_ context.Context, rc requestContext) (any, *apiError) {
+	resp := &serverapi.RepositoriesResponse{
+		Repositories: []serverapi.RepositoryInfo{},
+	}
+
+	current := rc.srv.getRepositoryName()
+
+	for name, srv := range rc.srv.getRepositoryRegistry().servers() {
+		ri := serverapi.RepositoryInfo{
+			Name:    name,
+			Current: name == current,
+		}
+
+		if rep := srv.currentRepository(); rep != nil {
+			ri.Connected = true
+			ri.Description = rep.ClientOptions().Description
+		}
+
+		resp.Repositories = append(resp.Repositories, ri)
+	}
+
+	sort.Slice(resp.Repositories, func(i, j int) bool {
+		return resp.Repositories[i].Name < resp.Repositories[j].Name
+	})
+
+	return resp, nil
+}
+
+func handleRepositorySelect(_ context.Context, rc requestContext) (any, *apiError) {
+	var req serverapi.SelectRepositoryRequest
+
+	if err := json.Unmarshal(rc.body, &req); err != nil {
+		return nil, unableToDecodeRequest(err)
+	}
+
+	if req.Name == "" {
+		http.SetCookie(rc.w, &http.Cookie{
+			Name:   kopiaRepositoryCookie,
+			Path:   "/",
+			MaxAge: -1,
+		})
+
+		return &serverapi.Empty{}, nil
+	}
+
+	if rc.srv.getRepositoryRegistry().get(req.Name) == nil {
+		return nil, notFoundError("repository not found")
+	}
+
+	http.SetCookie(rc.w, &http.Cookie{
+		Name:     kopiaRepositoryCookie,
+		Value:    req.Name,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return &serverapi.Empty{}, nil
+}
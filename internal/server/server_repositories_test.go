@@ -0,0 +1,362 @@
+package server_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/auth"
+	"github.com/kopia/kopia/internal/oidctesting"
+	"github.com/kopia/kopia/internal/passwordpersist"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/server"
+	"github.com/kopia/kopia/internal/serverapi"
+	"github.com/kopia/kopia/internal/servertesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/snapshot"
+)
+
+const (
+	namedRepoUsername = "baz"
+	namedRepoPassword = "456"
+)
+
+// startServerWithNamedRepository starts a TLS server hosting the repository of env as the default
+// repository and the repository of env2 as the named repository 'second', which has different users.
+func startServerWithNamedRepository(t *testing.T, env, env2 *repotesting.Environment) *repo.APIServerInfo {
+	t.Helper()
+
+	return startServerWithNamedRepositoryAndOIDC(t, env, env2, nil)
+}
+
+// startServerWithNamedRepositoryAndOIDC is like startServerWithNamedRepository, but both repositories
+// also authenticate users with the provided OpenID Connect authenticator.
+func startServerWithNamedRepositoryAndOIDC(t *testing.T, env, env2 *repotesting.Environment, oidc *auth.OIDCAuthenticator) *repo.APIServerInfo {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+
+	opts := &server.Options{
+		ConfigFile:      env.ConfigFile(),
+		PasswordPersist: passwordpersist.File(),
+		Authorizer:      auth.LegacyAuthorizer(),
+		Authenticator: auth.CombineAuthenticators(
+			auth.AuthenticateSingleUser(servertesting.TestUsername+"@"+servertesting.TestHostname, servertesting.TestPassword),
+			auth.AuthenticateSingleUser(servertesting.TestUIUsername, servertesting.TestUIPassword),
+		),
+		RefreshInterval:   1 * time.Minute,
+		UIUser:            servertesting.TestUIUsername,
+		UIPreferencesFile: filepath.Join(testutil.TempDirectory(t), "ui-pref.json"),
+		OIDC:              oidc,
+		OIDCUIGroup:       servertesting.TestOIDCUIGroup,
+	}
+
+	s, err := server.New(ctx, opts)
+	require.NoError(t, err)
+
+	opts2 := *opts
+	opts2.ConfigFile = env2.ConfigFile()
+	opts2.Authorizer = auth.LegacyAuthorizer()
+	opts2.Authenticator = auth.CombineAuthenticators(
+		auth.AuthenticateSingleUser(namedRepoUsername+"@"+servertesting.TestHostname, namedRepoPassword),
+		auth.AuthenticateSingleUser(servertesting.TestUIUsername, servertesting.TestUIPassword),
+	)
+
+	s2, err := server.New(ctx, &opts2)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetRepository(ctx, env.Repository))
+	require.NoError(t, s2.SetRepository(ctx, env2.Repository))
+
+	t.Cleanup(func() {
+		s.SetRepository(ctx, nil)
+		s2.SetRepository(ctx, nil)
+	})
+
+	m2 := mux.NewRouter()
+	s2.SetupHTMLUIAPIHandlers(m2)
+	s2.SetupControlAPIHandlers(m2)
+	s2.ServeStaticFiles(m2, server.AssetFile())
+
+	require.NoError(t, s.AddNamedRepository("second", s2, m2))
+	require.Error(t, s.AddNamedRepository("second", s2, m2))
+	require.Error(t, s.AddNamedRepository("Invalid Name", s2, m2))
+
+	m := mux.NewRouter()
+	s.SetupHTMLUIAPIHandlers(m)
+	s.SetupControlAPIHandlers(m)
+	s.ServeStaticFiles(m, server.AssetFile())
+
+	hs := httptest.NewUnstartedServer(s.GRPCRouterHandler(s.RepositoryRouterHandler(m)))
+	hs.EnableHTTP2 = true
+	hs.StartTLS()
+	t.Cleanup(hs.Close)
+
+	serverHash := sha256.Sum256(hs.Certificate().Raw)
+
+	return &repo.APIServerInfo{
+		BaseURL:                             hs.URL,
+		TrustedServerCertificateFingerprint: hex.EncodeToString(serverHash[:]),
+	}
+}
+
+func TestNamedRepositories_HTTP(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	_, env2 := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	si := startServerWithNamedRepository(t, env, env2)
+
+	newClient := func(repository string) *apiclient.KopiaAPIClient {
+		cli, err := apiclient.NewKopiaAPIClient(apiclient.Options{
+			BaseURL:                             si.BaseURL,
+			TrustedServerCertificateFingerprint: si.TrustedServerCertificateFingerprint,
+			Username:                            servertesting.TestUIUsername,
+			Password:                            servertesting.TestUIPassword,
+			Repository:                          repository,
+		})
+		require.NoError(t, err)
+
+		return cli
+	}
+
+	cli := newClient("")
+	require.NoError(t, cli.FetchCSRFTokenForTesting(ctx))
+
+	repos, err := serverapi.ListRepositories(ctx, cli)
+	require.NoError(t, err)
+	require.Equal(t, []serverapi.RepositoryInfo{
+		{Name: "", Description: "Repository in Map", Connected: true, Current: true},
+		{Name: "second", Description: "Repository in Map", Connected: true},
+	}, repos.Repositories)
+
+	st, err := serverapi.RepoStatus(ctx, cli)
+	require.NoError(t, err)
+	require.Equal(t, env.ConfigFile(), st.ConfigFile)
+
+	// requests with the header are handled by the named repository.
+	cli2 := newClient("second")
+	require.NoError(t, cli2.FetchCSRFTokenForTesting(ctx))
+
+	st, err = serverapi.RepoStatus(ctx, cli2)
+	require.NoError(t, err)
+	require.Equal(t, env2.ConfigFile(), st.ConfigFile)
+
+	repos, err = serverapi.ListRepositories(ctx, cli2)
+	require.NoError(t, err)
+	require.True(t, repos.Repositories[1].Current)
+
+	// unknown repositories are not found.
+	var hse apiclient.HTTPStatusError
+
+	require.ErrorAs(t, newClient("no-such-repo").FetchCSRFTokenForTesting(ctx), &hse)
+	require.Equal(t, http.StatusNotFound, hse.HTTPStatusCode)
+
+	// the UI selects the repository with a cookie.
+	require.NoError(t, serverapi.SelectRepository(ctx, cli, "second"))
+
+	st, err = serverapi.RepoStatus(ctx, cli)
+	require.NoError(t, err)
+	require.Equal(t, env2.ConfigFile(), st.ConfigFile)
+
+	require.Error(t, serverapi.SelectRepository(ctx, cli, "no-such-repo"))
+	require.NoError(t, serverapi.SelectRepository(ctx, cli, ""))
+
+	st, err = serverapi.RepoStatus(ctx, cli)
+	require.NoError(t, err)
+	require.Equal(t, env.ConfigFile(), st.ConfigFile)
+}
+
+func TestNamedRepositories_GRPC(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	_, env2 := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{UserName: namedRepoUsername, Host: servertesting.TestHostname, Path: "/data"}
+
+	_, err := snapshot.SaveSnapshot(ctx, env2.RepositoryWriter, &snapshot.Manifest{Source: src})
+	require.NoError(t, err)
+	require.NoError(t, env2.RepositoryWriter.Flush(ctx))
+
+	si := startServerWithNamedRepository(t, env, env2)
+
+	open := func(repository, username, password string) (repo.Repository, error) {
+		asi := *si
+		asi.Repository = repository
+
+		return servertesting.ConnectAndOpenAPIServer(t, ctx, &asi, repo.ClientOptions{
+			Username: username,
+			Hostname: servertesting.TestHostname,
+		}, content.CachingOptions{}, password, &repo.Options{})
+	}
+
+	// users are defined per repository.
+	_, err = open("second", servertesting.TestUsername, servertesting.TestPassword)
+	require.Error(t, err)
+
+	_, err = open("", namedRepoUsername, namedRepoPassword)
+	require.Error(t, err)
+
+	_, err = open("no-such-repo", namedRepoUsername, namedRepoPassword)
+	require.Error(t, err)
+
+	rep, err := open("second", namedRepoUsername, namedRepoPassword)
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	mans, err := snapshot.ListSnapshotManifests(ctx, rep, &src, nil)
+	require.NoError(t, err)
+	require.Len(t, mans, 1)
+
+	rep1, err := open("", servertesting.TestUsername, servertesting.TestPassword)
+	require.NoError(t, err)
+
+	defer rep1.Close(ctx)
+
+	mans, err = snapshot.ListSnapshotManifests(ctx, rep1, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, mans)
+}
+
+func TestNamedRepositories_AuthCookieNotSharedBetweenRepositories(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	_, env2 := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	si := startServerWithNamedRepository(t, env, env2)
+
+	cli := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			},
+		},
+	}
+
+	get := func(repository, username, password string, cookies []*http.Cookie) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, si.BaseURL+"/browse/?format=json", http.NoBody)
+		require.NoError(t, err)
+
+		req.SetBasicAuth(username, password)
+
+		if repository != "" {
+			req.Header.Set(apiclient.RepositoryHeader, repository)
+		}
+
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	namedUser := namedRepoUsername + "@" + servertesting.TestHostname
+
+	resp := get("second", namedUser, namedRepoPassword, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, resp.Cookies(), 1)
+
+	// cookies of named repositories have their own names, so that browsers keep them separately.
+	require.Equal(t, "Kopia-Auth-second", resp.Cookies()[0].Name)
+
+	// the cookie is accepted by the repository which issued it.
+	require.Equal(t, http.StatusOK, get("second", namedUser, "wrong-password", resp.Cookies()).StatusCode)
+
+	// the user does not exist in the default repository, which must not accept the cookie.
+	require.Equal(t, http.StatusUnauthorized, get("", namedUser, "wrong-password", resp.Cookies()).StatusCode)
+}
+
+func TestNamedRepositories_OIDCSessionsOfEachRepository(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+	_, env2 := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	iss := oidctesting.NewIssuer(t)
+
+	// the provider redirects to this URL, which the test rewrites to point at the test server.
+	const redirectURL = "https://kopia.invalid/oidc/callback"
+
+	oidc, err := auth.NewOIDCAuthenticator(ctx, auth.OIDCOptions{
+		IssuerURL:    iss.URL,
+		ClientID:     oidctesting.TestClientID,
+		ClientSecret: oidctesting.TestClientSecret,
+		RedirectURL:  redirectURL,
+	})
+	require.NoError(t, err)
+
+	iss.SetLoginClaims(jwt.MapClaims{"email": "alice@example.com", "email_verified": true, "groups": []string{servertesting.TestOIDCUIGroup}})
+
+	si := startServerWithNamedRepositoryAndOIDC(t, env, env2, oidc)
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	cli := &http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec
+			},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	get := func(repository, u string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+		require.NoError(t, err)
+
+		if repository != "" && strings.HasPrefix(u, si.BaseURL) {
+			req.Header.Set(apiclient.RepositoryHeader, repository)
+		}
+
+		resp, err := cli.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		return resp
+	}
+
+	// follows redirects of the login flow, sending the provider's redirect to the test server.
+	login := func(repository string) {
+		resp := get(repository, si.BaseURL+"/oidc/login?redirect=%2F")
+
+		for resp.StatusCode == http.StatusFound {
+			loc, err := resp.Location()
+			require.NoError(t, err)
+
+			u := loc.String()
+			if after, ok := strings.CutPrefix(u, redirectURL); ok {
+				u = si.BaseURL + "/oidc/callback" + after
+			}
+
+			resp = get(repository, u)
+		}
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	login("")
+	login("second")
+
+	// logging in to the named repository keeps the session of the default repository.
+	require.Equal(t, http.StatusOK, get("", si.BaseURL+"/").StatusCode)
+	require.Equal(t, http.StatusOK, get("second", si.BaseURL+"/").StatusCode)
+}
@@ -14,10 +14,12 @@
 	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/apiclient"
+	"github.com/kopia/kopia/internal/apitoken"
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/repotesting"
 	"github.com/kopia/kopia/internal/servertesting"
 	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/internal/user"
 	"github.com/kopia/kopia/notification"
 	"github.com/kopia/kopia/notification/notifydata"
 	"github.com/kopia/kopia/notification/notifyprofile"
@@ -76,6 +78,10 @@ func TestGRPCServer_AuthenticationError(t *testing.T) {
 	}
 }
 
+func TestGRPCServer_APITokenManifestsDenied(t *testing.T) {
+	verifyServerInternalManifestDenied(t, apitoken.ManifestType)
+}
+
 //nolint:gocyclo
 func TestServerUIAccessDeniedToRemoteUser(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
@@ -472,3 +478,50 @@ func mustGetCapacityNotAVolume(ctx context.Context, t *testing.T, rep repo.Repos
 	_, err := rep.GetCapacity(ctx)
 	require.ErrorIs(t, err, blob.ErrNotAVolume, "expected 'not a volume' error")
 }
+
+// verifyServerInternalManifestDenied verifies that a repository client can't write or delete manifests
+// of the provided type, even when they carry the client's username and hostname.
+func verifyServerInternalManifestDenied(t *testing.T, manifestType string) {
+	t.Helper()
+
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	labels := map[string]string{
+		manifest.TypeLabelKey:  manifestType,
+		snapshot.UsernameLabel: servertesting.TestUsername,
+		snapshot.HostnameLabel: servertesting.TestHostname,
+	}
+
+	serverManifestID, err := env.RepositoryWriter.PutManifest(ctx, labels, map[string]string{})
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	apiServerInfo := servertesting.StartServer(t, env, true)
+
+	rep, err := servertesting.ConnectAndOpenAPIServer(t, ctx, apiServerInfo, repo.ClientOptions{
+		Username: servertesting.TestUsername,
+		Hostname: servertesting.TestHostname,
+	}, content.CachingOptions{}, servertesting.TestPassword, &repo.Options{})
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	_, w, err := rep.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	defer w.Close(ctx)
+
+	_, err = w.PutManifest(ctx, labels, map[string]string{})
+	require.Error(t, err)
+	require.Error(t, w.DeleteManifest(ctx, serverManifestID))
+	require.NoError(t, w.Flush(ctx))
+
+	var v map[string]string
+
+	_, err = env.RepositoryWriter.GetManifest(ctx, serverManifestID, &v)
+	require.NoError(t, err)
+}
+
+func TestGRPCServer_UserGroupManifestsDenied(t *testing.T) {
+	verifyServerInternalManifestDenied(t, user.GroupManifestType)
+}
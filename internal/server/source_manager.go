@@ -11,6 +11,8 @@
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/localfs"
 	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/metrics"
+	"github.com/kopia/kopia/internal/pullsource"
 	"github.com/kopia/kopia/internal/serverapi"
 	"github.com/kopia/kopia/internal/uitask"
 	"github.com/kopia/kopia/notification/notifydata"
@@ -28,6 +30,8 @@
 type sourceManagerServerInterface interface {
 	runSnapshotTask(ctx context.Context, src snapshot.SourceInfo, inner func(ctx context.Context, ctrl uitask.Controller, result *notifydata.ManifestWithError) error) error
 	refreshScheduler(reason string)
+	publishUploadEvent(src snapshot.SourceInfo, taskID string, counters upload.Counters, final bool)
+	getRepositoryName() string
 }
 
 // sourceManager manages the state machine of each source
@@ -72,8 +76,13 @@ type sourceManager struct {
 	lastAttemptedSnapshotTime fs.UTCTimestamp
 	// +checklocks:sourceMutex
 	isReadOnly bool
+	// +checklocks:sourceMutex
+	pullSource *pullsource.Source
 
 	progress *upload.CountingUploadProgress
+
+	enableChangeJournal bool
+	changeJournal       sourceChangeJournal
 }
 
 func (s *sourceManager) Status() *serverapi.SourceStatus {
@@ -153,6 +162,10 @@ func (s *sourceManager) setUploader(u *upload.Uploader) {
 }
 
 func (s *sourceManager) start(ctx context.Context, isLocal bool) {
+	s.sourceMutex.Lock()
+	s.isReadOnly = !isLocal
+	s.sourceMutex.Unlock()
+
 	s.refreshStatus(ctx)
 
 	go s.run(ctx, isLocal)
@@ -182,6 +195,8 @@ func (s *sourceManager) runLocal(ctx context.Context) {
 		s.setStatus("IDLE")
 	}
 
+	defer s.closeChangeJournal(ctx)
+
 	for {
 		select {
 		case <-s.closed:
@@ -229,15 +244,51 @@ func (s *sourceManager) isRunningReadOnly() bool {
 }
 
 func (s *sourceManager) runReadOnly() {
-	s.sourceMutex.Lock()
-	s.isReadOnly = true
-	s.sourceMutex.Unlock()
 	s.setStatus("REMOTE")
 
 	// wait until closed
 	<-s.closed
 }
 
+func (s *sourceManager) getPullSource() *pullsource.Source {
+	s.sourceMutex.RLock()
+	defer s.sourceMutex.RUnlock()
+
+	return s.pullSource
+}
+
+// setPullSource sets the configuration used to read files of sources snapshotted from remote hosts.
+func (s *sourceManager) setPullSource(ps *pullsource.Source) {
+	s.sourceMutex.Lock()
+	defer s.sourceMutex.Unlock()
+
+	s.pullSource = ps
+}
+
+// openRoot returns the root entry of the source, which is read from a remote host for pull sources,
+// and a function that must be called after the snapshot completes.
+func (s *sourceManager) openRoot(ctx context.Context, ps *pullsource.Source) (fs.Entry, func(), error) {
+	if ps != nil {
+		dir, closer, err := ps.Open(ctx)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to open pull source")
+		}
+
+		return dir, func() {
+			if err := closer.Close(); err != nil {
+				userLog(ctx).Errorf("error closing pull source %v: %v", s.src, err)
+			}
+		}, nil
+	}
+
+	localEntry, err := localfs.NewEntry(s.src.Path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to create local filesystem")
+	}
+
+	return localEntry, func() {}, nil
+}
+
 func (s *sourceManager) scheduleSnapshotNow() {
 	s.sourceMutex.Lock()
 	defer s.sourceMutex.Unlock()
@@ -311,7 +362,7 @@ func (s *sourceManager) waitUntilStopped() {
 	s.wg.Wait()
 }
 
-func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Controller, result *notifydata.ManifestWithError) error {
+func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Controller, result *notifydata.ManifestWithError) (err error) {
 	s.setStatus("UPLOADING")
 
 	s.setCurrentTaskID(ctrl.CurrentTaskID())
@@ -326,11 +377,23 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 	default:
 	}
 
-	localEntry, err := localfs.NewEntry(s.src.Path)
+	startTime := clock.Now()
+
+	var uploadedBytes int64
+
+	defer func() {
+		s.recordSnapshotOutcome(startTime, &result.Manifest, uploadedBytes, err)
+	}()
+
+	pullSource := s.getPullSource()
+
+	rootEntry, closeRoot, err := s.openRoot(ctx, pullSource)
 	if err != nil {
-		return errors.Wrap(err, "unable to create local filesystem")
+		return err
 	}
 
+	defer closeRoot()
+
 	onUpload := func(int64) {}
 
 	s.sourceMutex.Lock()
@@ -366,8 +429,22 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 		prog := &uitaskProgress{
 			p:    s.progress,
 			ctrl: ctrl,
+			onReport: func(counters upload.Counters, final bool) {
+				s.server.publishUploadEvent(s.src, ctrl.CurrentTaskID(), counters, final)
+			},
 		}
 		u.Progress = prog
+
+		var (
+			journalGen        uint64
+			policyFingerprint string
+		)
+
+		// change journal only observes local filesystem.
+		if s.enableChangeJournal && pullSource == nil {
+			journalGen, policyFingerprint = s.prepareChangeJournal(ctx, w, u, policyTree, manifestsSinceLastCompleteSnapshot)
+		}
+
 		onUpload = func(numBytes int64) {
 			u.Progress.UploadedBytes(numBytes)
 		}
@@ -375,11 +452,13 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 		userLog(ctx).Debugf("starting upload of %v", s.src)
 		s.setUploader(u)
 
-		manifest, err := u.Upload(ctx, localEntry, policyTree, s.src, manifestsSinceLastCompleteSnapshot...)
+		manifest, err := u.Upload(ctx, rootEntry, policyTree, s.src, manifestsSinceLastCompleteSnapshot...)
 
 		prog.report(true)
 		s.setUploader(nil)
 
+		uploadedBytes = s.progress.Snapshot().TotalUploadedBytes
+
 		if err != nil {
 			return errors.Wrap(err, "upload error")
 		}
@@ -390,6 +469,8 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 		if ignoreIdenticalSnapshot && len(manifestsSinceLastCompleteSnapshot) > 0 {
 			if manifestsSinceLastCompleteSnapshot[0].RootObjectID() == manifest.RootObjectID() {
 				userLog(ctx).Debug("Not saving snapshot because no files have been changed since previous snapshot")
+				s.commitChangeJournal(journalGen, manifest, policyFingerprint)
+
 				return nil
 			}
 		}
@@ -399,6 +480,8 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 			return errors.Wrap(err, "unable to save snapshot")
 		}
 
+		s.commitChangeJournal(journalGen, manifest, policyFingerprint)
+
 		if _, err := policy.ApplyRetentionPolicy(ctx, w, s.src, true); err != nil {
 			return errors.Wrap(err, "unable to apply retention policy")
 		}
@@ -409,6 +492,22 @@ func (s *sourceManager) snapshotInternal(ctx context.Context, ctrl uitask.Contro
 	})
 }
 
+// recordSnapshotOutcome updates Prometheus gauges of the source after a snapshot attempt.
+func (s *sourceManager) recordSnapshotOutcome(startTime time.Time, man *snapshot.Manifest, uploadedBytes int64, err error) {
+	metrics.RecordSnapshotOutcome(&metrics.SnapshotOutcome{
+		Repository:    s.server.getRepositoryName(),
+		UserName:      s.src.UserName,
+		Host:          s.src.Host,
+		Path:          s.src.Path,
+		StartTime:     startTime,
+		EndTime:       clock.Now(),
+		Success:       err == nil && man.IncompleteReason == "",
+		UploadedBytes: uploadedBytes,
+		Files:         int64(man.Stats.TotalFileCount),
+		Errors:        int64(man.Stats.ErrorCount) + int64(man.Stats.IgnoredErrorCount),
+	})
+}
+
 // +checklocksread:s.sourceMutex
 func (s *sourceManager) findClosestNextSnapshotTimeReadLocked() *time.Time {
 	var previousSnapshotTime fs.UTCTimestamp
@@ -479,11 +578,18 @@ type uitaskProgress struct {
 	nextReportTimeNanos atomic.Int64
 	p                   *upload.CountingUploadProgress
 	ctrl                uitask.Controller
+
+	// if set, also reports the current counters to the event stream.
+	onReport func(counters upload.Counters, final bool)
 }
 
 // report reports the current progress to UITask.
 func (t *uitaskProgress) report(final bool) {
 	t.ctrl.ReportCounters(t.p.UITaskCounters(final))
+
+	if t.onReport != nil {
+		t.onReport(t.p.Snapshot(), final)
+	}
 }
 
 // maybeReport occasionally reports current progress to UI task.
@@ -601,6 +707,8 @@ func newSourceManager(src snapshot.SourceInfo, server *Server, rep repo.Reposito
 		closed:           make(chan struct{}),
 		snapshotRequests: make(chan struct{}, 1),
 		progress:         &upload.CountingUploadProgress{},
+
+		enableChangeJournal: server.options.EnableChangeJournal,
 	}
 
 	return m
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/changejournal"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+// sourceChangeJournal keeps the change journal of a local source together with the information about
+// the most recent complete snapshot, whose contents reflect the state of the source at a particular
+// journal generation. It is only accessed by the goroutine running snapshots of the source.
+type sourceChangeJournal struct {
+	journal      *changejournal.Journal
+	subtreeFiles []string
+	failed       bool
+
+	baseGen    uint64
+	baseRoot   object.ID
+	basePolicy string
+}
+
+// prepareChangeJournal starts the change journal if needed, marks the beginning of a snapshot and configures
+// the uploader to reuse directories that have not changed since the previous complete snapshot.
+// Returns the journal generation and policy fingerprint to be passed to commitChangeJournal().
+func (s *sourceManager) prepareChangeJournal(ctx context.Context, rep repo.Repository, u *upload.Uploader, policyTree *policy.Tree, previous []*snapshot.Manifest) (gen uint64, fingerprint string) {
+	cj := &s.changeJournal
+
+	fingerprint, err := policyFingerprint(ctx, rep)
+	if err != nil {
+		userLog(ctx).Errorf("unable to compute policy fingerprint: %v", err)
+		return 0, ""
+	}
+
+	subtreeFiles := policyTree.EffectivePolicy().FilesPolicy.DotIgnoreFiles
+
+	// the journal must be restarted when the names of ignore files change.
+	if !slices.Equal(cj.subtreeFiles, subtreeFiles) {
+		s.closeChangeJournal(ctx)
+
+		cj.failed = false
+		cj.subtreeFiles = slices.Clone(subtreeFiles)
+	}
+
+	if cj.failed {
+		return 0, ""
+	}
+
+	if cj.journal == nil {
+		j, err := changejournal.Start(ctx, s.src.Path, changejournal.Options{SubtreeFileNames: subtreeFiles})
+		if err != nil {
+			userLog(ctx).Errorf("unable to start change journal for %v, all files will be scanned: %v", s.src, err)
+
+			cj.failed = true
+
+			return 0, ""
+		}
+
+		cj.journal = j
+	}
+
+	gen = cj.journal.Mark()
+
+	if n := len(previous); n > 0 && cj.baseGen != 0 {
+		base := previous[n-1]
+
+		if base.IncompleteReason == "" && base.RootObjectID() == cj.baseRoot && cj.basePolicy == fingerprint {
+			if v := cj.journal.Since(cj.baseGen); v.IsValid() {
+				userLog(ctx).Debugf("using change journal for %v", s.src)
+
+				u.ChangeJournal = v
+			} else {
+				userLog(ctx).Infof("change journal for %v has lost track of changes, all files will be scanned", s.src)
+			}
+		}
+	}
+
+	return gen, fingerprint
+}
+
+// commitChangeJournal records that the snapshot, which started at the provided journal generation, has been saved.
+// Only complete snapshots can be used as a base for subsequent snapshots.
+func (s *sourceManager) commitChangeJournal(gen uint64, man *snapshot.Manifest, fingerprint string) {
+	cj := &s.changeJournal
+
+	if cj.journal == nil || gen == 0 || man.IncompleteReason != "" {
+		return
+	}
+
+	cj.baseGen = gen
+	cj.baseRoot = man.RootObjectID()
+	cj.basePolicy = fingerprint
+}
+
+func (s *sourceManager) closeChangeJournal(ctx context.Context) {
+	cj := &s.changeJournal
+
+	if cj.journal == nil {
+		return
+	}
+
+	if err := cj.journal.Close(); err != nil {
+		userLog(ctx).Errorf("error closing change journal for %v: %v", s.src, err)
+	}
+
+	cj.journal = nil
+	cj.baseGen = 0
+}
+
+// policyFingerprint returns a value that changes whenever any of the policies are modified.
+func policyFingerprint(ctx context.Context, rep repo.Repository) (string, error) {
+	pols, err := policy.ListPolicies(ctx, rep)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to list policies")
+	}
+
+	var serialized []string
+
+	for _, p := range pols {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to serialize policy")
+		}
+
+		serialized = append(serialized, p.Target().String()+":"+string(b))
+	}
+
+	slices.Sort(serialized)
+
+	h := sha256.New()
+
+	for _, s := range serialized {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -244,3 +244,19 @@ func matchSourceParameters(match *snapshot.SourceInfo) string {
 
 	return "?" + strings.Join(clauses, "&")
 }
+
+// ListRepositories lists the repositories hosted by the server.
+func ListRepositories(ctx context.Context, c *apiclient.KopiaAPIClient) (*RepositoriesResponse, error) {
+	resp := &RepositoriesResponse{}
+	if err := c.Get(ctx, "repos", nil, resp); err != nil {
+		return nil, errors.Wrap(err, "ListRepositories")
+	}
+
+	return resp, nil
+}
+
+// SelectRepository selects the repository used by subsequent UI requests made with the same cookies.
+func SelectRepository(ctx context.Context, c *apiclient.KopiaAPIClient, name string) error {
+	//nolint:wrapcheck
+	return c.Post(ctx, "repos/select", &SelectRepositoryRequest{Name: name}, &Empty{})
+}
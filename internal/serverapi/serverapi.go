@@ -227,6 +227,63 @@ type CurrentUserResponse struct {
 	Hostname string `json:"hostname"`
 }
 
+// RepositoryInfo describes one of the repositories hosted by the server.
+type RepositoryInfo struct {
+	Name        string `json:"name"` // empty for the default repository
+	Description string `json:"description,omitempty"`
+	Connected   bool   `json:"connected"`
+	Current     bool   `json:"current"` // the repository handling the request
+}
+
+// RepositoriesResponse is the response of 'repos' HTTP API command.
+type RepositoriesResponse struct {
+	Repositories []RepositoryInfo `json:"repositories"`
+}
+
+// SelectRepositoryRequest is the request of 'repos/select' HTTP API command.
+type SelectRepositoryRequest struct {
+	Name string `json:"name"` // empty to select the default repository
+}
+
+// Types of events streamed by the 'events' HTTP API command.
+const (
+	EventTypeTask         = "task"         // uitask.Info of a task that started, reported progress or finished
+	EventTypeUpload       = "upload"       // UploadEvent
+	EventTypeMaintenance  = "maintenance"  // MaintenanceEvent
+	EventTypeNotification = "notification" // NotificationEvent
+)
+
+// UploadEvent reports upload counters of a snapshot in progress.
+type UploadEvent struct {
+	Source   snapshot.SourceInfo `json:"source"`
+	TaskID   string              `json:"taskID,omitempty"`
+	Counters upload.Counters     `json:"counters"`
+	Final    bool                `json:"final"` // the snapshot has finished uploading
+}
+
+// Statuses of maintenance reported in MaintenanceEvent.
+const (
+	MaintenanceStarted  = "started"
+	MaintenanceFinished = "finished"
+)
+
+// MaintenanceEvent reports the start and finish of maintenance run by the server.
+type MaintenanceEvent struct {
+	TaskID    string     `json:"taskID,omitempty"`
+	Status    string     `json:"status"`
+	StartTime time.Time  `json:"startTime"`
+	EndTime   *time.Time `json:"endTime,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// NotificationEvent reports a notification sent by the server.
+type NotificationEvent struct {
+	TemplateName  string          `json:"template"`
+	Severity      string          `json:"severity"`
+	EventArgsType string          `json:"eventArgsType"`
+	EventArgs     json.RawMessage `json:"eventArgs"`
+}
+
 // TaskListResponse contains a list of tasks.
 type TaskListResponse struct {
 	Tasks []uitask.Info `json:"tasks"`
@@ -282,6 +339,25 @@ type ResolvePathResponse struct {
 	SourceInfo snapshot.SourceInfo `json:"source"`
 }
 
+// BrowseEntry describes a single entry of a directory listing returned by the '/browse' handler.
+type BrowseEntry struct {
+	Name  string    `json:"name"`
+	Type  string    `json:"type"` // "d" - directory, "f" - file, "s" - symbolic link
+	Mode  string    `json:"mode"`
+	Size  int64     `json:"size"`
+	MTime time.Time `json:"mtime"`
+	URL   string    `json:"url,omitempty"` // not set for symbolic links, which can't be opened
+
+	LinkTarget string `json:"linkTarget,omitempty"` // target of a symbolic link
+}
+
+// BrowseResponse contains a directory listing returned by the '/browse' handler.
+type BrowseResponse struct {
+	Path          string         `json:"path"`
+	ZipArchiveURL string         `json:"zipArchiveURL,omitempty"`
+	Entries       []*BrowseEntry `json:"entries"`
+}
+
 // CLIInfo contains CLI information.
 type CLIInfo struct {
 	Executable string `json:"executable"`
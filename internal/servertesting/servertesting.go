@@ -4,6 +4,8 @@
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"net/http/httptest"
 	"path/filepath"
@@ -30,6 +32,8 @@
 
 	TestUIUsername = "ui-user"
 	TestUIPassword = "123456"
+
+	TestOIDCUIGroup = "kopia-admins"
 )
 
 // StartServer starts a test server and returns APIServerInfo.
@@ -43,6 +47,29 @@ func StartServer(t *testing.T, env *repotesting.Environment, tls bool) *repo.API
 func StartServerContext(ctx context.Context, t *testing.T, env *repotesting.Environment, tls bool) *repo.APIServerInfo {
 	t.Helper()
 
+	return startServer(ctx, t, env, tls, nil, nil, false)
+}
+
+// StartServerWithClientCA starts a TLS test server which verifies client certificates issued by the provided CAs
+// and returns APIServerInfo.
+func StartServerWithClientCA(t *testing.T, env *repotesting.Environment, clientCAs *x509.CertPool) *repo.APIServerInfo {
+	t.Helper()
+
+	return startServer(testlogging.Context(t), t, env, true, clientCAs, nil, false)
+}
+
+// StartServerWithOIDC starts a test server which authenticates users with the provided OpenID Connect
+// authenticator in addition to passwords and returns APIServerInfo. When oidcOnly is set, UI users
+// without an OIDC session are redirected to the provider.
+func StartServerWithOIDC(t *testing.T, env *repotesting.Environment, oidc *auth.OIDCAuthenticator, oidcOnly bool) *repo.APIServerInfo {
+	t.Helper()
+
+	return startServer(testlogging.Context(t), t, env, false, nil, oidc, oidcOnly)
+}
+
+func startServer(ctx context.Context, t *testing.T, env *repotesting.Environment, useTLS bool, clientCAs *x509.CertPool, oidc *auth.OIDCAuthenticator, oidcOnly bool) *repo.APIServerInfo {
+	t.Helper()
+
 	s, err := server.New(ctx, &server.Options{
 		ConfigFile:      env.ConfigFile(),
 		PasswordPersist: passwordpersist.File(),
@@ -54,6 +81,9 @@ func StartServerContext(ctx context.Context, t *testing.T, env *repotesting.Envi
 		RefreshInterval:   1 * time.Minute,
 		UIUser:            TestUIUsername,
 		UIPreferencesFile: filepath.Join(testutil.TempDirectory(t), "ui-pref.json"),
+		OIDC:              oidc,
+		OIDCOnly:          oidcOnly,
+		OIDCUIGroup:       TestOIDCUIGroup,
 	})
 
 	require.NoError(t, err)
@@ -73,7 +103,15 @@ func StartServerContext(ctx context.Context, t *testing.T, env *repotesting.Envi
 	s.ServeStaticFiles(m, server.AssetFile())
 
 	hs := httptest.NewUnstartedServer(s.GRPCRouterHandler(m))
-	if tls {
+	if useTLS {
+		if clientCAs != nil {
+			hs.TLS = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				ClientCAs:  clientCAs,
+				ClientAuth: tls.VerifyClientCertIfGiven,
+			}
+		}
+
 		hs.EnableHTTP2 = true
 		hs.StartTLS()
 		serverHash := sha256.Sum256(hs.Certificate().Raw)
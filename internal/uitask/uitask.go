@@ -69,7 +69,8 @@ type Info struct {
 type runningTaskInfo struct {
 	Info
 
-	maxLogMessages int // +checklocksignore
+	maxLogMessages int        // +checklocksignore
+	onChange       func(Info) // +checklocksignore
 
 	mu sync.Mutex
 	// +checklocks:mu
@@ -94,35 +95,49 @@ func (t *runningTaskInfo) OnCancel(f context.CancelFunc) {
 	}
 }
 
-func (t *runningTaskInfo) cancel() {
+// cancel requests cancellation of the task and returns true if the task was running.
+func (t *runningTaskInfo) cancel() bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.Status == StatusRunning {
-		t.Status = StatusCanceling
-		for _, c := range t.taskCancel {
-			// run cancellation functions on their own goroutines
-			go c()
-		}
+	if t.Status != StatusRunning {
+		return false
+	}
 
-		t.taskCancel = nil
+	t.Status = StatusCanceling
+	for _, c := range t.taskCancel {
+		// run cancellation functions on their own goroutines
+		go c()
 	}
+
+	t.taskCancel = nil
+
+	return true
 }
 
 // ReportProgressInfo implements the Controller interface.
 func (t *runningTaskInfo) ReportProgressInfo(pi string) {
 	t.mu.Lock()
-	defer t.mu.Unlock()
-
 	t.ProgressInfo = pi
+	t.mu.Unlock()
+
+	t.changed()
 }
 
 // ReportCounters implements the Controller interface.
 func (t *runningTaskInfo) ReportCounters(c map[string]CounterValue) {
 	t.mu.Lock()
-	defer t.mu.Unlock()
-
 	t.Counters = maps.Clone(c)
+	t.mu.Unlock()
+
+	t.changed()
+}
+
+// changed invokes the change callback with a copy of task information, must be called without holding a lock.
+func (t *runningTaskInfo) changed() {
+	if t.onChange != nil {
+		t.onChange(t.info())
+	}
 }
 
 // info returns a copy of task information while holding a lock.
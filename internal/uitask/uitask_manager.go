@@ -33,6 +33,11 @@ type Manager struct {
 	MaxFinishedTasks      int // +checklocksignore
 	MaxLogMessagesPerTask int // +checklocksignore
 
+	// OnChange, if set, is invoked with a copy of task information when a task starts, reports progress,
+	// is being canceled or finishes. It is invoked synchronously without holding any locks and must not block.
+	// Must be set before running any tasks.
+	OnChange func(info Info) // +checklocksignore
+
 	persistentLogs bool // +checklocksignore
 }
 
@@ -56,6 +61,7 @@ func (m *Manager) Run(ctx context.Context, kind, description string, task TaskFu
 			Status:      StatusRunning,
 		},
 		maxLogMessages: m.MaxLogMessagesPerTask,
+		onChange:       m.OnChange,
 	}
 
 	if m.persistentLogs {
@@ -67,9 +73,11 @@ func (m *Manager) Run(ctx context.Context, kind, description string, task TaskFu
 	}
 
 	m.startTask(r)
+	r.changed()
 
 	err := task(ctx, r)
 	m.completeTask(r, err)
+	r.changed()
 
 	return err
 }
@@ -177,14 +185,12 @@ func (m *Manager) GetTask(taskID string) (Info, bool) {
 // CancelTask retrieves the log from the task.
 func (m *Manager) CancelTask(taskID string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	t := m.running[taskID]
-	if t == nil {
-		return
-	}
+	m.mu.Unlock()
 
-	t.cancel()
+	if t != nil && t.cancel() {
+		t.changed()
+	}
 }
 
 func (m *Manager) startTask(r *runningTaskInfo) string {
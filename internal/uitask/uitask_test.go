@@ -4,7 +4,9 @@
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -337,6 +339,48 @@ func TestUITaskCancel_BeforeOnCancel(t *testing.T) {
 	})
 }
 
+func TestUITask_OnChange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	m := uitask.NewManager(false)
+
+	var (
+		mu      sync.Mutex
+		changes []string
+	)
+
+	m.OnChange = func(i uitask.Info) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		changes = append(changes, fmt.Sprintf("%v %v %v %v", i.TaskID, i.Status, i.ProgressInfo, i.Counters["files"].Value))
+	}
+
+	m.Run(ctx, "some-kind", "test-1", func(_ context.Context, ctrl uitask.Controller) error {
+		ctrl.ReportProgressInfo("working")
+		ctrl.ReportCounters(map[string]uitask.CounterValue{
+			"files": uitask.SimpleCounter(3),
+		})
+
+		m.CancelTask(ctrl.CurrentTaskID())
+		m.CancelTask(ctrl.CurrentTaskID())
+
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, []string{
+		"1 RUNNING  0",
+		"1 RUNNING working 0",
+		"1 RUNNING working 3",
+		"1 CANCELING working 3",
+		"1 CANCELED  3",
+	}, changes)
+}
+
 func getTaskID(t *testing.T, m *uitask.Manager, desc string) string {
 	t.Helper()
 
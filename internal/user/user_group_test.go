@@ -0,0 +1,66 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
+)
+
+func TestUserGroups(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	_, err := user.GetGroup(ctx, env.RepositoryWriter, "ops")
+	require.ErrorIs(t, err, user.ErrGroupNotFound)
+
+	_, err = user.AddGroupMembers(ctx, env.RepositoryWriter, "Bad Name", "alice@host")
+	require.Error(t, err)
+
+	_, err = user.AddGroupMembers(ctx, env.RepositoryWriter, "ops", "not-a-user")
+	require.Error(t, err)
+
+	g, err := user.AddGroupMembers(ctx, env.RepositoryWriter, "ops", "bob@host", "alice@host")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice@host", "bob@host"}, g.Members)
+
+	// adding existing members is a no-op.
+	g, err = user.AddGroupMembers(ctx, env.RepositoryWriter, "ops", "alice@host", "carol@host")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice@host", "bob@host", "carol@host"}, g.Members)
+
+	_, err = user.AddGroupMembers(ctx, env.RepositoryWriter, "admins", "alice@host")
+	require.NoError(t, err)
+
+	groups, err := user.ListGroups(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	require.Equal(t, "admins", groups[0].Name)
+	require.Equal(t, "ops", groups[1].Name)
+
+	m, err := user.LoadGroupMap(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"admins", "ops"}, user.GroupsOfUser(m, "alice@host"))
+	require.Equal(t, []string{"ops"}, user.GroupsOfUser(m, "bob@host"))
+	require.Empty(t, user.GroupsOfUser(m, "dave@host"))
+
+	// unchanged groups are reused from the old map.
+	m2, err := user.LoadGroupMap(ctx, env.RepositoryWriter, m)
+	require.NoError(t, err)
+	require.Same(t, m["ops"], m2["ops"])
+
+	g, err = user.RemoveGroupMembers(ctx, env.RepositoryWriter, "ops", "alice@host", "bob@host")
+	require.NoError(t, err)
+	require.Equal(t, []string{"carol@host"}, g.Members)
+
+	// removing the last member deletes the group.
+	_, err = user.RemoveGroupMembers(ctx, env.RepositoryWriter, "ops", "carol@host")
+	require.NoError(t, err)
+
+	_, err = user.GetGroup(ctx, env.RepositoryWriter, "ops")
+	require.ErrorIs(t, err, user.ErrGroupNotFound)
+
+	_, err = user.RemoveGroupMembers(ctx, env.RepositoryWriter, "ops", "carol@host")
+	require.ErrorIs(t, err, user.ErrGroupNotFound)
+}
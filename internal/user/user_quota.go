@@ -0,0 +1,239 @@
+package user
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// QuotaManifestType is the type of the manifest used to represent storage quotas.
+const QuotaManifestType = "userquota"
+
+// QuotaPatternLabel is the manifest label identifying quotas by the user pattern they apply to.
+const QuotaPatternLabel = "pattern"
+
+// UsageManifestType is the type of the manifest used to track storage used by each user.
+// Usage manifests are labeled with UsernameAtHostnameLabel.
+const UsageManifestType = "userusage"
+
+// ErrQuotaNotFound is returned to indicate that a quota was not found in the system.
+var ErrQuotaNotFound = errors.New("quota not found")
+
+// Quota limits the number of new packed bytes that can be uploaded by users matching a pattern.
+// The pattern is 'username@hostname' which may include '*' wildcards, such as "*@host" or "user@*",
+// in which case the limits apply to the combined usage of all matching users.
+type Quota struct {
+	ManifestID manifest.ID `json:"-"`
+
+	Pattern        string `json:"pattern"`
+	SoftLimitBytes int64  `json:"softLimitBytes,omitempty"`
+	HardLimitBytes int64  `json:"hardLimitBytes,omitempty"`
+}
+
+// Matches returns true if the quota applies to the provided username@hostname.
+func (q *Quota) Matches(usernameAtHostname string) bool {
+	patternUser, patternHost, ok := strings.Cut(q.Pattern, "@")
+	if !ok {
+		return false
+	}
+
+	username, hostname, ok := strings.Cut(usernameAtHostname, "@")
+	if !ok {
+		return false
+	}
+
+	return (patternUser == "*" || patternUser == username) && (patternHost == "*" || patternHost == hostname)
+}
+
+// Validate returns an error if the quota is invalid.
+func (q *Quota) Validate() error {
+	if err := ValidateQuotaPattern(q.Pattern); err != nil {
+		return err
+	}
+
+	if q.SoftLimitBytes < 0 || q.HardLimitBytes < 0 {
+		return errors.New("quota limits must not be negative")
+	}
+
+	if q.SoftLimitBytes == 0 && q.HardLimitBytes == 0 {
+		return errors.New("at least one of soft or hard limit must be specified")
+	}
+
+	if q.HardLimitBytes > 0 && q.SoftLimitBytes > q.HardLimitBytes {
+		return errors.New("soft limit must not exceed hard limit")
+	}
+
+	return nil
+}
+
+// ValidateQuotaPattern returns an error if the given quota pattern is invalid.
+func ValidateQuotaPattern(pattern string) error {
+	u, h, ok := strings.Cut(pattern, "@")
+	if !ok || u == "" || h == "" || strings.Contains(h, "@") {
+		return errors.New("quota pattern must be 'username@hostname' possibly including wildcards")
+	}
+
+	return nil
+}
+
+// Usage describes the number of new packed bytes uploaded by a single user.
+type Usage struct {
+	ManifestID manifest.ID `json:"-"`
+
+	Username     string    `json:"username"`
+	PackedBytes  int64     `json:"packedBytes"`
+	ContentCount int64     `json:"contentCount"`
+	LastUpdated  time.Time `json:"lastUpdated"`
+}
+
+// QuotaUsage returns the combined usage of all users matching the quota.
+func QuotaUsage(q *Quota, usage map[string]*Usage) int64 {
+	var total int64
+
+	for username, u := range usage {
+		if q.Matches(username) {
+			total += u.PackedBytes
+		}
+	}
+
+	return total
+}
+
+// ListQuotas gets the list of all quotas in the system sorted by pattern.
+func ListQuotas(ctx context.Context, rep repo.Repository) ([]*Quota, error) {
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: QuotaManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing quota manifests")
+	}
+
+	var result []*Quota
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, QuotaPatternLabel) {
+		q := &Quota{}
+		if _, err := rep.GetManifest(ctx, m.ID, q); err != nil {
+			return nil, errors.Wrapf(err, "error loading quota manifest %v", m.Labels[QuotaPatternLabel])
+		}
+
+		q.ManifestID = m.ID
+
+		result = append(result, q)
+	}
+
+	slices.SortFunc(result, func(q1, q2 *Quota) int {
+		return strings.Compare(q1.Pattern, q2.Pattern)
+	})
+
+	return result, nil
+}
+
+// SetQuota creates or updates the quota for its pattern.
+func SetQuota(ctx context.Context, w repo.RepositoryWriter, q *Quota) error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	id, err := w.ReplaceManifests(ctx, map[string]string{
+		manifest.TypeLabelKey: QuotaManifestType,
+		QuotaPatternLabel:     q.Pattern,
+	}, q)
+	if err != nil {
+		return errors.Wrap(err, "error saving quota")
+	}
+
+	q.ManifestID = id
+
+	return nil
+}
+
+// DeleteQuota removes the quota for the given pattern.
+// Returns ErrQuotaNotFound when the quota does not exist.
+func DeleteQuota(ctx context.Context, w repo.RepositoryWriter, pattern string) error {
+	return deleteManifestsWithLabels(ctx, w, map[string]string{
+		manifest.TypeLabelKey: QuotaManifestType,
+		QuotaPatternLabel:     pattern,
+	}, errors.Wrap(ErrQuotaNotFound, pattern))
+}
+
+// LoadUsageMap returns the map of storage usage of all users by username.
+func LoadUsageMap(ctx context.Context, rep repo.Repository) (map[string]*Usage, error) {
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: UsageManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing usage manifests")
+	}
+
+	result := map[string]*Usage{}
+
+	for _, m := range manifest.DedupeEntryMetadataByLabel(entries, UsernameAtHostnameLabel) {
+		u := &Usage{}
+		if _, err := rep.GetManifest(ctx, m.ID, u); err != nil {
+			return nil, errors.Wrapf(err, "error loading usage manifest %v", m.Labels[UsernameAtHostnameLabel])
+		}
+
+		u.ManifestID = m.ID
+
+		result[u.Username] = u
+	}
+
+	return result, nil
+}
+
+// ListUsage gets the storage usage of all users sorted by username.
+func ListUsage(ctx context.Context, rep repo.Repository) ([]*Usage, error) {
+	usage, err := LoadUsageMap(ctx, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.SortedFunc(maps.Values(usage), func(u1, u2 *Usage) int {
+		return strings.Compare(u1.Username, u2.Username)
+	}), nil
+}
+
+// SetUsage stores the storage usage of a user.
+func SetUsage(ctx context.Context, w repo.RepositoryWriter, u *Usage) error {
+	id, err := w.ReplaceManifests(ctx, map[string]string{
+		manifest.TypeLabelKey:   UsageManifestType,
+		UsernameAtHostnameLabel: u.Username,
+	}, u)
+	if err != nil {
+		return errors.Wrap(err, "error saving usage")
+	}
+
+	u.ManifestID = id
+
+	return nil
+}
+
+// ResetUsage removes the recorded storage usage of a user.
+func ResetUsage(ctx context.Context, w repo.RepositoryWriter, username string) error {
+	return deleteManifestsWithLabels(ctx, w, map[string]string{
+		manifest.TypeLabelKey:   UsageManifestType,
+		UsernameAtHostnameLabel: username,
+	}, nil)
+}
+
+func deleteManifestsWithLabels(ctx context.Context, w repo.RepositoryWriter, labels map[string]string, notFoundErr error) error {
+	manifests, err := w.FindManifests(ctx, labels)
+	if err != nil {
+		return errors.Wrap(err, "error looking for manifests")
+	}
+
+	if len(manifests) == 0 {
+		return notFoundErr
+	}
+
+	for _, m := range manifests {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error deleting manifest %v", m.ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package user_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/user"
+)
+
+func TestQuotaMatches(t *testing.T) {
+	cases := []struct {
+		pattern string
+		user    string
+		want    bool
+	}{
+		{"alice@host", "alice@host", true},
+		{"alice@host", "alice@other", false},
+		{"*@host", "bob@host", true},
+		{"*@host", "bob@other", false},
+		{"alice@*", "alice@other", true},
+		{"*@*", "anyone@anywhere", true},
+		{"*@*", "invalid", false},
+	}
+
+	for _, tc := range cases {
+		require.Equal(t, tc.want, (&user.Quota{Pattern: tc.pattern}).Matches(tc.user), "%v %v", tc.pattern, tc.user)
+	}
+}
+
+func TestQuotaValidate(t *testing.T) {
+	require.NoError(t, (&user.Quota{Pattern: "*@host", HardLimitBytes: 100}).Validate())
+	require.NoError(t, (&user.Quota{Pattern: "a@b", SoftLimitBytes: 50, HardLimitBytes: 100}).Validate())
+	require.Error(t, (&user.Quota{Pattern: "a@b"}).Validate())
+	require.Error(t, (&user.Quota{Pattern: "a@b", SoftLimitBytes: 200, HardLimitBytes: 100}).Validate())
+	require.Error(t, (&user.Quota{Pattern: "a@b", HardLimitBytes: -1}).Validate())
+	require.Error(t, (&user.Quota{Pattern: "host", HardLimitBytes: 100}).Validate())
+	require.Error(t, (&user.Quota{Pattern: "a@b@c", HardLimitBytes: 100}).Validate())
+}
+
+func TestQuotasAndUsage(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	require.NoError(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{Pattern: "*@host", HardLimitBytes: 1000}))
+	require.NoError(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{Pattern: "alice@host", SoftLimitBytes: 100}))
+	require.NoError(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{Pattern: "*@host", HardLimitBytes: 2000}))
+	require.Error(t, user.SetQuota(ctx, env.RepositoryWriter, &user.Quota{Pattern: "bad"}))
+
+	quotas, err := user.ListQuotas(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, quotas, 2)
+	require.Equal(t, "*@host", quotas[0].Pattern)
+	require.Equal(t, int64(2000), quotas[0].HardLimitBytes)
+	require.Equal(t, "alice@host", quotas[1].Pattern)
+
+	require.NoError(t, user.SetUsage(ctx, env.RepositoryWriter, &user.Usage{Username: "alice@host", PackedBytes: 300}))
+	require.NoError(t, user.SetUsage(ctx, env.RepositoryWriter, &user.Usage{Username: "bob@host", PackedBytes: 200}))
+	require.NoError(t, user.SetUsage(ctx, env.RepositoryWriter, &user.Usage{Username: "bob@other", PackedBytes: 50}))
+
+	usage, err := user.LoadUsageMap(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, usage, 3)
+	require.Equal(t, int64(500), user.QuotaUsage(quotas[0], usage))
+	require.Equal(t, int64(300), user.QuotaUsage(quotas[1], usage))
+
+	require.NoError(t, user.ResetUsage(ctx, env.RepositoryWriter, "alice@host"))
+
+	list, err := user.ListUsage(ctx, env.RepositoryWriter)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.Equal(t, "bob@host", list[0].Username)
+	require.Equal(t, "bob@other", list[1].Username)
+
+	require.NoError(t, user.DeleteQuota(ctx, env.RepositoryWriter, "alice@host"))
+	require.ErrorIs(t, user.DeleteQuota(ctx, env.RepositoryWriter, "alice@host"), user.ErrQuotaNotFound)
+}
@@ -16,6 +16,11 @@ type APIServerInfo struct {
 	BaseURL                             string `json:"url"`
 	TrustedServerCertificateFingerprint string `json:"serverCertFingerprint"`
 	LocalCacheKeyDerivationAlgorithm    string `json:"localCacheKeyDerivationAlgorithm,omitempty"`
+	ClientCertificateFile               string `json:"clientCertFile,omitempty"`
+	ClientKeyFile                       string `json:"clientKeyFile,omitempty"`
+
+	// Repository is the name of the repository when the server hosts multiple repositories, empty for the default one.
+	Repository string `json:"repository,omitempty"`
 }
 
 // ConnectAPIServer sets up repository connection to a particular API server.
@@ -25,7 +30,12 @@ func ConnectAPIServer(ctx context.Context, configFile string, si *APIServerInfo,
 		ClientOptions: opt.ApplyDefaults(ctx, "API Server: "+si.BaseURL),
 	}
 
-	if err := setupCachingOptionsWithDefaults(ctx, configFile, &lc, &opt.CachingOptions, []byte(si.BaseURL)); err != nil {
+	uniqueID := si.BaseURL
+	if si.Repository != "" {
+		uniqueID += "#" + si.Repository
+	}
+
+	if err := setupCachingOptionsWithDefaults(ctx, configFile, &lc, &opt.CachingOptions, []byte(uniqueID)); err != nil {
 		return errors.Wrap(err, "unable to set up caching")
 	}
 
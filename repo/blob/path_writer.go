@@ -0,0 +1,25 @@
+package blob
+
+import (
+	"context"
+)
+
+// PathWriter is implemented by storage providers that map blob IDs to names of stored objects,
+// for example by sharding, and allows writing data under exact names instead.
+type PathWriter interface {
+	// PutBlobAtPath writes the provided data at the given slash-separated path relative to the storage root.
+	PutBlobAtPath(ctx context.Context, relPath string, data Bytes) error
+}
+
+// PutBlobAtPath writes the provided data at the given slash-separated path relative to the storage root.
+// Storage providers that don't implement PathWriter store blobs under names matching their IDs, so
+// the path is used as blob ID.
+func PutBlobAtPath(ctx context.Context, st Storage, relPath string, data Bytes) error {
+	if pw, ok := st.(PathWriter); ok {
+		//nolint:wrapcheck
+		return pw.PutBlobAtPath(ctx, relPath, data)
+	}
+
+	//nolint:wrapcheck
+	return st.PutBlob(ctx, ID(relPath), data, PutOptions{})
+}
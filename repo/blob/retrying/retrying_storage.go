@@ -36,6 +36,12 @@ func (s retryingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Byte
 	}, isRetriable)
 }
 
+func (s retryingStorage) PutBlobAtPath(ctx context.Context, relPath string, data blob.Bytes) error {
+	return retry.WithExponentialBackoffNoValue(ctx, "PutBlobAtPath("+relPath+")", func() error {
+		return blob.PutBlobAtPath(ctx, s.Storage, relPath, data)
+	}, isRetriable)
+}
+
 func (s retryingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return retry.WithExponentialBackoffNoValue(ctx, "DeleteBlob("+string(id)+")", func() error {
 		return s.Storage.DeleteBlob(ctx, id)
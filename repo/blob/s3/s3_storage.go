@@ -8,8 +8,10 @@
 	"crypto/x509"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 	"time"
 
@@ -247,6 +249,33 @@ func (s *s3Storage) ExtendBlobRetention(ctx context.Context, b blob.ID, opts blo
 	return nil
 }
 
+// PutBlobAtPath implements blob.PathWriter by storing the data under the provided path relative to the prefix.
+// Unlike blobs, which are kept small, files written at paths can be arbitrarily large, so they are uploaded
+// using multipart uploads when needed and with a content type based on the file extension.
+func (s *s3Storage) PutBlobAtPath(ctx context.Context, relPath string, data blob.Bytes) error {
+	r := data.Reader()
+	defer r.Close() //nolint:errcheck
+
+	_, err := s.cli.PutObject(ctx, s.BucketName, s.Prefix+relPath, r, int64(data.Length()), minio.PutObjectOptions{
+		ContentType: contentTypeForPath(relPath),
+	})
+
+	if isInvalidCredentials(err) {
+		return blob.ErrInvalidCredentials
+	}
+
+	return errors.Wrap(err, "unable to upload object")
+}
+
+// contentTypeForPath returns the MIME type of the file with the provided path based on its extension.
+func contentTypeForPath(p string) string {
+	if ct := mime.TypeByExtension(path.Ext(p)); ct != "" {
+		return ct
+	}
+
+	return "application/octet-stream"
+}
+
 func (s *s3Storage) getObjectNameString(b blob.ID) string {
 	return s.Prefix + string(b)
 }
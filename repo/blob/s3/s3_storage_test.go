@@ -469,6 +469,56 @@ func TestS3StorageMinio(t *testing.T) {
 	testStorage(t, options, true, blob.PutOptions{})
 }
 
+func TestS3StoragePutBlobAtPathMinio(t *testing.T) {
+	t.Parallel()
+	testutil.ProviderTest(t)
+
+	minioEndpoint := startDockerMinioOrSkip(t, testutil.TempDirectory(t))
+
+	options := &Options{
+		Endpoint:        minioEndpoint,
+		AccessKeyID:     minioRootAccessKeyID,
+		SecretAccessKey: minioRootSecretAccessKey,
+		BucketName:      minioBucketName,
+		Region:          minioRegion,
+		DoNotUseTLS:     true,
+		Prefix:          "restore/",
+	}
+
+	createBucket(t, options)
+
+	ctx := testlogging.Context(t)
+
+	st, err := New(ctx, options, false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	// files above the minimum part size are uploaded using multipart uploads.
+	large := make([]byte, 17<<20)
+	large[len(large)-1] = 1
+
+	require.NoError(t, blob.PutBlobAtPath(ctx, st, "dir/large.bin", gather.FromSlice(large)))
+	require.NoError(t, blob.PutBlobAtPath(ctx, st, "dir/readme.txt", gather.FromSlice([]byte("hello"))))
+
+	cli := createClient(t, options)
+
+	oi, err := cli.StatObject(ctx, options.BucketName, "restore/dir/large.bin", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	require.EqualValues(t, len(large), oi.Size)
+	require.Equal(t, "application/octet-stream", oi.ContentType)
+
+	oi, err = cli.StatObject(ctx, options.BucketName, "restore/dir/readme.txt", minio.StatObjectOptions{})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(oi.ContentType, "text/plain"), oi.ContentType)
+}
+
+func TestContentTypeForPath(t *testing.T) {
+	require.Equal(t, "application/octet-stream", contentTypeForPath("a/b/data.bin"))
+	require.Equal(t, "application/octet-stream", contentTypeForPath("a/b/noext"))
+	require.Equal(t, "image/png", contentTypeForPath("a/image.png"))
+}
+
 func TestS3StorageCustomCredentials(t *testing.T) {
 	t.Parallel()
 
@@ -543,6 +543,17 @@ func getSFTPClient(ctx context.Context, opt *Options) (*sftpConnection, error) {
 	}, nil
 }
 
+// NewClient opens a new SFTP session using the provided options, which can be used to access
+// arbitrary files on the server. The returned closer must be used to close the session.
+func NewClient(ctx context.Context, opts *Options) (*sftp.Client, io.Closer, error) {
+	conn, err := getSFTPClient(ctx, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conn.currentClient, conn, nil
+}
+
 // New creates new ssh-backed storage in a specified host.
 func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
 	impl := &sftpImpl{
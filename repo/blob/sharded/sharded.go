@@ -267,6 +267,15 @@ func (s *Storage) GetShardedPathAndFilePath(ctx context.Context, blobID blob.ID)
 	return shardPath, filePath, nil
 }
 
+// PutBlobAtPath implements blob.PathWriter by writing the data at the provided path relative to the root,
+// bypassing sharding.
+func (s *Storage) PutBlobAtPath(ctx context.Context, relPath string, data blob.Bytes) error {
+	filePath := path.Join(s.RootPath, relPath)
+
+	//nolint:wrapcheck
+	return s.Impl.PutBlobInPath(ctx, path.Dir(filePath), filePath, data, blob.PutOptions{})
+}
+
 // New returns new sharded.Storage helper.
 func New(impl Impl, rootPath string, opt Options, isCreate bool) Storage {
 	if opt.DirectoryShards == nil {
@@ -30,6 +30,10 @@
 
 	defaultFilePerm = 0o600
 	defaultDirPerm  = 0o700
+
+	// maxBufferedWriteSize is the size above which data is streamed to the server instead of being buffered
+	// in memory, which requires creating parent collections before each write.
+	maxBufferedWriteSize = 32 << 20
 )
 
 // davStorage implements blob.Storage on top of remove WebDAV repository.
@@ -160,18 +164,17 @@ func (d *davStorageImpl) PutBlobInPath(ctx context.Context, dirPath, filePath st
 		writePath = fmt.Sprintf("%v-%v", filePath, rand.Int63()) //nolint:gosec
 	}
 
-	var buf bytes.Buffer
-
-	data.WriteTo(&buf) //nolint:errcheck
-
-	b := buf.Bytes()
+	write := d.bufferedWriter(data)
+	if data.Length() > maxBufferedWriteSize {
+		write = d.streamingWriter(data)
+	}
 
 	if err := retry.WithExponentialBackoffNoValue(ctx, "WriteTemporaryFileAndCreateParentDirs", func() error {
 		mkdirAttempted := false
 
 		for {
 
-			err := d.translateError(d.cli.Write(writePath, b, defaultFilePerm))
+			err := d.translateError(write(writePath))
 			if err == nil {
 				if d.AtomicWrites {
 					return nil
@@ -212,6 +215,29 @@ func (d *davStorageImpl) PutBlobInPath(ctx context.Context, dirPath, filePath st
 	return nil
 }
 
+// bufferedWriter returns a function that writes the provided data, which is buffered in memory once.
+func (d *davStorageImpl) bufferedWriter(data blob.Bytes) func(writePath string) error {
+	var buf bytes.Buffer
+
+	data.WriteTo(&buf) //nolint:errcheck
+
+	b := buf.Bytes()
+
+	return func(writePath string) error {
+		return d.cli.Write(writePath, b, defaultFilePerm) //nolint:wrapcheck
+	}
+}
+
+// streamingWriter returns a function that writes the provided data without buffering it in memory.
+func (d *davStorageImpl) streamingWriter(data blob.Bytes) func(writePath string) error {
+	return func(writePath string) error {
+		r := data.Reader()
+		defer r.Close() //nolint:errcheck
+
+		return d.cli.WriteStreamWithLength(writePath, r, int64(data.Length()), defaultFilePerm) //nolint:wrapcheck
+	}
+}
+
 func (d *davStorageImpl) DeleteBlobInPath(ctx context.Context, dirPath, filePath string) error {
 	_ = dirPath
 
@@ -11,12 +11,14 @@
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/webdav"
 
 	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/providervalidation"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/internal/testutil"
@@ -99,6 +101,43 @@ func TestWebDAVStorageBuiltInServer(t *testing.T) {
 	}
 }
 
+func TestWebDAVStoragePutBlobAtPath(t *testing.T) {
+	t.Parallel()
+	testutil.ProviderTest(t)
+
+	ctx := testlogging.Context(t)
+	tmpDir := testutil.TempDirectory(t)
+
+	server := httptest.NewServer(basicAuth(&webdav.Handler{
+		FileSystem: webdav.Dir(tmpDir),
+		LockSystem: webdav.NewMemLS(),
+	}))
+	defer server.Close()
+
+	st, err := New(ctx, &Options{
+		URL:      server.URL,
+		Username: "user",
+		Password: "password",
+	}, false)
+	require.NoError(t, err)
+
+	defer st.Close(ctx)
+
+	// data above maxBufferedWriteSize is streamed to the server.
+	large := bytes.Repeat([]byte{1, 2, 3, 4}, maxBufferedWriteSize/4+1)
+
+	require.NoError(t, blob.PutBlobAtPath(ctx, st, "dir/large.bin", gather.FromSlice(large)))
+	require.NoError(t, blob.PutBlobAtPath(ctx, st, "dir/small.txt", gather.FromSlice([]byte("hello"))))
+
+	b, err := os.ReadFile(filepath.Join(tmpDir, "dir", "large.bin"))
+	require.NoError(t, err)
+	require.Equal(t, large, b)
+
+	b, err = os.ReadFile(filepath.Join(tmpDir, "dir", "small.txt"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello"), b)
+}
+
 func TestWebDAVStorageBuiltInServerWithMissingAsForbidden(t *testing.T) {
 	t.Parallel()
 	testutil.ProviderTest(t)
@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"io"
 	"net"
@@ -856,15 +857,16 @@ func (r *grpcRepositoryClient) OnSuccessfulFlush(callback RepositoryWriterCallba
 var _ Repository = (*grpcRepositoryClient)(nil)
 
 type grpcCreds struct {
-	hostname string
-	username string
-	password string
+	hostname   string
+	username   string
+	password   string
+	repository string
 }
 
 func (c grpcCreds) GetRequestMetadata(_ context.Context, uri ...string) (map[string]string, error) {
 	_ = uri
 
-	return map[string]string{
+	md := map[string]string{
 		"kopia-hostname":   c.hostname,
 		"kopia-username":   c.username,
 		"kopia-password":   c.password,
@@ -873,7 +875,13 @@ func (c grpcCreds) GetRequestMetadata(_ context.Context, uri ...string) (map[str
 		"kopia-repo":       BuildGitHubRepo,
 		"kopia-os":         runtime.GOOS,
 		"kopia-arch":       runtime.GOARCH,
-	}, nil
+	}
+
+	if c.repository != "" {
+		md["kopia-repository"] = c.repository
+	}
+
+	return md, nil
 }
 
 func (c grpcCreds) RequireTransportSecurity() bool {
@@ -883,14 +891,24 @@ func (c grpcCreds) RequireTransportSecurity() bool {
 // openGRPCAPIRepository opens the Repository based on remote GRPC server.
 // The APIServerInfo must have the address of the repository as 'https://host:port'
 func openGRPCAPIRepository(ctx context.Context, si *APIServerInfo, password string, par *immutableServerRepositoryParameters) (Repository, error) {
-	var transportCreds credentials.TransportCredentials
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
 
 	if si.TrustedServerCertificateFingerprint != "" {
-		transportCreds = credentials.NewTLS(tlsutil.TLSConfigTrustingSingleCertificate(si.TrustedServerCertificateFingerprint))
-	} else {
-		transportCreds = credentials.NewClientTLSFromCert(nil, "")
+		tlsConfig = tlsutil.TLSConfigTrustingSingleCertificate(si.TrustedServerCertificateFingerprint)
+	}
+
+	if si.ClientCertificateFile != "" {
+		// present client certificate, which authenticates the user to servers that trust its issuer.
+		cert, err := tls.LoadX509KeyPair(si.ClientCertificateFile, si.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load client certificate")
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
+	transportCreds := credentials.NewTLS(tlsConfig)
+
 	uri, err := baseURLToURI(si.BaseURL)
 	if err != nil {
 		return nil, errors.Wrap(err, "parsing base URL")
@@ -898,7 +916,7 @@ func openGRPCAPIRepository(ctx context.Context, si *APIServerInfo, password stri
 
 	conn, err := grpc.NewClient(
 		uri,
-		grpc.WithPerRPCCredentials(grpcCreds{par.cliOpts.Hostname, par.cliOpts.Username, password}),
+		grpc.WithPerRPCCredentials(grpcCreds{par.cliOpts.Hostname, par.cliOpts.Username, password, si.Repository}),
 		grpc.WithTransportCredentials(transportCreds),
 		grpc.WithDefaultCallOptions(
 			grpc.MaxCallRecvMsgSize(MaxGRPCMessageSize),
@@ -13,6 +13,7 @@
 	"github.com/kopia/kopia/internal/contentlog"
 	"github.com/kopia/kopia/internal/contentlog/logparam"
 	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/metrics"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/content/index"
@@ -244,16 +245,25 @@ func checkClockSkewBounds(rp RunParameters) error {
 
 // Run performs maintenance activities for a repository.
 func Run(ctx context.Context, runParams RunParameters, safety SafetyParameters) error {
+	var run func(ctx context.Context, runParams RunParameters, safety SafetyParameters) error
+
 	switch runParams.Mode {
 	case ModeQuick:
-		return runQuickMaintenance(ctx, runParams, safety)
+		run = runQuickMaintenance
 
 	case ModeFull:
-		return runFullMaintenance(ctx, runParams, safety)
+		run = runFullMaintenance
 
 	default:
 		return errors.Errorf("unknown mode %q", runParams.Mode)
 	}
+
+	startTime := clock.Now()
+	err := run(ctx, runParams, safety)
+
+	metrics.RecordMaintenanceOutcome(ctx, string(runParams.Mode), startTime, clock.Now(), err == nil)
+
+	return err
 }
 
 func runQuickMaintenance(ctx context.Context, runParams RunParameters, safety SafetyParameters) error {
@@ -1,6 +1,12 @@
 package policy
 
-import "github.com/kopia/kopia/snapshot"
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/snapshot"
+)
 
 // ActionsPolicy describes actions to be invoked when taking snapshots.
 type ActionsPolicy struct {
@@ -11,12 +17,16 @@ type ActionsPolicy struct {
 	// commands run once before and after each snapshot root (can be inherited).
 	BeforeSnapshotRoot *ActionCommand `json:"beforeSnapshotRoot,omitempty"`
 	AfterSnapshotRoot  *ActionCommand `json:"afterSnapshotRoot,omitempty"`
+
+	// commands whose standard output is captured as virtual files in each snapshot root (can be inherited).
+	StreamSources []StreamSourceCommand `json:"streamSources,omitempty"`
 }
 
 // ActionsPolicyDefinition specifies which policy definition provided the value of a particular field.
 type ActionsPolicyDefinition struct {
 	BeforeSnapshotRoot snapshot.SourceInfo `json:"beforeSnapshotRoot,omitempty"`
 	AfterSnapshotRoot  snapshot.SourceInfo `json:"afterSnapshotRoot,omitempty"`
+	StreamSources      snapshot.SourceInfo `json:"streamSources,omitempty"`
 }
 
 // ActionCommand configures a action command.
@@ -32,10 +42,49 @@ type ActionCommand struct {
 	Mode           string `json:"mode,omitempty"` // essential,optional,async
 }
 
+// StreamSourceCommand configures a command whose standard output is stored in the snapshot root
+// as a virtual file with the provided name, without staging it on disk.
+// Unless the mode is "optional", the command exiting with non-zero code fails the file.
+type StreamSourceCommand struct {
+	FileName string `json:"fileName"`
+
+	ActionCommand
+}
+
+// ValidateStreamSourceFileName returns an error if the provided name can't be used as the name
+// of a virtual file in the snapshot root.
+func ValidateStreamSourceFileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return errors.Errorf("invalid stream source file name %q", name)
+	}
+
+	return nil
+}
+
+// ValidateStreamSources returns an error if any of the stream sources has an invalid or duplicate file name.
+func ValidateStreamSources(sources []StreamSourceCommand) error {
+	seen := map[string]bool{}
+
+	for _, src := range sources {
+		if err := ValidateStreamSourceFileName(src.FileName); err != nil {
+			return err
+		}
+
+		if seen[src.FileName] {
+			return errors.Errorf("duplicate stream source file name: %v", src.FileName)
+		}
+
+		seen[src.FileName] = true
+	}
+
+	return nil
+}
+
 // Merge applies default values from the provided policy.
 func (p *ActionsPolicy) Merge(src ActionsPolicy, def *ActionsPolicyDefinition, si snapshot.SourceInfo) {
 	mergeActionCommand(&p.BeforeSnapshotRoot, src.BeforeSnapshotRoot, &def.BeforeSnapshotRoot, si)
 	mergeActionCommand(&p.AfterSnapshotRoot, src.AfterSnapshotRoot, &def.AfterSnapshotRoot, si)
+	mergeStreamSources(&p.StreamSources, src.StreamSources, &def.StreamSources, si)
 }
 
 // MergeNonInheritable copies non-inheritable properties from the provided actions policy.
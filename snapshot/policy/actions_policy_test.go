@@ -0,0 +1,48 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestValidateStreamSources(t *testing.T) {
+	cmd := policy.ActionCommand{Command: "pg_dump"}
+
+	cases := []struct {
+		names   []string
+		wantErr bool
+	}{
+		{names: nil},
+		{names: []string{"db.sql", "db2.sql", ".hidden", "a..b"}},
+		{names: []string{""}, wantErr: true},
+		{names: []string{"."}, wantErr: true},
+		{names: []string{".."}, wantErr: true},
+		{names: []string{"dir/db.sql"}, wantErr: true},
+		{names: []string{"/db.sql"}, wantErr: true},
+		{names: []string{`dir\db.sql`}, wantErr: true},
+		{names: []string{"db.sql", "db.sql"}, wantErr: true},
+	}
+
+	for _, tc := range cases {
+		var sources []policy.StreamSourceCommand
+
+		for _, n := range tc.names {
+			sources = append(sources, policy.StreamSourceCommand{FileName: n, ActionCommand: cmd})
+		}
+
+		err := policy.ValidateStreamSources(sources)
+		if tc.wantErr {
+			require.Error(t, err, "names: %q", tc.names)
+		} else {
+			require.NoError(t, err, "names: %q", tc.names)
+		}
+
+		// stream sources defined in policies are validated when saving them.
+		pol := &policy.Policy{Actions: policy.ActionsPolicy{StreamSources: sources}}
+		require.Equal(t, tc.wantErr, policy.ValidatePolicy(snapshot.SourceInfo{}, pol) != nil, "names: %q", tc.names)
+	}
+}
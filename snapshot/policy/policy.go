@@ -80,7 +80,7 @@ func (p *Policy) Target() snapshot.SourceInfo {
 }
 
 // ValidatePolicy returns error if the given policy is invalid.
-// Currently, only SchedulingPolicy is validated.
+// Currently, only SchedulingPolicy, UploadPolicy and stream sources are validated.
 func ValidatePolicy(si snapshot.SourceInfo, pol *Policy) error {
 	if err := ValidateSchedulingPolicy(pol.SchedulingPolicy); err != nil {
 		return errors.Wrap(err, "invalid scheduling policy")
@@ -90,6 +90,10 @@ func ValidatePolicy(si snapshot.SourceInfo, pol *Policy) error {
 		return errors.Wrap(err, "invalid upload policy")
 	}
 
+	if err := ValidateStreamSources(pol.Actions.StreamSources); err != nil {
+		return errors.Wrap(err, "invalid actions policy")
+	}
+
 	return nil
 }
 
@@ -165,6 +165,13 @@ func mergeLogLevel(target **LogDetail, src *LogDetail, def *snapshot.SourceInfo,
 	}
 }
 
+func mergeStreamSources(target *[]StreamSourceCommand, src []StreamSourceCommand, def *snapshot.SourceInfo, si snapshot.SourceInfo) {
+	if len(*target) == 0 && len(src) != 0 {
+		*target = append([]StreamSourceCommand(nil), src...)
+		*def = si
+	}
+}
+
 func mergeActionCommand(target **ActionCommand, src *ActionCommand, def *snapshot.SourceInfo, si snapshot.SourceInfo) {
 	if *target == nil && src != nil {
 		b := *src
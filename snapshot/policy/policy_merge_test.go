@@ -146,6 +146,10 @@ func testPolicyMergeSingleField(t *testing.T, fieldName string, typ reflect.Type
 		v0 = reflect.ValueOf((*policy.ActionCommand)(nil))
 		v1 = reflect.ValueOf(&policy.ActionCommand{Command: "foo"})
 		v2 = reflect.ValueOf(&policy.ActionCommand{Command: "bar"})
+	case "[]policy.StreamSourceCommand":
+		v0 = reflect.ValueOf([]policy.StreamSourceCommand{})
+		v1 = reflect.ValueOf([]policy.StreamSourceCommand{{FileName: "foo", ActionCommand: policy.ActionCommand{Command: "foo"}}})
+		v2 = reflect.ValueOf([]policy.StreamSourceCommand{{FileName: "bar", ActionCommand: policy.ActionCommand{Command: "bar"}}})
 	case "[]policy.TimeOfDay":
 		v0 = reflect.ValueOf([]policy.TimeOfDay{})
 		v1 = reflect.ValueOf([]policy.TimeOfDay{{Hour: 10}})
@@ -62,6 +62,10 @@
 		VolumeShadowCopy: VolumeShadowCopyPolicy{
 			Enable: NewOSSnapshotMode(OSSnapshotNever),
 		},
+		LinuxSnapshot: LinuxSnapshotPolicy{
+			Enable:   NewOSSnapshotMode(OSSnapshotNever),
+			Provider: LinuxSnapshotProviderAuto,
+		},
 	}
 
 	defaultUploadPolicy = UploadPolicy{
@@ -0,0 +1,125 @@
+package restore
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// BlobStorageOutput contains the options for restoring files into blob storage, such as S3 bucket prefix,
+// SFTP directory or WebDAV collection. Each file is stored under its path relative to the restore root.
+// Directories are created implicitly and symbolic links are skipped, since they can't be represented
+// in blob storage.
+type BlobStorageOutput struct {
+	storage blob.Storage
+}
+
+// Parallelizable implements restore.Output interface.
+func (o *BlobStorageOutput) Parallelizable() bool {
+	return true
+}
+
+// BeginDirectory implements restore.Output interface.
+func (o *BlobStorageOutput) BeginDirectory(ctx context.Context, relativePath string, _ fs.Directory) error {
+	return nil
+}
+
+// FinishDirectory implements restore.Output interface.
+func (o *BlobStorageOutput) FinishDirectory(ctx context.Context, relativePath string, _ fs.Directory) error {
+	return nil
+}
+
+// WriteDirEntry implements restore.Output interface.
+func (o *BlobStorageOutput) WriteDirEntry(ctx context.Context, relativePath string, de *snapshot.DirEntry, e fs.Directory) error {
+	return errors.New("shallow restore is not supported when restoring to blob storage")
+}
+
+// WriteFile implements restore.Output interface.
+func (o *BlobStorageOutput) WriteFile(ctx context.Context, relativePath string, f fs.File, progressCb FileWriteProgress) error {
+	if relativePath == "" {
+		// restoring a single file.
+		relativePath = f.Name()
+	}
+
+	log(ctx).Debugf("WriteFile %v (%v bytes)", relativePath, f.Size())
+
+	if err := blob.PutBlobAtPath(ctx, o.storage, relativePath, fileBytes{ctx, f}); err != nil {
+		return errors.Wrapf(err, "error writing %v", relativePath)
+	}
+
+	if progressCb != nil {
+		progressCb(f.Size())
+	}
+
+	return nil
+}
+
+// FileExists implements restore.Output interface.
+func (o *BlobStorageOutput) FileExists(ctx context.Context, relativePath string, f fs.File) bool {
+	return false
+}
+
+// CreateSymlink implements restore.Output interface.
+func (o *BlobStorageOutput) CreateSymlink(ctx context.Context, relativePath string, e fs.Symlink) error {
+	log(ctx).Infof("skipping symbolic link %v, which can't be restored to blob storage", relativePath)
+
+	return nil
+}
+
+// SymlinkExists implements restore.Output interface.
+func (o *BlobStorageOutput) SymlinkExists(ctx context.Context, relativePath string, e fs.Symlink) bool {
+	return false
+}
+
+// Close implements restore.Output interface.
+func (o *BlobStorageOutput) Close(ctx context.Context) error {
+	return errors.Wrap(o.storage.Close(ctx), "error closing storage")
+}
+
+// NewBlobStorageOutput creates new blob storage output, which takes ownership of the provided storage.
+func NewBlobStorageOutput(st blob.Storage) *BlobStorageOutput {
+	return &BlobStorageOutput{st}
+}
+
+var _ Output = (*BlobStorageOutput)(nil)
+
+// fileBytes implements blob.Bytes by streaming the contents of a snapshot file,
+// which avoids loading entire files in memory when the storage supports streaming.
+type fileBytes struct {
+	ctx context.Context //nolint:containedctx
+	f   fs.File
+}
+
+func (b fileBytes) Length() int {
+	return int(b.f.Size())
+}
+
+func (b fileBytes) Reader() io.ReadSeekCloser {
+	r, err := b.f.Open(b.ctx)
+	if err != nil {
+		return errorReader{errors.Wrap(err, "unable to open snapshot file")}
+	}
+
+	return r
+}
+
+func (b fileBytes) WriteTo(w io.Writer) (int64, error) {
+	r := b.Reader()
+	defer r.Close() //nolint:errcheck
+
+	//nolint:wrapcheck
+	return io.Copy(w, r)
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read(_ []byte) (int, error)         { return 0, r.err }
+func (r errorReader) Seek(_ int64, _ int) (int64, error) { return 0, r.err }
+func (r errorReader) Close() error                       { return nil }
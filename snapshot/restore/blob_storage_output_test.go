@@ -0,0 +1,40 @@
+package restore
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob/filesystem"
+)
+
+func TestBlobStorageOutput(t *testing.T) {
+	ctx := testlogging.Context(t)
+	target := t.TempDir()
+
+	root := mockfs.NewDirectory()
+	root.AddFile("readme.txt", []byte("hello"), 0o644)
+	root.AddDir("a", 0o755)
+	root.AddDir("a/b", 0o755)
+	root.AddFile("a/b/data.bin", []byte{1, 2, 3}, 0o644)
+	root.AddSymlink("link", "readme.txt", 0o777)
+
+	st, err := filesystem.New(ctx, &filesystem.Options{Path: target}, true)
+	require.NoError(t, err)
+
+	stats, err := Entry(ctx, nil, NewBlobStorageOutput(st), root, Options{RestoreDirEntryAtDepth: math.MaxInt32})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, stats.RestoredFileCount)
+
+	// files must be stored at their relative paths, without sharding or suffixes.
+	require.Equal(t, []string{"a/b/data.bin", "readme.txt"}, listFiles(t, target))
+
+	b, err := os.ReadFile(filepath.Join(target, "a", "b", "data.bin"))
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3}, b)
+}
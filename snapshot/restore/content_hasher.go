@@ -0,0 +1,95 @@
+package restore
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/hashing"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// contentHasher compares local data against chunks of snapshot files using the repository hash function,
+// which avoids reading snapshot contents from the repository.
+type contentHasher struct {
+	cr       hasherContentReader
+	hashFunc hashing.HashFunc
+}
+
+// hasherContentReader provides access to contents needed to load object indexes.
+type hasherContentReader struct {
+	content.Reader
+
+	rep repo.Repository
+}
+
+func (r hasherContentReader) PrefetchContents(ctx context.Context, contentIDs []content.ID, hint string) []content.ID {
+	return r.rep.PrefetchContents(ctx, contentIDs, hint)
+}
+
+// newContentHasher returns a content hasher for the provided repository or nil if the repository
+// does not provide direct access to contents.
+func newContentHasher(rep repo.Repository) *contentHasher {
+	dr, ok := rep.(repo.DirectRepository)
+	if !ok {
+		return nil
+	}
+
+	return &contentHasher{
+		cr:       hasherContentReader{dr.ContentReader(), rep},
+		hashFunc: dr.ContentReader().ContentFormat().HashFunc(),
+	}
+}
+
+// chunkLayout returns the ranges of file contents together with the objects that store them
+// or nil if the layout of the file can't be determined.
+func (h *contentHasher) chunkLayout(ctx context.Context, f fs.File) ([]object.IndirectObjectEntry, error) {
+	hoid, ok := f.(object.HasObjectID)
+	if !ok {
+		return nil, nil
+	}
+
+	oid := hoid.ObjectID()
+
+	indexObjectID, ok := oid.IndexObjectID()
+	if !ok {
+		return []object.IndirectObjectEntry{{Start: 0, Length: f.Size(), Object: oid}}, nil
+	}
+
+	entries, err := object.LoadIndexObject(ctx, h.cr, indexObjectID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load index of %v", oid)
+	}
+
+	return entries, nil
+}
+
+// canHash returns true if the contents of the provided chunk can be compared by hashing.
+// Chunks with object-level compression can't be, since their content IDs are computed from compressed data.
+func canHash(ch object.IndirectObjectEntry) bool {
+	_, compressed, ok := ch.Object.ContentID()
+
+	return ok && !compressed
+}
+
+// matchesChunk returns true if the provided data hashes to the ID of the content storing the chunk.
+func (h *contentHasher) matchesChunk(ch object.IndirectObjectEntry, data []byte) bool {
+	if !canHash(ch) {
+		return false
+	}
+
+	cid, _, _ := ch.Object.ContentID()
+
+	var hashOutput [hashing.MaxHashSize]byte
+
+	actual, err := content.IDFromHash(cid.Prefix(), h.hashFunc(hashOutput[:0], gather.FromSlice(data)))
+	if err != nil {
+		return false
+	}
+
+	return actual == cid
+}
@@ -108,6 +108,22 @@ type FilesystemOutput struct {
 	// WriteSparseFiles when set to true, write contents as sparse files, minimizing allocated disk space.
 	WriteSparseFiles bool `json:"writeSparseFiles"`
 
+	// DeltaRestore when set to true causes existing files to be updated in place by comparing their
+	// contents against the chunks of restored files and only rewriting ranges that differ.
+	DeltaRestore bool `json:"deltaRestore"`
+
+	// Journal when set to true records restored entries and checkpoints of partially written files in
+	// a journal in the target directory, which allows an interrupted restore to be resumed.
+	Journal bool `json:"journal"`
+
+	// Resume when set to true continues a restore interrupted while journaling, skipping entries
+	// recorded as restored and continuing partially written files from their last intact checkpoint.
+	Resume bool `json:"resume"`
+
+	// JournalCheckpointBytes is the number of bytes written to a file between journal checkpoints,
+	// zero means the default.
+	JournalCheckpointBytes int64 `json:"journalCheckpointBytes,omitempty"`
+
 	// copier is the StreamCopier to use for copying the actual bit stream to output.
 	// It is assigned at runtime based on the target filesystem and restore options.
 	copier streamCopier `json:"-"`
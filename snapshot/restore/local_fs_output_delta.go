@@ -0,0 +1,143 @@
+package restore
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// deltaWriter updates existing files in the filesystem output by comparing their contents against
+// the chunk layout of restored objects and only rewriting ranges that differ.
+type deltaWriter struct {
+	*contentHasher
+
+	output *FilesystemOutput
+}
+
+// newDeltaWriter returns a delta writer for the provided output or nil if delta restore is not enabled.
+func newDeltaWriter(ctx context.Context, rep repo.Repository, output Output) *deltaWriter {
+	fso, ok := output.(*FilesystemOutput)
+	if !ok || !fso.DeltaRestore {
+		return nil
+	}
+
+	h := newContentHasher(rep)
+	if h == nil {
+		log(ctx).Warn("delta restore requires direct repository access, existing files will be overwritten")
+		return nil
+	}
+
+	return &deltaWriter{h, fso}
+}
+
+// WriteFile writes the provided file, only rewriting ranges of an existing target file that differ from
+// the snapshot contents. Returns the number of bytes that did not need to be written.
+func (d *deltaWriter) WriteFile(ctx context.Context, relativePath string, f fs.File, progressCb FileWriteProgress) (int64, error) {
+	o := d.output
+	path := filepath.Join(o.TargetPath, filepath.FromSlash(relativePath))
+
+	st, err := os.Lstat(path)
+	if err != nil || !st.Mode().IsRegular() || !o.OverwriteFiles || o.WriteFilesAtomically {
+		return 0, o.WriteFile(ctx, relativePath, f, progressCb)
+	}
+
+	chunks, err := d.chunkLayout(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+
+	if chunks == nil {
+		return 0, o.WriteFile(ctx, relativePath, f, progressCb)
+	}
+
+	log(ctx).Debugf("updating existing file %v (%v bytes)", path, f.Size())
+
+	skipped, err := d.updateFile(ctx, ospath.SafeLongFilename(path), f, chunks, progressCb)
+	if err != nil {
+		return 0, errors.Wrap(err, "error updating file")
+	}
+
+	if err := o.setAttributes(path, f, os.FileMode(0)); err != nil {
+		return 0, errors.Wrap(err, "error setting attributes")
+	}
+
+	return skipped, SafeRemoveAll(path)
+}
+
+func (d *deltaWriter) updateFile(ctx context.Context, targetPath string, f fs.File, chunks []object.IndirectObjectEntry, progressCb FileWriteProgress) (skipped int64, err error) {
+	out, err := os.OpenFile(targetPath, os.O_RDWR, 0) //nolint:gosec
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to open existing file")
+	}
+
+	defer func() {
+		err = stderrors.Join(err, out.Close())
+	}()
+
+	if err := out.Truncate(f.Size()); err != nil {
+		return 0, errors.Wrap(err, "unable to truncate existing file")
+	}
+
+	r, err := f.Open(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to open snapshot file")
+	}
+	defer r.Close() //nolint:errcheck
+
+	var buf []byte
+
+	for _, ch := range chunks {
+		if int64(cap(buf)) < ch.Length {
+			buf = make([]byte, ch.Length)
+		}
+
+		buf = buf[:ch.Length]
+
+		if d.isUnchanged(out, ch, buf) {
+			skipped += ch.Length
+			continue
+		}
+
+		if _, err := r.Seek(ch.Start, io.SeekStart); err != nil {
+			return 0, errors.Wrap(err, "unable to seek snapshot file")
+		}
+
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, errors.Wrap(err, "unable to read snapshot file")
+		}
+
+		if _, err := out.WriteAt(buf, ch.Start); err != nil {
+			return 0, errors.Wrap(err, "unable to write file")
+		}
+
+		if progressCb != nil {
+			progressCb(ch.Length)
+		}
+	}
+
+	if d.output.FlushFiles {
+		if err := out.Sync(); err != nil {
+			return 0, errors.Wrap(err, "unable to flush file")
+		}
+	}
+
+	return skipped, nil
+}
+
+// isUnchanged returns true if the existing file contents in the range of the provided chunk match the chunk.
+func (d *deltaWriter) isUnchanged(out *os.File, ch object.IndirectObjectEntry, buf []byte) bool {
+	if _, err := out.ReadAt(buf, ch.Start); err != nil {
+		return false
+	}
+
+	return d.matchesChunk(ch, buf)
+}
@@ -0,0 +1,96 @@
+package restore_test
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestDeltaRestore(t *testing.T) {
+	ctx, te := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	data := make([]byte, 20<<20)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("image.bin", data, 0o644)
+
+	var man *snapshot.Manifest
+
+	require.NoError(t, repo.WriteSession(ctx, te.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		man, err = upload.NewUploader(w).Upload(ctx, dir, nil, te.LocalPathSourceInfo("/dummy/path"))
+		return err
+	}))
+
+	rootEntry, err := snapshotfs.SnapshotRoot(te.Repository, man)
+	require.NoError(t, err)
+
+	target := t.TempDir()
+
+	doRestore := func(delta bool) restore.Stats {
+		t.Helper()
+
+		out := &restore.FilesystemOutput{
+			TargetPath:           target,
+			OverwriteDirectories: true,
+			OverwriteFiles:       true,
+			SkipOwners:           true,
+			DeltaRestore:         delta,
+		}
+		require.NoError(t, out.Init(ctx))
+
+		st, err := restore.Entry(ctx, te.Repository, out, rootEntry, restore.Options{RestoreDirEntryAtDepth: math.MaxInt32})
+		require.NoError(t, err)
+
+		return st
+	}
+
+	st := doRestore(true)
+	require.Zero(t, st.DeltaSkippedTotalFileSize)
+
+	fname := filepath.Join(target, "image.bin")
+
+	// modify a single byte at the beginning of the file, only the first chunk needs to be rewritten.
+	modified := append([]byte{}, data...)
+	modified[0] ^= 0xff
+	require.NoError(t, os.WriteFile(fname, modified, 0o644))
+
+	st = doRestore(true)
+	require.Positive(t, st.DeltaSkippedTotalFileSize)
+	require.Less(t, st.DeltaSkippedTotalFileSize, int64(len(data)))
+
+	restored, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, data, restored)
+
+	// unmodified file does not need to be rewritten at all.
+	st = doRestore(true)
+	require.Equal(t, int64(len(data)), st.DeltaSkippedTotalFileSize)
+
+	// longer file gets truncated.
+	require.NoError(t, os.WriteFile(fname, append(modified, 1, 2, 3), 0o644))
+
+	doRestore(true)
+
+	restored, err = os.ReadFile(fname)
+	require.NoError(t, err)
+	require.Equal(t, data, restored)
+
+	// without delta restore, files are rewritten entirely.
+	st = doRestore(false)
+	require.Zero(t, st.DeltaSkippedTotalFileSize)
+}
@@ -0,0 +1,300 @@
+package restore
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+)
+
+// OCI image layout media types and file names, see https://github.com/opencontainers/image-spec.
+const (
+	ociLayoutVersion       = "1.0.0"
+	ociMediaTypeIndex      = "application/vnd.oci.image.index.v1+json"
+	ociMediaTypeManifest   = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeConfig     = "application/vnd.oci.image.config.v1+json"
+	ociMediaTypeLayerGzip  = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociAnnotationRefName   = "org.opencontainers.image.ref.name"
+	ociAnnotationCreated   = "org.opencontainers.image.created"
+	ociLayoutFileName      = "oci-layout"
+	ociIndexFileName       = "index.json"
+	ociBlobsDirName        = "blobs"
+	ociDigestAlgorithm     = "sha256"
+	ociLayerTempFilePrefix = ".layer-"
+	ociDefaultRefName      = "latest"
+	ociDefaultOS           = "linux"
+	ociFileMode            = 0o644
+	ociDirMode             = 0o755
+)
+
+// OCIImageOptions provides optional parameters of the OCI image.
+type OCIImageOptions struct {
+	// RefName is the name of the image reference in the image index, "latest" by default.
+	RefName string
+
+	// OS and Architecture of the image, default to "linux" and the architecture of the current process.
+	OS           string
+	Architecture string
+
+	// Created is the creation time of the image, defaults to the current time.
+	Created time.Time
+
+	// Entrypoint and Cmd are the default command of containers created from the image.
+	Entrypoint []string
+	Cmd        []string
+}
+
+// OCIOutput writes the file system tree as a single-layer image in OCI image layout, which
+// can be imported by tools such as skopeo and podman. The layer is streamed using TarOutput.
+type OCIOutput struct {
+	*TarOutput
+
+	dir     string
+	layer   *ociLayerWriter
+	options OCIImageOptions
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+type ociImageConfig struct {
+	Created      time.Time          `json:"created"`
+	Architecture string             `json:"architecture"`
+	OS           string             `json:"os"`
+	Config       ociContainerConfig `json:"config"`
+	RootFS       ociRootFS          `json:"rootfs"`
+	History      []ociHistory       `json:"history"`
+}
+
+type ociContainerConfig struct {
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+}
+
+type ociRootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type ociHistory struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+}
+
+// ociLayerWriter compresses the layer into a temporary file while computing digests
+// of both uncompressed and compressed data.
+type ociLayerWriter struct {
+	f      *os.File
+	gz     *gzip.Writer
+	diffID hash.Hash
+	digest hash.Hash
+	size   int64
+}
+
+func (w *ociLayerWriter) Write(p []byte) (int, error) {
+	w.diffID.Write(p)
+
+	//nolint:wrapcheck
+	return w.gz.Write(p)
+}
+
+func (w *ociLayerWriter) Close() error {
+	if err := w.gz.Close(); err != nil {
+		w.f.Close() //nolint:errcheck
+		return errors.Wrap(err, "error compressing layer")
+	}
+
+	return errors.Wrap(w.f.Close(), "error closing layer")
+}
+
+type countingWriter struct {
+	n *int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	*w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Close implements restore.Output interface.
+func (o *OCIOutput) Close(ctx context.Context) error {
+	if err := o.TarOutput.Close(ctx); err != nil {
+		return err
+	}
+
+	layerDesc := ociDescriptor{
+		MediaType: ociMediaTypeLayerGzip,
+		Digest:    ociDigestAlgorithm + ":" + hex.EncodeToString(o.layer.digest.Sum(nil)),
+		Size:      o.layer.size,
+	}
+
+	if err := os.Chmod(o.layer.f.Name(), ociFileMode); err != nil {
+		return errors.Wrap(err, "error setting layer permissions")
+	}
+
+	if err := os.Rename(o.layer.f.Name(), o.blobPath(layerDesc.Digest)); err != nil {
+		return errors.Wrap(err, "error writing layer")
+	}
+
+	created := o.options.Created.UTC()
+
+	configDesc, err := o.writeBlob(ociMediaTypeConfig, ociImageConfig{
+		Created:      created,
+		Architecture: o.options.Architecture,
+		OS:           o.options.OS,
+		Config: ociContainerConfig{
+			Entrypoint: o.options.Entrypoint,
+			Cmd:        o.options.Cmd,
+		},
+		RootFS: ociRootFS{
+			Type:    "layers",
+			DiffIDs: []string{ociDigestAlgorithm + ":" + hex.EncodeToString(o.layer.diffID.Sum(nil))},
+		},
+		History: []ociHistory{{Created: created, CreatedBy: "kopia restore"}},
+	})
+	if err != nil {
+		return err
+	}
+
+	manifestDesc, err := o.writeBlob(ociMediaTypeManifest, ociManifest{
+		SchemaVersion: 2, //nolint:mnd
+		MediaType:     ociMediaTypeManifest,
+		Config:        configDesc,
+		Layers:        []ociDescriptor{layerDesc},
+	})
+	if err != nil {
+		return err
+	}
+
+	manifestDesc.Annotations = map[string]string{
+		ociAnnotationRefName: o.options.RefName,
+		ociAnnotationCreated: created.Format(time.RFC3339),
+	}
+
+	if err := o.writeJSON(filepath.Join(o.dir, ociIndexFileName), ociIndex{
+		SchemaVersion: 2, //nolint:mnd
+		MediaType:     ociMediaTypeIndex,
+		Manifests:     []ociDescriptor{manifestDesc},
+	}); err != nil {
+		return err
+	}
+
+	return o.writeJSON(filepath.Join(o.dir, ociLayoutFileName), map[string]string{
+		"imageLayoutVersion": ociLayoutVersion,
+	})
+}
+
+func (o *OCIOutput) blobPath(digest string) string {
+	return filepath.Join(o.dir, ociBlobsDirName, ociDigestAlgorithm, digest[len(ociDigestAlgorithm)+1:])
+}
+
+// writeBlob writes the JSON representation of the provided value as a content-addressed blob.
+func (o *OCIOutput) writeBlob(mediaType string, v any) (ociDescriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ociDescriptor{}, errors.Wrap(err, "error serializing "+mediaType)
+	}
+
+	h := sha256.Sum256(b)
+
+	desc := ociDescriptor{
+		MediaType: mediaType,
+		Digest:    ociDigestAlgorithm + ":" + hex.EncodeToString(h[:]),
+		Size:      int64(len(b)),
+	}
+
+	if err := os.WriteFile(o.blobPath(desc.Digest), b, ociFileMode); err != nil {
+		return ociDescriptor{}, errors.Wrap(err, "error writing "+mediaType)
+	}
+
+	return desc, nil
+}
+
+func (o *OCIOutput) writeJSON(fname string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error serializing "+filepath.Base(fname))
+	}
+
+	return errors.Wrap(os.WriteFile(fname, b, ociFileMode), "error writing "+filepath.Base(fname))
+}
+
+// NewOCIOutput creates new output that writes OCI image layout to the provided directory,
+// which must not already contain an image.
+func NewOCIOutput(dir string, options OCIImageOptions) (*OCIOutput, error) {
+	if options.RefName == "" {
+		options.RefName = ociDefaultRefName
+	}
+
+	if options.OS == "" {
+		options.OS = ociDefaultOS
+	}
+
+	if options.Architecture == "" {
+		options.Architecture = runtime.GOARCH
+	}
+
+	if options.Created.IsZero() {
+		options.Created = clock.Now()
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ociIndexFileName)); err == nil {
+		return nil, errors.Errorf("%v already contains an OCI image", dir)
+	}
+
+	blobsDir := filepath.Join(dir, ociBlobsDirName, ociDigestAlgorithm)
+
+	if err := os.MkdirAll(blobsDir, ociDirMode); err != nil {
+		return nil, errors.Wrap(err, "unable to create OCI image directory")
+	}
+
+	f, err := os.CreateTemp(blobsDir, ociLayerTempFilePrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create layer file")
+	}
+
+	lw := &ociLayerWriter{
+		f:      f,
+		diffID: sha256.New(),
+		digest: sha256.New(),
+	}
+
+	lw.gz = gzip.NewWriter(io.MultiWriter(f, lw.digest, countingWriter{&lw.size}))
+
+	return &OCIOutput{
+		TarOutput: NewTarOutput(lw),
+		dir:       dir,
+		layer:     lw,
+		options:   options,
+	}, nil
+}
+
+var _ Output = (*OCIOutput)(nil)
@@ -0,0 +1,113 @@
+package restore
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestOCIOutput(t *testing.T) {
+	ctx := testlogging.Context(t)
+	dir := t.TempDir()
+
+	root := mockfs.NewDirectory()
+	root.AddDir("bin", 0o755)
+	root.AddFile("bin/sh", []byte("#!shell"), 0o755)
+	root.AddFile("etc-hostname", []byte("host"), 0o644)
+	root.AddSymlink("link", "bin/sh", 0o777)
+
+	out, err := NewOCIOutput(dir, OCIImageOptions{RefName: "v1", Cmd: []string{"/bin/sh"}})
+	require.NoError(t, err)
+
+	_, err = Entry(ctx, nil, out, root, Options{RestoreDirEntryAtDepth: math.MaxInt32})
+	require.NoError(t, err)
+
+	readBlob := func(desc ociDescriptor, v any) []byte {
+		t.Helper()
+
+		b, err := os.ReadFile(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(desc.Digest, "sha256:")))
+		require.NoError(t, err)
+
+		h := sha256.Sum256(b)
+		require.Equal(t, desc.Digest, "sha256:"+hex.EncodeToString(h[:]))
+		require.EqualValues(t, desc.Size, len(b))
+
+		if v != nil {
+			require.NoError(t, json.Unmarshal(b, v))
+		}
+
+		return b
+	}
+
+	layout, err := os.ReadFile(filepath.Join(dir, "oci-layout"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"imageLayoutVersion":"1.0.0"}`, string(layout))
+
+	var index ociIndex
+
+	b, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, &index))
+	require.Len(t, index.Manifests, 1)
+	require.Equal(t, "v1", index.Manifests[0].Annotations[ociAnnotationRefName])
+
+	var (
+		manifest ociManifest
+		config   ociImageConfig
+	)
+
+	readBlob(index.Manifests[0], &manifest)
+	readBlob(manifest.Config, &config)
+	require.Equal(t, []string{"/bin/sh"}, config.Config.Cmd)
+	require.Len(t, manifest.Layers, 1)
+
+	layer := readBlob(manifest.Layers[0], nil)
+
+	gz, err := gzip.NewReader(bytes.NewReader(layer))
+	require.NoError(t, err)
+
+	uncompressed, err := io.ReadAll(gz)
+	require.NoError(t, err)
+
+	diffID := sha256.Sum256(uncompressed)
+	require.Equal(t, []string{"sha256:" + hex.EncodeToString(diffID[:])}, config.RootFS.DiffIDs)
+
+	var names []string
+
+	tr := tar.NewReader(bytes.NewReader(uncompressed))
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+
+		names = append(names, h.Name)
+	}
+
+	require.ElementsMatch(t, []string{"bin/", "bin/sh", "etc-hostname", "link"}, names)
+
+	// temporary layer file must have been renamed.
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	_, err = NewOCIOutput(dir, OCIImageOptions{})
+	require.ErrorContains(t, err, "already contains an OCI image")
+}
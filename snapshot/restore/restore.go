@@ -7,10 +7,12 @@
 	"path"
 	"runtime"
 	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/parallelwork"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/logging"
@@ -41,6 +43,9 @@ type Stats struct {
 	EnqueuedTotalFileSize int64
 	SkippedTotalFileSize  int64
 
+	// DeltaSkippedTotalFileSize is the number of bytes of existing files that did not need to be rewritten.
+	DeltaSkippedTotalFileSize int64
+
 	RestoredFileCount    int32
 	RestoredDirCount     int32
 	RestoredSymlinkCount int32
@@ -48,10 +53,15 @@ type Stats struct {
 	EnqueuedDirCount     int32
 	EnqueuedSymlinkCount int32
 	SkippedCount         int32
+	ExcludedCount        int32
 	DeletedFilesCount    int32
 	DeletedSymlinkCount  int32
 	DeletedDirCount      int32
 	IgnoredErrorCount    int32
+
+	VerifiedCount       int32
+	VerifyMismatchCount int32
+	VerifySkippedCount  int32
 }
 
 // stats represents restore statistics.
@@ -60,6 +70,8 @@ type statsInternal struct {
 	EnqueuedTotalFileSize atomic.Int64
 	SkippedTotalFileSize  atomic.Int64
 
+	DeltaSkippedTotalFileSize atomic.Int64
+
 	RestoredFileCount    atomic.Int32
 	RestoredDirCount     atomic.Int32
 	RestoredSymlinkCount atomic.Int32
@@ -67,10 +79,15 @@ type statsInternal struct {
 	EnqueuedDirCount     atomic.Int32
 	EnqueuedSymlinkCount atomic.Int32
 	SkippedCount         atomic.Int32
+	ExcludedCount        atomic.Int32
 	DeletedFilesCount    atomic.Int32
 	DeletedSymlinkCount  atomic.Int32
 	DeletedDirCount      atomic.Int32
 	IgnoredErrorCount    atomic.Int32
+
+	VerifiedCount       atomic.Int32
+	VerifyMismatchCount atomic.Int32
+	VerifySkippedCount  atomic.Int32
 }
 
 func (s *statsInternal) clone() Stats {
@@ -78,17 +95,24 @@ func (s *statsInternal) clone() Stats {
 		RestoredTotalFileSize: s.RestoredTotalFileSize.Load(),
 		EnqueuedTotalFileSize: s.EnqueuedTotalFileSize.Load(),
 		SkippedTotalFileSize:  s.SkippedTotalFileSize.Load(),
-		RestoredFileCount:     s.RestoredFileCount.Load(),
-		RestoredDirCount:      s.RestoredDirCount.Load(),
-		RestoredSymlinkCount:  s.RestoredSymlinkCount.Load(),
-		EnqueuedFileCount:     s.EnqueuedFileCount.Load(),
-		EnqueuedDirCount:      s.EnqueuedDirCount.Load(),
-		EnqueuedSymlinkCount:  s.EnqueuedSymlinkCount.Load(),
-		SkippedCount:          s.SkippedCount.Load(),
-		DeletedFilesCount:     s.DeletedFilesCount.Load(),
-		DeletedSymlinkCount:   s.DeletedSymlinkCount.Load(),
-		DeletedDirCount:       s.DeletedDirCount.Load(),
-		IgnoredErrorCount:     s.IgnoredErrorCount.Load(),
+
+		DeltaSkippedTotalFileSize: s.DeltaSkippedTotalFileSize.Load(),
+
+		RestoredFileCount:    s.RestoredFileCount.Load(),
+		RestoredDirCount:     s.RestoredDirCount.Load(),
+		RestoredSymlinkCount: s.RestoredSymlinkCount.Load(),
+		EnqueuedFileCount:    s.EnqueuedFileCount.Load(),
+		EnqueuedDirCount:     s.EnqueuedDirCount.Load(),
+		EnqueuedSymlinkCount: s.EnqueuedSymlinkCount.Load(),
+		SkippedCount:         s.SkippedCount.Load(),
+		ExcludedCount:        s.ExcludedCount.Load(),
+		DeletedFilesCount:    s.DeletedFilesCount.Load(),
+		DeletedSymlinkCount:  s.DeletedSymlinkCount.Load(),
+		DeletedDirCount:      s.DeletedDirCount.Load(),
+		IgnoredErrorCount:    s.IgnoredErrorCount.Load(),
+		VerifiedCount:        s.VerifiedCount.Load(),
+		VerifyMismatchCount:  s.VerifyMismatchCount.Load(),
+		VerifySkippedCount:   s.VerifySkippedCount.Load(),
 	}
 }
 
@@ -106,6 +130,23 @@ type Options struct {
 	RestoreDirEntryAtDepth int32 `json:"restoreDirEntryAtDepth"`
 	MinSizeForPlaceholder  int32 `json:"minSizeForPlaceholder"`
 
+	// Patterns in .gitignore syntax of entries to restore and to skip, relative to the restore root.
+	// When include patterns are specified, only matching entries and contents of matching directories
+	// are restored. Directories without any restored entries are skipped.
+	Include        []string   `json:"include,omitempty"`
+	Exclude        []string   `json:"exclude,omitempty"`
+	MinFileSize    int64      `json:"minFileSize,omitempty"`
+	MaxFileSize    int64      `json:"maxFileSize,omitempty"`
+	ModifiedSince  *time.Time `json:"modifiedSince,omitempty"`
+	ModifiedBefore *time.Time `json:"modifiedBefore,omitempty"`
+
+	// Verify causes restored files and symbolic links to be read back and compared against the snapshot.
+	// Only supported when restoring to a local filesystem.
+	Verify bool `json:"verify,omitempty"`
+
+	// VerifyReport, if not nil, receives the results of verification of each restored entry.
+	VerifyReport *VerifyReport `json:"-"`
+
 	ProgressCallback ProgressCallback `json:"-"`
 	Cancel           chan struct{}    `json:"-"` // channel that can be externally closed to signal cancellation
 }
@@ -114,9 +155,41 @@ type Options struct {
 //
 //nolint:revive
 func Entry(ctx context.Context, rep repo.Repository, output Output, rootEntry fs.Entry, options Options) (Stats, error) {
+	filter, err := newEntryFilter(options)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var verifier *restoreVerifier
+
+	if options.Verify {
+		if verifier, err = newRestoreVerifier(rep, output, options.VerifyReport); err != nil {
+			return Stats{}, err
+		}
+
+		verifier.report.Target = verifier.output.TargetPath
+
+		if verifier.report.StartTime.IsZero() {
+			verifier.report.StartTime = clock.Now()
+		}
+
+		defer func() {
+			verifier.report.EndTime = clock.Now()
+		}()
+	}
+
+	journal, err := newRestoreJournal(ctx, output, rootEntry)
+	if err != nil {
+		return Stats{}, err
+	}
+
 	c := copier{
+		filter:           filter,
 		output:           output,
 		shallowoutput:    makeShallowFilesystemOutput(output, options),
+		delta:            newDeltaWriter(ctx, rep, output),
+		verifier:         verifier,
+		journal:          journal,
 		q:                parallelwork.NewQueue(),
 		incremental:      options.Incremental,
 		deleteExtra:      options.DeleteExtra,
@@ -146,9 +219,22 @@ func Entry(ctx context.Context, rep repo.Repository, output Output, rootEntry fs
 	}
 
 	if err := c.q.Process(ctx, numWorkers); err != nil {
+		if journal != nil {
+			if cerr := journal.close(false); cerr != nil {
+				log(ctx).Errorf("%v", cerr)
+			}
+		}
+
 		return Stats{}, errors.Wrap(err, "restore error")
 	}
 
+	if journal != nil {
+		// keep the journal if the restore has been cancelled, so that it can be resumed.
+		if err := journal.close(!c.isCancelled()); err != nil {
+			return Stats{}, err
+		}
+	}
+
 	if err := c.output.Close(ctx); err != nil {
 		return Stats{}, errors.Wrap(err, "error closing output")
 	}
@@ -167,6 +253,37 @@ type copier struct {
 	cancel        chan struct{}
 
 	progressCallback ProgressCallback
+
+	filter   *entryFilter     // nil when restoring all entries
+	delta    *deltaWriter     // nil unless existing files are updated in place
+	verifier *restoreVerifier // nil unless restored entries are verified
+	journal  *restoreJournal  // nil unless restore progress is journaled
+}
+
+func (c *copier) isCancelled() bool {
+	return isCancelled(c.cancel)
+}
+
+// recordComplete records the restored entry in the journal unless the restore has been cancelled,
+// in which case some of its children may have not been restored.
+func (c *copier) recordComplete(targetPath string) error {
+	if c.journal == nil || c.isCancelled() {
+		return nil
+	}
+
+	return c.journal.recordComplete(targetPath)
+}
+
+// recordVerifyStatus updates statistics with the result of verification of a single entry.
+func (c *copier) recordVerifyStatus(s VerifyStatus) {
+	switch s {
+	case VerifyStatusVerified:
+		c.stats.VerifiedCount.Add(1)
+	case VerifyStatusMismatch:
+		c.stats.VerifyMismatchCount.Add(1)
+	case VerifyStatusSkipped:
+		c.stats.VerifySkippedCount.Add(1)
+	}
 }
 
 func (c *copier) reportProgress(ctx context.Context) {
@@ -185,6 +302,21 @@ func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string, c
 		}
 	}
 
+	if c.journal != nil && c.journal.isComplete(targetPath, e) {
+		log(ctx).Debugf("skipping %v because it has been restored before the restore was resumed", targetPath)
+		c.stats.SkippedCount.Add(1)
+
+		if !e.IsDir() {
+			c.stats.SkippedTotalFileSize.Add(e.Size())
+		}
+
+		if c.verifier != nil {
+			c.recordVerifyStatus(c.verifier.skip(targetPath, e, "restored before the restore was resumed"))
+		}
+
+		return onCompletion()
+	}
+
 	if c.incremental {
 		// in incremental mode, do not copy if the output already exists
 		switch e := e.(type) {
@@ -194,6 +326,10 @@ func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string, c
 				c.stats.SkippedCount.Add(1)
 				c.stats.SkippedTotalFileSize.Add(e.Size())
 
+				if c.verifier != nil {
+					c.recordVerifyStatus(c.verifier.verifyFile(ctx, targetPath, e))
+				}
+
 				return onCompletion()
 			}
 
@@ -202,6 +338,10 @@ func (c *copier) copyEntry(ctx context.Context, e fs.Entry, targetPath string, c
 				c.stats.SkippedCount.Add(1)
 				log(ctx).Debugf("skipping symlink %v because it already exists", targetPath)
 
+				if c.verifier != nil {
+					c.recordVerifyStatus(c.verifier.verifySymlink(ctx, targetPath, e))
+				}
+
 				return onCompletion()
 			}
 		}
@@ -242,6 +382,24 @@ func (c *copier) copyEntryInternal(ctx context.Context, e fs.Entry, targetPath s
 			if err := c.shallowoutput.WriteFile(ctx, targetPath, e, progressCallback); err != nil {
 				return errors.Wrap(err, "copy file")
 			}
+		} else if c.delta != nil {
+			skipped, err := c.delta.WriteFile(ctx, targetPath, e, progressCallback)
+			if err != nil {
+				return errors.Wrap(err, "copy file")
+			}
+
+			c.stats.DeltaSkippedTotalFileSize.Add(skipped)
+		} else if c.journal != nil && c.journal.checkpointsFile(e) {
+			skipped, err := c.journal.writeFile(ctx, targetPath, e, c.cancel, progressCallback)
+			if errors.Is(err, errRestoreCancelled) {
+				return onCompletion()
+			}
+
+			if err != nil {
+				return errors.Wrap(err, "copy file")
+			}
+
+			c.stats.DeltaSkippedTotalFileSize.Add(skipped)
 		} else {
 			if err := c.output.WriteFile(ctx, targetPath, e, progressCallback); err != nil {
 				return errors.Wrap(err, "copy file")
@@ -251,6 +409,18 @@ func (c *copier) copyEntryInternal(ctx context.Context, e fs.Entry, targetPath s
 		c.stats.RestoredFileCount.Add(1)
 		c.stats.RestoredTotalFileSize.Add(bytesExpected - bytesWritten)
 
+		if c.verifier != nil {
+			if currentdepth > maxdepth {
+				c.recordVerifyStatus(c.verifier.skip(targetPath, e, "restored as placeholder"))
+			} else {
+				c.recordVerifyStatus(c.verifier.verifyFile(ctx, targetPath, e))
+			}
+		}
+
+		if err := c.recordComplete(targetPath); err != nil {
+			return err
+		}
+
 		return onCompletion()
 
 	case fs.Symlink:
@@ -261,6 +431,14 @@ func (c *copier) copyEntryInternal(ctx context.Context, e fs.Entry, targetPath s
 			return errors.Wrap(err, "create symlink")
 		}
 
+		if c.verifier != nil {
+			c.recordVerifyStatus(c.verifier.verifySymlink(ctx, targetPath, e))
+		}
+
+		if err := c.recordComplete(targetPath); err != nil {
+			return err
+		}
+
 		return onCompletion()
 
 	default:
@@ -269,6 +447,18 @@ func (c *copier) copyEntryInternal(ctx context.Context, e fs.Entry, targetPath s
 }
 
 func (c *copier) copyDirectory(ctx context.Context, d fs.Directory, targetPath string, currentdepth, maxdepth int32, onCompletion parallelwork.CallbackFunc) error {
+	if c.filter != nil && targetPath != "" {
+		selected, err := c.filter.hasSelectedEntries(ctx, d, targetPath)
+		if err != nil {
+			return err
+		}
+
+		if !selected {
+			c.stats.ExcludedCount.Add(1)
+			return onCompletion()
+		}
+	}
+
 	c.stats.RestoredDirCount.Add(1)
 
 	if SafelySuffixablePath(targetPath) && currentdepth > maxdepth {
@@ -302,6 +492,10 @@ func (c *copier) copyDirectory(ctx context.Context, d fs.Directory, targetPath s
 			return errors.Wrap(err, "finish directory")
 		}
 
+		if err := c.recordComplete(targetPath); err != nil {
+			return err
+		}
+
 		return onCompletion()
 	}), "copy directory contents")
 }
@@ -340,6 +534,10 @@ func (c *copier) deleteExtraFilesInDir(ctx context.Context, o *FilesystemOutput,
 	// - delete existing files that are directories in the snapshot.
 	// This allows "overwriting" existing entries with when their (directory vs. file) types do not match.
 	for _, existingEntry := range existingEntries {
+		if targetPath == "" && existingEntry.Name() == JournalFileName {
+			continue
+		}
+
 		if existingEntry.IsDir() {
 			if _, ok := snapshotDirectories[existingEntry.Name()]; !ok {
 				entryPath := path.Join(o.TargetPath, targetPath, existingEntry.Name())
@@ -383,6 +581,10 @@ func (c *copier) copyDirectoryContent(ctx context.Context, d fs.Directory, targe
 		return errors.Wrap(err, "error reading directory")
 	}
 
+	if c.filter != nil {
+		entries = c.filterEntries(entries, targetPath)
+	}
+
 	if len(entries) == 0 {
 		return onCompletion()
 	}
@@ -413,3 +615,26 @@ func (c *copier) copyDirectoryContent(ctx context.Context, d fs.Directory, targe
 
 	return nil
 }
+
+// filterEntries returns entries of the directory that should be restored.
+func (c *copier) filterEntries(entries []fs.Entry, targetPath string) []fs.Entry {
+	var result []fs.Entry
+
+	for _, e := range entries {
+		childPath := path.Join(targetPath, e.Name())
+
+		if e.IsDir() {
+			if c.filter.isExcludedDir(childPath) {
+				c.stats.ExcludedCount.Add(1)
+				continue
+			}
+		} else if !c.filter.selectsEntry(childPath, e) {
+			c.stats.ExcludedCount.Add(1)
+			continue
+		}
+
+		result = append(result, e)
+	}
+
+	return result
+}
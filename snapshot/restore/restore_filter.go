@@ -0,0 +1,178 @@
+package restore
+
+import (
+	"context"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/wcmatch"
+)
+
+// entryFilter selects entries to be restored based on include/exclude patterns, size and modification time.
+type entryFilter struct {
+	include []*wcmatch.WildcardMatcher
+	exclude []*wcmatch.WildcardMatcher
+
+	minSize        int64
+	maxSize        int64
+	modifiedSince  *time.Time
+	modifiedBefore *time.Time
+
+	mu sync.Mutex
+	// +checklocks:mu
+	dirSelected map[string]bool // cache of results of hasSelectedEntries()
+}
+
+// newEntryFilter returns a filter for the provided options or nil if the options don't specify any filters.
+func newEntryFilter(options Options) (*entryFilter, error) {
+	if len(options.Include) == 0 && len(options.Exclude) == 0 &&
+		options.MinFileSize == 0 && options.MaxFileSize == 0 &&
+		options.ModifiedSince == nil && options.ModifiedBefore == nil {
+		return nil, nil
+	}
+
+	f := &entryFilter{
+		minSize:        options.MinFileSize,
+		maxSize:        options.MaxFileSize,
+		modifiedSince:  options.ModifiedSince,
+		modifiedBefore: options.ModifiedBefore,
+		dirSelected:    map[string]bool{},
+	}
+
+	var err error
+
+	if f.include, err = parsePatterns(options.Include); err != nil {
+		return nil, errors.Wrap(err, "invalid include pattern")
+	}
+
+	if f.exclude, err = parsePatterns(options.Exclude); err != nil {
+		return nil, errors.Wrap(err, "invalid exclude pattern")
+	}
+
+	return f, nil
+}
+
+func parsePatterns(patterns []string) ([]*wcmatch.WildcardMatcher, error) {
+	var result []*wcmatch.WildcardMatcher
+
+	for _, p := range patterns {
+		m, err := wcmatch.NewWildcardMatcher(p)
+		if err != nil {
+			return nil, errors.Wrap(err, p)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// matches returns true if the provided path matches the list of patterns, which are evaluated in order
+// so that subsequent negated patterns can revert earlier matches, following .gitignore semantics.
+func matches(matchers []*wcmatch.WildcardMatcher, relPath string, isDir bool) bool {
+	matched := false
+	p := "/" + relPath
+
+	for _, m := range matchers {
+		if matched == m.Negated() {
+			matched = m.Match(p, isDir)
+		}
+	}
+
+	return matched
+}
+
+// isExcludedDir returns true if the directory at a given path must be skipped entirely.
+func (f *entryFilter) isExcludedDir(relPath string) bool {
+	return matches(f.exclude, relPath, true)
+}
+
+// isIncluded returns true if the path or any of its parent directories match include patterns.
+func (f *entryFilter) isIncluded(relPath string, isDir bool) bool {
+	if len(f.include) == 0 || matches(f.include, relPath, isDir) {
+		return true
+	}
+
+	for p := path.Dir(relPath); p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if matches(f.include, p, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectsEntry returns true if the provided non-directory entry should be restored.
+func (f *entryFilter) selectsEntry(relPath string, e fs.Entry) bool {
+	if matches(f.exclude, relPath, false) || !f.isIncluded(relPath, false) {
+		return false
+	}
+
+	if _, ok := e.(fs.File); ok {
+		if f.minSize > 0 && e.Size() < f.minSize {
+			return false
+		}
+
+		if f.maxSize > 0 && e.Size() > f.maxSize {
+			return false
+		}
+	}
+
+	if f.modifiedSince != nil && e.ModTime().Before(*f.modifiedSince) {
+		return false
+	}
+
+	if f.modifiedBefore != nil && !e.ModTime().Before(*f.modifiedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// hasSelectedEntries returns true if the provided directory contains any entry that should be restored,
+// directly or in any of its subdirectories. Directories without selected entries are not restored.
+func (f *entryFilter) hasSelectedEntries(ctx context.Context, d fs.Directory, relPath string) (bool, error) {
+	f.mu.Lock()
+	result, ok := f.dirSelected[relPath]
+	f.mu.Unlock()
+
+	if ok {
+		return result, nil
+	}
+
+	entries, err := fs.GetAllEntries(ctx, d)
+	if err != nil {
+		return false, errors.Wrap(err, "error reading directory")
+	}
+
+	for _, e := range entries {
+		childPath := path.Join(relPath, e.Name())
+
+		if sd, ok := e.(fs.Directory); ok {
+			if f.isExcludedDir(childPath) {
+				continue
+			}
+
+			result, err = f.hasSelectedEntries(ctx, sd, childPath)
+			if err != nil {
+				return false, err
+			}
+		} else {
+			result = f.selectsEntry(childPath, e)
+		}
+
+		if result {
+			break
+		}
+	}
+
+	f.mu.Lock()
+	f.dirSelected[relPath] = result
+	f.mu.Unlock()
+
+	return result, nil
+}
@@ -0,0 +1,143 @@
+package restore
+
+import (
+	"io/fs"
+	"math"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/testlogging"
+)
+
+func TestRestoreFilters(t *testing.T) {
+	root := mockfs.NewDirectory()
+	root.AddFile("readme.txt", []byte{1}, 0o644)
+	root.AddDir("projects", 0o755)
+	root.AddDir("projects/a", 0o755)
+	root.AddDir("projects/a/node_modules", 0o755)
+	root.AddDir("projects/b", 0o755)
+	root.AddDir("photos", 0o755)
+	root.AddFile("projects/a/doc.pdf", []byte{1, 2, 3}, 0o644)
+	root.AddFile("projects/a/big.pdf", make([]byte, 1000), 0o644)
+	root.AddFile("projects/a/notes.txt", []byte{1}, 0o644)
+	root.AddFile("projects/a/node_modules/x.pdf", []byte{1}, 0o644)
+	root.AddFile("projects/b/notes.txt", []byte{1}, 0o644)
+	root.AddFile("photos/img.pdf", []byte{1}, 0o644)
+
+	future := time.Now().Add(time.Hour)
+
+	cases := []struct {
+		name    string
+		options Options
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "include",
+			options: Options{Include: []string{"/projects/**/*.pdf"}},
+			want:    []string{"projects/a/big.pdf", "projects/a/doc.pdf", "projects/a/node_modules/x.pdf"},
+		},
+		{
+			name:    "include and exclude",
+			options: Options{Include: []string{"/projects/**/*.pdf"}, Exclude: []string{"node_modules/"}},
+			want:    []string{"projects/a/big.pdf", "projects/a/doc.pdf"},
+		},
+		{
+			name:    "include directory",
+			options: Options{Include: []string{"/projects/b/"}},
+			want:    []string{"projects/b/notes.txt"},
+		},
+		{
+			name:    "negated exclude",
+			options: Options{Exclude: []string{"*.pdf", "!doc.pdf", "node_modules/"}},
+			want:    []string{"projects/a/doc.pdf", "projects/a/notes.txt", "projects/b/notes.txt", "readme.txt"},
+		},
+		{
+			name:    "size",
+			options: Options{Include: []string{"*.pdf"}, MinFileSize: 2, MaxFileSize: 100},
+			want:    []string{"projects/a/doc.pdf"},
+		},
+		{
+			name:    "modified before",
+			options: Options{Include: []string{"*.txt"}, ModifiedBefore: &future},
+			want:    []string{"projects/a/notes.txt", "projects/b/notes.txt", "readme.txt"},
+		},
+		{
+			name:    "modified since",
+			options: Options{ModifiedSince: &future},
+		},
+		{
+			name:    "invalid pattern",
+			options: Options{Include: []string{"[a"}},
+			wantErr: "invalid include pattern",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testlogging.Context(t)
+			target := t.TempDir()
+
+			out := &FilesystemOutput{
+				TargetPath:           target,
+				OverwriteDirectories: true,
+				OverwriteFiles:       true,
+				SkipOwners:           true,
+			}
+			require.NoError(t, out.Init(ctx))
+
+			opt := tc.options
+			opt.RestoreDirEntryAtDepth = math.MaxInt32
+
+			_, err := Entry(ctx, nil, out, root, opt)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.want, listFiles(t, target))
+		})
+	}
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var result []string
+
+	require.NoError(t, filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// directories without selected entries must not be created.
+			if rel != "." {
+				entries, err := filepath.Glob(filepath.Join(p, "*"))
+				require.NoError(t, err)
+				require.NotEmpty(t, entries, rel)
+			}
+
+			return nil
+		}
+
+		result = append(result, filepath.ToSlash(rel))
+
+		return nil
+	}))
+
+	sort.Strings(result)
+
+	return result
+}
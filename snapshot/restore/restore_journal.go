@@ -0,0 +1,422 @@
+package restore
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo/object"
+)
+
+// JournalFileName is the name of the file in the target directory where restore progress is journaled.
+const JournalFileName = ".kopia-restore-journal"
+
+// defaultJournalCheckpointBytes is the default number of bytes written to a file between checkpoints.
+const defaultJournalCheckpointBytes = 64 << 20
+
+// errRestoreCancelled is returned when writing a file is interrupted due to cancellation.
+var errRestoreCancelled = errors.New("restore cancelled")
+
+// journalRecord is a single line of the restore journal.
+type journalRecord struct {
+	// Root is the ID of the restored object, only present in the first record.
+	Root string `json:"root,omitempty"`
+
+	Path     string `json:"path,omitempty"`
+	Complete bool   `json:"complete,omitempty"`
+
+	// Offset and Hash describe a checkpoint of a partially written file: the number of bytes
+	// that have been flushed to disk and the SHA-256 of those bytes.
+	Offset int64  `json:"offset,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// restoreJournal records directories and files that have been completely restored and checkpoints
+// of partially written files, which allows an interrupted restore to a filesystem to be resumed.
+type restoreJournal struct {
+	output          *FilesystemOutput
+	fname           string
+	root            string
+	checkpointBytes int64
+
+	// state loaded from the journal of the restore being resumed, read-only.
+	complete    map[string]bool
+	checkpoints map[string]journalRecord
+
+	mu sync.Mutex
+	// +checklocks:mu
+	f *os.File // nil until the first record is written
+	// +checklocks:mu
+	w *bufio.Writer
+}
+
+// newRestoreJournal returns a journal for the restore of the provided root entry or nil if journaling
+// is not enabled.
+func newRestoreJournal(ctx context.Context, output Output, rootEntry fs.Entry) (*restoreJournal, error) {
+	fso, ok := output.(*FilesystemOutput)
+	if !ok || !(fso.Journal || fso.Resume) {
+		return nil, nil
+	}
+
+	if _, isDir := rootEntry.(fs.Directory); !isDir {
+		log(ctx).Debug("restore journal is only supported when restoring directories")
+		return nil, nil
+	}
+
+	j := &restoreJournal{
+		output:          fso,
+		fname:           filepath.Join(fso.TargetPath, JournalFileName),
+		checkpointBytes: fso.JournalCheckpointBytes,
+		complete:        map[string]bool{},
+		checkpoints:     map[string]journalRecord{},
+	}
+
+	if j.checkpointBytes <= 0 {
+		j.checkpointBytes = defaultJournalCheckpointBytes
+	}
+
+	if hoid, ok := rootEntry.(object.HasObjectID); ok {
+		j.root = hoid.ObjectID().String()
+	}
+
+	if fso.Resume {
+		if err := j.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return j, nil
+}
+
+// load reads the journal left behind by an interrupted restore.
+func (j *restoreJournal) load(ctx context.Context) error {
+	f, err := os.Open(j.fname) //nolint:gosec
+	if os.IsNotExist(err) {
+		log(ctx).Warnf("restore journal not found in %v, restoring everything", j.output.TargetPath)
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to open restore journal")
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	s := bufio.NewScanner(f)
+	first := true
+
+	for s.Scan() {
+		var rec journalRecord
+
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			// the last record may have been partially written when the restore was interrupted.
+			log(ctx).Debugf("ignoring malformed restore journal record: %v", err)
+			continue
+		}
+
+		if first {
+			if rec.Root != j.root {
+				return errors.Errorf("restore journal in %v was written when restoring %v, not %v", j.output.TargetPath, rec.Root, j.root)
+			}
+
+			first = false
+
+			continue
+		}
+
+		if rec.Complete {
+			j.complete[rec.Path] = true
+		} else {
+			j.checkpoints[rec.Path] = rec
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return errors.Wrap(err, "error reading restore journal")
+	}
+
+	log(ctx).Infof("Resuming restore, %v entries have been restored and %v files have been partially written.", len(j.complete), len(j.checkpoints))
+
+	return nil
+}
+
+// isComplete returns true if the journal records the provided entry as restored and it is still present in the target.
+func (j *restoreJournal) isComplete(relativePath string, e fs.Entry) bool {
+	if !j.complete[relativePath] {
+		return false
+	}
+
+	st, err := os.Lstat(filepath.Join(j.output.TargetPath, filepath.FromSlash(relativePath)))
+	if err != nil {
+		return false
+	}
+
+	switch e := e.(type) {
+	case fs.Directory:
+		return st.IsDir()
+	case fs.Symlink:
+		return fileIsSymlink(st)
+	default:
+		return st.Mode().IsRegular() && st.Size() == e.Size()
+	}
+}
+
+// recordComplete records that the provided entry has been restored.
+func (j *restoreJournal) recordComplete(relativePath string) error {
+	if relativePath == "" {
+		// the restore is complete once the root is done, at which point the journal is removed.
+		return nil
+	}
+
+	return j.append(journalRecord{Path: relativePath, Complete: true}, false)
+}
+
+func (j *restoreJournal) append(rec journalRecord, flush bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		f, err := os.OpenFile(j.fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:gosec,mnd
+		if err != nil {
+			return errors.Wrap(err, "unable to create restore journal")
+		}
+
+		j.f = f
+		j.w = bufio.NewWriter(f)
+
+		// carry over the state of the resumed restore, so that it survives another interruption.
+		if err := j.writeHeaderLocked(); err != nil {
+			return err
+		}
+
+		if err := j.w.Flush(); err != nil {
+			return errors.Wrap(err, "unable to write restore journal")
+		}
+	}
+
+	if err := j.writeLocked(rec); err != nil {
+		return err
+	}
+
+	if !flush {
+		return nil
+	}
+
+	if err := j.w.Flush(); err != nil {
+		return errors.Wrap(err, "unable to write restore journal")
+	}
+
+	return errors.Wrap(j.f.Sync(), "unable to flush restore journal")
+}
+
+// +checklocks:j.mu
+func (j *restoreJournal) writeHeaderLocked() error {
+	if err := j.writeLocked(journalRecord{Root: j.root}); err != nil {
+		return err
+	}
+
+	for p := range j.complete {
+		if err := j.writeLocked(journalRecord{Path: p, Complete: true}); err != nil {
+			return err
+		}
+	}
+
+	for _, cp := range j.checkpoints {
+		if err := j.writeLocked(cp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// +checklocks:j.mu
+func (j *restoreJournal) writeLocked(rec journalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize restore journal record")
+	}
+
+	if _, err := j.w.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "unable to write restore journal")
+	}
+
+	return nil
+}
+
+// close closes the journal and removes it if the restore has completed.
+func (j *restoreJournal) close(completed bool) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var err error
+
+	if j.f != nil {
+		err = stderrors.Join(j.w.Flush(), j.f.Close())
+		j.f = nil
+	}
+
+	if !completed {
+		return errors.Wrap(err, "error closing restore journal")
+	}
+
+	if rerr := os.Remove(j.fname); rerr != nil && !os.IsNotExist(rerr) {
+		err = stderrors.Join(err, rerr)
+	}
+
+	return errors.Wrap(err, "error removing restore journal")
+}
+
+// checkpointsFile returns true if the provided file should be written with checkpoints.
+func (j *restoreJournal) checkpointsFile(f fs.File) bool {
+	return !j.output.WriteFilesAtomically && !j.output.WriteSparseFiles && f.Size() > j.checkpointBytes
+}
+
+// writeFile writes the provided file, recording checkpoints in the journal as it goes. If the journal has
+// a checkpoint for the file and the existing contents up to it are intact, writing continues from there.
+// Returns the number of bytes that did not need to be written.
+func (j *restoreJournal) writeFile(ctx context.Context, relativePath string, f fs.File, cancel chan struct{}, progressCb FileWriteProgress) (int64, error) {
+	o := j.output
+	path := filepath.Join(o.TargetPath, filepath.FromSlash(relativePath))
+	targetPath := ospath.SafeLongFilename(path)
+
+	start, h := j.resumeOffset(ctx, relativePath, targetPath)
+
+	if start == 0 && !o.OverwriteFiles {
+		if _, err := os.Lstat(targetPath); err == nil {
+			return 0, errors.Errorf("unable to create %q, it already exists", path)
+		}
+	}
+
+	if err := j.copyFrom(ctx, relativePath, targetPath, f, start, h, cancel, progressCb); err != nil {
+		return 0, err
+	}
+
+	if err := o.setAttributes(path, f, os.FileMode(0)); err != nil {
+		return 0, errors.Wrap(err, "error setting attributes")
+	}
+
+	return start, SafeRemoveAll(path)
+}
+
+func (j *restoreJournal) copyFrom(ctx context.Context, relativePath, targetPath string, f fs.File, start int64, h hash.Hash, cancel chan struct{}, progressCb FileWriteProgress) (err error) {
+	r, err := f.Open(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to open snapshot file for "+targetPath)
+	}
+	defer r.Close() //nolint:errcheck
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return errors.Wrap(err, "unable to seek snapshot file")
+	}
+
+	out, err := os.OpenFile(targetPath, os.O_RDWR|os.O_CREATE, 0o600) //nolint:gosec,mnd
+	if err != nil {
+		return errors.Wrap(err, "unable to open target file")
+	}
+
+	defer func() {
+		err = stderrors.Join(err, out.Close())
+	}()
+
+	if start == 0 {
+		if err := out.Truncate(0); err != nil {
+			return errors.Wrap(err, "unable to truncate target file")
+		}
+	}
+
+	if err := out.Truncate(f.Size()); err != nil {
+		return errors.Wrap(err, "unable to resize target file")
+	}
+
+	if _, err := out.Seek(start, io.SeekStart); err != nil {
+		return errors.Wrap(err, "unable to seek target file")
+	}
+
+	w := io.MultiWriter(out, h)
+	rr := &progressReportingReader{Reader: r, cb: progressCb}
+
+	for offset := start; offset < f.Size(); {
+		if isCancelled(cancel) {
+			return errRestoreCancelled
+		}
+
+		n, err := io.CopyN(w, rr, min(j.checkpointBytes, f.Size()-offset))
+		if err != nil {
+			return errors.Wrapf(err, "cannot write data to file %q", targetPath)
+		}
+
+		offset += n
+
+		if offset == f.Size() {
+			break
+		}
+
+		if err := out.Sync(); err != nil {
+			return errors.Wrapf(err, "cannot flush file %q", targetPath)
+		}
+
+		if err := j.append(journalRecord{Path: relativePath, Offset: offset, Hash: hex.EncodeToString(h.Sum(nil))}, true); err != nil {
+			return err
+		}
+	}
+
+	if j.output.FlushFiles {
+		return errors.Wrapf(out.Sync(), "cannot flush file %q", targetPath)
+	}
+
+	return nil
+}
+
+// resumeOffset returns the offset of the last checkpoint of the provided file if the existing contents
+// up to it match the checkpoint, along with the hash of those contents.
+func (j *restoreJournal) resumeOffset(ctx context.Context, relativePath, targetPath string) (int64, hash.Hash) {
+	h := sha256.New()
+
+	cp, ok := j.checkpoints[relativePath]
+	if !ok {
+		return 0, h
+	}
+
+	f, err := os.Open(targetPath) //nolint:gosec
+	if err != nil {
+		log(ctx).Debugf("unable to open partially written file %v: %v", targetPath, err)
+		return 0, h
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	if _, err := io.CopyN(h, f, cp.Offset); err != nil || hex.EncodeToString(h.Sum(nil)) != cp.Hash {
+		log(ctx).Infof("contents of partially written file %v have changed, restoring it from the beginning", targetPath)
+		return 0, sha256.New()
+	}
+
+	log(ctx).Debugf("resuming %v at offset %v", targetPath, cp.Offset)
+
+	return cp.Offset, h
+}
+
+func isCancelled(cancel chan struct{}) bool {
+	if cancel == nil {
+		return false
+	}
+
+	select {
+	case <-cancel:
+		return true
+	default:
+		return false
+	}
+}
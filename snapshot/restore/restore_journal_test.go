@@ -0,0 +1,163 @@
+package restore_test
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestJournaledRestoreResume(t *testing.T) {
+	ctx, te := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	const checkpointBytes = 1 << 20
+
+	data := make([]byte, 4*checkpointBytes)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	dir := mockfs.NewDirectory()
+	dir.AddDir("a", 0o755).AddFile("large", data, 0o644)
+	dir.AddDir("b", 0o755).AddFile("large", data, 0o644)
+
+	var man *snapshot.Manifest
+
+	require.NoError(t, repo.WriteSession(ctx, te.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		man, err = upload.NewUploader(w).Upload(ctx, dir, nil, te.LocalPathSourceInfo("/dummy/path"))
+		return err
+	}))
+
+	rootEntry, err := snapshotfs.SnapshotRoot(te.Repository, man)
+	require.NoError(t, err)
+
+	target := t.TempDir()
+
+	// doRestore restores the snapshot, cancelling the restore once the provided number of bytes has been restored.
+	doRestore := func(resume bool, cancelAfter int64) restore.Stats {
+		t.Helper()
+
+		out := &restore.FilesystemOutput{
+			TargetPath:             target,
+			OverwriteDirectories:   true,
+			OverwriteFiles:         true,
+			SkipOwners:             true,
+			Journal:                true,
+			Resume:                 resume,
+			JournalCheckpointBytes: checkpointBytes,
+		}
+		require.NoError(t, out.Init(ctx))
+
+		var cancelOnce sync.Once
+
+		cancel := make(chan struct{})
+
+		st, err := restore.Entry(ctx, te.Repository, out, rootEntry, restore.Options{
+			Parallel:               1,
+			RestoreDirEntryAtDepth: math.MaxInt32,
+			Cancel:                 cancel,
+			ProgressCallback: func(_ context.Context, s restore.Stats) {
+				if cancelAfter > 0 && s.RestoredTotalFileSize >= cancelAfter {
+					cancelOnce.Do(func() { close(cancel) })
+				}
+			},
+		})
+		require.NoError(t, err)
+
+		return st
+	}
+
+	verifyRestored := func() {
+		t.Helper()
+
+		for _, d := range []string{"a", "b"} {
+			restored, err := os.ReadFile(filepath.Join(target, d, "large"))
+			require.NoError(t, err)
+			require.Equal(t, data, restored)
+		}
+
+		require.NoFileExists(t, filepath.Join(target, restore.JournalFileName))
+	}
+
+	// interrupt the restore in the middle of the second file.
+	doRestore(false, 6*checkpointBytes+100)
+	require.FileExists(t, filepath.Join(target, restore.JournalFileName))
+
+	// resuming skips the directory that has been restored and continues the second file from the last
+	// checkpoint, which is the end of the chunk being written when the restore was cancelled.
+	stats := doRestore(true, 0)
+	require.Equal(t, int32(1), stats.SkippedCount)
+	require.Equal(t, int64(3*checkpointBytes), stats.DeltaSkippedTotalFileSize)
+	verifyRestored()
+
+	// partially written file whose contents have changed since the checkpoint is restored from the beginning.
+	target = t.TempDir()
+
+	doRestore(false, 2*checkpointBytes+100)
+
+	for _, d := range []string{"a", "b"} {
+		f, err := os.OpenFile(filepath.Join(target, d, "large"), os.O_RDWR, 0)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		require.NoError(t, err)
+		_, err = f.WriteAt([]byte{data[0] ^ 0xff}, 0)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	stats = doRestore(true, 0)
+	require.Zero(t, stats.DeltaSkippedTotalFileSize)
+	verifyRestored()
+}
+
+func TestJournaledRestoreResumeDifferentSnapshot(t *testing.T) {
+	ctx, te := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	target := t.TempDir()
+
+	var roots []*snapshot.Manifest
+
+	require.NoError(t, repo.WriteSession(ctx, te.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		for _, contents := range []string{"v1", "v2"} {
+			dir := mockfs.NewDirectory()
+			dir.AddFile("file", []byte(contents), 0o644)
+
+			man, err := upload.NewUploader(w).Upload(ctx, dir, nil, te.LocalPathSourceInfo("/dummy/path"))
+			require.NoError(t, err)
+
+			roots = append(roots, man)
+		}
+
+		return nil
+	}))
+
+	require.NoError(t, os.WriteFile(filepath.Join(target, restore.JournalFileName), []byte(`{"root":"`+roots[0].RootObjectID().String()+`"}`+"\n"), 0o600))
+
+	rootEntry, err := snapshotfs.SnapshotRoot(te.Repository, roots[1])
+	require.NoError(t, err)
+
+	out := &restore.FilesystemOutput{
+		TargetPath:           target,
+		OverwriteDirectories: true,
+		SkipOwners:           true,
+		Resume:               true,
+	}
+	require.NoError(t, out.Init(ctx))
+
+	_, err = restore.Entry(ctx, te.Repository, out, rootEntry, restore.Options{})
+	require.ErrorContains(t, err, "restore journal")
+}
@@ -0,0 +1,406 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+)
+
+const (
+	verifyReportKeyPurpose = "restore-verify-report"
+	verifyReportKeyLength  = 32
+
+	// verifyCompareWindowSize is the size of windows in which restored files are compared with data read from the repository.
+	verifyCompareWindowSize = 1 << 20
+)
+
+// VerifyStatus describes the result of verification of a single restored entry.
+type VerifyStatus string
+
+// Supported verification statuses.
+const (
+	VerifyStatusVerified VerifyStatus = "verified"
+	VerifyStatusMismatch VerifyStatus = "mismatch"
+	VerifyStatusSkipped  VerifyStatus = "skipped"
+)
+
+// VerifyReportEntry describes the result of verification of a single restored entry.
+type VerifyReportEntry struct {
+	Path     string       `json:"path"`
+	Type     string       `json:"type"`
+	ObjectID string       `json:"objectID,omitempty"`
+	Status   VerifyStatus `json:"status"`
+	Reason   string       `json:"reason,omitempty"`
+}
+
+// VerifyReport contains the results of verification of restored entries against the snapshot.
+// The report can be signed using a key derived from the repository, which allows checking
+// that it has not been modified afterwards by anyone without access to the repository.
+type VerifyReport struct {
+	Source     string              `json:"source,omitempty"`
+	Target     string              `json:"target,omitempty"`
+	StartTime  time.Time           `json:"startTime"`
+	EndTime    time.Time           `json:"endTime"`
+	Verified   int                 `json:"verified"`
+	Mismatches int                 `json:"mismatches"`
+	Skipped    int                 `json:"skipped"`
+	Entries    []VerifyReportEntry `json:"entries"`
+	Signature  string              `json:"signature,omitempty"`
+
+	mu sync.Mutex
+}
+
+func (r *VerifyReport) add(e VerifyReportEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Status {
+	case VerifyStatusVerified:
+		r.Verified++
+	case VerifyStatusMismatch:
+		r.Mismatches++
+	case VerifyStatusSkipped:
+		r.Skipped++
+	}
+
+	r.Entries = append(r.Entries, e)
+}
+
+func (r *VerifyReport) computeSignature(rep repo.Repository) ([]byte, error) {
+	dr, ok := rep.(repo.DirectRepository)
+	if !ok {
+		return nil, errors.New("signing verification reports requires direct repository access")
+	}
+
+	key, err := dr.DeriveKey(verifyReportKeyPurpose, verifyReportKeyLength)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to derive signing key")
+	}
+
+	unsigned := VerifyReport{
+		Source:     r.Source,
+		Target:     r.Target,
+		StartTime:  r.StartTime,
+		EndTime:    r.EndTime,
+		Verified:   r.Verified,
+		Mismatches: r.Mismatches,
+		Skipped:    r.Skipped,
+		Entries:    r.Entries,
+	}
+
+	b, err := json.Marshal(&unsigned) //nolint:musttag
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to serialize report")
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write(b)
+
+	return h.Sum(nil), nil
+}
+
+// Sign signs the report using a key derived from the repository.
+func (r *VerifyReport) Sign(rep repo.Repository) error {
+	sig, err := r.computeSignature(rep)
+	if err != nil {
+		return err
+	}
+
+	r.Signature = hex.EncodeToString(sig)
+
+	return nil
+}
+
+// VerifySignature returns an error if the report has not been signed using the key derived from the repository.
+func (r *VerifyReport) VerifySignature(rep repo.Repository) error {
+	expected, err := r.computeSignature(rep)
+	if err != nil {
+		return err
+	}
+
+	actual, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature")
+	}
+
+	if !hmac.Equal(actual, expected) {
+		return errors.New("report signature does not match")
+	}
+
+	return nil
+}
+
+// restoreVerifier reads back restored entries and compares them against the snapshot.
+type restoreVerifier struct {
+	output *FilesystemOutput
+	hasher *contentHasher // nil when contents are compared against data read from the repository
+	report *VerifyReport
+}
+
+func newRestoreVerifier(rep repo.Repository, output Output, report *VerifyReport) (*restoreVerifier, error) {
+	fso, ok := output.(*FilesystemOutput)
+	if !ok {
+		return nil, errors.New("verification is only supported when restoring to a local filesystem")
+	}
+
+	if report == nil {
+		report = &VerifyReport{}
+	}
+
+	return &restoreVerifier{
+		output: fso,
+		hasher: newContentHasher(rep),
+		report: report,
+	}, nil
+}
+
+func objectIDString(e fs.Entry) string {
+	if h, ok := e.(object.HasObjectID); ok {
+		return h.ObjectID().String()
+	}
+
+	return ""
+}
+
+// verifyFile verifies the restored file and records the result in the report.
+func (v *restoreVerifier) verifyFile(ctx context.Context, relativePath string, f fs.File) VerifyStatus {
+	entry := VerifyReportEntry{
+		Path:     relativePath,
+		Type:     "file",
+		ObjectID: objectIDString(f),
+		Status:   VerifyStatusVerified,
+	}
+
+	if reason := v.compareFile(ctx, filepath.Join(v.output.TargetPath, filepath.FromSlash(relativePath)), f); reason != "" {
+		log(ctx).Errorf("verification of %v failed: %v", relativePath, reason)
+
+		entry.Status = VerifyStatusMismatch
+		entry.Reason = reason
+	}
+
+	v.report.add(entry)
+
+	return entry.Status
+}
+
+// verifySymlink verifies the restored symbolic link and records the result in the report.
+func (v *restoreVerifier) verifySymlink(ctx context.Context, relativePath string, l fs.Symlink) VerifyStatus {
+	entry := VerifyReportEntry{
+		Path:     relativePath,
+		Type:     "symlink",
+		ObjectID: objectIDString(l),
+		Status:   VerifyStatusVerified,
+	}
+
+	if reason := v.compareSymlink(ctx, filepath.Join(v.output.TargetPath, filepath.FromSlash(relativePath)), l); reason != "" {
+		log(ctx).Errorf("verification of %v failed: %v", relativePath, reason)
+
+		entry.Status = VerifyStatusMismatch
+		entry.Reason = reason
+	}
+
+	v.report.add(entry)
+
+	return entry.Status
+}
+
+// skip records the entry that could not be verified in the report.
+func (v *restoreVerifier) skip(relativePath string, e fs.Entry, reason string) VerifyStatus {
+	v.report.add(VerifyReportEntry{
+		Path:     relativePath,
+		Type:     entryType(e),
+		ObjectID: objectIDString(e),
+		Status:   VerifyStatusSkipped,
+		Reason:   reason,
+	})
+
+	return VerifyStatusSkipped
+}
+
+func entryType(e fs.Entry) string {
+	switch e.(type) {
+	case fs.Directory:
+		return "directory"
+	case fs.Symlink:
+		return "symlink"
+	default:
+		return "file"
+	}
+}
+
+// compareFile returns the reason why the local file does not match the snapshot file or an empty string if it does.
+func (v *restoreVerifier) compareFile(ctx context.Context, path string, f fs.File) string {
+	le, err := localfs.NewEntry(path)
+	if err != nil {
+		return fmt.Sprintf("unable to read file: %v", err)
+	}
+
+	if !le.Mode().IsRegular() {
+		return "not a regular file"
+	}
+
+	if le.Size() != f.Size() {
+		return fmt.Sprintf("size is %v, expected %v", le.Size(), f.Size())
+	}
+
+	if reason := v.compareFileContents(ctx, path, f); reason != "" {
+		return reason
+	}
+
+	switch {
+	case v.output.shouldUpdateOwner(le, f):
+		return "owner does not match"
+	case v.output.shouldUpdatePermissions(le, f, 0):
+		return fmt.Sprintf("permissions are %v, expected %v", le.Mode()&fs.ModBits, f.Mode()&fs.ModBits)
+	case !v.output.SkipTimes && !modTimesMatch(le.ModTime(), f.ModTime()):
+		return fmt.Sprintf("modification time is %v, expected %v", le.ModTime(), f.ModTime())
+	}
+
+	return ""
+}
+
+// modTimesMatch returns true if the modification times are equal within the precision of common filesystems.
+func modTimesMatch(t1, t2 time.Time) bool {
+	d := t1.Sub(t2)
+	if d < 0 {
+		d = -d
+	}
+
+	return d < maxTimeDeltaToConsiderFileTheSame
+}
+
+func (v *restoreVerifier) compareFileContents(ctx context.Context, path string, f fs.File) string {
+	var (
+		chunks []object.IndirectObjectEntry
+		err    error
+	)
+
+	if v.hasher != nil {
+		if chunks, err = v.hasher.chunkLayout(ctx, f); err != nil {
+			return fmt.Sprintf("unable to determine file layout: %v", err)
+		}
+	}
+
+	if chunks == nil {
+		chunks = []object.IndirectObjectEntry{{Start: 0, Length: f.Size()}}
+	}
+
+	local, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return fmt.Sprintf("unable to open file: %v", err)
+	}
+	defer local.Close() //nolint:errcheck
+
+	var (
+		snap fs.Reader
+		buf  []byte
+	)
+
+	defer func() {
+		if snap != nil {
+			snap.Close() //nolint:errcheck
+		}
+	}()
+
+	for _, ch := range chunks {
+		if v.hasher != nil && canHash(ch) {
+			// chunks stored in contents are bounded by the splitter, hash them as a whole.
+			if int64(cap(buf)) < ch.Length {
+				buf = make([]byte, ch.Length)
+			}
+
+			buf = buf[:ch.Length]
+
+			if _, err := local.ReadAt(buf, ch.Start); err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Sprintf("unable to read file: %v", err)
+			}
+
+			if !v.hasher.matchesChunk(ch, buf) {
+				return fmt.Sprintf("contents differ at offset %v", ch.Start)
+			}
+
+			continue
+		}
+
+		// compare against data read from the repository.
+		if snap == nil {
+			if snap, err = f.Open(ctx); err != nil {
+				return fmt.Sprintf("unable to open snapshot file: %v", err)
+			}
+		}
+
+		if _, err := snap.Seek(ch.Start, io.SeekStart); err != nil {
+			return fmt.Sprintf("unable to seek snapshot file: %v", err)
+		}
+
+		if reason := compareRangeWithSnapshot(local, snap, ch.Start, ch.Length); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+// compareRangeWithSnapshot compares the range of the local file with data read from the snapshot reader
+// positioned at the start of the range. The range may span the entire file, so it's compared in
+// fixed-size windows to bound memory usage.
+func compareRangeWithSnapshot(local io.ReaderAt, snap io.Reader, start, length int64) string {
+	n := min(length, verifyCompareWindowSize)
+	localData := make([]byte, n)
+	snapData := make([]byte, n)
+
+	for pos, end := start, start+length; pos < end; {
+		w := min(end-pos, n)
+
+		if _, err := local.ReadAt(localData[:w], pos); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Sprintf("unable to read file: %v", err)
+		}
+
+		if _, err := io.ReadFull(snap, snapData[:w]); err != nil {
+			return fmt.Sprintf("unable to read snapshot file: %v", err)
+		}
+
+		if !bytes.Equal(localData[:w], snapData[:w]) {
+			return fmt.Sprintf("contents differ at offset %v", pos)
+		}
+
+		pos += w
+	}
+
+	return ""
+}
+
+// compareSymlink returns the reason why the local symbolic link does not match the snapshot or an empty string if it does.
+func (v *restoreVerifier) compareSymlink(ctx context.Context, path string, l fs.Symlink) string {
+	expected, err := l.Readlink(ctx)
+	if err != nil {
+		return fmt.Sprintf("unable to read snapshot symlink: %v", err)
+	}
+
+	actual, err := os.Readlink(path)
+	if err != nil {
+		return fmt.Sprintf("unable to read symlink: %v", err)
+	}
+
+	if actual != expected {
+		return fmt.Sprintf("symlink target is %q, expected %q", actual, expected)
+	}
+
+	return ""
+}
@@ -0,0 +1,189 @@
+package restore_test
+
+import (
+	"context"
+	"crypto/rand"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestVerifiedRestore(t *testing.T) {
+	ctx, te := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("file1", []byte("hello"), 0o644)
+	dir.AddDir("sub", 0o755)
+	dir.AddFile("sub/file2", []byte("world"), 0o600)
+	dir.AddSymlink("link", "file1", 0o777)
+
+	var man *snapshot.Manifest
+
+	require.NoError(t, repo.WriteSession(ctx, te.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		var err error
+
+		man, err = upload.NewUploader(w).Upload(ctx, dir, nil, te.LocalPathSourceInfo("/dummy/path"))
+
+		return err
+	}))
+
+	rootEntry, err := snapshotfs.SnapshotRoot(te.Repository, man)
+	require.NoError(t, err)
+
+	target := t.TempDir()
+
+	doRestore := func(incremental bool) (restore.Stats, *restore.VerifyReport) {
+		t.Helper()
+
+		out := &restore.FilesystemOutput{
+			TargetPath:           target,
+			OverwriteDirectories: true,
+			OverwriteFiles:       true,
+			OverwriteSymlinks:    true,
+			SkipOwners:           true,
+		}
+		require.NoError(t, out.Init(ctx))
+
+		report := &restore.VerifyReport{}
+
+		st, err := restore.Entry(ctx, te.Repository, out, rootEntry, restore.Options{
+			RestoreDirEntryAtDepth: math.MaxInt32,
+			Incremental:            incremental,
+			Verify:                 true,
+			VerifyReport:           report,
+		})
+		require.NoError(t, err)
+
+		return st, report
+	}
+
+	st, report := doRestore(false)
+	require.EqualValues(t, 3, st.VerifiedCount)
+	require.Zero(t, st.VerifyMismatchCount)
+	require.Equal(t, 3, report.Verified)
+	require.Len(t, report.Entries, 3)
+	require.Equal(t, target, report.Target)
+
+	// modify contents without changing size and modification time, so that incremental restore skips the file.
+	fname := filepath.Join(target, "sub", "file2")
+	st2, err := os.Stat(fname)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fname, []byte("WORLD"), 0o600))
+	require.NoError(t, os.Chtimes(fname, time.Now(), st2.ModTime()))
+
+	st, report = doRestore(true)
+	require.EqualValues(t, 2, st.VerifiedCount)
+	require.EqualValues(t, 1, st.VerifyMismatchCount)
+	require.Equal(t, 1, report.Mismatches)
+
+	for _, e := range report.Entries {
+		if e.Path == "sub/file2" {
+			require.Equal(t, restore.VerifyStatusMismatch, e.Status)
+			require.Contains(t, e.Reason, "contents differ")
+		}
+	}
+
+	require.NoError(t, report.Sign(te.Repository))
+	require.NotEmpty(t, report.Signature)
+	require.NoError(t, report.VerifySignature(te.Repository))
+
+	report.Mismatches = 0
+	require.Error(t, report.VerifySignature(te.Repository))
+
+	// verification is not supported for other outputs.
+	_, err = restore.Entry(ctx, te.Repository, &restore.TarOutput{}, rootEntry, restore.Options{Verify: true})
+	require.ErrorContains(t, err, "only supported when restoring to a local filesystem")
+}
+
+// indirectRepository hides the direct repository interface, like repositories connected to a repository server,
+// so that restored files are verified against data read from the repository.
+type indirectRepository struct {
+	repo.Repository
+}
+
+func TestVerifiedRestore_ComparesLargeFilesWithRepositoryData(t *testing.T) {
+	ctx, te := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	// the file spans multiple comparison windows.
+	data := make([]byte, 3<<20+123)
+	rand.Read(data)
+
+	dir := mockfs.NewDirectory()
+	dir.AddFile("large", data, 0o644)
+
+	var man *snapshot.Manifest
+
+	require.NoError(t, repo.WriteSession(ctx, te.Repository, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+		var err error
+
+		man, err = upload.NewUploader(w).Upload(ctx, dir, nil, te.LocalPathSourceInfo("/dummy/path"))
+
+		return err
+	}))
+
+	rep := indirectRepository{te.Repository}
+
+	rootEntry, err := snapshotfs.SnapshotRoot(rep, man)
+	require.NoError(t, err)
+
+	target := t.TempDir()
+
+	doRestore := func(incremental bool) *restore.VerifyReport {
+		t.Helper()
+
+		out := &restore.FilesystemOutput{
+			TargetPath:           target,
+			OverwriteDirectories: true,
+			OverwriteFiles:       true,
+			SkipOwners:           true,
+		}
+		require.NoError(t, out.Init(ctx))
+
+		report := &restore.VerifyReport{}
+
+		_, err := restore.Entry(ctx, rep, out, rootEntry, restore.Options{
+			RestoreDirEntryAtDepth: math.MaxInt32,
+			Incremental:            incremental,
+			Verify:                 true,
+			VerifyReport:           report,
+		})
+		require.NoError(t, err)
+
+		return report
+	}
+
+	report := doRestore(false)
+	require.Equal(t, 1, report.Verified)
+	require.Zero(t, report.Mismatches)
+
+	// modify a byte in the third window without changing size and modification time.
+	fname := filepath.Join(target, "large")
+	st, err := os.Stat(fname)
+	require.NoError(t, err)
+
+	data[2<<20+5] ^= 0xff
+	require.NoError(t, os.WriteFile(fname, data, 0o644))
+	require.NoError(t, os.Chtimes(fname, time.Now(), st.ModTime()))
+
+	report = doRestore(true)
+	require.Equal(t, 1, report.Mismatches)
+
+	for _, e := range report.Entries {
+		if e.Path == "large" {
+			require.Equal(t, restore.VerifyStatusMismatch, e.Status)
+			require.Equal(t, "contents differ at offset 2097152", e.Reason)
+		}
+	}
+}
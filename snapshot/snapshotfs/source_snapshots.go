@@ -99,4 +99,15 @@ func (s *sourceSnapshots) Iterate(ctx context.Context) (fs.DirectoryIterator, er
 	return fs.StaticIterator(entries, nil), nil
 }
 
+// SnapshotSourceOf returns the source whose snapshots are listed by the provided directory, which is
+// a grandchild of AllSourcesEntry().
+func SnapshotSourceOf(e fs.Entry) (snapshot.SourceInfo, bool) {
+	s, ok := e.(*sourceSnapshots)
+	if !ok {
+		return snapshot.SourceInfo{}, false
+	}
+
+	return s.src, true
+}
+
 var _ fs.Directory = (*sourceSnapshots)(nil)
@@ -0,0 +1,275 @@
+package snapshotfs
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+)
+
+// TimeTravelSnapshotsDir is the name of the virtual directory present in each directory of TimeTravelView(),
+// which lists versions of the directory from all snapshots. It shadows real entries with the same name.
+const TimeTravelSnapshotsDir = ".snapshots"
+
+// TimeTravelView returns a view of the sources returned by AllSourcesEntry() which is organized by path first.
+// Each source directory presents the contents of the latest complete snapshot of the source and every
+// directory contains a virtual '.snapshots' directory with the versions of that directory in all snapshots,
+// named by snapshot start time, similar to '.zfs/snapshot'.
+func TimeTravelView(allSources fs.Directory) fs.Directory {
+	return &mappedDirectory{allSources, func(_ context.Context, userHost fs.Entry) (fs.Entry, error) {
+		d, ok := userHost.(fs.Directory)
+		if !ok {
+			return userHost, nil
+		}
+
+		return &mappedDirectory{d, newTimeTravelSource}, nil
+	}}
+}
+
+// mappedDirectory is a directory whose children are transformed by the provided function.
+type mappedDirectory struct {
+	fs.Directory
+
+	mapChild func(ctx context.Context, e fs.Entry) (fs.Entry, error)
+}
+
+func (d *mappedDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	e, err := d.Directory.Child(ctx, name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return d.mapChild(ctx, e)
+}
+
+func (d *mappedDirectory) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	entries, err := fs.GetAllEntries(ctx, d.Directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list directory")
+	}
+
+	for i, e := range entries {
+		if entries[i], err = d.mapChild(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+
+	return fs.StaticIterator(entries, nil), nil
+}
+
+// newTimeTravelSource returns the time travel directory for a directory containing all snapshots of a source.
+func newTimeTravelSource(ctx context.Context, src fs.Entry) (fs.Entry, error) {
+	srcDir, ok := src.(fs.Directory)
+	if !ok {
+		return src, nil
+	}
+
+	versions, err := fs.GetAllEntries(ctx, srcDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list snapshots of %v", src.Name())
+	}
+
+	// snapshot names start with their timestamp, so they sort chronologically.
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Name() < versions[j].Name()
+	})
+
+	d := &timeTravelDirectory{Entry: src, versions: versions}
+
+	for _, v := range slices.Backward(versions) {
+		// skip incomplete snapshots, whose names have the reason appended.
+		if vd, ok := v.(fs.Directory); ok && !strings.Contains(v.Name(), " ") {
+			d.current = vd
+			break
+		}
+	}
+
+	return d, nil
+}
+
+// timeTravelDirectory presents the contents of a directory in the latest snapshot along with the virtual
+// directory listing versions of the same directory in all snapshots.
+type timeTravelDirectory struct {
+	fs.Entry
+
+	current  fs.Directory // nil if not present in the latest snapshot
+	versions []fs.Entry   // roots of all snapshots of the source
+	relPath  []string     // path relative to the root of the source
+}
+
+func (d *timeTravelDirectory) SupportsMultipleIterations() bool {
+	return true
+}
+
+func (d *timeTravelDirectory) Child(ctx context.Context, name string) (fs.Entry, error) {
+	if name == TimeTravelSnapshotsDir {
+		return d.snapshotsDir(), nil
+	}
+
+	if d.current == nil {
+		return nil, fs.ErrEntryNotFound
+	}
+
+	e, err := d.current.Child(ctx, name)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return d.wrap(e), nil
+}
+
+func (d *timeTravelDirectory) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	entries := []fs.Entry{d.snapshotsDir()}
+
+	if d.current != nil {
+		if err := fs.IterateEntries(ctx, d.current, func(_ context.Context, e fs.Entry) error {
+			if e.Name() != TimeTravelSnapshotsDir {
+				entries = append(entries, d.wrap(e))
+			}
+
+			return nil
+		}); err != nil {
+			return nil, errors.Wrap(err, "unable to list directory")
+		}
+	}
+
+	return fs.StaticIterator(entries, nil), nil
+}
+
+func (d *timeTravelDirectory) wrap(e fs.Entry) fs.Entry {
+	dir, ok := e.(fs.Directory)
+	if !ok {
+		return e
+	}
+
+	return &timeTravelDirectory{
+		Entry:    dir,
+		current:  dir,
+		versions: d.versions,
+		relPath:  append(slices.Clone(d.relPath), e.Name()),
+	}
+}
+
+func (d *timeTravelDirectory) snapshotsDir() fs.Directory {
+	return &timeTravelVersions{d.Entry, d.versions, d.relPath}
+}
+
+// timeTravelVersions is a virtual directory listing versions of a directory in all snapshots of a source.
+type timeTravelVersions struct {
+	fs.Entry // metadata of the parent directory
+
+	versions []fs.Entry
+	relPath  []string
+}
+
+func (v *timeTravelVersions) Name() string {
+	return TimeTravelSnapshotsDir
+}
+
+func (v *timeTravelVersions) IsDir() bool {
+	return true
+}
+
+func (v *timeTravelVersions) Mode() os.FileMode {
+	return 0o555 | os.ModeDir //nolint:mnd
+}
+
+func (v *timeTravelVersions) Size() int64 {
+	return 0
+}
+
+func (v *timeTravelVersions) LocalFilesystemPath() string {
+	return ""
+}
+
+func (v *timeTravelVersions) SupportsMultipleIterations() bool {
+	return true
+}
+
+func (v *timeTravelVersions) Child(ctx context.Context, name string) (fs.Entry, error) {
+	for _, root := range v.versions {
+		if root.Name() != name {
+			continue
+		}
+
+		e, err := v.versionOf(ctx, root)
+		if err != nil || e == nil {
+			return nil, fs.ErrEntryNotFound
+		}
+
+		return e, nil
+	}
+
+	return nil, fs.ErrEntryNotFound
+}
+
+func (v *timeTravelVersions) Iterate(ctx context.Context) (fs.DirectoryIterator, error) {
+	var entries []fs.Entry
+
+	for _, root := range v.versions {
+		e, err := v.versionOf(ctx, root)
+		if err != nil {
+			return nil, err
+		}
+
+		if e != nil {
+			entries = append(entries, e)
+		}
+	}
+
+	return fs.StaticIterator(entries, nil), nil
+}
+
+// versionOf returns the directory in the provided snapshot named after the snapshot or nil if the
+// snapshot does not have that directory.
+func (v *timeTravelVersions) versionOf(ctx context.Context, root fs.Entry) (fs.Entry, error) {
+	current := root
+
+	for _, p := range v.relPath {
+		d, ok := current.(fs.Directory)
+		if !ok {
+			return nil, nil
+		}
+
+		e, err := d.Child(ctx, p)
+		if errors.Is(err, fs.ErrEntryNotFound) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %v", root.Name())
+		}
+
+		current = e
+	}
+
+	d, ok := current.(fs.Directory)
+	if !ok {
+		return nil, nil
+	}
+
+	return &renamedDirectory{d, root.Name()}, nil
+}
+
+// renamedDirectory is a directory presented under a different name.
+type renamedDirectory struct {
+	fs.Directory
+
+	name string
+}
+
+func (d *renamedDirectory) Name() string {
+	return d.name
+}
+
+var (
+	_ fs.Directory = (*mappedDirectory)(nil)
+	_ fs.Directory = (*timeTravelDirectory)(nil)
+	_ fs.Directory = (*timeTravelVersions)(nil)
+	_ fs.Directory = (*renamedDirectory)(nil)
+)
@@ -0,0 +1,96 @@
+package snapshotfs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/snapshot/upload"
+)
+
+func TestTimeTravelView(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{UserName: "some-user", Host: "some-host", Path: "/data"}
+	u := upload.NewUploader(env.RepositoryWriter)
+
+	v1 := mockfs.NewDirectory()
+	v1.AddDir("a", 0o755)
+	v1.AddFile("a/f1", []byte{1}, 0o644)
+	v1.AddDir("b", 0o755)
+
+	man1, err := u.Upload(ctx, v1, nil, src)
+	require.NoError(t, err)
+
+	v2 := mockfs.NewDirectory()
+	v2.AddDir("a", 0o755)
+	v2.AddFile("a/f1", []byte{1}, 0o644)
+	v2.AddFile("a/f2", []byte{2}, 0o644)
+	v2.AddDir("c", 0o755)
+
+	man2, err := u.Upload(ctx, v2, nil, src)
+	require.NoError(t, err)
+
+	mustWriteSnapshotManifest(ctx, t, env.RepositoryWriter, src, fs.UTCTimestampFromTime(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)), man1)
+	mustWriteSnapshotManifest(ctx, t, env.RepositoryWriter, src, fs.UTCTimestampFromTime(time.Date(2020, 1, 2, 10, 0, 0, 0, time.UTC)), man2)
+
+	view := snapshotfs.TimeTravelView(snapshotfs.AllSourcesEntry(env.RepositoryWriter))
+
+	require.Equal(t, map[string]struct{}{
+		"some-user@some-host/":                                     {},
+		"some-user@some-host/data/":                                {},
+		"some-user@some-host/data/.snapshots/":                     {},
+		"some-user@some-host/data/.snapshots/20200101-100000/":     {},
+		"some-user@some-host/data/.snapshots/20200101-100000/a/":   {},
+		"some-user@some-host/data/.snapshots/20200101-100000/a/f1": {},
+		"some-user@some-host/data/.snapshots/20200101-100000/b/":   {},
+		"some-user@some-host/data/.snapshots/20200102-100000/":     {},
+		"some-user@some-host/data/.snapshots/20200102-100000/a/":   {},
+		"some-user@some-host/data/.snapshots/20200102-100000/a/f1": {},
+		"some-user@some-host/data/.snapshots/20200102-100000/a/f2": {},
+		"some-user@some-host/data/.snapshots/20200102-100000/c/":   {},
+		"some-user@some-host/data/a/":                              {},
+		"some-user@some-host/data/a/f1":                            {},
+		"some-user@some-host/data/a/f2":                            {},
+		"some-user@some-host/data/a/.snapshots/":                   {},
+		"some-user@some-host/data/a/.snapshots/20200101-100000/":   {},
+		"some-user@some-host/data/a/.snapshots/20200101-100000/f1": {},
+		"some-user@some-host/data/a/.snapshots/20200102-100000/":   {},
+		"some-user@some-host/data/a/.snapshots/20200102-100000/f1": {},
+		"some-user@some-host/data/a/.snapshots/20200102-100000/f2": {},
+		"some-user@some-host/data/c/":                              {},
+		"some-user@some-host/data/c/.snapshots/":                   {},
+		"some-user@some-host/data/c/.snapshots/20200102-100000/":   {},
+	}, iterateAllNames(ctx, t, view, ""))
+
+	// directory removed in the latest snapshot is only reachable through versions of its parent.
+	e, err := snapshotfs.GetNestedEntry(ctx, view, []string{"some-user@some-host", "data", "b"})
+	require.ErrorIs(t, err, fs.ErrEntryNotFound)
+	require.Nil(t, e)
+
+	e, err = snapshotfs.GetNestedEntry(ctx, view, []string{"some-user@some-host", "data", "a", snapshotfs.TimeTravelSnapshotsDir, "20200101-100000", "f1"})
+	require.NoError(t, err)
+	require.Equal(t, "f1", e.Name())
+
+	_, err = snapshotfs.GetNestedEntry(ctx, view, []string{"some-user@some-host", "data", "c", snapshotfs.TimeTravelSnapshotsDir, "20200101-100000"})
+	require.ErrorIs(t, err, fs.ErrEntryNotFound)
+
+	// incomplete snapshots are listed as versions but are never presented as current contents.
+	man3, err := u.Upload(ctx, v1, nil, src)
+	require.NoError(t, err)
+
+	man3.IncompleteReason = "checkpoint"
+	mustWriteSnapshotManifest(ctx, t, env.RepositoryWriter, src, fs.UTCTimestampFromTime(time.Date(2020, 1, 3, 10, 0, 0, 0, time.UTC)), man3)
+
+	_, err = snapshotfs.GetNestedEntry(ctx, view, []string{"some-user@some-host", "data", "c"})
+	require.NoError(t, err)
+
+	_, err = snapshotfs.GetNestedEntry(ctx, view, []string{"some-user@some-host", "data", snapshotfs.TimeTravelSnapshotsDir, "20200103-100000 (checkpoint)", "b"})
+	require.NoError(t, err)
+}
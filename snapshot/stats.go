@@ -34,6 +34,12 @@ type Stats struct {
 	IgnoredErrorCount int32 `json:"ignoredErrorCount"`
 	// +checkatomic
 	ErrorCount int32 `json:"errorCount"`
+
+	// +checkatomic
+	ResumedDirectoryCount int32 `json:"resumedDirCount,omitempty"`
+
+	// +checkatomic
+	UnchangedDirectoryCount int32 `json:"unchangedDirCount,omitempty"`
 }
 
 // AddExcluded adds the information about excluded file to the statistics.
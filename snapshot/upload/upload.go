@@ -22,6 +22,7 @@
 
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/ignorefs"
+	"github.com/kopia/kopia/fs/virtualfs"
 	"github.com/kopia/kopia/internal/contentlog"
 	"github.com/kopia/kopia/internal/contentlog/logparam"
 	"github.com/kopia/kopia/internal/iocopy"
@@ -98,6 +99,14 @@ type Uploader struct {
 	// Labels to apply to every checkpoint made for this snapshot.
 	CheckpointLabels map[string]string
 
+	// When set to true, directories completed by the most recent incomplete snapshot
+	// (checkpoint or canceled) are reused without scanning them again.
+	Resume bool
+
+	// When set, directories reported as unchanged by the journal are reused from previous
+	// snapshots without scanning them.
+	ChangeJournal ChangeJournal
+
 	repo repo.RepositoryWriter
 
 	// stats must be allocated on heap to enforce 64-bit alignment due to atomic access on ARM.
@@ -116,6 +125,9 @@ type Uploader struct {
 	workerPool *workshare.Pool[*uploadWorkItem]
 
 	traceEnabled bool
+
+	// directories completed by the snapshot being resumed, read-only during upload.
+	resumeFrontier resumeFrontier
 }
 
 // IsCanceled returns true if the upload is canceled.
@@ -633,6 +645,13 @@ func (u *Uploader) uploadDirWithCheckpointing(ctx context.Context, rootDir fs.Di
 		rootDir = u.wrapIgnorefs(uploadLog(ctx), overrideDir, policyTree, true)
 	}
 
+	streamEntries, err := u.streamSourceEntries(ctx, policyTree.EffectivePolicy().Actions.StreamSources, localDirPathOrEmpty, &hc)
+	if err != nil {
+		return nil, dirReadError{errors.Wrap(err, "error preparing stream sources")}
+	}
+
+	rootDir = virtualfs.NewDirectoryWithExtraEntries(rootDir, streamEntries)
+
 	return uploadDirInternal(ctx, u, rootDir, policyTree, previousDirs, localDirPathOrEmpty, ".", &dmb, &cp)
 }
 
@@ -871,6 +890,18 @@ func (u *Uploader) processSingle(
 
 	switch entry := entry.(type) {
 	case fs.Directory:
+		if de := u.maybeResumeDirectory(entryRelativePath, entry); de != nil {
+			parentDirBuilder.AddEntry(de)
+
+			return nil
+		}
+
+		if de := u.maybeReuseUnchangedDirectory(ctx, entryRelativePath, entry, prevDirs); de != nil {
+			parentDirBuilder.AddEntry(de)
+
+			return nil
+		}
+
 		childDirBuilder := &snapshotfs.DirManifestBuilder{}
 
 		childLocalDirPathOrEmpty := ""
@@ -962,8 +993,11 @@ func (u *Uploader) processSingle(
 
 		de, err := u.uploadStreamingFileInternal(ctx, entryRelativePath, entry, policyTree.Child(entry.Name()).EffectivePolicy())
 
+		// failures of essential stream sources must not be silently dropped from the snapshot.
+		isIgnored := policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false) && !errors.Is(err, errStreamSourceFailed)
+
 		return u.processEntryUploadResult(ctx, de, err, entryRelativePath, parentDirBuilder,
-			policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
+			isIgnored,
 			u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
 			"snapshotted streaming file", t0)
 
@@ -1311,6 +1345,20 @@ func (u *Uploader) Upload(
 
 	u.stats = &snapshot.Stats{}
 	u.totalWrittenBytes.Store(0)
+	u.resumeFrontier = nil
+
+	if u.Resume {
+		if m := latestIncompleteManifest(previousManifests); m != nil {
+			f, err := loadResumeFrontier(ctx, u.repo, m)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to load state of interrupted snapshot")
+			}
+
+			uploadLog(ctx).Infof("resuming snapshot started at %v, skipping %v completed directories", m.StartTime.Format(time.RFC3339), len(f))
+
+			u.resumeFrontier = f
+		}
+	}
 
 	var err error
 
@@ -0,0 +1,48 @@
+package upload
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// ChangeJournal reports directories that are known not to have changed since previous snapshots
+// were taken.
+type ChangeJournal interface {
+	// IsUnchanged returns true if the directory with a given slash-separated path relative to the
+	// snapshot root and all its descendants have not changed.
+	IsUnchanged(relPath string) bool
+}
+
+// maybeReuseUnchangedDirectory returns the entry of the directory from a previous snapshot if the change
+// journal reports that the directory has not changed since, or nil.
+func (u *Uploader) maybeReuseUnchangedDirectory(ctx context.Context, entryRelativePath string, dir fs.Directory, prevDirs []fs.Directory) *snapshot.DirEntry {
+	if u.ChangeJournal == nil || !u.ChangeJournal.IsUnchanged(entryRelativePath) {
+		return nil
+	}
+
+	for _, pd := range prevDirs {
+		e, err := pd.Child(ctx, dir.Name())
+		if err != nil {
+			continue
+		}
+
+		hde, ok := e.(snapshot.HasDirEntry)
+		if !ok {
+			continue
+		}
+
+		de := hde.DirEntry()
+		if !isResumableDirEntry(de) {
+			continue
+		}
+
+		atomic.AddInt32(&u.stats.UnchangedDirectoryCount, int32(de.DirSummary.TotalDirCount)) //nolint:gosec
+
+		return u.reuseCompletedDirectory(entryRelativePath, de)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package upload
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/localfs"
+	"github.com/kopia/kopia/internal/linuxsnapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func osSnapshotMode(p *policy.OSSnapshotPolicy) policy.OSSnapshotMode {
+	return p.LinuxSnapshot.Enable.OrDefault(policy.OSSnapshotNever)
+}
+
+//nolint:wrapcheck
+func createOSSnapshot(ctx context.Context, root fs.Directory, p *policy.OSSnapshotPolicy) (newRoot fs.Directory, cleanup func(), finalErr error) {
+	local := root.LocalFilesystemPath()
+	if local == "" {
+		return nil, nil, errors.New("not a local filesystem")
+	}
+
+	snap, err := linuxsnapshot.New().Create(ctx, local, p.LinuxSnapshot.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		if finalErr != nil {
+			snap.Release(ctx) //nolint:errcheck
+		}
+	}()
+
+	newRoot, err = localfs.Directory(snap.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uploadLog(ctx).Debugf("file system snapshot root is %s", newRoot.LocalFilesystemPath())
+
+	cleanup = func() {
+		// errors are logged by Release()
+		snap.Release(context.WithoutCancel(ctx)) //nolint:errcheck
+	}
+
+	return newRoot, cleanup, nil
+}
@@ -0,0 +1,115 @@
+package upload
+
+import (
+	"context"
+	"path"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+// resumeFrontier holds directories that have been fully uploaded by an interrupted snapshot,
+// keyed by their path relative to the snapshot root. The frontier is persisted as part of the
+// directory tree of checkpoint and canceled snapshots, where completed directories are stored
+// with complete summaries while directories that were still in progress are marked as incomplete.
+type resumeFrontier map[string]*snapshot.DirEntry
+
+// latestIncompleteManifest returns the most recent incomplete manifest or nil if none.
+func latestIncompleteManifest(manifests []*snapshot.Manifest) *snapshot.Manifest {
+	var result *snapshot.Manifest
+
+	for _, m := range manifests {
+		if m.IncompleteReason == "" || m.RootEntry == nil || m.RootEntry.Type != snapshot.EntryTypeDirectory {
+			continue
+		}
+
+		if result == nil || m.StartTime.After(result.StartTime) {
+			result = m
+		}
+	}
+
+	return result
+}
+
+// isResumableDirEntry returns true if the provided directory has been completely uploaded without fatal errors.
+func isResumableDirEntry(de *snapshot.DirEntry) bool {
+	if de.Type != snapshot.EntryTypeDirectory || de.DirSummary == nil {
+		return false
+	}
+
+	return de.DirSummary.IncompleteReason == "" && de.DirSummary.FatalErrorCount == 0
+}
+
+// loadResumeFrontier walks incomplete directories of the provided manifest and returns all completed
+// directories found along the way.
+func loadResumeFrontier(ctx context.Context, rep repo.Repository, man *snapshot.Manifest) (resumeFrontier, error) {
+	result := resumeFrontier{}
+
+	if err := addResumeFrontier(ctx, rep, man.RootEntry, ".", result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func addResumeFrontier(ctx context.Context, rep repo.Repository, de *snapshot.DirEntry, relPath string, result resumeFrontier) error {
+	dir, ok := snapshotfs.EntryFromDirEntry(rep, de).(fs.Directory)
+	if !ok {
+		return nil
+	}
+
+	//nolint:wrapcheck
+	return fs.IterateEntries(ctx, dir, func(ctx context.Context, e fs.Entry) error {
+		hde, ok := e.(snapshot.HasDirEntry)
+		if !ok {
+			return nil
+		}
+
+		child := hde.DirEntry()
+		if child.Type != snapshot.EntryTypeDirectory {
+			return nil
+		}
+
+		childPath := path.Join(relPath, child.Name)
+
+		if isResumableDirEntry(child) {
+			result[childPath] = child
+			return nil
+		}
+
+		return errors.Wrapf(addResumeFrontier(ctx, rep, child, childPath, result), "error reading %v", childPath)
+	})
+}
+
+// maybeResumeDirectory returns the directory entry of the directory completed in an interrupted snapshot or nil.
+func (u *Uploader) maybeResumeDirectory(entryRelativePath string, dir fs.Directory) *snapshot.DirEntry {
+	de := u.resumeFrontier[entryRelativePath]
+	if de == nil || de.Name != dir.Name() {
+		return nil
+	}
+
+	atomic.AddInt32(&u.stats.ResumedDirectoryCount, int32(de.DirSummary.TotalDirCount)) //nolint:gosec
+
+	return u.reuseCompletedDirectory(entryRelativePath, de)
+}
+
+// reuseCompletedDirectory updates statistics for the completed directory reused from a previous snapshot
+// and returns a copy of its entry.
+func (u *Uploader) reuseCompletedDirectory(entryRelativePath string, de *snapshot.DirEntry) *snapshot.DirEntry {
+	ds := de.DirSummary
+
+	atomic.AddInt32(&u.stats.TotalDirectoryCount, int32(ds.TotalDirCount)) //nolint:gosec
+	atomic.AddInt32(&u.stats.CachedFiles, int32(ds.TotalFileCount))        //nolint:gosec
+	atomic.AddInt64(&u.stats.TotalFileSize, ds.TotalFileSize)
+
+	u.Progress.CachedFile(entryRelativePath, ds.TotalFileSize)
+
+	clone := *de
+
+	return &clone
+}
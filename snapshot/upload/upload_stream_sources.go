@@ -0,0 +1,177 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/fs/virtualfs"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+const streamSourceModeOptional = "optional"
+
+// errStreamSourceFailed is returned when an essential stream source command fails.
+// Such failures are never ignored, regardless of the error handling policy.
+var errStreamSourceFailed = errors.New("stream source command failed")
+
+// streamSourceReader is an io.ReadCloser that lazily starts the stream source command
+// on first read and returns its standard output.
+type streamSourceReader struct {
+	ctx        context.Context //nolint:containedctx
+	actionType string
+	src        policy.StreamSourceCommand
+	inputs     []string
+	workDir    string
+
+	mu sync.Mutex
+	// +checklocks:mu
+	cmd *exec.Cmd
+	// +checklocks:mu
+	cancel context.CancelFunc
+	// +checklocks:mu
+	stdout io.ReadCloser
+	// +checklocks:mu
+	done bool
+}
+
+// +checklocks:r.mu
+func (r *streamSourceReader) startLocked() error {
+	cmd, cancel, err := prepareCommandForAction(r.ctx, r.actionType, &r.src.ActionCommand, r.workDir)
+	if err != nil {
+		return errors.Wrap(err, "error preparing command")
+	}
+
+	cmd.Env = append(os.Environ(), r.inputs...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+
+		return errors.Wrap(err, "error getting standard output")
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+
+		return errors.Wrap(err, "error starting command")
+	}
+
+	r.cmd = cmd
+	r.cancel = cancel
+	r.stdout = stdout
+
+	return nil
+}
+
+// +checklocks:r.mu
+func (r *streamSourceReader) waitLocked() error {
+	r.done = true
+
+	defer r.cancel()
+
+	if err := r.cmd.Wait(); err != nil {
+		if r.src.Mode == streamSourceModeOptional {
+			uploadLog(r.ctx).Errorf("error running optional stream source command for %v: %v", r.src.FileName, err)
+			return nil
+		}
+
+		return errors.Wrapf(errStreamSourceFailed, "stream source command for %v failed: %v", r.src.FileName, err)
+	}
+
+	return nil
+}
+
+func (r *streamSourceReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return 0, io.EOF
+	}
+
+	if r.cmd == nil {
+		if err := r.startLocked(); err != nil {
+			r.done = true
+
+			if r.src.Mode == streamSourceModeOptional {
+				return 0, err
+			}
+
+			return 0, errors.Wrapf(errStreamSourceFailed, "unable to start stream source command for %v: %v", r.src.FileName, err)
+		}
+	}
+
+	n, err := r.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		if werr := r.waitLocked(); werr != nil {
+			return n, werr
+		}
+	}
+
+	//nolint:wrapcheck
+	return n, err
+}
+
+func (r *streamSourceReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cmd == nil || r.done {
+		return nil
+	}
+
+	// the reader was abandoned before reaching the end of the output, kill the command.
+	r.cancel()
+	r.done = true
+
+	r.cmd.Wait() //nolint:errcheck
+
+	return nil
+}
+
+// streamSourceEntries returns virtual files whose contents are the standard output of the provided
+// stream source commands. Commands are started only when their files are being uploaded.
+func (u *Uploader) streamSourceEntries(ctx context.Context, sources []policy.StreamSourceCommand, dirPathOrEmpty string, hc *actionContext) ([]fs.Entry, error) {
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	if err := hc.ensureInitialized(ctx, "stream-source", dirPathOrEmpty, u.EnableActions); err != nil {
+		return nil, errors.Wrap(err, "error initializing action context")
+	}
+
+	if !hc.ActionsEnabled {
+		return nil, nil
+	}
+
+	// policies are validated when saved, but may have been written by older versions or directly to the repository.
+	if err := policy.ValidateStreamSources(sources); err != nil {
+		return nil, errors.Wrap(err, "invalid stream sources")
+	}
+
+	var result []fs.Entry
+
+	for i, src := range sources {
+		actionType := fmt.Sprintf("stream-source-%v", i)
+
+		uploadLog(ctx).Debugf("adding stream source %v on %v %#v", src.FileName, hc.SourcePath, src)
+
+		result = append(result, virtualfs.StreamingFileFromReader(src.FileName, &streamSourceReader{
+			ctx:        ctx,
+			actionType: actionType,
+			src:        src,
+			inputs:     append(hc.envars("stream-source"), "KOPIA_STREAM_FILE_NAME="+src.FileName),
+			workDir:    hc.WorkDir,
+		}))
+	}
+
+	return result, nil
+}
@@ -910,6 +910,87 @@ func TestUploadWithCheckpointing(t *testing.T) {
 	}
 }
 
+func TestUploadResumeSkipsCompletedDirectories(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+
+	t.Cleanup(th.cleanup)
+
+	u := NewUploader(th.repo)
+	u.ParallelUploads = 1
+	u.disableEstimation = true
+
+	fakeTicker := make(chan time.Time)
+	u.getTicker = func(d time.Duration) <-chan time.Time {
+		return fakeTicker
+	}
+	u.checkpointFinished = make(chan struct{})
+
+	policyTree := policy.BuildTree(nil, policy.DefaultPolicy)
+
+	si := snapshot.SourceInfo{
+		UserName: "user",
+		Host:     "host",
+		Path:     "path",
+	}
+
+	// checkpoint and cancel when d2 is reached, at which point d1 has been completed.
+	th.sourceDir.Subdir("d2").OnReaddir(func() {
+		fakeTicker <- clock.Now()
+		<-u.checkpointFinished
+		u.Cancel()
+	})
+
+	_, err := u.Upload(ctx, th.sourceDir, policyTree, si)
+	require.NoError(t, err)
+
+	checkpoints, err := snapshot.ListSnapshots(ctx, th.repo, si)
+	require.NoError(t, err)
+	require.Len(t, checkpoints, 1)
+
+	checkpointRoot := snapshotfs.EntryFromDirEntry(th.repo, checkpoints[0].RootEntry).(fs.Directory)
+	checkpointD1, err := checkpointRoot.Child(ctx, "d1")
+	require.NoError(t, err)
+
+	// change contents of the completed directory, which will not be noticed when resuming.
+	th.sourceDir.Subdir("d1").Subdir("d1").AddFile("f3", []byte{1, 2, 3, 4, 5, 6}, defaultPermissions)
+	th.sourceDir.Subdir("d2").OnReaddir(func() {})
+
+	u = NewUploader(th.repo)
+	u.disableEstimation = true
+	u.Resume = true
+
+	man, err := u.Upload(ctx, th.sourceDir, policyTree, si, checkpoints...)
+	require.NoError(t, err)
+	require.Empty(t, man.IncompleteReason)
+	require.Equal(t, int32(3), man.Stats.ResumedDirectoryCount)
+
+	root := snapshotfs.EntryFromDirEntry(th.repo, man.RootEntry).(fs.Directory)
+
+	d1, err := root.Child(ctx, "d1")
+	require.NoError(t, err)
+	require.Equal(t, checkpointD1.(object.HasObjectID).ObjectID(), d1.(object.HasObjectID).ObjectID())
+
+	_, err = root.Child(ctx, "d2")
+	require.NoError(t, err)
+
+	// without resume, the change is picked up.
+	u = NewUploader(th.repo)
+	u.disableEstimation = true
+
+	man, err = u.Upload(ctx, th.sourceDir, policyTree, si, checkpoints...)
+	require.NoError(t, err)
+	require.Zero(t, man.Stats.ResumedDirectoryCount)
+
+	root = snapshotfs.EntryFromDirEntry(th.repo, man.RootEntry).(fs.Directory)
+
+	d1, err = root.Child(ctx, "d1")
+	require.NoError(t, err)
+	require.NotEqual(t, checkpointD1.(object.HasObjectID).ObjectID(), d1.(object.HasObjectID).ObjectID())
+}
+
 func TestParallelUploadUploadsBlobsInParallel(t *testing.T) {
 	t.Parallel()
 
@@ -1819,3 +1900,52 @@ func verifyLogDetails(t *testing.T, desc string, wantDetailKeys []string, keysAn
 	sort.Strings(wantDetailKeys)
 	require.Equal(t, wantDetailKeys, gotDetailKeys, "invalid details for "+desc)
 }
+
+type fakeChangeJournal map[string]bool
+
+func (j fakeChangeJournal) IsUnchanged(relPath string) bool {
+	return !j[relPath]
+}
+
+func TestUploadChangeJournalReusesUnchangedDirectories(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+	th := newUploadTestHarness(ctx, t)
+
+	t.Cleanup(th.cleanup)
+
+	policyTree := policy.BuildTree(nil, policy.DefaultPolicy)
+
+	u := NewUploader(th.repo)
+	u.disableEstimation = true
+
+	man1, err := u.Upload(ctx, th.sourceDir, policyTree, snapshot.SourceInfo{})
+	require.NoError(t, err)
+
+	root1 := snapshotfs.EntryFromDirEntry(th.repo, man1.RootEntry).(fs.Directory)
+
+	// change contents of both directories, only the one reported by the journal will be scanned.
+	th.sourceDir.Subdir("d1").Subdir("d1").AddFile("f3", []byte{1, 2, 3, 4, 5, 6}, defaultPermissions)
+	th.sourceDir.Subdir("d2").Subdir("d1").AddFile("f3", []byte{1, 2, 3, 4, 5, 6}, defaultPermissions)
+
+	u = NewUploader(th.repo)
+	u.disableEstimation = true
+	u.ChangeJournal = fakeChangeJournal{"d2": true, "d2/d1": true}
+
+	man2, err := u.Upload(ctx, th.sourceDir, policyTree, snapshot.SourceInfo{}, man1)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), man2.Stats.UnchangedDirectoryCount)
+
+	root2 := snapshotfs.EntryFromDirEntry(th.repo, man2.RootEntry).(fs.Directory)
+
+	for name, wantSame := range map[string]bool{"d1": true, "d2": false} {
+		before, err := root1.Child(ctx, name)
+		require.NoError(t, err)
+
+		after, err := root2.Child(ctx, name)
+		require.NoError(t, err)
+
+		require.Equal(t, wantSame, before.(object.HasObjectID).ObjectID() == after.(object.HasObjectID).ObjectID(), name)
+	}
+}
@@ -5,6 +5,7 @@
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -967,3 +968,117 @@ func TestRestoreByPathWithoutTarget(t *testing.T) {
 	// Defaults to latest snapshot time
 	e.RunAndExpectSuccess(t, "restore", srcdir)
 }
+
+func TestRestoreWithFilters(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	source := testutil.TempDirectory(t)
+
+	for _, f := range []string{"projects/a/doc.pdf", "projects/a/notes.txt", "projects/b/skip/other.pdf", "top.pdf"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(source, f)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(source, f), []byte(f), 0o600))
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", source)
+
+	restoreDir := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "snapshot", "restore", source, restoreDir, "--include=/projects/**/*.pdf", "--exclude=skip/")
+
+	require.FileExists(t, filepath.Join(restoreDir, "projects", "a", "doc.pdf"))
+	require.NoFileExists(t, filepath.Join(restoreDir, "projects", "a", "notes.txt"))
+	require.NoFileExists(t, filepath.Join(restoreDir, "top.pdf"))
+	require.NoDirExists(t, filepath.Join(restoreDir, "projects", "b"))
+
+	zipFile := filepath.Join(testutil.TempDirectory(t), "out.zip")
+	e.RunAndExpectSuccess(t, "snapshot", "restore", source, zipFile, "--include=*.pdf", "--modified-since=2000-01-01", "--min-size=8")
+
+	zr, err := zip.OpenReader(zipFile)
+	require.NoError(t, err)
+
+	defer zr.Close()
+
+	var names []string
+
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			names = append(names, f.Name)
+		}
+	}
+
+	require.ElementsMatch(t, []string{"projects/a/doc.pdf", "projects/b/skip/other.pdf"}, names)
+
+	e.RunAndExpectFailure(t, "snapshot", "restore", source, restoreDir, "--modified-before=yesterday-ish")
+}
+
+func TestRestoreWithVerifyReport(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	source := testutil.TempDirectory(t)
+
+	for _, f := range []string{"a/file1.txt", "file2.txt"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(source, f)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(source, f), []byte(f), 0o600))
+	}
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", source)
+
+	restoreDir := testutil.TempDirectory(t)
+	reportFile := filepath.Join(testutil.TempDirectory(t), "report.json")
+
+	e.RunAndExpectSuccess(t, "snapshot", "restore", source, restoreDir, "--verify-report", reportFile)
+
+	b, err := os.ReadFile(reportFile)
+	require.NoError(t, err)
+
+	var report restore.VerifyReport
+
+	require.NoError(t, json.Unmarshal(b, &report))
+	require.Equal(t, 2, report.Verified)
+	require.Zero(t, report.Mismatches)
+	require.NotEmpty(t, report.Signature)
+
+	// verification is only supported for local filesystem restores.
+	e.RunAndExpectFailure(t, "snapshot", "restore", source, filepath.Join(restoreDir, "out.zip"), "--verify")
+}
+
+func TestRestoreOCIImage(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	source := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(source, "file1.txt"), []byte("hello"), 0o600))
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", source)
+
+	imageDir := filepath.Join(testutil.TempDirectory(t), "image")
+	e.RunAndExpectSuccess(t, "snapshot", "restore", source, imageDir, "--mode=oci", "--oci-ref=v1")
+
+	require.FileExists(t, filepath.Join(imageDir, "oci-layout"))
+
+	b, err := os.ReadFile(filepath.Join(imageDir, "index.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"org.opencontainers.image.ref.name":"v1"`)
+
+	// existing image is not overwritten.
+	e.RunAndExpectFailure(t, "snapshot", "restore", source, imageDir, "--mode=oci")
+}
@@ -348,6 +348,54 @@ func TestSnapshotActionsEnable(t *testing.T) {
 	}
 }
 
+func TestSnapshotActionsStreamSources(t *testing.T) {
+	t.Parallel()
+
+	th := skipUnlessTestAction(t)
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--enable-actions")
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	dump1 := tmpfileWithContents(t, "first dump contents")
+	dump2 := tmpfileWithContents(t, "second dump contents")
+
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1,
+		"--add-stream-source", "db1.sql="+th+" --stdout-file="+dump1,
+		"--add-stream-source", "db2.sql="+th+" --stdout-file="+dump2)
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	snaps := clitestutil.ListSnapshotsAndExpectSuccess(t, e, sharedTestDataDir1)[0].Snapshots
+	require.Len(t, snaps, 1)
+
+	require.Equal(t, []string{"first dump contents"}, e.RunAndExpectSuccess(t, "show", snaps[0].ObjectID+"/db1.sql"))
+	require.Equal(t, []string{"second dump contents"}, e.RunAndExpectSuccess(t, "show", snaps[0].ObjectID+"/db2.sql"))
+
+	// failing essential stream source fails the snapshot.
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1,
+		"--add-stream-source", "db2.sql="+th+" --exit-code=3 --stdout-file="+dump2)
+	e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1)
+
+	// ... even when file errors are ignored.
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1, "--ignore-file-errors=true")
+	e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1)
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1, "--ignore-file-errors=inherit")
+
+	// optional stream source failures are ignored.
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1,
+		"--add-stream-source", "db2.sql="+th+" --exit-code=3 --stdout-file="+dump2,
+		"--action-command-mode=optional")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	e.RunAndExpectSuccess(t, "policy", "set", sharedTestDataDir1, "--clear-stream-sources")
+	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir1)
+
+	snaps = clitestutil.ListSnapshotsAndExpectSuccess(t, e, sharedTestDataDir1)[0].Snapshots
+	e.RunAndExpectFailure(t, "show", snaps[len(snaps)-1].ObjectID+"/db1.sql")
+}
+
 func tmpfileWithContents(t *testing.T, contents string) string {
 	t.Helper()
 
@@ -800,3 +800,102 @@ func TestSnapshotCreateWithAllAndPath(t *testing.T) {
 	e.RunAndExpectSuccess(t, "snapshot", "create", sharedTestDataDir2)
 	e.RunAndExpectFailure(t, "snapshot", "create", sharedTestDataDir1, "--all")
 }
+
+func TestSnapshotCreateFilesFrom(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	baseDir := testutil.TempDirectory(t)
+
+	require.NoError(t, createFileStructure(baseDir, []testFileEntry{
+		{Name: "a/b/file1", Content: []string{"file1"}},
+		{Name: "a/b/file2", Content: []string{"file2"}},
+		{Name: "a/c/file3", Content: []string{"file3"}},
+		{Name: "d/file4", Content: []string{"file4"}},
+		{Name: "file5", Content: []string{"file5"}},
+	}))
+
+	listFile := filepath.Join(testutil.TempDirectory(t), "list.txt")
+	require.NoError(t, os.WriteFile(listFile, []byte("a/b/file1\n"+filepath.Join(baseDir, "a", "c")+"\n\nfile5\n"), 0o600))
+
+	e.RunAndExpectSuccess(t, "policy", "set", baseDir, "--snapshot-interval", "1h")
+	e.RunAndExpectSuccess(t, "snapshot", "create", baseDir, "--files-from", listFile)
+
+	// NUL-separated list from stdin, the source remains the same.
+	runner.SetNextStdin(strings.NewReader("d/file4\x00file5\x00"))
+	e.RunAndExpectSuccess(t, "snapshot", "create", baseDir, "--files-from", "-")
+
+	si := clitestutil.ListSnapshotsAndExpectSuccess(t, e, baseDir)
+	require.Len(t, si, 1)
+	require.Len(t, si[0].Snapshots, 2)
+
+	restoreDir := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "snapshot", "restore", si[0].Snapshots[0].SnapshotID, restoreDir)
+
+	var got []string
+
+	require.NoError(t, filepath.Walk(restoreDir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(restoreDir, p)
+			got = append(got, filepath.ToSlash(rel))
+		}
+
+		return err
+	}))
+
+	require.ElementsMatch(t, []string{"a/b/file1", "a/c/file3", "file5"}, got)
+
+	// snapshots of some of the files don't change how the directory is scheduled.
+	var plist []policy.TargetWithPolicy
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "policy", "list", "--json"), &plist)
+
+	var found bool
+
+	for _, p := range plist {
+		if p.Target.Path == baseDir {
+			found = true
+
+			require.False(t, p.SchedulingPolicy.Manual)
+			require.Equal(t, time.Hour, p.SchedulingPolicy.Interval())
+		}
+	}
+
+	require.True(t, found)
+
+	e.RunAndExpectFailure(t, "snapshot", "create", baseDir, "--files-from", listFile, "--stdin-file", "x")
+}
+
+func TestSnapshotCreateMetricsFile(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-hostname=metrics-host", "--override-username=metrics-user")
+
+	baseDir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "file1"), []byte("hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "file2"), []byte("world"), 0o600))
+
+	metricsFile := filepath.Join(testutil.TempDirectory(t), "kopia.prom")
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", baseDir, "--metrics-file", metricsFile)
+
+	b, err := os.ReadFile(metricsFile)
+	require.NoError(t, err)
+
+	labels := `{hostname="metrics-host",path="` + baseDir + `",repository="",username="metrics-user"}`
+
+	require.Contains(t, string(b), "kopia_snapshot_last_run_success"+labels+" 1\n")
+	require.Contains(t, string(b), "kopia_snapshot_last_files"+labels+" 2\n")
+	require.Contains(t, string(b), "kopia_snapshot_last_errors"+labels+" 0\n")
+	require.Contains(t, string(b), "kopia_snapshot_last_success_timestamp_seconds"+labels)
+	require.Contains(t, string(b), "kopia_snapshot_last_uploaded_bytes"+labels)
+}
@@ -0,0 +1,112 @@
+package endtoend_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/clitestutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotImportArchive(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	archiveFile := filepath.Join(testutil.TempDirectory(t), "archive.tar.gz")
+	writeTarGzipOfDirectory(t, sharedTestDataDir1, archiveFile)
+
+	e.RunAndExpectSuccess(t, "snapshot", "import-archive", archiveFile,
+		"--source", "olduser@oldhost:/data/archived",
+		"--time", "2012-03-04 05:06:07 UTC",
+		"--description", "imported")
+
+	sources := clitestutil.ListSnapshotsAndExpectSuccess(t, e, "--all")
+	require.Len(t, sources, 1)
+	require.Len(t, sources[0].Snapshots, 1)
+
+	wantTime, err := time.Parse("2006-01-02 15:04:05 MST", "2012-03-04 05:06:07 UTC")
+	require.NoError(t, err)
+	require.True(t, sources[0].Snapshots[0].Time.Equal(wantTime), "unexpected snapshot time %v", sources[0].Snapshots[0].Time)
+
+	restoreDir := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "restore", sources[0].Snapshots[0].SnapshotID, restoreDir)
+
+	compareDirs(t, sharedTestDataDir1, restoreDir)
+
+	// re-importing the same archive must not upload any new contents.
+	e.RunAndExpectSuccess(t, "snapshot", "import-archive", archiveFile, "--source", "olduser@oldhost:/data/archived")
+
+	sources = clitestutil.ListSnapshotsAndExpectSuccess(t, e, "--all")
+	require.Len(t, sources[0].Snapshots, 2)
+	require.Equal(t, sources[0].Snapshots[0].ObjectID, sources[0].Snapshots[1].ObjectID)
+
+	e.RunAndExpectFailure(t, "snapshot", "import-archive", archiveFile, "--source", "olduser@oldhost:/data/archived", "--time", "2012-03-04")
+	e.RunAndExpectFailure(t, "snapshot", "import-archive", archiveFile)
+}
+
+func writeTarGzipOfDirectory(t *testing.T, dir, fname string) {
+	t.Helper()
+
+	f, err := os.Create(fname)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	require.NoError(t, filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+
+		return err
+	}))
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+}